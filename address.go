@@ -0,0 +1,175 @@
+package bscript
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrAddressUnsupportedScript = errors.New("address: unsupported script")
+	ErrAddressUnknowFormat      = errors.New("address: unknow format")
+	ErrAddressWrongNetwork      = errors.New("address: wrong network")
+)
+
+// AddressParams are the address prefixes of a network. An empty Bech32HRP
+// disables segwit addresses and a non empty CashAddrPrefix makes CashAddr
+// the encoding of P2PKH and P2SH scripts.
+type AddressParams struct {
+	Name              string
+	PubkeyHashVersion byte
+	ScriptHashVersion byte
+	Bech32HRP         string
+	CashAddrPrefix    string
+}
+
+var (
+	AddressParamsBitcoinMainnet = &AddressParams{
+		Name:              "bitcoin",
+		PubkeyHashVersion: 0x00,
+		ScriptHashVersion: 0x05,
+		Bech32HRP:         "bc",
+	}
+
+	// AddressParamsBitcoinTestnet are the params of testnet and signet.
+	AddressParamsBitcoinTestnet = &AddressParams{
+		Name:              "testnet",
+		PubkeyHashVersion: 0x6f,
+		ScriptHashVersion: 0xc4,
+		Bech32HRP:         "tb",
+	}
+
+	AddressParamsBitcoinRegtest = &AddressParams{
+		Name:              "regtest",
+		PubkeyHashVersion: 0x6f,
+		ScriptHashVersion: 0xc4,
+		Bech32HRP:         "bcrt",
+	}
+
+	AddressParamsBitcoinCash = &AddressParams{
+		Name:              "bch",
+		PubkeyHashVersion: 0x00,
+		ScriptHashVersion: 0x05,
+		CashAddrPrefix:    "bitcoincash",
+	}
+
+	AddressParamsBitcoinCashTestnet = &AddressParams{
+		Name:              "bchtest",
+		PubkeyHashVersion: 0x6f,
+		ScriptHashVersion: 0xc4,
+		CashAddrPrefix:    "bchtest",
+	}
+
+	AddressParamsBitcoinSV = &AddressParams{
+		Name:              "bsv",
+		PubkeyHashVersion: 0x00,
+		ScriptHashVersion: 0x05,
+	}
+
+	AddressParamsLitecoin = &AddressParams{
+		Name:              "litecoin",
+		PubkeyHashVersion: 0x30,
+		ScriptHashVersion: 0x32,
+		Bech32HRP:         "ltc",
+	}
+)
+
+// NewAddressFromScript encodes the address of scriptPubkey on the network of
+// params. Only P2PKH, P2SH, BCH P2SH32 and witness programs have one.
+func NewAddressFromScript(script *Script, params *AddressParams) (string, error) {
+	typ, solutions := script.Solve()
+
+	switch typ {
+	case ScriptTypePubkeyHash:
+		if params.CashAddrPrefix != "" {
+			return EncodeCashAddr(params.CashAddrPrefix, CashAddrPubkeyHash, solutions[0])
+		}
+		return EncodeBase58Check(params.PubkeyHashVersion, solutions[0]), nil
+
+	case ScriptTypeScriptHash:
+		if params.CashAddrPrefix != "" {
+			return EncodeCashAddr(params.CashAddrPrefix, CashAddrScriptHash, solutions[0])
+		}
+		return EncodeBase58Check(params.ScriptHashVersion, solutions[0]), nil
+
+	case ScriptTypeWitnessV0KeyHash, ScriptTypeWitnessV0ScriptHash, ScriptTypeWitnessV1Taproot, ScriptTypeWitnessUnknown, ScriptTypeAnchor:
+		if params.Bech32HRP == "" {
+			return "", ErrAddressUnsupportedScript
+		}
+
+		version, program, _ := script.ParseWitnessProgram()
+		return EncodeSegwitAddress(params.Bech32HRP, version, program)
+	}
+
+	if params.CashAddrPrefix != "" && isPayToScriptHash32(script) {
+		return EncodeCashAddr(params.CashAddrPrefix, CashAddrScriptHash, script.Data[2:34])
+	}
+
+	return "", ErrAddressUnsupportedScript
+}
+
+// NewScriptFromAddress decodes the scriptPubkey address pays to on the
+// network of params.
+func NewScriptFromAddress(address string, params *AddressParams) (*Script, error) {
+	if params.CashAddrPrefix != "" {
+		if typ, hash, err := DecodeCashAddr(params.CashAddrPrefix, address); err == nil {
+			return newCashAddrScript(typ, hash)
+		} else if err == ErrCashAddrBadPrefix {
+			return nil, ErrAddressWrongNetwork
+		}
+	}
+
+	if params.Bech32HRP != "" && strings.HasPrefix(strings.ToLower(address), params.Bech32HRP+"1") {
+		version, program, err := DecodeSegwitAddress(params.Bech32HRP, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewScript().PushInt64(int64(version)).PushBytesWithOP(program), nil
+	}
+
+	version, hash, err := DecodeBase58Check(address)
+	if err != nil {
+		if _, _, _, berr := DecodeBech32(address); berr == nil {
+			return nil, ErrAddressWrongNetwork
+		}
+		if err == ErrBase58BadCharacter {
+			return nil, ErrAddressUnknowFormat
+		}
+		return nil, err
+	}
+
+	if len(hash) != 20 {
+		return nil, ErrAddressUnknowFormat
+	}
+
+	switch version {
+	case params.PubkeyHashVersion:
+		return NewPayToPubkeyHashScript(hash)
+	case params.ScriptHashVersion:
+		return NewPayToScriptHashScript(hash)
+	}
+
+	return nil, ErrAddressWrongNetwork
+}
+
+func newCashAddrScript(typ CashAddrType, hash []byte) (*Script, error) {
+	switch {
+	case (typ == CashAddrPubkeyHash || typ == CashAddrTokenPubkeyHash) && len(hash) == 20:
+		return NewPayToPubkeyHashScript(hash)
+	case (typ == CashAddrScriptHash || typ == CashAddrTokenScriptHash) && len(hash) == 20:
+		return NewPayToScriptHashScript(hash)
+	case (typ == CashAddrScriptHash || typ == CashAddrTokenScriptHash) && len(hash) == 32:
+		return NewScript().PushOPCode(OP_HASH256).PushBytesWithOP(hash).PushOPCode(OP_EQUAL), nil
+	}
+
+	return nil, ErrAddressUnsupportedScript
+}
+
+// isPayToScriptHash32 matches the BCH P2SH32 template,
+// OP_HASH256 <32 bytes> OP_EQUAL.
+func isPayToScriptHash32(s *Script) bool {
+	return len(s.Data) == 35 &&
+		s.Data[0] == byte(OP_HASH256) &&
+		s.Data[1] == byte(OP_PUSHBYTES_32) &&
+		s.Data[34] == byte(OP_EQUAL)
+}
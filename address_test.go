@@ -0,0 +1,112 @@
+package bscript
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		script  string
+		params  *AddressParams
+		address string
+	}{
+		{"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", AddressParamsBitcoinMainnet, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"},
+		{"76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac", AddressParamsBitcoinMainnet, "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu"},
+		{"76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac", AddressParamsBitcoinCash, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"},
+		{"0014751e76e8199196d454941c45d1b3a323f1433bd6", AddressParamsBitcoinMainnet, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", AddressParamsBitcoinTestnet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7"},
+		{"512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", AddressParamsBitcoinMainnet, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+	}
+
+	for i, test := range tests {
+		script, _ := NewScriptFromHexString(test.script)
+
+		address, err := NewAddressFromScript(script, test.params)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		} else if address != test.address {
+			t.Errorf("#%d: expect %s got %s", i, test.address, address)
+		}
+
+		decoded, err := NewScriptFromAddress(test.address, test.params)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		} else if !bytes.Equal(decoded.Bytes(), script.Bytes()) {
+			t.Errorf("#%d: expect %s got %s", i, test.script, decoded)
+		}
+	}
+
+	// P2SH32 and addresses without the CashAddr prefix
+	script := NewScript().PushOPCode(OP_HASH256).PushBytesWithOP(bytes.Repeat([]byte{0x11}, 32)).PushOPCode(OP_EQUAL)
+	address, err := NewAddressFromScript(script, AddressParamsBitcoinCash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := NewScriptFromAddress(address[len("bitcoincash:"):], AddressParamsBitcoinCash)
+	if err != nil || !bytes.Equal(decoded.Bytes(), script.Bytes()) {
+		t.Errorf("expect P2SH32 round trip, got %v %v", decoded, err)
+	}
+}
+
+func TestAddressInvalid(t *testing.T) {
+	tests := []struct {
+		address string
+		params  *AddressParams
+		expect  error
+	}{
+		{"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMJ", AddressParamsBitcoinMainnet, ErrBase58BadChecksum},
+		{"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", AddressParamsBitcoinTestnet, ErrAddressWrongNetwork},
+		{"0BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", AddressParamsBitcoinMainnet, ErrAddressUnknowFormat},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", AddressParamsBitcoinMainnet, ErrBech32BadChecksum},
+		{"bc1qw508d6qejxtdg4y5r3zarvarY0c5xw7kv8f3t4", AddressParamsBitcoinMainnet, ErrBech32MixedCase},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", AddressParamsBitcoinMainnet, ErrAddressWrongNetwork},
+		{"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b", AddressParamsBitcoinCash, ErrAddressUnknowFormat},
+		{"bchtest:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", AddressParamsBitcoinCash, ErrAddressWrongNetwork},
+	}
+
+	for i, test := range tests {
+		if _, err := NewScriptFromAddress(test.address, test.params); err != test.expect {
+			t.Errorf("#%d %s: expect %v got %v", i, test.address, test.expect, err)
+		}
+	}
+
+	// a version 0 program with a bech32m checksum
+	data, _ := convertBits(bytes.Repeat([]byte{0x75}, 20), 8, 5, true)
+	address := EncodeBech32("bc", append([]byte{0}, data...), Bech32m)
+	if _, _, err := DecodeSegwitAddress("bc", address); err != ErrBech32WrongEncoding {
+		t.Errorf("expect wrong encoding error, got %v", err)
+	}
+
+	// a pubkey script has no address
+	pubkey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	if _, err := NewAddressFromScript(NewScript().PushBytesWithOP(pubkey).PushOPCode(OP_CHECKSIG), AddressParamsBitcoinMainnet); err != ErrAddressUnsupportedScript {
+		t.Errorf("expect unsupported script error, got %v", err)
+	}
+}
+
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		data   string
+		expect string
+	}{
+		{"", ""},
+		{"61", "2g"},
+		{"626262", "a3gV"},
+		{"00000000000000000000", "1111111111"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+	}
+
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.data)
+		if s := EncodeBase58(data); s != test.expect {
+			t.Errorf("expect %s got %s", test.expect, s)
+		}
+
+		decoded, err := DecodeBase58(test.expect)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%s: expect %x got %x %v", test.expect, data, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package bscript
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrAssemblerUnknowDialect = errors.New("assembler: unknow dialect")
+	ErrAssemblerBadToken      = errors.New("assembler: bad token")
+)
+
+// Dialect selects the script syntax understood by NewScriptFromStringWithDialect.
+type Dialect int
+
+const (
+	// DialectBScript is the syntax of this package: OP_ prefixed names,
+	// 0x hex strings and decimal numbers. Numbers and hex strings are pushed
+	// with OP_PUSHDATA unless they follow an explicit push opcode, but for
+	// a single byte of an undefined opcode such as 0xbc, which is that
+	// opcode.
+	DialectBScript Dialect = iota
+	// DialectCoreTest is the syntax of Bitcoin Core's script_tests.json:
+	// names with or without OP_, minimal pushes for decimal numbers,
+	// 0x bytes spliced verbatim and 'quoted' string pushes.
+	DialectCoreTest
+	// DialectCoreAsm is the asm output of Bitcoin Core's decodescript:
+	// pushes of up to 4 bytes as decimal numbers, longer pushes as bare hex
+	// with an optional sighash suffix such as [ALL] and OP_ prefixed names.
+	DialectCoreAsm
+	// DialectBtcdAsm is the output of btcd's txscript.DisasmString: small
+	// integers as decimal numbers, every data push as bare hex and OP_
+	// prefixed names.
+	DialectBtcdAsm
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectBScript:
+		return "bscript"
+	case DialectCoreTest:
+		return "core-test"
+	case DialectCoreAsm:
+		return "core-asm"
+	case DialectBtcdAsm:
+		return "btcd-asm"
+	}
+
+	return "unknow"
+}
+
+// NewDialectFromString is the inverse of Dialect.String.
+func NewDialectFromString(s string) (Dialect, error) {
+	for _, d := range []Dialect{DialectBScript, DialectCoreTest, DialectCoreAsm, DialectBtcdAsm} {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+
+	return 0, ErrAssemblerUnknowDialect
+}
+
+// NewScriptFromStringWithDialect assembles src written in the given dialect.
+func NewScriptFromStringWithDialect(src string, dialect Dialect) (*Script, error) {
+	switch dialect {
+	case DialectBScript:
+		return assembleBScript(src)
+	case DialectCoreTest:
+		return assembleCoreTest(src)
+	case DialectCoreAsm:
+		return assembleCoreAsm(src)
+	case DialectBtcdAsm:
+		return assembleBtcdAsm(src)
+	}
+
+	return nil, ErrAssemblerUnknowDialect
+}
+
+func assembleBScript(src string) (*Script, error) {
+	lexer := NewLexer(src)
+	script := NewScript()
+
+	needPushSize := true
+
+	for {
+		tok, err := lexer.Scan()
+		if err != nil {
+			if err == ErrLexerReachEOF {
+				break
+			}
+			return nil, err
+		}
+
+		switch tok.kind {
+		case TOKEN_CODE:
+			opcode, ok := tok.value.(OPCode)
+			if !ok {
+				return nil, ErrScriptBadTypeCast
+			}
+			script.PushOPCode(opcode)
+
+			if OP_PUSHBYTES_1 <= opcode && opcode <= OP_PUSHDATA4 {
+				needPushSize = false
+			} else {
+				needPushSize = true
+			}
+		case TOKEN_NUMBER:
+			value, ok := tok.value.(int64)
+			if !ok {
+				return nil, ErrScriptBadTypeCast
+			}
+
+			var n Number
+			var size int
+			if value != 0 {
+				n = Number(value)
+				size = len(n.Bytes())
+			} else {
+				n = Number(0)
+				size = 1
+			}
+
+			if needPushSize {
+				switch {
+				case size <= math.MaxInt8:
+					script.PushOPCode(OP_PUSHDATA1)
+					script.PushBytes([]byte{byte(size)})
+				case size <= math.MaxInt16:
+					script.PushOPCode(OP_PUSHDATA2)
+					buf := make([]byte, 2)
+					binary.LittleEndian.PutUint16(buf, uint16(size))
+					script.PushBytes(buf)
+				case size <= math.MaxInt32:
+					script.PushOPCode(OP_PUSHDATA4)
+					buf := make([]byte, 4)
+					binary.LittleEndian.PutUint32(buf, uint32(size))
+					script.PushBytes(buf)
+				default:
+					return nil, ErrScriptPushSizeOverflow
+				}
+			}
+
+			if value != 0 {
+				script.PushNumber(n)
+			} else {
+				script.PushBytes([]byte{0})
+			}
+		case TOKEN_HEXSTRING:
+			value, ok := tok.value.([]byte)
+			if !ok {
+				return nil, ErrScriptBadTypeCast
+			}
+
+			if needPushSize && len(value) == 1 && OPCode(value[0]).IsUndefined() {
+				script.PushOPCode(OPCode(value[0]))
+				continue
+			}
+
+			size := len(value)
+
+			if needPushSize {
+				switch {
+				case size <= math.MaxInt8:
+					script.PushOPCode(OP_PUSHDATA1)
+					script.PushBytes([]byte{byte(size)})
+				case size <= math.MaxInt16:
+					script.PushOPCode(OP_PUSHDATA2)
+					buf := make([]byte, 2)
+					binary.LittleEndian.PutUint16(buf, uint16(size))
+					script.PushBytes(buf)
+				case size <= math.MaxInt32:
+					script.PushOPCode(OP_PUSHDATA4)
+					buf := make([]byte, 4)
+					binary.LittleEndian.PutUint32(buf, uint32(size))
+					script.PushBytes(buf)
+				default:
+					return nil, ErrScriptPushSizeOverflow
+				}
+			}
+
+			script.PushBytes(value)
+		}
+	}
+
+	return script, nil
+}
+
+func assembleCoreTest(src string) (*Script, error) {
+	script := NewScript()
+
+	for _, word := range strings.Fields(src) {
+		switch {
+		case isDecimalWord(word):
+			n, err := strconv.ParseInt(word, 10, 64)
+			if err != nil {
+				return nil, badToken(word)
+			}
+			script.PushInt64(n)
+		case strings.HasPrefix(word, "0x") && len(word) > 2:
+			b, err := hex.DecodeString(word[2:])
+			if err != nil {
+				return nil, badToken(word)
+			}
+			script.PushBytes(b)
+		case len(word) >= 2 && word[0] == '\'' && word[len(word)-1] == '\'':
+			script.PushBytesWithOP([]byte(word[1 : len(word)-1]))
+		default:
+			opcode, err := opcodeFromName(word, true)
+			if err != nil {
+				return nil, err
+			}
+			script.PushOPCode(opcode)
+		}
+	}
+
+	return script, nil
+}
+
+func assembleCoreAsm(src string) (*Script, error) {
+	script := NewScript()
+
+	for _, word := range strings.Fields(src) {
+		// decodescript prints pushes of up to 4 bytes as numbers, which
+		// never have a leading zero and fit in 10 digits plus a sign, so
+		// any other decimal word can only be hex.
+		n, err := strconv.ParseInt(word, 10, 32)
+		isNumber := err == nil && isDecimalWord(word) && !isCoreAsmHexWord(word)
+
+		switch {
+		case strings.HasPrefix(word, "OP_"):
+			opcode, err := opcodeFromName(word, false)
+			if err != nil {
+				return nil, err
+			}
+			script.PushOPCode(opcode)
+		case isNumber:
+			script.PushInt64(n)
+		default:
+			data, err := decodeAsmHex(word, true)
+			if err != nil {
+				return nil, err
+			}
+			script.PushBytesWithOP(data)
+		}
+	}
+
+	return script, nil
+}
+
+func assembleBtcdAsm(src string) (*Script, error) {
+	script := NewScript()
+
+	for _, word := range strings.Fields(src) {
+		switch {
+		case strings.HasPrefix(word, "OP_"):
+			opcode, err := opcodeFromName(word, false)
+			if err != nil {
+				return nil, err
+			}
+			script.PushOPCode(opcode)
+		case word == "0":
+			script.PushOPCode(OP_0)
+		case word == "-1":
+			script.PushOPCode(OP_1NEGATE)
+		case isSmallIntWord(word):
+			n, _ := strconv.Atoi(word)
+			script.PushOPCode(OPCode(int(OP_1) + n - 1))
+		default:
+			data, err := decodeAsmHex(word, false)
+			if err != nil {
+				return nil, err
+			}
+			script.PushBytesWithOP(data)
+		}
+	}
+
+	return script, nil
+}
+
+// decodeAsmHex decodes a bare hex push, optionally followed by a decodescript
+// sighash suffix such as [ALL|FORKID] which becomes the trailing byte.
+func decodeAsmHex(word string, sighashSuffix bool) ([]byte, error) {
+	suffix := ""
+	if i := strings.IndexByte(word, '['); sighashSuffix && i >= 0 && strings.HasSuffix(word, "]") {
+		word, suffix = word[:i], word[i+1:len(word)-1]
+	}
+
+	data, err := hex.DecodeString(word)
+	if err != nil {
+		return nil, badToken(word)
+	}
+
+	if len(suffix) > 0 {
+		sighash, ok := NewSigHashFromString(suffix)
+		if !ok {
+			return nil, badToken(suffix)
+		}
+		data = append(data, byte(sighash))
+	}
+
+	return data, nil
+}
+
+// opcodeFromName resolves an opcode name, accepting names without the OP_
+// prefix when bare is set.
+func opcodeFromName(word string, bare bool) (OPCode, error) {
+	opcode, err := NewOPCodeFromString(word)
+	if err == nil {
+		return opcode, nil
+	}
+
+	if bare && !strings.HasPrefix(word, "OP_") {
+		if opcode, err := NewOPCodeFromString("OP_" + word); err == nil {
+			return opcode, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s: %s", ErrLexerUnknowOPCode, word)
+}
+
+func badToken(word string) error {
+	return fmt.Errorf("%s: %s", ErrAssemblerBadToken, word)
+}
+
+func isDecimalWord(word string) bool {
+	if len(word) > 1 && word[0] == '-' {
+		word = word[1:]
+	}
+
+	if len(word) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(word); i++ {
+		if word[i] < '0' || word[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isCoreAsmHexWord reports whether the digit only word must be a hex push in
+// decodescript output.
+func isCoreAsmHexWord(word string) bool {
+	if len(word) > 1 && word[0] == '0' {
+		return true
+	}
+
+	return len(word) > 11 && len(word)%2 == 0
+}
+
+func isSmallIntWord(word string) bool {
+	n, err := strconv.Atoi(word)
+	return err == nil && isDecimalWord(word) && word[0] != '0' && n >= 1 && n <= 16
+}
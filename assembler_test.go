@@ -0,0 +1,118 @@
+package bscript
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssembleCoreTest(t *testing.T) {
+	tests := []struct {
+		src    string
+		expect []byte
+	}{
+		{"", []byte{}},
+		{"0 1 16 -1", []byte{0x00, 0x51, 0x60, 0x4f}},
+		{"17 -2 1000", []byte{0x01, 0x11, 0x01, 0x82, 0x02, 0xe8, 0x03}},
+		{"DUP OP_HASH160", []byte{0x76, 0xa9}},
+		{"NOP2 NOP3", []byte{0xb1, 0xb2}},
+		{"0x4c 0x01 0x07", []byte{0x4c, 0x01, 0x07}},
+		{"'Az'", []byte{0x02, 'A', 'z'}},
+	}
+
+	for _, test := range tests {
+		script, err := assembleCoreTest(test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(script.Bytes(), test.expect) {
+			t.Errorf("%s: expect %x got %x", test.src, test.expect, script.Bytes())
+		}
+	}
+
+	for _, src := range []string{"NOSUCHOPCODE", "0xzz"} {
+		if _, err := assembleCoreTest(src); err == nil {
+			t.Errorf("%s: expect error", src)
+		}
+	}
+}
+
+func TestScriptFromStringWithDialect(t *testing.T) {
+	sig := "3044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb"
+	pkh := "89abcdefabbaabbaabbaabbaabbaabbaabbaabba"
+
+	tests := []struct {
+		dialect Dialect
+		src     string
+		expect  string
+	}{
+		{DialectBScript, "1 2 OP_ADD", "4c01014c010293"},
+		{DialectBScript, "OP_PUSHBYTES_2 0x0102", "020102"},
+
+		{DialectCoreTest, "0 1 16 -1", "0051604f"},
+
+		{DialectCoreAsm, "OP_DUP OP_HASH160 " + pkh + " OP_EQUALVERIFY OP_CHECKSIG", "76a914" + pkh + "88ac"},
+		{DialectCoreAsm, "0 1 -1 17 1000", "00514f0111" + "02e803"},
+		{DialectCoreAsm, sig + "[ALL]", "47" + sig + "01"},
+		{DialectCoreAsm, sig + "[ALL|FORKID|ANYONECANPAY]", "47" + sig + "c1"},
+		{DialectCoreAsm, "9999999999", "059999999999"},
+		{DialectCoreAsm, "0011223344", "050011223344"},
+		{DialectCoreAsm, "00", "0100"},
+		{DialectCoreAsm, "100000000000", "06100000000000"},
+		{DialectCoreAsm, "1000000000 OP_CHECKLOCKTIMEVERIFY", "0400ca9a3bb1"},
+
+		{DialectBtcdAsm, "0 16 -1 05 OP_CHECKSIG", "00604f0105ac"},
+		{DialectBtcdAsm, "OP_DUP OP_HASH160 " + pkh + " OP_EQUALVERIFY OP_CHECKSIG", "76a914" + pkh + "88ac"},
+	}
+
+	for _, test := range tests {
+		script, err := NewScriptFromStringWithDialect(test.src, test.dialect)
+		if err != nil {
+			t.Fatalf("%s %q: %s", test.dialect, test.src, err)
+		}
+
+		if script.Hex() != test.expect {
+			t.Errorf("%s %q: expect %s got %s", test.dialect, test.src, test.expect, script.Hex())
+		}
+	}
+}
+
+func TestScriptFromStringWithDialectErrors(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		src     string
+	}{
+		{DialectCoreTest, "NOSUCHOPCODE"},
+		{DialectCoreAsm, "DUP"},
+		{DialectCoreAsm, "3044[BOGUS]"},
+		{DialectBtcdAsm, "abc"},
+		{Dialect(100), "OP_DUP"},
+	}
+
+	for _, test := range tests {
+		if _, err := NewScriptFromStringWithDialect(test.src, test.dialect); err == nil {
+			t.Errorf("%s %q: expect error", test.dialect, test.src)
+		}
+	}
+}
+
+func TestPushBytesWithOP(t *testing.T) {
+	tests := []struct {
+		size   int
+		prefix []byte
+	}{
+		{0, []byte{0x00}},
+		{75, []byte{0x4b}},
+		{76, []byte{0x4c, 76}},
+		{255, []byte{0x4c, 0xff}},
+		{256, []byte{0x4d, 0x00, 0x01}},
+		{520, []byte{0x4d, 0x08, 0x02}},
+	}
+
+	for _, test := range tests {
+		b := NewScript().PushBytesWithOP(make([]byte, test.size)).Bytes()
+		if !bytes.Equal(b[:len(test.prefix)], test.prefix) || len(b) != len(test.prefix)+test.size {
+			t.Errorf("%d: expect prefix %x got %x", test.size, test.prefix, b[:len(test.prefix)])
+		}
+	}
+}
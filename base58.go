@@ -0,0 +1,118 @@
+package bscript
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrBase58BadCharacter = errors.New("base58: bad character")
+	ErrBase58BadChecksum  = errors.New("base58: bad checksum")
+	ErrBase58TooShort     = errors.New("base58: too short")
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var base58Index = func() [256]int {
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		index[base58Alphabet[i]] = i
+	}
+	return index
+}()
+
+// EncodeBase58 encodes b, each leading zero byte as a leading '1'.
+func EncodeBase58(b []byte) string {
+	zeros := 0
+	for zeros < len(b) && b[zeros] == 0 {
+		zeros++
+	}
+
+	// log(256) / log(58), rounded up
+	digits := make([]byte, 0, len(b)*138/100+1)
+	for _, c := range b[zeros:] {
+		carry := int(c)
+		for i := range digits {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+
+	s := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		s[i] = '1'
+	}
+	for i, d := range digits {
+		s[len(s)-1-i] = base58Alphabet[d]
+	}
+
+	return string(s)
+}
+
+func DecodeBase58(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := zeros; i < len(s); i++ {
+		carry := base58Index[s[i]]
+		if carry < 0 {
+			return nil, ErrBase58BadCharacter
+		}
+
+		for j := range b {
+			carry += int(b[j]) * 58
+			b[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			b = append(b, byte(carry))
+			carry >>= 8
+		}
+	}
+
+	rv := make([]byte, zeros+len(b))
+	for i, c := range b {
+		rv[len(rv)-1-i] = c
+	}
+
+	return rv, nil
+}
+
+// EncodeBase58Check encodes the version byte and payload followed by the
+// first four bytes of their double SHA256.
+func EncodeBase58Check(version byte, payload []byte) string {
+	b := append([]byte{version}, payload...)
+	checksum := DHash256(b)
+	return EncodeBase58(append(b, checksum[:4]...))
+}
+
+func DecodeBase58Check(s string) (byte, []byte, error) {
+	b, err := DecodeBase58(s)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(b) < 5 {
+		return 0, nil, ErrBase58TooShort
+	}
+
+	checksum := DHash256(b[:len(b)-4])
+	if !bytes.Equal(checksum[:4], b[len(b)-4:]) {
+		return 0, nil, ErrBase58BadChecksum
+	}
+
+	return b[0], b[1 : len(b)-4], nil
+}
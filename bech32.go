@@ -0,0 +1,233 @@
+package bscript
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrBech32BadCharacter  = errors.New("bech32: bad character")
+	ErrBech32BadChecksum   = errors.New("bech32: bad checksum")
+	ErrBech32BadLength     = errors.New("bech32: bad length")
+	ErrBech32MixedCase     = errors.New("bech32: mixed case")
+	ErrBech32BadPadding    = errors.New("bech32: bad padding")
+	ErrBech32BadHRP        = errors.New("bech32: bad human readable part")
+	ErrBech32BadVersion    = errors.New("bech32: bad witness version")
+	ErrBech32BadProgram    = errors.New("bech32: bad witness program")
+	ErrBech32WrongEncoding = errors.New("bech32: wrong encoding for witness version")
+)
+
+// Bech32Encoding is the checksum constant of BIP173 bech32 or BIP350 bech32m.
+type Bech32Encoding uint32
+
+const (
+	Bech32  Bech32Encoding = 1
+	Bech32m Bech32Encoding = 0x2bc830a3
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Index = func() [256]int {
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i := 0; i < len(bech32Charset); i++ {
+		index[bech32Charset[i]] = i
+	}
+	return index
+}()
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	rv := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		rv = append(rv, hrp[i]>>5)
+	}
+	rv = append(rv, 0)
+	for i := 0; i < len(hrp); i++ {
+		rv = append(rv, hrp[i]&31)
+	}
+
+	return rv
+}
+
+// EncodeBech32 encodes hrp and the 5 bit groups of data with encoding's
+// checksum.
+func EncodeBech32(hrp string, data []byte, encoding Bech32Encoding) string {
+	hrp = strings.ToLower(hrp)
+
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ uint32(encoding)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+
+	return sb.String()
+}
+
+// DecodeBech32 decodes s into its lower case hrp, the 5 bit groups of its
+// data and the encoding its checksum matches.
+func DecodeBech32(s string) (string, []byte, Bech32Encoding, error) {
+	if len(s) > 90 {
+		return "", nil, 0, ErrBech32BadLength
+	}
+
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, 0, ErrBech32MixedCase
+	}
+	s = lower
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, ErrBech32BadLength
+	}
+
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, ErrBech32BadHRP
+		}
+	}
+
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		d := bech32Index[s[i]]
+		if d < 0 {
+			return "", nil, 0, ErrBech32BadCharacter
+		}
+		data = append(data, byte(d))
+	}
+
+	encoding := Bech32Encoding(bech32Polymod(append(bech32HRPExpand(hrp), data...)))
+	if encoding != Bech32 && encoding != Bech32m {
+		return "", nil, 0, ErrBech32BadChecksum
+	}
+
+	return hrp, data[:len(data)-6], encoding, nil
+}
+
+// convertBits regroups data from groups of from bits to groups of to bits,
+// padding the last group with zeros if pad is set.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<to - 1
+
+	rv := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, d := range data {
+		if uint32(d)>>from != 0 {
+			return nil, ErrBech32BadCharacter
+		}
+
+		acc = acc<<from | uint32(d)
+		bits += from
+		for bits >= to {
+			bits -= to
+			rv = append(rv, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			rv = append(rv, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, ErrBech32BadPadding
+	}
+
+	return rv, nil
+}
+
+// EncodeSegwitAddress encodes a witness program as a BIP173 address for
+// version 0 and a BIP350 one otherwise.
+func EncodeSegwitAddress(hrp string, version uint8, program []byte) (string, error) {
+	if err := checkWitnessProgram(version, program); err != nil {
+		return "", err
+	}
+
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	encoding := Bech32m
+	if version == 0 {
+		encoding = Bech32
+	}
+
+	return EncodeBech32(hrp, append([]byte{version}, data...), encoding), nil
+}
+
+// DecodeSegwitAddress decodes the witness version and program of a segwit
+// address, whose hrp has to be hrp.
+func DecodeSegwitAddress(hrp, address string) (uint8, []byte, error) {
+	got, data, encoding, err := DecodeBech32(address)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if got != strings.ToLower(hrp) {
+		return 0, nil, ErrBech32BadHRP
+	}
+
+	if len(data) < 1 {
+		return 0, nil, ErrBech32BadLength
+	}
+
+	version := data[0]
+	if (version == 0) != (encoding == Bech32) {
+		return 0, nil, ErrBech32WrongEncoding
+	}
+
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := checkWitnessProgram(version, program); err != nil {
+		return 0, nil, err
+	}
+
+	return version, program, nil
+}
+
+func checkWitnessProgram(version uint8, program []byte) error {
+	if version > 16 {
+		return ErrBech32BadVersion
+	}
+
+	if len(program) < 2 || len(program) > 40 {
+		return ErrBech32BadProgram
+	}
+
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return ErrBech32BadProgram
+	}
+
+	return nil
+}
@@ -3,19 +3,18 @@ package bscript
 type Boolean bool
 
 func NewBoolean(d []byte) Boolean {
-	rv := false
 	for i := range d {
 		if d[i] != 0 {
 			// Negative 0 is also considered false.
 			if i == len(d)-1 && d[i] == 0x80 {
-				rv = false
+				return false
 			}
 
-			rv = true
+			return true
 		}
 	}
 
-	return Boolean(rv)
+	return false
 }
 
 // Byte vectors are interpreted as Booleans
@@ -25,5 +24,5 @@ func (b Boolean) Bytes() []byte {
 		return []byte{1}
 	}
 
-	return []byte{0}
+	return []byte{}
 }
@@ -0,0 +1,160 @@
+package bscript
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrInterpreterInstructionBudget = errors.New("interpreter: instruction budget exhausted")
+	ErrInterpreterHashBudget        = errors.New("interpreter: hash budget exhausted")
+	ErrInterpreterStackMemoryBudget = errors.New("interpreter: stack memory budget exhausted")
+)
+
+// ExecutionBudget bounds the work spent evaluating untrusted scripts, on top
+// of the consensus limits. It is shared by every script a VerifyScript call
+// evaluates, and a zero field is unlimited.
+type ExecutionBudget struct {
+	// Instructions is the number of instructions stepped through, those of
+	// unexecuted branches included.
+	Instructions uint64
+	// HashedBytes is the number of bytes fed to the hash opcodes, and to
+	// the signature hashes of checkers which are HashCounters.
+	HashedBytes uint64
+	// StackMemory is the size of the elements of the main and alt stacks
+	// together, checked after every instruction.
+	StackMemory uint64
+}
+
+// executionMeter enforces the context and budget of an evaluation. A nil
+// meter enforces nothing.
+type executionMeter struct {
+	ctx          context.Context
+	done         <-chan struct{}
+	budget       ExecutionBudget
+	instructions uint64
+	hashedBytes  uint64
+}
+
+func newExecutionMeter(ctx context.Context, budget *ExecutionBudget) *executionMeter {
+	m := &executionMeter{
+		ctx:  ctx,
+		done: ctx.Done(),
+	}
+
+	if budget != nil {
+		m.budget = *budget
+	}
+
+	return m
+}
+
+func (m *executionMeter) step() error {
+	if m == nil {
+		return nil
+	}
+
+	select {
+	case <-m.done:
+		return m.ctx.Err()
+	default:
+	}
+
+	m.instructions++
+	if m.budget.Instructions > 0 && m.instructions > m.budget.Instructions {
+		return ErrInterpreterInstructionBudget
+	}
+
+	return nil
+}
+
+func (m *executionMeter) hash(n int) error {
+	if m == nil {
+		return nil
+	}
+
+	m.hashedBytes += uint64(n)
+	if m.budget.HashedBytes > 0 && m.hashedBytes > m.budget.HashedBytes {
+		return ErrInterpreterHashBudget
+	}
+
+	return nil
+}
+
+// HashCounter is implemented by checkers which count the bytes of the
+// signature hash preimages they hash, as TransactionSigner does.
+type HashCounter interface {
+	HashedBytes() uint64
+}
+
+func hashedBytesOf(checker Checker) uint64 {
+	if counter, ok := checker.(HashCounter); ok {
+		return counter.HashedBytes()
+	}
+
+	return 0
+}
+
+// hashChecker charges the preimage bytes checker hashed since it had hashed
+// before bytes.
+func (m *executionMeter) hashChecker(checker Checker, before uint64) error {
+	if m == nil {
+		return nil
+	}
+
+	return m.hash(int(hashedBytesOf(checker) - before))
+}
+
+// stackMemory is the size of the elements of stacks.
+func stackMemory(stacks ...*Stack) uint64 {
+	var size uint64
+	for _, stack := range stacks {
+		stack.Iter(func(e StackElemnt) {
+			size += uint64(len(e.Bytes()))
+		})
+	}
+
+	return size
+}
+
+func (m *executionMeter) checkStack(stacks ...*Stack) error {
+	if m == nil || m.budget.StackMemory == 0 {
+		return nil
+	}
+
+	return m.checkMemory(stackMemory(stacks...))
+}
+
+func (m *executionMeter) checkMemory(size uint64) error {
+	if m == nil || m.budget.StackMemory == 0 {
+		return nil
+	}
+
+	if size > m.budget.StackMemory {
+		return ErrInterpreterStackMemoryBudget
+	}
+
+	return nil
+}
+
+// SetContext makes the following Eval calls abort with ctx.Err() once ctx is
+// done, and with a budget error once budget, which may be nil, is exhausted.
+// The budget is shared by those calls.
+func (i *Interpreter) SetContext(ctx context.Context, budget *ExecutionBudget) {
+	i.meter = newExecutionMeter(ctx, budget)
+}
+
+// EvalScriptWithContext is EvalScript under ctx and budget.
+func EvalScriptWithContext(ctx context.Context, script *Script, flag Flag, checker Checker, budget *ExecutionBudget) error {
+	interpreter := NewInterpreter()
+	interpreter.SetContext(ctx, budget)
+	return interpreter.Eval(script, flag, checker, SignatureVersionBase)
+}
+
+// VerifyScriptWithContext is VerifyScript under ctx and budget, which covers
+// the scriptSig, scriptPubkey, redeem script and witness script together.
+func VerifyScriptWithContext(ctx context.Context, scriptSig, scriptPubkey *Script, scriptWitness ScriptWitness, flag Flag, checker Checker, sigversion SignatureVersion, budget *ExecutionBudget) error {
+	interpreter := NewInterpreter()
+	interpreter.SetContext(ctx, budget)
+	return interpreter.Verify(scriptSig, scriptPubkey, scriptWitness, flag, checker, sigversion)
+}
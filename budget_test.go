@@ -0,0 +1,117 @@
+package bscript
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEvalScriptWithContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		code   string
+		ctx    context.Context
+		budget *ExecutionBudget
+		expect error
+	}{
+		{"no budget", strings.Repeat("OP_1 OP_DROP ", 50), context.Background(), nil, nil},
+		{"instructions", strings.Repeat("OP_1 OP_DROP ", 50), context.Background(), &ExecutionBudget{Instructions: 99}, ErrInterpreterInstructionBudget},
+		{"instructions fit", strings.Repeat("OP_1 OP_DROP ", 50), context.Background(), &ExecutionBudget{Instructions: 100}, nil},
+		{"skipped branch", "OP_0 OP_IF OP_1 OP_1 OP_1 OP_ENDIF", context.Background(), &ExecutionBudget{Instructions: 5}, ErrInterpreterInstructionBudget},
+		{"hashed bytes", "OP_PUSHBYTES_4 0x01020304 OP_SHA256 OP_HASH256", context.Background(), &ExecutionBudget{HashedBytes: 35}, ErrInterpreterHashBudget},
+		{"hashed bytes fit", "OP_PUSHBYTES_4 0x01020304 OP_SHA256 OP_HASH256", context.Background(), &ExecutionBudget{HashedBytes: 36}, nil},
+		{"stack memory", "OP_PUSHBYTES_4 0x01020304 OP_DUP OP_TOALTSTACK OP_DUP", context.Background(), &ExecutionBudget{StackMemory: 11}, ErrInterpreterStackMemoryBudget},
+		{"stack memory fit", "OP_PUSHBYTES_4 0x01020304 OP_DUP OP_TOALTSTACK OP_DUP", context.Background(), &ExecutionBudget{StackMemory: 12}, nil},
+		{"canceled", "OP_1", canceled, nil, context.Canceled},
+	}
+
+	for _, test := range tests {
+		script, err := NewScriptFromString(test.code)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		err = EvalScriptWithContext(test.ctx, script, 0, NewNoopChecker(), test.budget)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+func TestVerifyScriptWithContext(t *testing.T) {
+	scriptSig := NewScript().PushBytesWithOP([]byte{1, 2, 3, 4})
+	scriptPubkey := NewScript().PushOPCode(OP_SHA256).PushOPCode(OP_DROP).PushOPCode(OP_1)
+
+	verify := func(budget *ExecutionBudget) error {
+		return VerifyScriptWithContext(
+			context.Background(),
+			NewScriptFromBytes(scriptSig.Bytes()),
+			NewScriptFromBytes(scriptPubkey.Bytes()),
+			NewScriptWitness([][]byte{}),
+			0,
+			NewNoopChecker(),
+			SignatureVersionBase,
+			budget,
+		)
+	}
+
+	// the budget covers the scriptSig and the scriptPubkey together
+	if err := verify(&ExecutionBudget{Instructions: 4}); err != nil {
+		t.Errorf("expect success got %v", err)
+	}
+	if err := verify(&ExecutionBudget{Instructions: 3}); err != ErrInterpreterInstructionBudget {
+		t.Errorf("expect %v got %v", ErrInterpreterInstructionBudget, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	err := VerifyScriptWithContext(ctx, NewScriptFromBytes(scriptSig.Bytes()), NewScriptFromBytes(scriptPubkey.Bytes()), NewScriptWitness([][]byte{}), 0, NewNoopChecker(), SignatureVersionBase, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expect %v got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestVerifyScriptWithContextSignatureHash(t *testing.T) {
+	// a signature which does not verify still has its preimage hashed
+	scriptSig := NewScript().PushBytesWithOP([]byte{byte(SigHashAll)})
+	scriptPubkey := NewScript().PushBytesWithOP(make([]byte, 33)).PushOPCode(OP_CHECKSIG).PushOPCode(OP_NOT)
+
+	creditTx := NewCreditingTransaction(scriptPubkey, 0)
+	spendTx := NewSpendingTransaction(scriptSig, creditTx)
+
+	verify := func(budget *ExecutionBudget) (*TransactionSigner, error) {
+		signer := NewTransactionSigner(spendTx, 0, 0)
+		err := VerifyScriptWithContext(
+			context.Background(),
+			NewScriptFromBytes(scriptSig.Bytes()),
+			NewScriptFromBytes(scriptPubkey.Bytes()),
+			NewScriptWitness([][]byte{}),
+			0,
+			NewCachingChecker(signer, NewSignatureCache(0), false),
+			SignatureVersionBase,
+			budget,
+		)
+		return signer, err
+	}
+
+	signer, err := verify(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := signer.HashedBytes()
+	if n == 0 {
+		t.Fatal("expect the preimage to be counted")
+	}
+
+	if _, err := verify(&ExecutionBudget{HashedBytes: n}); err != nil {
+		t.Errorf("expect success got %v", err)
+	}
+	if _, err := verify(&ExecutionBudget{HashedBytes: n - 1}); err != ErrInterpreterHashBudget {
+		t.Errorf("expect %v got %v", ErrInterpreterHashBudget, err)
+	}
+}
@@ -0,0 +1,163 @@
+package bscript
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+var (
+	ErrBuilderBadPubkey         = errors.New("builder: bad public key")
+	ErrBuilderBadHashSize       = errors.New("builder: bad hash size")
+	ErrBuilderBadMultisig       = errors.New("builder: bad multisig threshold")
+	ErrBuilderUncompressed      = errors.New("builder: sorted multisig takes compressed public keys only")
+	ErrBuilderNullDataSize      = errors.New("builder: nulldata over size policy")
+	ErrBuilderBadLockTime       = errors.New("builder: bad locktime")
+	ErrBuilderBadSequence       = errors.New("builder: sequence has the disable flag")
+	ErrBuilderEmptyLockedScript = errors.New("builder: empty locked script")
+)
+
+// MaxNullDataScriptSize is Bitcoin Core's default -datacarriersize, the size
+// of a standard nulldata script, OP_RETURN included.
+const MaxNullDataScriptSize = 83
+
+// NewPayToPubkeyScript builds <pubkey> OP_CHECKSIG.
+func NewPayToPubkeyScript(pubkey []byte) (*Script, error) {
+	if _, ok := secp256k1ParsePubkey(pubkey); !ok {
+		return nil, ErrBuilderBadPubkey
+	}
+
+	return NewScript().PushBytesWithOP(pubkey).PushOPCode(OP_CHECKSIG), nil
+}
+
+// NewPayToPubkeyHashScript builds
+// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG.
+func NewPayToPubkeyHashScript(hash []byte) (*Script, error) {
+	if len(hash) != 20 {
+		return nil, ErrBuilderBadHashSize
+	}
+
+	return NewScript().PushOPCode(OP_DUP).PushOPCode(OP_HASH160).
+		PushBytesWithOP(hash).
+		PushOPCode(OP_EQUALVERIFY).PushOPCode(OP_CHECKSIG), nil
+}
+
+// NewPayToScriptHashScript builds OP_HASH160 <hash> OP_EQUAL.
+func NewPayToScriptHashScript(hash []byte) (*Script, error) {
+	if len(hash) != 20 {
+		return nil, ErrBuilderBadHashSize
+	}
+
+	return NewScript().PushOPCode(OP_HASH160).PushBytesWithOP(hash).PushOPCode(OP_EQUAL), nil
+}
+
+// NewPayToWitnessPubkeyHashScript builds OP_0 <hash>.
+func NewPayToWitnessPubkeyHashScript(hash []byte) (*Script, error) {
+	if len(hash) != 20 {
+		return nil, ErrBuilderBadHashSize
+	}
+
+	return NewScript().PushOPCode(OP_0).PushBytesWithOP(hash), nil
+}
+
+// NewPayToWitnessScriptHashScript builds OP_0 <hash>, hash being the SHA256
+// of the witness script.
+func NewPayToWitnessScriptHashScript(hash []byte) (*Script, error) {
+	if len(hash) != 32 {
+		return nil, ErrBuilderBadHashSize
+	}
+
+	return NewScript().PushOPCode(OP_0).PushBytesWithOP(hash), nil
+}
+
+// NewPayToTaprootScript builds OP_1 <key>, key being the x-only output key.
+func NewPayToTaprootScript(key []byte) (*Script, error) {
+	if _, ok := secp256k1LiftX(key); !ok {
+		return nil, ErrBuilderBadPubkey
+	}
+
+	return NewScript().PushOPCode(OP_1).PushBytesWithOP(key), nil
+}
+
+// NewMultisigScript builds m <pubkey>... n OP_CHECKMULTISIG with the keys in
+// the given order.
+func NewMultisigScript(m int, pubkeys [][]byte) (*Script, error) {
+	n := len(pubkeys)
+	if m < 1 || m > n || n > LimitsBitcoin.MaxPubkeysPerMultisig {
+		return nil, ErrBuilderBadMultisig
+	}
+
+	script := NewScript().PushInt64(int64(m))
+	for _, pubkey := range pubkeys {
+		if _, ok := secp256k1ParsePubkey(pubkey); !ok {
+			return nil, ErrBuilderBadPubkey
+		}
+		script.PushBytesWithOP(pubkey)
+	}
+
+	return script.PushInt64(int64(n)).PushOPCode(OP_CHECKMULTISIG), nil
+}
+
+// NewSortedMultisigScript is NewMultisigScript with the keys sorted as BIP67
+// requires, which only allows compressed keys. pubkeys is left unchanged.
+func NewSortedMultisigScript(m int, pubkeys [][]byte) (*Script, error) {
+	sorted := make([][]byte, len(pubkeys))
+	for i, pubkey := range pubkeys {
+		if len(pubkey) != 33 {
+			return nil, ErrBuilderUncompressed
+		}
+		sorted[i] = pubkey
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	return NewMultisigScript(m, sorted)
+}
+
+// NewNullDataScript builds OP_RETURN followed by a push of each data, which
+// has to fit MaxNullDataScriptSize to be standard.
+func NewNullDataScript(data ...[]byte) (*Script, error) {
+	script := NewScript().PushOPCode(OP_RETURN)
+	for _, d := range data {
+		script.PushBytesWithOP(d)
+	}
+
+	if script.Size() > MaxNullDataScriptSize {
+		return nil, ErrBuilderNullDataSize
+	}
+
+	return script, nil
+}
+
+// NewLockTimeScript guards script with an absolute locktime,
+// <locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP <script>. A locktime below
+// TransactionSignerLocktimeThreshold is a height, a time otherwise.
+func NewLockTimeScript(locktime uint32, script *Script) (*Script, error) {
+	if locktime == 0 {
+		return nil, ErrBuilderBadLockTime
+	}
+	if script == nil || script.Size() == 0 {
+		return nil, ErrBuilderEmptyLockedScript
+	}
+
+	return NewScript().PushInt64(int64(locktime)).
+		PushOPCode(OP_CHECKLOCKTIMEVERIFY).PushOPCode(OP_DROP).
+		PushBytes(script.Data), nil
+}
+
+// NewRelativeLockTimeScript guards script with a BIP68 relative locktime,
+// <sequence> OP_CHECKSEQUENCEVERIFY OP_DROP <script>.
+func NewRelativeLockTimeScript(sequence uint32, script *Script) (*Script, error) {
+	if sequence&SequenceLockTimeDisabledFlag != 0 {
+		return nil, ErrBuilderBadSequence
+	}
+	if script == nil || script.Size() == 0 {
+		return nil, ErrBuilderEmptyLockedScript
+	}
+
+	return NewScript().PushInt64(int64(sequence)).
+		PushOPCode(OP_CHECKSEQUENCEVERIFY).PushOPCode(OP_DROP).
+		PushBytes(script.Data), nil
+}
@@ -0,0 +1,162 @@
+package bscript
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/detailyang/go-bcore"
+	bcrypto "github.com/detailyang/go-bcrypto"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func TestScriptBuilders(t *testing.T) {
+	pubkey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	pubkey2, _ := hex.DecodeString("02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5")
+	hash := Hash160(pubkey)
+	hash32 := bytes.Repeat([]byte{0x18}, 32)
+	inner, _ := NewPayToPubkeyHashScript(hash)
+
+	build := func(s *Script, err error) *Script {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		script *Script
+		expect ScriptType
+	}{
+		{build(NewPayToPubkeyScript(pubkey)), ScriptTypePubkey},
+		{build(NewPayToPubkeyHashScript(hash)), ScriptTypePubkeyHash},
+		{build(NewPayToScriptHashScript(hash)), ScriptTypeScriptHash},
+		{build(NewPayToWitnessPubkeyHashScript(hash)), ScriptTypeWitnessV0KeyHash},
+		{build(NewPayToWitnessScriptHashScript(hash32)), ScriptTypeWitnessV0ScriptHash},
+		{build(NewPayToTaprootScript(pubkey[1:])), ScriptTypeWitnessV1Taproot},
+		{build(NewMultisigScript(1, [][]byte{pubkey2, pubkey})), ScriptTypeMultisig},
+		{build(NewNullDataScript([]byte("hello"), []byte("world"))), ScriptTypeNullData},
+		{build(NewLockTimeScript(500000, inner)), ScriptTypeNonStandard},
+	}
+
+	for i, test := range tests {
+		if typ := test.script.Classify(); typ != test.expect {
+			t.Errorf("#%d: expect %s got %s", i, test.expect, typ)
+		}
+	}
+
+	sorted := build(NewSortedMultisigScript(2, [][]byte{pubkey2, pubkey}))
+	m, keys, ok := sorted.ParseMultisig()
+	if !ok || m != 2 || !bytes.Equal(keys[0], pubkey) || !bytes.Equal(keys[1], pubkey2) {
+		t.Errorf("expect BIP67 key order, got %s", sorted)
+	}
+
+	locked := build(NewRelativeLockTimeScript(144, inner))
+	if expect := "029000b275" + inner.Hex(); locked.Hex() != expect {
+		t.Errorf("expect %s got %s", expect, locked.Hex())
+	}
+}
+
+func TestScriptBuildersInvalid(t *testing.T) {
+	pubkey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	uncompressed, _ := hex.DecodeString("0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	offcurve := append([]byte{0x02}, bytes.Repeat([]byte{0xff}, 32)...)
+	inner := NewScript().PushOPCode(OP_1)
+
+	tests := []struct {
+		err    error
+		expect error
+	}{
+		{second(NewPayToPubkeyScript(offcurve)), ErrBuilderBadPubkey},
+		{second(NewPayToPubkeyScript(pubkey[1:])), ErrBuilderBadPubkey},
+		{second(NewPayToPubkeyHashScript(pubkey)), ErrBuilderBadHashSize},
+		{second(NewPayToWitnessScriptHashScript(pubkey[:20])), ErrBuilderBadHashSize},
+		{second(NewPayToTaprootScript(offcurve[1:])), ErrBuilderBadPubkey},
+		{second(NewMultisigScript(0, [][]byte{pubkey})), ErrBuilderBadMultisig},
+		{second(NewMultisigScript(2, [][]byte{pubkey})), ErrBuilderBadMultisig},
+		{second(NewMultisigScript(1, [][]byte{offcurve})), ErrBuilderBadPubkey},
+		{second(NewSortedMultisigScript(1, [][]byte{uncompressed})), ErrBuilderUncompressed},
+		{second(NewNullDataScript(make([]byte, 81))), ErrBuilderNullDataSize},
+		{second(NewLockTimeScript(0, inner)), ErrBuilderBadLockTime},
+		{second(NewLockTimeScript(1, nil)), ErrBuilderEmptyLockedScript},
+		{second(NewRelativeLockTimeScript(SequenceLockTimeDisabledFlag, inner)), ErrBuilderBadSequence},
+	}
+
+	for i, test := range tests {
+		if test.err != test.expect {
+			t.Errorf("#%d: expect %v got %v", i, test.expect, test.err)
+		}
+	}
+
+	keys := make([][]byte, 21)
+	for i := range keys {
+		keys[i] = pubkey
+	}
+	if _, err := NewMultisigScript(1, keys); err != ErrBuilderBadMultisig {
+		t.Errorf("expect bad multisig for 21 keys, got %v", err)
+	}
+
+	if _, err := NewNullDataScript(make([]byte, 80)); err != nil {
+		t.Errorf("expect 80 bytes of data to be standard, got %v", err)
+	}
+}
+
+func TestLockTimeScriptSpend(t *testing.T) {
+	key := bcrypto.NewKey(key0bytes[:], true)
+	pubkey, _ := key.GetPubkey()
+	inner, _ := NewPayToPubkeyHashScript(Hash160(pubkey.Bytes()))
+
+	flag := ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyStrictEncoding | ScriptVerifyLowS |
+		ScriptVerifyMinimalData | ScriptVerifyNullFail | ScriptVerifyCleanStack |
+		ScriptVerifyCheckLockTimeVerify | ScriptVerifyCheckSequenceVerify
+
+	timeSequence := TransactionSequenceLockTimeTypeFlag | 10
+
+	tests := []struct {
+		name     string
+		build    func() (*Script, error)
+		locktime uint32
+		sequence uint32
+		expect   error
+	}{
+		{"height", func() (*Script, error) { return NewLockTimeScript(500000, inner) }, 500000, 0xfffffffe, nil},
+		{"height not reached", func() (*Script, error) { return NewLockTimeScript(500000, inner) }, 499999, 0xfffffffe, ErrInterpreterUnsatisfiedLocktime},
+		{"height final sequence", func() (*Script, error) { return NewLockTimeScript(500000, inner) }, 500000, bcore.TransactionFinalSequence, ErrInterpreterUnsatisfiedLocktime},
+		{"time", func() (*Script, error) { return NewLockTimeScript(1600000000, inner) }, 1600000001, 0, nil},
+		{"time against height", func() (*Script, error) { return NewLockTimeScript(1600000000, inner) }, 500000, 0, ErrInterpreterUnsatisfiedLocktime},
+		{"blocks", func() (*Script, error) { return NewRelativeLockTimeScript(144, inner) }, 0, 144, nil},
+		{"blocks not reached", func() (*Script, error) { return NewRelativeLockTimeScript(144, inner) }, 0, 143, ErrInterpreterUnsatisfiedLocktime},
+		{"blocks against time", func() (*Script, error) { return NewRelativeLockTimeScript(144, inner) }, 0, timeSequence, ErrInterpreterUnsatisfiedLocktime},
+		{"seconds", func() (*Script, error) { return NewRelativeLockTimeScript(timeSequence, inner) }, 0, timeSequence, nil},
+		{"seconds against blocks", func() (*Script, error) { return NewRelativeLockTimeScript(timeSequence, inner) }, 0, 144, ErrInterpreterUnsatisfiedLocktime},
+	}
+
+	for _, test := range tests {
+		locked, err := test.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		credit := NewCreditingTransaction(locked, 1000)
+		tx := &bcore.Transaction{Version: 2, Locktime: test.locktime}
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{PrevOutput: bcore.NewOutPoint(credit.ID(), 0), Sequence: test.sequence})
+		tx.Outputs = append(tx.Outputs, &bcore.TransactionOutput{Value: 1000, ScriptPubkey: inner.Bytes()})
+
+		ts := NewTransactionSigner(tx, 0, 1000)
+		hash, err := ts.SignatureHash(locked, SigHashAll, flag, SignatureVersionBase, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, _ := key.Signature(hash.Bytes(), 0)
+		scriptSig := NewScript().PushBytesWithOP(append(sig, byte(SigHashAll))).PushBytesWithOP(pubkey.Bytes())
+
+		err = VerifyScript(NewScriptFromBytes(scriptSig.Bytes()), NewScriptFromBytes(locked.Bytes()), nil, flag, ts, SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+func second(_ *Script, err error) error {
+	return err
+}
@@ -0,0 +1,140 @@
+package bscript
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrCashAddrBadCharacter = errors.New("cashaddr: bad character")
+	ErrCashAddrBadChecksum  = errors.New("cashaddr: bad checksum")
+	ErrCashAddrBadPrefix    = errors.New("cashaddr: bad prefix")
+	ErrCashAddrBadVersion   = errors.New("cashaddr: bad version")
+	ErrCashAddrBadHashSize  = errors.New("cashaddr: bad hash size")
+	ErrCashAddrMixedCase    = errors.New("cashaddr: mixed case")
+)
+
+// CashAddrType is the type bits of the CashAddr version byte.
+type CashAddrType uint8
+
+const (
+	CashAddrPubkeyHash CashAddrType = 0
+	CashAddrScriptHash CashAddrType = 1
+	// The CashTokens aware types pay to the same scripts.
+	CashAddrTokenPubkeyHash CashAddrType = 2
+	CashAddrTokenScriptHash CashAddrType = 3
+)
+
+// cashAddrHashSizes are the hash sizes of the size bits of the version byte.
+var cashAddrHashSizes = [8]int{20, 24, 28, 32, 40, 48, 56, 64}
+
+func cashAddrPolymod(values []byte) uint64 {
+	generator := [5]uint64{0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470}
+
+	c := uint64(1)
+	for _, d := range values {
+		c0 := c >> 35
+		c = (c&0x07ffffffff)<<5 ^ uint64(d)
+		for i := 0; i < 5; i++ {
+			if (c0>>uint(i))&1 == 1 {
+				c ^= generator[i]
+			}
+		}
+	}
+
+	return c ^ 1
+}
+
+func cashAddrPrefixExpand(prefix string) []byte {
+	rv := make([]byte, 0, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		rv = append(rv, prefix[i]&31)
+	}
+
+	return append(rv, 0)
+}
+
+// EncodeCashAddr encodes hash of type typ with prefix, as in
+// "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a".
+func EncodeCashAddr(prefix string, typ CashAddrType, hash []byte) (string, error) {
+	size := -1
+	for i, n := range cashAddrHashSizes {
+		if n == len(hash) {
+			size = i
+		}
+	}
+	if size < 0 {
+		return "", ErrCashAddrBadHashSize
+	}
+	if typ > 15 {
+		return "", ErrCashAddrBadVersion
+	}
+
+	payload, err := convertBits(append([]byte{byte(typ)<<3 | byte(size)}, hash...), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	prefix = strings.ToLower(prefix)
+	polymod := cashAddrPolymod(append(append(cashAddrPrefixExpand(prefix), payload...), 0, 0, 0, 0, 0, 0, 0, 0))
+
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	sb.WriteByte(':')
+	for _, d := range payload {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 8; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(7-i)))&31])
+	}
+
+	return sb.String(), nil
+}
+
+// DecodeCashAddr decodes the type and hash of address, whose prefix has to
+// be prefix and may be left out.
+func DecodeCashAddr(prefix, address string) (CashAddrType, []byte, error) {
+	lower := strings.ToLower(address)
+	if lower != address && strings.ToUpper(address) != address {
+		return 0, nil, ErrCashAddrMixedCase
+	}
+	address = lower
+	prefix = strings.ToLower(prefix)
+
+	if pos := strings.IndexByte(address, ':'); pos >= 0 {
+		if address[:pos] != prefix {
+			return 0, nil, ErrCashAddrBadPrefix
+		}
+		address = address[pos+1:]
+	}
+
+	data := make([]byte, 0, len(address))
+	for i := 0; i < len(address); i++ {
+		d := bech32Index[address[i]]
+		if d < 0 {
+			return 0, nil, ErrCashAddrBadCharacter
+		}
+		data = append(data, byte(d))
+	}
+
+	if len(data) <= 8 || cashAddrPolymod(append(cashAddrPrefixExpand(prefix), data...)) != 0 {
+		return 0, nil, ErrCashAddrBadChecksum
+	}
+
+	payload, err := convertBits(data[:len(data)-8], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(payload) < 1 || payload[0]&0x80 != 0 {
+		return 0, nil, ErrCashAddrBadVersion
+	}
+
+	typ := CashAddrType(payload[0] >> 3)
+	hash := payload[1:]
+	if len(hash) != cashAddrHashSizes[payload[0]&7] {
+		return 0, nil, ErrCashAddrBadHashSize
+	}
+
+	return typ, hash, nil
+}
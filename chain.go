@@ -0,0 +1,227 @@
+package bscript
+
+import (
+	"errors"
+)
+
+var (
+	ErrChainUnknow      = errors.New("chain: unknow chain")
+	ErrChainUnsupported = errors.New("chain: unsupported upgrade")
+)
+
+// ChainUpgrade is a consensus upgrade which enables Flags, and replaces the
+// limits with Limits when set, from block Height on, or once the median
+// time past reaches MedianTime. A negative Height or a zero MedianTime
+// leaves the corresponding trigger unused.
+type ChainUpgrade struct {
+	Name       string
+	Height     int
+	MedianTime int64
+	Flags      Flag
+	Limits     *Limits
+}
+
+// IsActive reports whether u applies to the block at height whose previous
+// block has median time past mtp.
+func (u *ChainUpgrade) IsActive(height int, mtp int64) bool {
+	if u.Height >= 0 && height >= u.Height {
+		return true
+	}
+
+	return u.MedianTime > 0 && mtp >= u.MedianTime
+}
+
+// Chain is the script validation profile of a network: its upgrades in
+// activation order, the limits before any of them and the flags mempool
+// policy adds on top of consensus. Exempt are the flags single blocks, by
+// height, are validated without. Unsupported is the first upgrade the
+// profile does not implement, blocks it applies to have no flags nor limits.
+type Chain struct {
+	Name        string
+	Upgrades    []*ChainUpgrade
+	Exempt      map[int]Flag
+	Unsupported *ChainUpgrade
+	BaseLimits  Limits
+	Standard    Flag
+}
+
+// Flags are the consensus flags of the block at height whose previous block
+// has median time past mtp.
+func (c *Chain) Flags(height int, mtp int64) (Flag, error) {
+	if c.Unsupported != nil && c.Unsupported.IsActive(height, mtp) {
+		return ScriptVerifyNone, ErrChainUnsupported
+	}
+
+	flag := NewFlag()
+	for _, u := range c.Upgrades {
+		if u.IsActive(height, mtp) {
+			flag.Enable(u.Flags)
+		}
+	}
+
+	return flag &^ c.Exempt[height], nil
+}
+
+// StandardFlags are the flags mempool policy validates transactions for the
+// block at height with, consensus ones included.
+func (c *Chain) StandardFlags(height int, mtp int64) (Flag, error) {
+	flag, err := c.Flags(height, mtp)
+	if err != nil {
+		return ScriptVerifyNone, err
+	}
+
+	return flag | c.Standard, nil
+}
+
+// Limits are the limits of the block at height whose previous block has
+// median time past mtp.
+func (c *Chain) Limits(height int, mtp int64) (Limits, error) {
+	if c.Unsupported != nil && c.Unsupported.IsActive(height, mtp) {
+		return Limits{}, ErrChainUnsupported
+	}
+
+	limits := c.BaseLimits
+	for _, u := range c.Upgrades {
+		if u.Limits != nil && u.IsActive(height, mtp) {
+			limits = *u.Limits
+		}
+	}
+
+	return limits, nil
+}
+
+// bitcoinStandardFlags are Bitcoin Core's STANDARD_SCRIPT_VERIFY_FLAGS.
+const bitcoinStandardFlags = ScriptVerifyP2SH | ScriptVerifyDERSignatures | ScriptVerifyStrictEncoding |
+	ScriptVerifyMinimalData | ScriptVerifyNullDummy | ScriptDiscourageUpgradableNops | ScriptVerifyCleanStack |
+	ScriptVerifyMinimalIf | ScriptVerifyNullFail | ScriptVerifyCheckLockTimeVerify | ScriptVerifyCheckSequenceVerify |
+	ScriptVerifyLowS | ScriptVerifyWitness | ScriptVerifyDiscourageUpgradeableWitnessProgram |
+	ScriptVerifyWitnessPubKeyType | ScriptVerifyTaproot | ScriptVerifyDiscourageUpgradableTaprootVersion |
+	ScriptVerifyDiscourageOPSuccess | ScriptVerifyDiscourageUpgradablePubkeyType
+
+// bitcoinUpgrades are the soft forks of Bitcoin and its forks, a negative
+// height leaves one out. segwit enables NULLDUMMY, witness and taproot the
+// witness v0 and v1 programs.
+func bitcoinUpgrades(bip16, bip66, bip65, csv, segwit, witness, taproot int) []*ChainUpgrade {
+	return []*ChainUpgrade{
+		{Name: "bip16", Height: bip16, Flags: ScriptVerifyP2SH},
+		{Name: "bip66", Height: bip66, Flags: ScriptVerifyDERSignatures},
+		{Name: "bip65", Height: bip65, Flags: ScriptVerifyCheckLockTimeVerify},
+		{Name: "csv", Height: csv, Flags: ScriptVerifyCheckSequenceVerify},
+		{Name: "segwit", Height: segwit, Flags: ScriptVerifyNullDummy},
+		{Name: "witness", Height: witness, Flags: ScriptVerifyWitness},
+		{Name: "taproot", Height: taproot, Flags: ScriptVerifyTaproot},
+	}
+}
+
+// coreUpgrades are the Bitcoin networks' soft forks as Bitcoin Core applies
+// them: P2SH, witness and taproot together from the BIP16 height, since
+// historical blocks are valid under the latter two, except the ones in
+// Chain.Exempt.
+func coreUpgrades(bip16, bip66, bip65, csv, segwit int) []*ChainUpgrade {
+	return bitcoinUpgrades(bip16, bip66, bip65, csv, segwit, bip16, bip16)
+}
+
+// forkUpgrades are the upgrades Bitcoin Cash and Bitcoin SV share, from the
+// August 2017 fork to the May 2018 opcode reactivation.
+func forkUpgrades() []*ChainUpgrade {
+	return append(bitcoinUpgrades(173805, 363725, 388381, 419328, -1, -1, -1),
+		&ChainUpgrade{Name: "uahf", Height: -1, MedianTime: 1501590000, Flags: ScriptEnableSigHashForkID | ScriptVerifyStrictEncoding},
+		&ChainUpgrade{Name: "daa", Height: -1, MedianTime: 1510600000, Flags: ScriptVerifyLowS | ScriptVerifyNullFail},
+		&ChainUpgrade{Name: "monolith", Height: -1, MedianTime: 1526400000, Flags: ScriptEnableMonolithOpcodes},
+	)
+}
+
+var (
+	// ChainBitcoinMainnet exempts block 692261, the one historical block
+	// which is invalid under taproot.
+	ChainBitcoinMainnet = &Chain{
+		Name:       "bitcoin",
+		Upgrades:   coreUpgrades(173805, 363725, 388381, 419328, 481824),
+		Exempt:     map[int]Flag{692261: ScriptVerifyTaproot},
+		BaseLimits: LimitsBitcoin,
+		Standard:   bitcoinStandardFlags,
+	}
+
+	// ChainBitcoinTestnet is testnet3.
+	ChainBitcoinTestnet = &Chain{
+		Name:       "testnet",
+		Upgrades:   coreUpgrades(514, 330776, 581885, 770112, 834624),
+		BaseLimits: LimitsBitcoin,
+		Standard:   bitcoinStandardFlags,
+	}
+
+	ChainBitcoinSignet = &Chain{
+		Name:       "signet",
+		Upgrades:   coreUpgrades(0, 1, 1, 1, 1),
+		BaseLimits: LimitsBitcoin,
+		Standard:   bitcoinStandardFlags,
+	}
+
+	ChainBitcoinRegtest = &Chain{
+		Name:       "regtest",
+		Upgrades:   coreUpgrades(0, 1, 1, 1, 0),
+		BaseLimits: LimitsBitcoin,
+		Standard:   bitcoinStandardFlags,
+	}
+
+	// ChainBitcoinCash leaves out the upgrades without script flags. It
+	// ends at magnetic anomaly: great wall also allows segwit recovery
+	// spends and later upgrades add Schnorr multisig, OP_REVERSEBYTES,
+	// 64 bit integers, introspection and CashTokens, none of which are
+	// implemented, so blocks from great wall on are unsupported.
+	ChainBitcoinCash = &Chain{
+		Name: "bch",
+		Upgrades: append(forkUpgrades(),
+			&ChainUpgrade{Name: "magnetic-anomaly", Height: -1, MedianTime: 1542300000, Flags: ScriptEnableCheckDataSig | ScriptVerifySigPushOnly | ScriptVerifyCleanStack},
+		),
+		Unsupported: &ChainUpgrade{Name: "great-wall", Height: -1, MedianTime: 1557921600},
+		BaseLimits:  LimitsBCH,
+		Standard: ScriptVerifyP2SH | ScriptVerifyDERSignatures | ScriptVerifyStrictEncoding | ScriptVerifyMinimalData |
+			ScriptVerifyNullDummy | ScriptDiscourageUpgradableNops | ScriptVerifyCleanStack | ScriptVerifyNullFail |
+			ScriptVerifyCheckLockTimeVerify | ScriptVerifyCheckSequenceVerify | ScriptVerifyLowS,
+	}
+
+	// ChainBitcoinSV lifts the limits and reenables every opcode at Genesis.
+	// Bitcoin SV only applies P2SH, CHECKLOCKTIMEVERIFY and
+	// CHECKSEQUENCEVERIFY to outputs created before Genesis, which a block
+	// flag can not express, so they stay enforced and spends of later
+	// outputs relying on NOP2 or NOP3 being a NOP fail to validate.
+	ChainBitcoinSV = &Chain{
+		Name: "bsv",
+		Upgrades: append(forkUpgrades(),
+			&ChainUpgrade{Name: "genesis", Height: 620538, Flags: ScriptSkipDisabledOPCode, Limits: &LimitsBSV},
+		),
+		BaseLimits: LimitsBitcoin,
+		Standard: ScriptVerifyP2SH | ScriptVerifyDERSignatures | ScriptVerifyStrictEncoding | ScriptVerifyMinimalData |
+			ScriptDiscourageUpgradableNops | ScriptVerifyCleanStack | ScriptVerifyNullFail | ScriptVerifyLowS,
+	}
+
+	ChainLitecoin = &Chain{
+		Name:       "litecoin",
+		Upgrades:   bitcoinUpgrades(218579, 811879, 918684, 1201536, 1201536, 1201536, 2265984),
+		BaseLimits: LimitsBitcoin,
+		Standard:   bitcoinStandardFlags,
+	}
+)
+
+// Chains are the known chains by name.
+var Chains = map[string]*Chain{}
+
+func init() {
+	for _, c := range []*Chain{
+		ChainBitcoinMainnet, ChainBitcoinTestnet, ChainBitcoinSignet, ChainBitcoinRegtest,
+		ChainBitcoinCash, ChainBitcoinSV, ChainLitecoin,
+	} {
+		Chains[c.Name] = c
+	}
+}
+
+// NewChainFromString returns the chain named name.
+func NewChainFromString(name string) (*Chain, error) {
+	c, ok := Chains[name]
+	if !ok {
+		return nil, ErrChainUnknow
+	}
+
+	return c, nil
+}
@@ -0,0 +1,92 @@
+package bscript
+
+import (
+	"testing"
+)
+
+func TestChainFlags(t *testing.T) {
+	tests := []struct {
+		chain  *Chain
+		height int
+		mtp    int64
+		has    Flag
+		hasnt  Flag
+	}{
+		{ChainBitcoinMainnet, 170000, 0, ScriptVerifyNone, ScriptVerifyP2SH},
+		{ChainBitcoinMainnet, 173805, 0, ScriptVerifyP2SH, ScriptVerifyDERSignatures},
+		{ChainBitcoinMainnet, 173805, 0, ScriptVerifyWitness | ScriptVerifyTaproot, ScriptVerifyNullDummy},
+		{ChainBitcoinMainnet, 419328, 0, ScriptVerifyDERSignatures | ScriptVerifyCheckLockTimeVerify | ScriptVerifyCheckSequenceVerify, ScriptVerifyNullDummy},
+		{ChainBitcoinMainnet, 481824, 0, ScriptVerifyWitness | ScriptVerifyNullDummy | ScriptVerifyTaproot, ScriptEnableSigHashForkID},
+		{ChainBitcoinMainnet, 692261, 0, ScriptVerifyWitness | ScriptVerifyNullDummy, ScriptVerifyTaproot},
+		{ChainBitcoinMainnet, 692262, 0, ScriptVerifyWitness | ScriptVerifyTaproot, ScriptVerifyNone},
+		{ChainBitcoinTestnet, 514, 0, ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyTaproot, ScriptVerifyNullDummy},
+		{ChainBitcoinTestnet, 513, 0, ScriptVerifyNone, ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyTaproot},
+		{ChainBitcoinRegtest, 0, 0, ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyTaproot, ScriptVerifyDERSignatures},
+		{ChainBitcoinSignet, 1, 0, ScriptVerifyDERSignatures | ScriptVerifyWitness, ScriptVerifyNone},
+		{ChainBitcoinCash, 478558, 1501589999, ScriptVerifyCheckSequenceVerify, ScriptEnableSigHashForkID},
+		{ChainBitcoinCash, 478559, 1501590000, ScriptEnableSigHashForkID | ScriptVerifyStrictEncoding, ScriptVerifyWitness | ScriptVerifyLowS},
+		{ChainBitcoinCash, 556767, 1542300000, ScriptEnableMonolithOpcodes | ScriptEnableCheckDataSig | ScriptVerifyCleanStack, ScriptEnableSchnorr},
+		{ChainBitcoinCash, 582679, 1557921599, ScriptEnableCheckDataSig | ScriptVerifySigPushOnly, ScriptEnableSchnorr | ScriptVerifyMinimalData},
+		{ChainBitcoinSV, 620538, 1581000000, ScriptSkipDisabledOPCode | ScriptEnableMonolithOpcodes, ScriptEnableCheckDataSig},
+		{ChainLitecoin, 1201536, 0, ScriptVerifyWitness | ScriptVerifyCheckSequenceVerify, ScriptVerifyTaproot},
+	}
+
+	for i, test := range tests {
+		flag, err := test.chain.Flags(test.height, test.mtp)
+		if err != nil {
+			t.Errorf("#%d %s at %d: %v", i, test.chain.Name, test.height, err)
+			continue
+		}
+		if !flag.Has(test.has) {
+			t.Errorf("#%d %s at %d: expect %#x in %#x", i, test.chain.Name, test.height, test.has, flag)
+		}
+		if test.hasnt != ScriptVerifyNone && flag&test.hasnt != 0 {
+			t.Errorf("#%d %s at %d: unexpect %#x in %#x", i, test.chain.Name, test.height, test.hasnt, flag)
+		}
+	}
+}
+
+func TestChainLimits(t *testing.T) {
+	if got, err := ChainBitcoinCash.Limits(556767, 1542300000); err != nil || got != LimitsBCH {
+		t.Errorf("expect LimitsBCH, got %+v %v", got, err)
+	}
+	if got, err := ChainBitcoinSV.Limits(620538, 0); err != nil || got != LimitsBSV {
+		t.Errorf("expect LimitsBSV after Genesis, got %+v %v", got, err)
+	}
+	if got, err := ChainBitcoinMainnet.Limits(900000, 0); err != nil || got != LimitsBitcoin {
+		t.Errorf("expect LimitsBitcoin, got %+v %v", got, err)
+	}
+}
+
+func TestChainUnsupported(t *testing.T) {
+	for _, mtp := range []int64{1557921600, 1747310400} {
+		if _, err := ChainBitcoinCash.Flags(582680, mtp); err != ErrChainUnsupported {
+			t.Errorf("flags at %d: expect unsupported got %v", mtp, err)
+		}
+		if _, err := ChainBitcoinCash.StandardFlags(582680, mtp); err != ErrChainUnsupported {
+			t.Errorf("standard flags at %d: expect unsupported got %v", mtp, err)
+		}
+		if _, err := ChainBitcoinCash.Limits(582680, mtp); err != ErrChainUnsupported {
+			t.Errorf("limits at %d: expect unsupported got %v", mtp, err)
+		}
+	}
+}
+
+func TestChainStandardFlags(t *testing.T) {
+	consensus, _ := ChainBitcoinMainnet.Flags(900000, 0)
+	standard, _ := ChainBitcoinMainnet.StandardFlags(900000, 0)
+	if !standard.Has(consensus) {
+		t.Error("expect standard flags to include consensus ones")
+	}
+	if consensus.Has(ScriptVerifyCleanStack) || !standard.Has(ScriptVerifyCleanStack|ScriptVerifyLowS) {
+		t.Error("expect policy only flags in standard flags")
+	}
+
+	chain, err := NewChainFromString("bch")
+	if err != nil || chain != ChainBitcoinCash {
+		t.Error("expect bch chain")
+	}
+	if _, err := NewChainFromString("dogecoin"); err != ErrChainUnknow {
+		t.Error("expect unknow chain error")
+	}
+}
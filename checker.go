@@ -4,10 +4,16 @@ import (
 	"github.com/detailyang/go-bcrypto"
 )
 
+// SchnorrSignatureSize is the size of a Schnorr signature without hash type,
+// for both BIP340 and the BCH scheme.
+const SchnorrSignatureSize = 64
+
 type Checker interface {
 	CheckLockTime(locktime uint32) error
 	CheckSequence(sequence uint32) error
 	CheckSignature(sig, pubkey []byte, script *Script, flag Flag, version SignatureVersion) error
+	CheckSchnorrSignature(sig, pubkey []byte, version SignatureVersion, execdata *ScriptExecutionData) error
+	CheckDataSignature(sig, pubkey, message []byte, flag Flag) error
 }
 
 type NoopChecker struct{}
@@ -18,140 +24,114 @@ func (n *NoopChecker) CheckSequence(sequence uint32) error { return nil }
 func (n *NoopChecker) CheckSignature(sig, pubkey []byte, script *Script, flag Flag, version SignatureVersion) error {
 	return nil
 }
-
-func CheckHashTypeEncoding(hashtype byte, flag Flag) error {
+func (n *NoopChecker) CheckSchnorrSignature(sig, pubkey []byte, version SignatureVersion, execdata *ScriptExecutionData) error {
 	return nil
 }
-
-func CheckPubkeyEncoding(pubkey []byte, flag Flag) error {
-	if flag.Has(ScriptVerifyStrictEncoding) && !isPubKey(pubkey) {
-		return ErrInterpreterBadPubkey
-	}
-
+func (n *NoopChecker) CheckDataSignature(sig, pubkey, message []byte, flag Flag) error {
 	return nil
 }
 
-func CheckSignatureEncoding(sig []byte, flag Flag, sigver SignatureVersion) error {
-	if len(sig) == 0 {
+// CheckHashTypeEncoding enforces that strictly encoded signatures use
+// SIGHASH_FORKID exactly when it is enabled.
+func CheckHashTypeEncoding(hashtype byte, flag Flag) error {
+	if !flag.Has(ScriptVerifyStrictEncoding) {
 		return nil
 	}
 
-	if (flag.Has(ScriptVerifyDERSignatures) ||
-		flag.Has(ScriptVerifyLowS) ||
-		flag.Has(ScriptVerifyStrictEncoding)) &&
-		!isValidSignatureEncoding(sig) {
-		return ErrInterpreterBadSignatureDer
+	useForkId := hashtype&byte(SigHashForkId) != 0
+	enableForkId := flag.Has(ScriptEnableSigHashForkID)
+	if !enableForkId && useForkId {
+		return ErrInterpreterIllegalForkId
 	}
-
-	if flag.Has(ScriptVerifyLowS) {
-		if !isLowDerSignature(sig) {
-			return ErrInterpreterSigantureHighS
-		}
+	if enableForkId && !useForkId {
+		return ErrInterpreterMustUseForkId
 	}
 
-	if flag.Has(ScriptVerifyStrictEncoding) &&
-		!isDefinedHashtypeSiganture(sigver, sig) {
-		return ErrInterpreterBadSignatureHashType
-	}
+	return nil
+}
 
-	if flag.Has(ScriptVerifyStrictEncoding) {
-		useForkId := sig[len(sig)-1]&byte(SigHashForkId) != 0
-		enableForkId := flag.Has(ScriptEnableSigHashForkID)
-		if !enableForkId && useForkId {
-			return ErrInterpreterIllegalForkId
-		}
-		if enableForkId && !useForkId {
-			return ErrInterpreterMustUseForkId
-		}
+func CheckPubkeyEncoding(pubkey []byte, flag Flag) error {
+	if flag.Has(ScriptVerifyStrictEncoding) && !isPubKey(pubkey) {
+		return ErrInterpreterBadPubkey
 	}
 
 	return nil
 }
 
-/// A canonical signature exists of: <30> <total len> <02> <len R> <R> <02> <len S> <S> <hashtype>
-/// Where R and S are not negative (their first byte has its highest bit not set), and not
-/// excessively padded (do not start with a 0 byte, unless an otherwise negative number follows,
-/// in which case a single 0 byte is necessary and even required).
-///
-/// See https://bitcointalk.org/index.php?topic=8392.msg127623#msg127623
-///
-/// This function is consensus-critical since BIP66.
-func isValidSignatureEncoding(sig []byte) bool {
-	// Format: 0x30 [total-length] 0x02 [R-length] [R] 0x02 [S-length] [S] [sighash]
-	// * total-length: 1-byte length descriptor of everything that follows,
-	//   excluding the sighash byte.
-	// * R-length: 1-byte length descriptor of the R value that follows.
-	// * R: arbitrary-length big-endian encoded R value. It must use the shortest
-	//   possible encoding for a positive integers (which means no null bytes at
-	//   the start, except a single one when the next byte has its highest bit set).
-	// * S-length: 1-byte length descriptor of the S value that follows.
-	// * S: arbitrary-length big-endian encoded S value. The same rules apply.
-	// * sighash: 1-byte value indicating what data is hashed (not part of the DER
-	//   signature)
-	// if len(sig) < 9 || len(sig) > 73 {
-	// 	return false
-	// }
+// CheckSignatureEncoding checks the encoding of a CHECKSIG signature, which
+// is a Schnorr signature when it has the size of one and a Schnorr scheme is
+// enabled, DER encoded ECDSA otherwise.
+func CheckSignatureEncoding(sig []byte, flag Flag, sigver SignatureVersion) error {
+	return checkSignatureEncoding(sig, flag, sigver, isSchnorrSignature(sig, flag))
+}
 
-	if sig[0] != 0x30 {
-		return false
+// CheckECDSASignatureEncoding is CheckSignatureEncoding for CHECKMULTISIG,
+// which only takes ECDSA signatures and so rejects the Schnorr size outright.
+func CheckECDSASignatureEncoding(sig []byte, flag Flag, sigver SignatureVersion) error {
+	if isSchnorrSignature(sig, flag) {
+		return ErrInterpreterSignatureBadLength
 	}
 
-	if int(sig[1]) != len(sig)-3 {
-		return false
-	}
+	return checkSignatureEncoding(sig, flag, sigver, false)
+}
 
-	nr := int(sig[3])
-	if nr+5 >= len(sig) {
-		return false
+// CheckDataSignatureEncoding checks an OP_CHECKDATASIG signature, which is
+// like a CHECKSIG one without the hash type byte.
+func CheckDataSignatureEncoding(sig []byte, flag Flag) error {
+	if len(sig) == 0 {
+		return nil
 	}
 
-	ns := int(sig[nr+5])
-
-	if nr+ns+7 != len(sig) {
-		return false
+	if len(sig) == SchnorrSignatureSize && flag.Has(ScriptEnableSchnorr) {
+		return nil
 	}
 
-	if sig[2] != 2 {
-		return false
-	}
+	// the DER checks expect a trailing hash type
+	der := append(sig[:len(sig):len(sig)], 0)
 
-	if nr == 0 {
-		return false
-	}
+	return checkDEREncoding(der, flag)
+}
 
-	if sig[4]&0x80 != 0 {
-		return false
+func checkSignatureEncoding(sig []byte, flag Flag, sigver SignatureVersion, schnorr bool) error {
+	if len(sig) == 0 {
+		return nil
 	}
 
-	if nr > 1 && sig[4] == 0 && (sig[5]&0x80 != 0x80) {
-		return false
+	// Schnorr signatures are fixed size and have no encoding to check
+	// beyond the hash type
+	if !schnorr {
+		if err := checkDEREncoding(sig, flag); err != nil {
+			return err
+		}
 	}
 
-	if sig[nr+4] != 2 {
-		return false
+	if flag.Has(ScriptVerifyStrictEncoding) &&
+		!isDefinedHashtypeSiganture(sigver, sig) {
+		return ErrInterpreterBadSignatureHashType
 	}
 
-	if ns == 0 {
-		return false
-	}
+	return CheckHashTypeEncoding(sig[len(sig)-1], flag)
+}
 
-	if sig[nr+6]&0x80 != 0 {
-		return false
+// checkDEREncoding enforces BIP66 on sig, hash type included, when any of
+// DERSIG, LOW_S or STRICTENC is set and a low S under LOW_S.
+func checkDEREncoding(sig []byte, flag Flag) error {
+	if !flag.Has(ScriptVerifyDERSignatures) &&
+		!flag.Has(ScriptVerifyLowS) &&
+		!flag.Has(ScriptVerifyStrictEncoding) {
+		return nil
 	}
 
-	if ns > 1 && (sig[nr+6] == 0) && (sig[nr+7]&0x80 != 0x80) {
-		return false
+	d, err := ParseDERSignature(sig)
+	if err != nil {
+		return ErrInterpreterBadSignatureDer
 	}
 
-	return true
-}
-
-func isLowDerSignature(sig []byte) bool {
-	if !isValidSignatureEncoding(sig) {
-		return false
+	if flag.Has(ScriptVerifyLowS) && !d.IsLowS() {
+		return ErrInterpreterSigantureHighS
 	}
 
-	return bcrypto.CheckLowS(sig)
+	return nil
 }
 
 func isDefinedHashtypeSiganture(sigver SignatureVersion, sig []byte) bool {
@@ -184,6 +164,41 @@ func isDefinedHashtypeSiganture(sigver SignatureVersion, sig []byte) bool {
 	// return false
 }
 
+// isSchnorrSignature reports whether sig, hash type included, is taken as a
+// Schnorr signature under flag.
+func isSchnorrSignature(sig []byte, flag Flag) bool {
+	return len(sig) == SchnorrSignatureSize+1 && flag.Has(ScriptEnableSchnorr)
+}
+
+// signatureScheme is how a signature, hash type stripped, gets verified.
+type signatureScheme uint8
+
+const (
+	signatureSchemeECDSA signatureScheme = iota
+	signatureSchemeSchnorrBCH
+	signatureSchemeSchnorrBIP340
+)
+
+// signatureSchemeOf picks the scheme of a CHECKSIG or CHECKDATASIG signature
+// outside of tapscript, which only knows BIP340 through
+// CheckSchnorrSignature.
+func signatureSchemeOf(sig []byte, flag Flag) signatureScheme {
+	if len(sig) == SchnorrSignatureSize && flag.Has(ScriptEnableSchnorr) {
+		return signatureSchemeSchnorrBCH
+	}
+
+	return signatureSchemeECDSA
+}
+
+func verifySignature(scheme signatureScheme, pubkey, hash, sig []byte) bool {
+	switch scheme {
+	case signatureSchemeSchnorrBCH:
+		return VerifySchnorrBCH(pubkey, hash, sig)
+	}
+
+	return bcrypto.NewPublicKey(pubkey).Verify(hash, sig)
+}
+
 func isPubKey(pubkey []byte) bool {
 	switch len(pubkey) {
 	case 33:
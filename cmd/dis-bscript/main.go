@@ -9,6 +9,8 @@ import (
 )
 
 func main() {
+	name := flag.String("format", "bscript", "output format: bscript, core-asm, btcd-asm or lines")
+	flags := flag.String("flags", "", "script flags naming the opcodes, e.g. CHECKDATASIG")
 	flag.Parse()
 	args := flag.Args()
 	hexcode := args[0]
@@ -17,13 +19,24 @@ func main() {
 		panic(err)
 	}
 
+	format, err := bscript.NewDisassembleFormatFromString(*name)
+	if err != nil {
+		panic(err)
+	}
+
+	scriptFlag, err := bscript.ParseFlag(*flags)
+	if err != nil {
+		panic(err)
+	}
+
 	script := bscript.NewScriptFromBytes([]byte(code))
 
-	dissembler := bscript.NewDisassembler()
-	s, err := dissembler.Disassemble(script)
+	dissembler := bscript.NewDisassemblerWithFormat(format)
+	dissembler.SetFlag(scriptFlag)
+	s, err := dissembler.Disassemble(script, " ")
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("%s", s)
+	fmt.Printf("%s\n", s)
 }
@@ -0,0 +1,446 @@
+package bscript
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	bcore "github.com/detailyang/go-bcore"
+)
+
+var (
+	ErrConformanceBadVector = errors.New("conformance: bad vector")
+)
+
+// ConformanceErrors maps the expected result names used by Bitcoin Core's
+// script_tests.json onto interpreter errors. Names without an entry have no
+// equivalent error yet, which usually means the rule is not implemented.
+var ConformanceErrors = map[string]error{
+	"EVAL_FALSE":                            ErrInterpreterEvalFalse,
+	"BAD_OPCODE":                            ErrInterpreterBadOPCode,
+	"UNBALANCED_CONDITIONAL":                ErrInterpreterUnbalancedConditional,
+	"VERIFY":                                ErrInterpreterVerifyFailed,
+	"EQUALVERIFY":                           ErrInterpreterVerifyFailed,
+	"SCRIPT_SIZE":                           ErrInterpreterScriptSize,
+	"PUSH_SIZE":                             ErrInterpreterPushSize,
+	"OP_COUNT":                              ErrInterpreterScriptOPCount,
+	"STACK_SIZE":                            ErrInterpreterStackOverflow,
+	"PUBKEY_COUNT":                          ErrInterpreterScriptPubekyesPerMultisig,
+	"SIG_COUNT":                             ErrInterpreterScriptSigCount,
+	"INVALID_STACK_OPERATION":               ErrInterpreterInvalidStackOperation,
+	"INVALID_ALTSTACK_OPERATION":            ErrInterpreterInvalidAltstackOperation,
+	"DISABLED_OPCODE":                       ErrInterpreterDisabledOPCode,
+	"SIG_PUSHONLY":                          ErrInterpreterSignaturePushOnly,
+	"SIG_HASHTYPE":                          ErrInterpreterBadSignatureHashType,
+	"SIG_DER":                               ErrInterpreterBadSignatureDer,
+	"SIG_HIGH_S":                            ErrInterpreterSigantureHighS,
+	"SIG_NULLDUMMY":                         ErrInterpreterSignatureNullDummy,
+	"PUBKEYTYPE":                            ErrInterpreterBadPubkey,
+	"CLEANSTACK":                            ErrInterpreterCleanStack,
+	"NULLFAIL":                              ErrInterpreterSignatureNullFail,
+	"DISCOURAGE_UPGRADABLE_NOPS":            ErrInterpreterDiscourageUpgradableNops,
+	"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": ErrInterpreterDiscourageUpgradableWitnessProgram,
+	"NEGATIVE_LOCKTIME":                     ErrInterpreterNegativeLocktime,
+	"UNSATISFIED_LOCKTIME":                  ErrInterpreterUnsatisfiedLocktime,
+	"WITNESS_PROGRAM_WRONG_LENGTH":          ErrInterpreterWitnessProgramWrongLength,
+	"WITNESS_PROGRAM_WITNESS_EMPTY":         ErrInterpreterWitnessProgramWitnessEmpty,
+	"WITNESS_PROGRAM_MISMATCH":              ErrInterpreterWitnessProgramMismatch,
+	"WITNESS_MALLEATED":                     ErrInterpreterWitnessMalleated,
+	"WITNESS_MALLEATED_P2SH":                ErrInterpreterWitnessMalleatedP2SH,
+	"WITNESS_UNEXPECTED":                    ErrInterpreterWitnessUnexpected,
+	"ILLEGAL_FORKID":                        ErrInterpreterIllegalForkId,
+	"MUST_USE_FORKID":                       ErrInterpreterMustUseForkId,
+	"INVALID_OPERAND_SIZE":                  ErrInterpreterOperandsSize,
+	"INVALID_SPLIT_RANGE":                   ErrInterpreterInvalidSplitRange,
+	"INVALID_NUMBER_RANGE":                  ErrInterpreterInvalidNumberRange,
+	"IMPOSSIBLE_ENCODING":                   ErrInterpreterImpossibleEncoding,
+	"DIV_BY_ZERO":                           ErrInterpreterDivZero,
+	"MOD_BY_ZERO":                           ErrInterpreterModZero,
+	"MINIMALIF":                             ErrInterpreterMinimalIf,
+	"MINIMALDATA":                           ErrInterpreterMinimalData,
+	"OP_RETURN":                             ErrInterpreterOPReturn,
+	"SCHNORR_SIG":                           ErrInterpreterSchnorrSig,
+	"SCHNORR_SIG_SIZE":                      ErrInterpreterSchnorrSigSize,
+	"SCHNORR_SIG_HASHTYPE":                  ErrInterpreterSchnorrSigHashType,
+	"TAPROOT_WRONG_CONTROL_SIZE":            ErrInterpreterTaprootWrongControlSize,
+	"TAPSCRIPT_VALIDATION_WEIGHT":           ErrInterpreterTapscriptValidationWeight,
+	"TAPSCRIPT_CHECKMULTISIG":               ErrInterpreterTapscriptCheckMultisig,
+	"TAPSCRIPT_MINIMALIF":                   ErrInterpreterTapscriptMinimalIf,
+	"TAPSCRIPT_EMPTY_PUBKEY":                ErrInterpreterTapscriptEmptyPubkey,
+	"DISCOURAGE_OP_SUCCESS":                 ErrInterpreterDiscourageOPSuccess,
+	"DISCOURAGE_UPGRADABLE_TAPROOT_VERSION": ErrInterpreterDiscourageUpgradableTaprootVersion,
+	"DISCOURAGE_UPGRADABLE_PUBKEYTYPE":      ErrInterpreterDiscourageUpgradablePubkeyType,
+	"SIG_BADLENGTH":                         ErrInterpreterSignatureBadLength,
+	"CHECKDATASIGVERIFY":                    ErrInterpreterCheckDataSigVerify,
+	"UNKNOWN_ERROR":                         errConformanceUnknown,
+}
+
+// errConformanceUnknown stands for the number errors, which Core throws and
+// reports as UNKNOWN_ERROR.
+var errConformanceUnknown = errors.New("conformance: unknown error")
+
+// conformanceErrorAliases maps the errors this package names more finely
+// than Bitcoin Core to the ScriptError Core reports for them.
+var conformanceErrorAliases = map[error]error{
+	ErrStackEmpty:                    ErrInterpreterInvalidStackOperation,
+	ErrStackNotEnough:                ErrInterpreterInvalidStackOperation,
+	ErrInterpreterStackSizeNotEnough: ErrInterpreterInvalidStackOperation,
+	ErrInterpreterNoMatchConditional: ErrInterpreterUnbalancedConditional,
+	ErrInterpreterIllegalOPCode:      ErrInterpreterBadOPCode,
+	ErrScriptTakeOverflow:            ErrInterpreterBadOPCode,
+	ErrNumberNonMinimalEncode:        errConformanceUnknown,
+	ErrNumberOverflow:                errConformanceUnknown,
+}
+
+// conformanceErrorIs reports whether err, or an error it wraps, is expected
+// or an alias of it.
+func conformanceErrorIs(err, expected error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err == expected || conformanceErrorAliases[err] == expected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseConformanceFlags parses a comma separated flag list such as
+// "P2SH,STRICTENC,WITNESS", whose names are those of ParseFlag.
+func ParseConformanceFlags(s string) (Flag, error) {
+	return ParseFlag(s)
+}
+
+// NewCreditingTransaction builds the transaction whose only output is spent by
+// a conformance vector, as described in the script_tests.json header.
+func NewCreditingTransaction(script *Script, value uint64) *bcore.Transaction {
+	var tx bcore.Transaction
+	tx.Version = 1
+	tx.Locktime = 0
+	tx.Inputs = make([]*bcore.TransactionInput, 1)
+	tx.Outputs = make([]*bcore.TransactionOutput, 1)
+	var input bcore.TransactionInput
+	var output bcore.TransactionOutput
+	input.PrevOutput = bcore.NewDefaultOutPoint()
+	input.ScriptSig = NewScript().PushInt64(0).PushInt64(0).Bytes()
+	input.Sequence = bcore.TransactionFinalSequence
+	output.ScriptPubkey = script.Bytes()
+	output.Value = value
+
+	tx.Inputs[0] = &input
+	tx.Outputs[0] = &output
+
+	return &tx
+}
+
+// NewSpendingTransaction builds the transaction which spends the output of
+// creditTx with the given scriptSig.
+func NewSpendingTransaction(script *Script, creditTx *bcore.Transaction) *bcore.Transaction {
+	var tx bcore.Transaction
+	tx.Version = 1
+	tx.Locktime = 0
+	tx.Inputs = make([]*bcore.TransactionInput, 1)
+	tx.Outputs = make([]*bcore.TransactionOutput, 1)
+	var input bcore.TransactionInput
+	var output bcore.TransactionOutput
+	input.PrevOutput = bcore.NewOutPoint(creditTx.ID(), 0)
+	input.ScriptSig = script.Bytes()
+	input.Sequence = bcore.TransactionFinalSequence
+	output.ScriptPubkey = make([]byte, 0)
+	output.Value = creditTx.Outputs[0].Value
+
+	tx.Inputs[0] = &input
+	tx.Outputs[0] = &output
+
+	return &tx
+}
+
+// ConformanceVector is one entry of Bitcoin Core's script_tests.json:
+// [[wit..., amount]?, scriptSig, scriptPubKey, flags, expected_scripterror, ... comments]
+type ConformanceVector struct {
+	Index        int
+	Witness      ScriptWitness
+	Amount       uint64
+	ScriptSig    string
+	ScriptPubkey string
+	Flags        string
+	Expected     string
+	Comment      string
+}
+
+func (v *ConformanceVector) String() string {
+	if len(v.Comment) > 0 {
+		return fmt.Sprintf("#%d (%s)", v.Index, v.Comment)
+	}
+
+	return fmt.Sprintf("#%d ([%s, %s, %s])", v.Index, v.ScriptSig, v.ScriptPubkey, v.Flags)
+}
+
+// NewConformanceVectors decodes script_tests.json, skipping the single string
+// entries which are comments.
+func NewConformanceVectors(data []byte) ([]*ConformanceVector, error) {
+	var tests [][]interface{}
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, err
+	}
+
+	vectors := make([]*ConformanceVector, 0, len(tests))
+	for i, test := range tests {
+		if len(test) == 1 {
+			continue
+		}
+
+		vector, err := newConformanceVector(i, test)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+
+	return vectors, nil
+}
+
+func newConformanceVector(index int, test []interface{}) (*ConformanceVector, error) {
+	vector := &ConformanceVector{
+		Index: index,
+	}
+
+	// When the first field of the test data is a slice it contains
+	// witness data and everything else is offset by 1 as a result.
+	offset := 0
+	if witnessData, ok := test[0].([]interface{}); ok {
+		offset++
+
+		if len(witnessData) == 0 {
+			return nil, fmt.Errorf("%s: #%d missing amount", ErrConformanceBadVector, index)
+		}
+
+		// The final element within the slice is the input amount.
+		amount, ok := witnessData[len(witnessData)-1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: #%d amount is not a number", ErrConformanceBadVector, index)
+		}
+		vector.Amount = uint64(math.Round(amount * 1e8))
+
+		witness := make([][]byte, len(witnessData)-1)
+		for i, e := range witnessData[:len(witnessData)-1] {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: #%d witness is not a string", ErrConformanceBadVector, index)
+			}
+
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: #%d %s", ErrConformanceBadVector, index, err)
+			}
+			witness[i] = b
+		}
+		vector.Witness = NewScriptWitness(witness)
+	}
+
+	// The test must consist of at least a signature script, public key
+	// script, flags, and expected error. Finally, it may optionally contain
+	// a comment.
+	if len(test) < offset+4 || len(test) > offset+5 {
+		return nil, fmt.Errorf("%s: #%d invalid length %d", ErrConformanceBadVector, index, len(test))
+	}
+
+	fields := make([]string, len(test)-offset)
+	for i := range fields {
+		s, ok := test[offset+i].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: #%d field %d is not a string", ErrConformanceBadVector, index, offset+i)
+		}
+		fields[i] = s
+	}
+
+	vector.ScriptSig = fields[0]
+	vector.ScriptPubkey = fields[1]
+	vector.Flags = fields[2]
+	vector.Expected = fields[3]
+	if len(fields) == 5 {
+		vector.Comment = fields[4]
+	}
+
+	return vector, nil
+}
+
+type ConformanceStatus int
+
+const (
+	// ConformancePass means the interpreter returned exactly the expected result.
+	ConformancePass ConformanceStatus = iota
+	// ConformanceUnexpectedSuccess means the vector should fail but verified.
+	ConformanceUnexpectedSuccess
+	// ConformanceUnexpectedFailure means the vector should verify but failed.
+	ConformanceUnexpectedFailure
+	// ConformanceWrongError means the vector failed with a different error.
+	ConformanceWrongError
+	// ConformanceUnmappedError means the vector failed as expected but the
+	// expected error has no interpreter equivalent to compare against.
+	ConformanceUnmappedError
+	// ConformanceBadInput means the scripts or flags could not be parsed.
+	ConformanceBadInput
+)
+
+func (s ConformanceStatus) String() string {
+	switch s {
+	case ConformancePass:
+		return "PASS"
+	case ConformanceUnexpectedSuccess:
+		return "UNEXPECTED_SUCCESS"
+	case ConformanceUnexpectedFailure:
+		return "UNEXPECTED_FAILURE"
+	case ConformanceWrongError:
+		return "WRONG_ERROR"
+	case ConformanceUnmappedError:
+		return "UNMAPPED_ERROR"
+	case ConformanceBadInput:
+		return "BAD_INPUT"
+	}
+
+	return "UNKNOW"
+}
+
+type ConformanceResult struct {
+	Vector *ConformanceVector
+	Status ConformanceStatus
+	Err    error
+}
+
+func (r *ConformanceResult) String() string {
+	if r.Err == nil {
+		return fmt.Sprintf("%-18s %s expect %s got OK", r.Status, r.Vector, r.Vector.Expected)
+	}
+
+	return fmt.Sprintf("%-18s %s expect %s got %s", r.Status, r.Vector, r.Vector.Expected, r.Err)
+}
+
+// RunConformanceVector builds the crediting/spending transaction pair for v and
+// verifies it with a TransactionSigner.
+func RunConformanceVector(v *ConformanceVector) (result *ConformanceResult) {
+	result = &ConformanceResult{
+		Vector: v,
+	}
+
+	// A panic inside the interpreter is a failure of this vector only.
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("panic: %v", r)
+			result.Status = result.classify()
+		}
+	}()
+
+	scriptSig, err := NewScriptFromStringWithDialect(v.ScriptSig, DialectCoreTest)
+	if err != nil {
+		result.Status, result.Err = ConformanceBadInput, err
+		return result
+	}
+
+	scriptPubkey, err := NewScriptFromStringWithDialect(v.ScriptPubkey, DialectCoreTest)
+	if err != nil {
+		result.Status, result.Err = ConformanceBadInput, err
+		return result
+	}
+
+	flag, err := ParseConformanceFlags(v.Flags)
+	if err != nil {
+		result.Status, result.Err = ConformanceBadInput, err
+		return result
+	}
+
+	creditTx := NewCreditingTransaction(scriptPubkey, v.Amount)
+	spendTx := NewSpendingTransaction(scriptSig, creditTx)
+
+	result.Err = VerifyScript(
+		scriptSig,
+		scriptPubkey,
+		v.Witness,
+		flag,
+		NewTransactionSignerWithPrevOutputs(spendTx, 0, creditTx.Outputs),
+		SignatureVersionBase,
+	)
+	result.Status = result.classify()
+
+	return result
+}
+
+func (r *ConformanceResult) classify() ConformanceStatus {
+	if r.Vector.Expected == "OK" {
+		if r.Err == nil {
+			return ConformancePass
+		}
+		return ConformanceUnexpectedFailure
+	}
+
+	if r.Err == nil {
+		return ConformanceUnexpectedSuccess
+	}
+
+	expected, ok := ConformanceErrors[r.Vector.Expected]
+	if !ok {
+		return ConformanceUnmappedError
+	}
+
+	if !conformanceErrorIs(r.Err, expected) {
+		return ConformanceWrongError
+	}
+
+	return ConformancePass
+}
+
+type ConformanceReport struct {
+	Results []*ConformanceResult
+}
+
+// RunConformanceVectors runs every vector of a script_tests.json file.
+func RunConformanceVectors(data []byte) (*ConformanceReport, error) {
+	vectors, err := NewConformanceVectors(data)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ConformanceReport{
+		Results: make([]*ConformanceResult, len(vectors)),
+	}
+	for i, vector := range vectors {
+		report.Results[i] = RunConformanceVector(vector)
+	}
+
+	return report, nil
+}
+
+// Count returns the number of results with the given status.
+func (r *ConformanceReport) Count(status ConformanceStatus) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (r *ConformanceReport) Summary() string {
+	return fmt.Sprintf("%d vectors: %d %s, %d %s, %d %s, %d %s, %d %s, %d %s",
+		len(r.Results),
+		r.Count(ConformancePass), ConformancePass,
+		r.Count(ConformanceUnexpectedSuccess), ConformanceUnexpectedSuccess,
+		r.Count(ConformanceUnexpectedFailure), ConformanceUnexpectedFailure,
+		r.Count(ConformanceWrongError), ConformanceWrongError,
+		r.Count(ConformanceUnmappedError), ConformanceUnmappedError,
+		r.Count(ConformanceBadInput), ConformanceBadInput)
+}
+
+func (r *ConformanceReport) String() string {
+	lines := make([]string, 0, len(r.Results)+1)
+	for _, result := range r.Results {
+		lines = append(lines, result.String())
+	}
+	lines = append(lines, r.Summary())
+
+	return strings.Join(lines, "\n")
+}
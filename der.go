@@ -0,0 +1,257 @@
+package bscript
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrDERTooShort      = errors.New("der: signature too short")
+	ErrDERTooLong       = errors.New("der: signature too long")
+	ErrDERBadSequence   = errors.New("der: missing sequence tag")
+	ErrDERBadLength     = errors.New("der: length does not match the signature size")
+	ErrDERBadIntegerR   = errors.New("der: missing integer tag of r")
+	ErrDERBadIntegerS   = errors.New("der: missing integer tag of s")
+	ErrDERZeroLengthR   = errors.New("der: zero length r")
+	ErrDERZeroLengthS   = errors.New("der: zero length s")
+	ErrDERNegativeR     = errors.New("der: negative r")
+	ErrDERNegativeS     = errors.New("der: negative s")
+	ErrDERPaddedR       = errors.New("der: excessively padded r")
+	ErrDERPaddedS       = errors.New("der: excessively padded s")
+	ErrDEROverflow      = errors.New("der: integer over 32 bytes")
+	ErrDERMissingValues = errors.New("der: missing r or s")
+	ErrDEROutOfRange    = errors.New("der: r or s not below the curve order")
+)
+
+// secp256k1HalfN is the largest low S value.
+var secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+
+// DERSignature is an ECDSA signature as scripts carry it, the DER encoding
+// of R and S followed by the hash type byte.
+type DERSignature struct {
+	R       *big.Int
+	S       *big.Int
+	SigHash SigHash
+}
+
+// ParseDERSignature parses sig under the strict encoding rules of BIP66,
+// which the interpreter enforces for consensus, and names the rule sig
+// breaks.
+func ParseDERSignature(sig []byte) (*DERSignature, error) {
+	if err := CheckBIP66(sig); err != nil {
+		return nil, err
+	}
+
+	nr := int(sig[3])
+	ns := int(sig[nr+5])
+
+	return &DERSignature{
+		R:       new(big.Int).SetBytes(sig[4 : 4+nr]),
+		S:       new(big.Int).SetBytes(sig[nr+6 : nr+6+ns]),
+		SigHash: SigHash(sig[len(sig)-1]),
+	}, nil
+}
+
+// CheckBIP66 reports the first BIP66 rule sig, hash type included, breaks
+// in the order Bitcoin Core checks them, nil for a strict DER signature.
+func CheckBIP66(sig []byte) error {
+	// Format: 0x30 [total-length] 0x02 [R-length] [R] 0x02 [S-length] [S] [sighash]
+	if len(sig) < 9 {
+		return ErrDERTooShort
+	}
+	if len(sig) > 73 {
+		return ErrDERTooLong
+	}
+	if sig[0] != 0x30 {
+		return ErrDERBadSequence
+	}
+	if int(sig[1]) != len(sig)-3 {
+		return ErrDERBadLength
+	}
+
+	nr := int(sig[3])
+	if nr+5 >= len(sig) {
+		return ErrDERBadLength
+	}
+	ns := int(sig[nr+5])
+	if nr+ns+7 != len(sig) {
+		return ErrDERBadLength
+	}
+
+	if sig[2] != 2 {
+		return ErrDERBadIntegerR
+	}
+	if nr == 0 {
+		return ErrDERZeroLengthR
+	}
+	if sig[4]&0x80 != 0 {
+		return ErrDERNegativeR
+	}
+	if nr > 1 && sig[4] == 0 && sig[5]&0x80 == 0 {
+		return ErrDERPaddedR
+	}
+
+	if sig[nr+4] != 2 {
+		return ErrDERBadIntegerS
+	}
+	if ns == 0 {
+		return ErrDERZeroLengthS
+	}
+	if sig[nr+6]&0x80 != 0 {
+		return ErrDERNegativeS
+	}
+	if ns > 1 && sig[nr+6] == 0 && sig[nr+7]&0x80 == 0 {
+		return ErrDERPaddedS
+	}
+
+	return nil
+}
+
+// ParseLaxDERSignature parses sig, hash type included, as leniently as
+// libsecp256k1's ecdsa_signature_parse_der_lax, which pre BIP66 signatures
+// were verified with: long form lengths, padding and garbage after S are
+// accepted. R or S not below the curve order, which libsecp256k1 turns into
+// a signature that never verifies, is rejected. Bytes re-encodes the result
+// strictly.
+func ParseLaxDERSignature(sig []byte) (*DERSignature, error) {
+	if len(sig) < 1 {
+		return nil, ErrDERTooShort
+	}
+
+	der := sig[:len(sig)-1]
+	pos := 0
+
+	if pos == len(der) || der[pos] != 0x30 {
+		return nil, ErrDERBadSequence
+	}
+	pos++
+
+	// the sequence length is skipped
+	if pos == len(der) {
+		return nil, ErrDERBadLength
+	}
+	n := int(der[pos])
+	pos++
+	if n&0x80 != 0 {
+		n -= 0x80
+		if n > len(der)-pos {
+			return nil, ErrDERBadLength
+		}
+		pos += n
+	}
+
+	var values [2][]byte
+	for i := range values {
+		if pos == len(der) || der[pos] != 0x02 {
+			if i == 0 {
+				return nil, ErrDERBadIntegerR
+			}
+			return nil, ErrDERBadIntegerS
+		}
+		pos++
+
+		if pos == len(der) {
+			return nil, ErrDERMissingValues
+		}
+		size := int(der[pos])
+		pos++
+		if size&0x80 != 0 {
+			n := size - 0x80
+			if n > len(der)-pos {
+				return nil, ErrDERBadLength
+			}
+			for n > 0 && der[pos] == 0 {
+				pos++
+				n--
+			}
+			if n > 4 {
+				return nil, ErrDERBadLength
+			}
+			size = 0
+			for ; n > 0; n-- {
+				size = size<<8 | int(der[pos])
+				pos++
+			}
+		}
+		if size > len(der)-pos {
+			return nil, ErrDERBadLength
+		}
+
+		value := der[pos : pos+size]
+		pos += size
+		for len(value) > 0 && value[0] == 0 {
+			value = value[1:]
+		}
+		if len(value) > 32 {
+			return nil, ErrDEROverflow
+		}
+		values[i] = value
+	}
+
+	d := &DERSignature{
+		R:       new(big.Int).SetBytes(values[0]),
+		S:       new(big.Int).SetBytes(values[1]),
+		SigHash: SigHash(sig[len(sig)-1]),
+	}
+	if d.R.Cmp(secp256k1N) >= 0 || d.S.Cmp(secp256k1N) >= 0 {
+		return nil, ErrDEROutOfRange
+	}
+
+	return d, nil
+}
+
+// IsLowS reports whether S is at most half the curve order, as
+// SCRIPT_VERIFY_LOW_S requires.
+func (d *DERSignature) IsLowS() bool {
+	return d.S.Cmp(secp256k1HalfN) <= 0
+}
+
+// Normalize replaces a high S with its low counterpart, N - S, which
+// verifies against the same key and message. It reports whether S changed.
+func (d *DERSignature) Normalize() bool {
+	if d.IsLowS() {
+		return false
+	}
+
+	d.S = new(big.Int).Sub(secp256k1N, d.S)
+	return true
+}
+
+// DER is the minimal DER encoding of R and S, without the hash type.
+func (d *DERSignature) DER() []byte {
+	r, s := derInteger(d.R), derInteger(d.S)
+
+	der := []byte{0x30, byte(4 + len(r) + len(s)), 0x02, byte(len(r))}
+	der = append(der, r...)
+	der = append(der, 0x02, byte(len(s)))
+
+	return append(der, s...)
+}
+
+// Bytes is the signature as scripts carry it, DER followed by the hash type.
+func (d *DERSignature) Bytes() []byte {
+	return append(d.DER(), byte(d.SigHash))
+}
+
+// NormalizeSignature re-encodes sig strictly with a low S, so that it passes
+// SCRIPT_VERIFY_DERSIG and SCRIPT_VERIFY_LOW_S.
+func NormalizeSignature(sig []byte) ([]byte, error) {
+	d, err := ParseLaxDERSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Normalize()
+	return d.Bytes(), nil
+}
+
+// derInteger is the shortest big endian encoding of a non negative x, with
+// a zero byte in front of a set high bit.
+func derInteger(x *big.Int) []byte {
+	b := x.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+
+	return b
+}
@@ -0,0 +1,118 @@
+package bscript
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	bcrypto "github.com/detailyang/go-bcrypto"
+)
+
+func TestCheckBIP66(t *testing.T) {
+	key := bcrypto.NewKey(key0bytes[:], true)
+	pubkey, _ := key.GetPubkey()
+	hash := bytes.Repeat([]byte{7}, 32)
+	der, _ := key.Signature(hash, 0)
+	sig := append(der, byte(SigHashAll))
+
+	mutate := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte{}, sig...))
+	}
+	nr := int(sig[3])
+
+	tests := []struct {
+		name string
+		sig  []byte
+		err  error
+	}{
+		{"valid", sig, nil},
+		{"short", sig[:8], ErrDERTooShort},
+		{"long", append(bytes.Repeat([]byte{0}, 70), sig...), ErrDERTooLong},
+		{"sequence", mutate(func(b []byte) []byte { b[0] = 0x31; return b }), ErrDERBadSequence},
+		{"total length", mutate(func(b []byte) []byte { b[1]++; return b }), ErrDERBadLength},
+		{"r length", mutate(func(b []byte) []byte { b[3] = byte(len(b)); return b }), ErrDERBadLength},
+		{"r tag", mutate(func(b []byte) []byte { b[2] = 3; return b }), ErrDERBadIntegerR},
+		{"s tag", mutate(func(b []byte) []byte { b[nr+4] = 3; return b }), ErrDERBadIntegerS},
+		{"r negative", mutate(func(b []byte) []byte { b[4] = 0x80; return b }), ErrDERNegativeR},
+		{"s negative", mutate(func(b []byte) []byte { b[nr+6] = 0x80; return b }), ErrDERNegativeS},
+		{"r padded", mutate(func(b []byte) []byte { b[4], b[5] = 0, 0; return b }), ErrDERPaddedR},
+		{"s padded", mutate(func(b []byte) []byte { b[nr+6], b[nr+7] = 0, 0; return b }), ErrDERPaddedS},
+		{"r empty", []byte{0x30, 0x06, 0x02, 0x00, 0x02, 0x02, 0x01, 0x01, 0x01}, ErrDERZeroLengthR},
+		{"s empty", []byte{0x30, 0x06, 0x02, 0x02, 0x01, 0x01, 0x02, 0x00, 0x01}, ErrDERZeroLengthS},
+	}
+
+	for _, test := range tests {
+		if err := CheckBIP66(test.sig); err != test.err {
+			t.Errorf("%s: expect %v got %v", test.name, test.err, err)
+		}
+	}
+
+	// truncated encodings fail without reading past the end
+	for _, short := range [][]byte{{0x30}, {0x30, 0x00, 0x01}, {0x30, 0x06, 0x02, 0x09, 0x01}} {
+		if err := checkSignatureEncoding(short, ScriptVerifyDERSignatures, SignatureVersionBase, false); err != ErrInterpreterBadSignatureDer {
+			t.Errorf("%x: expect bad der got %v", short, err)
+		}
+		if err := CheckDataSignatureEncoding(short, ScriptVerifyLowS); err != ErrInterpreterBadSignatureDer {
+			t.Errorf("%x: expect bad data signature der got %v", short, err)
+		}
+	}
+
+	d, err := ParseDERSignature(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.IsLowS() || d.SigHash != SigHashAll || !bytes.Equal(d.Bytes(), sig) {
+		t.Errorf("unexpect parse %x", d.Bytes())
+	}
+
+	// the high S twin verifies as well and normalizes back
+	d.S = new(big.Int).Sub(secp256k1N, d.S)
+	high := d.Bytes()
+	if d.IsLowS() || checkSignatureEncoding(high, ScriptVerifyLowS, SignatureVersionBase, false) != ErrInterpreterSigantureHighS ||
+		!pubkey.Verify(hash, high[:len(high)-1]) {
+		t.Fatalf("expect a valid high S signature %x", high)
+	}
+	low, err := NormalizeSignature(high)
+	if err != nil || !bytes.Equal(low, sig) {
+		t.Errorf("expect normalized %x got %x %v", sig, low, err)
+	}
+}
+
+func TestParseLaxDERSignature(t *testing.T) {
+	strict := "3006020101020102"
+	tests := []struct {
+		sig    string
+		expect string
+		err    error
+	}{
+		{strict, strict, nil},
+		// padded integers
+		{"300802020001020300000201", strict, nil},
+		// long form lengths and trailing garbage
+		{"3081070281010102010200ff", strict, nil},
+		{"3008020101020102deadbeef", strict, nil},
+		// negative values are read unsigned
+		{"3006020181020102", "300702020081020102", nil},
+		{"3106020101020102", "", ErrDERBadSequence},
+		{"30060201010302", "", ErrDERBadIntegerS},
+		{"3006020901020102", "", ErrDERBadLength},
+		{"3026022101" + strings.Repeat("ff", 32) + "020101", "", ErrDEROverflow},
+		// the curve order itself
+		{"3026022100" + secp256k1N.Text(16) + "020101", "", ErrDEROutOfRange},
+		{"3026020101022100" + secp256k1N.Text(16), "", ErrDEROutOfRange},
+	}
+
+	for _, test := range tests {
+		sig, _ := hex.DecodeString(test.sig + "01")
+		d, err := ParseLaxDERSignature(sig)
+		if err != test.err {
+			t.Errorf("%s: expect %v got %v", test.sig, test.err, err)
+			continue
+		}
+		if err == nil && hex.EncodeToString(d.DER()) != test.expect {
+			t.Errorf("%s: expect %s got %x", test.sig, test.expect, d.DER())
+		}
+	}
+}
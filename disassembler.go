@@ -1,26 +1,129 @@
 package bscript
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 )
 
+var (
+	ErrDisassemblerUnknowFormat     = errors.New("disassembler: unknow format")
+	ErrDisassemblerNotRepresentable = errors.New("disassembler: script is not representable in format")
+)
+
+// DisassembleFormat selects the text produced by Disassembler. Every format
+// round-trips: assembling the output with Format.Dialect gives back the exact
+// script bytes, and scripts which cannot be written that way are rejected
+// with ErrDisassemblerNotRepresentable. Opcodes are named as the flags set
+// with Disassembler.SetFlag enable them, see OPCode.StringWithFlag.
+type DisassembleFormat int
+
+const (
+	// FormatBScript keeps every push opcode and its length prefix so that any
+	// well formed script can be reproduced, e.g. "OP_PUSHBYTES_2 0x0102".
+	// Undefined opcodes, OP_SUCCESSx among them, are raw bytes like "0xbc".
+	FormatBScript DisassembleFormat = iota
+	// FormatCoreAsm mimics Bitcoin Core's decodescript asm, with sighash
+	// suffixes such as [ALL|FORKID] on signature pushes.
+	FormatCoreAsm
+	// FormatBtcdAsm mimics btcd's txscript.DisasmString.
+	FormatBtcdAsm
+	// FormatLines is FormatBScript with one instruction per line, each
+	// followed by a comment holding its byte offset.
+	FormatLines
+)
+
+func (f DisassembleFormat) String() string {
+	switch f {
+	case FormatBScript:
+		return "bscript"
+	case FormatCoreAsm:
+		return "core-asm"
+	case FormatBtcdAsm:
+		return "btcd-asm"
+	case FormatLines:
+		return "lines"
+	}
+
+	return "unknow"
+}
+
+// NewDisassembleFormatFromString is the inverse of DisassembleFormat.String.
+func NewDisassembleFormatFromString(s string) (DisassembleFormat, error) {
+	for _, f := range []DisassembleFormat{FormatBScript, FormatCoreAsm, FormatBtcdAsm, FormatLines} {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+
+	return 0, ErrDisassemblerUnknowFormat
+}
+
+// Dialect returns the assembler dialect which parses the format back.
+func (f DisassembleFormat) Dialect() Dialect {
+	switch f {
+	case FormatCoreAsm:
+		return DialectCoreAsm
+	case FormatBtcdAsm:
+		return DialectBtcdAsm
+	}
+
+	return DialectBScript
+}
+
 type Disassembler struct {
+	format DisassembleFormat
+	flag   Flag
 }
 
 func NewDisassembler() *Disassembler {
-	return &Disassembler{}
+	return NewDisassemblerWithFormat(FormatBScript)
+}
+
+func NewDisassemblerWithFormat(format DisassembleFormat) *Disassembler {
+	return &Disassembler{
+		format: format,
+	}
+}
+
+// SetFlag names the opcodes Bitcoin Cash reuses as flag enables them.
+func (d *Disassembler) SetFlag(flag Flag) {
+	d.flag = flag
 }
 
+// Disassemble renders script joining instructions with sep. FormatLines
+// always uses a newline.
 func (d *Disassembler) Disassemble(script *Script, sep string) (string, error) {
+	dis, err := d.disassemble(script, sep)
+	if err != nil {
+		return "", err
+	}
+
+	if err := d.verify(dis, script.Data); err != nil {
+		return "", err
+	}
+
+	return dis, nil
+}
+
+// disassemble is Disassemble without the round-trip check.
+func (d *Disassembler) disassemble(script *Script, sep string) (string, error) {
 	tmp := script.Pos
 	script.Pos = 0
 	defer func() {
 		script.Pos = tmp
 	}()
 
+	if d.format == FormatLines {
+		sep = "\n"
+	}
+
 	rv := make([]string, 0, 64)
 	for {
+		offset := script.Pos
 		ins, err := script.Next()
 		if err != nil {
 			if err == ErrScriptEOF {
@@ -29,8 +132,101 @@ func (d *Disassembler) Disassemble(script *Script, sep string) (string, error) {
 			return "", err
 		}
 
-		rv = append(rv, fmt.Sprintf("%s", ins))
+		var s string
+		switch d.format {
+		case FormatBScript:
+			s = disassembleBScript(ins, d.flag)
+		case FormatLines:
+			s = fmt.Sprintf("%s # %04d", disassembleBScript(ins, d.flag), offset)
+		case FormatCoreAsm:
+			s = disassembleCoreAsm(ins, d.flag)
+		case FormatBtcdAsm:
+			s = disassembleBtcdAsm(ins, d.flag)
+		default:
+			return "", ErrDisassemblerUnknowFormat
+		}
+
+		rv = append(rv, s)
 	}
 
 	return strings.Join(rv, sep), nil
 }
+
+// verify checks the round-trip guarantee, the asm formats drop push opcodes
+// so non-minimal pushes cannot survive it.
+func (d *Disassembler) verify(dis string, expect []byte) error {
+	script, err := NewScriptFromStringWithDialect(dis, d.format.Dialect())
+	if err != nil {
+		return fmt.Errorf("%s: %s", ErrDisassemblerNotRepresentable, err)
+	}
+
+	if !bytes.Equal(script.Data, expect) {
+		return ErrDisassemblerNotRepresentable
+	}
+
+	return nil
+}
+
+func disassembleBScript(ins *Instruction, flag Flag) string {
+	if ins.OPCode.IsUndefined() {
+		return fmt.Sprintf("0x%02x", uint8(ins.OPCode))
+	}
+
+	rv := []string{ins.OPCode.StringWithFlag(flag)}
+
+	switch ins.OPCode {
+	case OP_PUSHDATA1:
+		rv = append(rv, fmt.Sprintf("0x%02x", len(ins.Data)))
+	case OP_PUSHDATA2:
+		buf := make([]byte, 2)
+		binary.LittleEndian.PutUint16(buf, uint16(len(ins.Data)))
+		rv = append(rv, "0x"+hex.EncodeToString(buf))
+	case OP_PUSHDATA4:
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, uint32(len(ins.Data)))
+		rv = append(rv, "0x"+hex.EncodeToString(buf))
+	}
+
+	if len(ins.Data) > 0 {
+		rv = append(rv, "0x"+hex.EncodeToString(ins.Data))
+	}
+
+	return strings.Join(rv, " ")
+}
+
+func disassembleCoreAsm(ins *Instruction, flag Flag) string {
+	switch {
+	case ins.OPCode == OP_1NEGATE:
+		return "-1"
+	case OP_1 <= ins.OPCode && ins.OPCode <= OP_16:
+		return fmt.Sprintf("%d", int(ins.OPCode)-int(OP_1)+1)
+	case ins.OPCode > OP_PUSHDATA4:
+		return ins.OPCode.StringWithFlag(flag)
+	case len(ins.Data) <= 4:
+		return fmt.Sprintf("%d", NewNumber(ins.Data))
+	}
+
+	if CheckBIP66(ins.Data) == nil {
+		sighash := SigHash(ins.Data[len(ins.Data)-1])
+		if name, ok := sigHashNames[sighash]; ok {
+			return hex.EncodeToString(ins.Data[:len(ins.Data)-1]) + "[" + name + "]"
+		}
+	}
+
+	return hex.EncodeToString(ins.Data)
+}
+
+func disassembleBtcdAsm(ins *Instruction, flag Flag) string {
+	switch {
+	case ins.OPCode == OP_0:
+		return "0"
+	case ins.OPCode == OP_1NEGATE:
+		return "-1"
+	case OP_1 <= ins.OPCode && ins.OPCode <= OP_16:
+		return fmt.Sprintf("%d", int(ins.OPCode)-int(OP_1)+1)
+	case ins.OPCode > OP_PUSHDATA4:
+		return ins.OPCode.StringWithFlag(flag)
+	}
+
+	return hex.EncodeToString(ins.Data)
+}
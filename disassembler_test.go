@@ -0,0 +1,117 @@
+package bscript
+
+import (
+	"testing"
+)
+
+func TestDisassemblerFormats(t *testing.T) {
+	sig := "3044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb"
+	pkh := "89abcdefabbaabbaabbaabbaabbaabbaabbaabba"
+
+	tests := []struct {
+		format DisassembleFormat
+		hex    string
+		expect string
+	}{
+		{FormatBScript, "", ""},
+		{FormatBScript, "76a914" + pkh + "88ac", "OP_DUP OP_HASH160 OP_PUSHBYTES_20 0x" + pkh + " OP_EQUALVERIFY OP_CHECKSIG"},
+		{FormatBScript, "4c00", "OP_PUSHDATA1 0x00"},
+		{FormatBScript, "4d02000102", "OP_PUSHDATA2 0x0200 0x0102"},
+		{FormatBScript, "0100514f", "OP_PUSHBYTES_1 0x00 OP_1 OP_1NEGATE"},
+		{FormatBScript, "bb51c0fe", "OP_CHECKDATASIGVERIFY OP_1 0xc0 0xfe"},
+		{FormatBScript, "01c0bc", "OP_PUSHBYTES_1 0xc0 0xbc"},
+		{FormatLines, "51bc", "OP_1 # 0000\n0xbc # 0001"},
+		{FormatLines, "0051020102ac", "OP_0 # 0000\nOP_1 # 0001\nOP_PUSHBYTES_2 0x0102 # 0002\nOP_CHECKSIG # 0005"},
+		{FormatCoreAsm, "76a914" + pkh + "88ac", "OP_DUP OP_HASH160 " + pkh + " OP_EQUALVERIFY OP_CHECKSIG"},
+		{FormatCoreAsm, "00514f600111" + "02e803", "0 1 -1 16 17 1000"},
+		{FormatCoreAsm, "47" + sig + "41", sig + "[ALL|FORKID]"},
+		{FormatCoreAsm, "47" + sig + "01", sig + "[ALL]"},
+		{FormatBtcdAsm, "00604f0105ac", "0 16 -1 05 OP_CHECKSIG"},
+	}
+
+	for _, test := range tests {
+		script, err := NewScriptFromHexString(test.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dis, err := NewDisassemblerWithFormat(test.format).Disassemble(script, " ")
+		if err != nil {
+			t.Fatalf("%s %s: %s", test.format, test.hex, err)
+		}
+
+		if dis != test.expect {
+			t.Errorf("%s %s: expect %q got %q", test.format, test.hex, test.expect, dis)
+		}
+
+		back, err := NewScriptFromStringWithDialect(dis, test.format.Dialect())
+		if err != nil {
+			t.Fatalf("%s %q: %s", test.format, dis, err)
+		}
+
+		if back.Hex() != test.hex {
+			t.Errorf("%s %q: expect %s got %s", test.format, dis, test.hex, back.Hex())
+		}
+	}
+}
+
+func TestDisassemblerFlag(t *testing.T) {
+	tests := []struct {
+		format DisassembleFormat
+		flag   Flag
+		expect string
+	}{
+		{FormatBScript, ScriptVerifyTaproot, "OP_CHECKSIGADD OP_CHECKDATASIGVERIFY OP_SUBSTR OP_LEFT OP_RIGHT"},
+		{FormatBScript, ScriptEnableCheckDataSig | ScriptEnableMonolithOpcodes, "OP_CHECKDATASIG OP_CHECKDATASIGVERIFY OP_SPLIT OP_NUM2BIN OP_BIN2NUM"},
+		{FormatCoreAsm, ScriptEnableCheckDataSig, "OP_CHECKDATASIG OP_CHECKDATASIGVERIFY OP_SUBSTR OP_LEFT OP_RIGHT"},
+		{FormatBtcdAsm, ScriptEnableMonolithOpcodes, "OP_CHECKSIGADD OP_CHECKDATASIGVERIFY OP_SPLIT OP_NUM2BIN OP_BIN2NUM"},
+	}
+
+	for _, test := range tests {
+		script, _ := NewScriptFromHexString("babb7f8081")
+		disassembler := NewDisassemblerWithFormat(test.format)
+		disassembler.SetFlag(test.flag)
+
+		dis, err := disassembler.Disassemble(script, " ")
+		if err != nil || dis != test.expect {
+			t.Errorf("%s %s: expect %q got %q %v", test.format, test.flag, test.expect, dis, err)
+		}
+	}
+}
+
+func TestDisassemblerNotRepresentable(t *testing.T) {
+	tests := []struct {
+		format DisassembleFormat
+		hex    string
+	}{
+		// non-minimal pushes collapse in the asm formats
+		{FormatCoreAsm, "0105"},
+		{FormatCoreAsm, "4c00"},
+		{FormatBtcdAsm, "4c0101"},
+		// truncated push
+		{FormatBScript, "0301"},
+	}
+
+	for _, test := range tests {
+		script, err := NewScriptFromHexString(test.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewDisassemblerWithFormat(test.format).Disassemble(script, " "); err == nil {
+			t.Errorf("%s %s: expect error", test.format, test.hex)
+		}
+	}
+}
+
+func TestScriptDisassemble(t *testing.T) {
+	script, _ := NewScriptFromHexString("0102")
+	if dis, err := script.Disassemble(" "); err != nil || dis != "OP_PUSHBYTES_1 0x02" {
+		t.Errorf("expect OP_PUSHBYTES_1 0x02 got %q %v", dis, err)
+	}
+
+	script, _ = NewScriptFromHexString("0301")
+	if _, err := script.Disassemble(" "); err == nil {
+		t.Error("expect truncated push error")
+	}
+}
@@ -1,5 +1,12 @@
 package bscript
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 type Flag uint32
 
 const (
@@ -7,6 +14,8 @@ const (
 
 	// ScriptBip16 defines whether the bip16 threshold has passed and thus
 	// pay-to-script hash transactions will be fully validated.
+	//
+	// Deprecated: the interpreter ignores it, use ScriptVerifyP2SH.
 	ScriptBip16 Flag = 1 << iota
 
 	// ScriptSkipDisabledOPCode allows vm to execute all opcode
@@ -95,6 +104,31 @@ const (
 	ScriptEnableMonolithOpcodes
 
 	ScriptEnableTrace
+
+	// ScriptVerifyTaproot enables BIP341 and BIP342 validation of witness
+	// version 1 programs.
+	ScriptVerifyTaproot
+
+	// ScriptVerifyDiscourageUpgradableTaprootVersion makes script path
+	// spends of unknown leaf versions non-standard.
+	ScriptVerifyDiscourageUpgradableTaprootVersion
+
+	// ScriptVerifyDiscourageOPSuccess makes tapscripts containing OP_SUCCESSx
+	// non-standard.
+	ScriptVerifyDiscourageOPSuccess
+
+	// ScriptVerifyDiscourageUpgradablePubkeyType makes tapscript signature
+	// checks against unknown public key types non-standard.
+	ScriptVerifyDiscourageUpgradablePubkeyType
+
+	// ScriptEnableSchnorr enables the BCH 2019 Schnorr scheme: a 64 byte
+	// signature plus hash type in CHECKSIG is verified as Schnorr instead
+	// of DER encoded ECDSA.
+	ScriptEnableSchnorr
+
+	// ScriptEnableCheckDataSig enables the BCH OP_CHECKDATASIG and
+	// OP_CHECKDATASIGVERIFY opcodes outside of tapscript.
+	ScriptEnableCheckDataSig
 )
 
 func NewFlag() Flag {
@@ -109,3 +143,186 @@ func (f *Flag) Enable(mask Flag) Flag {
 func (f Flag) Has(mask Flag) bool {
 	return f&mask == mask
 }
+
+var (
+	ErrFlagUnknow   = errors.New("flag: unknow flag")
+	ErrFlagRequires = errors.New("flag: missing required flag")
+	ErrFlagConflict = errors.New("flag: conflicting flags")
+)
+
+// flagNames are the Bitcoin Core style names of the flags in bit order,
+// flags Core does not have are named after their Go identifier.
+var flagNames = []struct {
+	name string
+	flag Flag
+}{
+	{"BIP16", ScriptBip16},
+	{"SKIP_DISABLED_OPCODE", ScriptSkipDisabledOPCode},
+	{"STRICT_MULTISIG", ScriptStrictMultiSig},
+	{"DISCOURAGE_UPGRADABLE_NOPS", ScriptDiscourageUpgradableNops},
+	{"CHECKLOCKTIMEVERIFY", ScriptVerifyCheckLockTimeVerify},
+	{"CHECKSEQUENCEVERIFY", ScriptVerifyCheckSequenceVerify},
+	{"CLEANSTACK", ScriptVerifyCleanStack},
+	{"DERSIG", ScriptVerifyDERSignatures},
+	{"LOW_S", ScriptVerifyLowS},
+	{"MINIMALDATA", ScriptVerifyMinimalData},
+	{"NULLFAIL", ScriptVerifyNullFail},
+	{"NULLDUMMY", ScriptVerifyNullDummy},
+	{"SIGPUSHONLY", ScriptVerifySigPushOnly},
+	{"STRICTENC", ScriptVerifyStrictEncoding},
+	{"WITNESS", ScriptVerifyWitness},
+	{"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM", ScriptVerifyDiscourageUpgradeableWitnessProgram},
+	{"MINIMALIF", ScriptVerifyMinimalIf},
+	{"WITNESS_PUBKEYTYPE", ScriptVerifyWitnessPubKeyType},
+	{"P2SH", ScriptVerifyP2SH},
+	{"COMPRESSED_PUBKEYTYPE", ScriptVerifyCompressedPubkeyType},
+	{"SIGHASH_FORKID", ScriptEnableSigHashForkID},
+	{"REPLAY_PROTECTION", ScriptEnableReplayProtection},
+	{"MONOLITH_OPCODES", ScriptEnableMonolithOpcodes},
+	{"TRACE", ScriptEnableTrace},
+	{"TAPROOT", ScriptVerifyTaproot},
+	{"DISCOURAGE_UPGRADABLE_TAPROOT_VERSION", ScriptVerifyDiscourageUpgradableTaprootVersion},
+	{"DISCOURAGE_OP_SUCCESS", ScriptVerifyDiscourageOPSuccess},
+	{"DISCOURAGE_UPGRADABLE_PUBKEYTYPE", ScriptVerifyDiscourageUpgradablePubkeyType},
+	{"SCHNORR", ScriptEnableSchnorr},
+	{"CHECKDATASIG", ScriptEnableCheckDataSig},
+}
+
+// ParseFlag parses a comma separated list of flag names as String formats
+// them, such as "P2SH,STRICTENC,WITNESS". Names are case insensitive and
+// may carry Core's SCRIPT_VERIFY_ prefix.
+func ParseFlag(s string) (Flag, error) {
+	flag := NewFlag()
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SCRIPT_VERIFY_")
+		if len(name) == 0 || name == "NONE" {
+			continue
+		}
+
+		mask, ok := flagByName(name)
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", ErrFlagUnknow, name)
+		}
+		flag.Enable(mask)
+	}
+
+	return flag, nil
+}
+
+func flagByName(name string) (Flag, bool) {
+	for _, n := range flagNames {
+		if n.name == name {
+			return n.flag, true
+		}
+	}
+
+	return 0, false
+}
+
+// String formats f as a comma separated list of flag names, "NONE" when
+// empty. Bits without a name are formatted in hex.
+func (f Flag) String() string {
+	if f == ScriptVerifyNone {
+		return "NONE"
+	}
+
+	var names []string
+	for _, n := range flagNames {
+		if f.Has(n.flag) {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(f)))
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (f Flag) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *Flag) UnmarshalText(text []byte) error {
+	flag, err := ParseFlag(string(text))
+	if err != nil {
+		return err
+	}
+
+	*f = flag
+	return nil
+}
+
+// UnmarshalJSON accepts the numeric encoding too, as a JSON number.
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	var n uint32
+	if err := json.Unmarshal(data, &n); err == nil {
+		*f = Flag(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return f.UnmarshalText([]byte(s))
+}
+
+// flagRequires are flags which have no effect, or a broken one, without
+// others. CLEANSTACK needs WITNESS only where witnesses exist, which the
+// SIGHASH_FORKID chains do not.
+var flagRequires = []struct {
+	flag     Flag
+	requires Flag
+}{
+	{ScriptVerifyWitness, ScriptVerifyP2SH},
+	{ScriptVerifyCleanStack, ScriptVerifyP2SH},
+	{ScriptVerifyDiscourageUpgradeableWitnessProgram, ScriptVerifyWitness},
+	{ScriptVerifyWitnessPubKeyType, ScriptVerifyWitness},
+	{ScriptVerifyDiscourageUpgradableTaprootVersion, ScriptVerifyTaproot},
+	{ScriptVerifyDiscourageOPSuccess, ScriptVerifyTaproot},
+	{ScriptVerifyDiscourageUpgradablePubkeyType, ScriptVerifyTaproot},
+	{ScriptEnableReplayProtection, ScriptEnableSigHashForkID},
+}
+
+// flagConflicts are flags of different chains which interpret the same
+// scripts differently.
+var flagConflicts = []struct {
+	a, b Flag
+}{
+	{ScriptEnableSigHashForkID, ScriptVerifyWitness},
+}
+
+// Validate reports unknown bits and flag combinations which are illegal or
+// contradictory, such as CLEANSTACK without P2SH or the unused ScriptBip16
+// in place of ScriptVerifyP2SH.
+func (f Flag) Validate() error {
+	if f&1 != 0 {
+		return fmt.Errorf("%w: %#x", ErrFlagUnknow, uint32(1))
+	}
+
+	if f.Has(ScriptBip16) && !f.Has(ScriptVerifyP2SH) {
+		return fmt.Errorf("%w: BIP16 is not enforced, use P2SH", ErrFlagRequires)
+	}
+
+	if f.Has(ScriptVerifyCleanStack) && !f.Has(ScriptEnableSigHashForkID) && !f.Has(ScriptVerifyWitness) {
+		return fmt.Errorf("%w: CLEANSTACK requires WITNESS", ErrFlagRequires)
+	}
+
+	for _, r := range flagRequires {
+		if f.Has(r.flag) && f&r.requires == 0 {
+			return fmt.Errorf("%w: %s requires %s", ErrFlagRequires, r.flag, r.requires)
+		}
+	}
+
+	for _, c := range flagConflicts {
+		if f.Has(c.a) && f.Has(c.b) {
+			return fmt.Errorf("%w: %s and %s", ErrFlagConflict, c.a, c.b)
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package bscript
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/detailyang/go-bcore"
@@ -27,46 +29,6 @@ type TestBuilder struct {
 	spendTx  *bcore.Transaction
 }
 
-func NewCreditingTransaction(script *Script, value uint64) *bcore.Transaction {
-	var tx bcore.Transaction
-	tx.Version = 1
-	tx.Locktime = 0
-	tx.Inputs = make([]*bcore.TransactionInput, 1)
-	tx.Outputs = make([]*bcore.TransactionOutput, 1)
-	var input bcore.TransactionInput
-	var output bcore.TransactionOutput
-	input.PrevOutput = bcore.NewDefaultOutPoint()
-	input.ScriptSig = NewScript().PushNumber(0).PushNumber(0).Bytes()
-	input.Sequence = bcore.TransactionFinalSequence
-	output.ScriptPubkey = script.Bytes()
-	output.Value = value
-
-	tx.Inputs[0] = &input
-	tx.Outputs[0] = &output
-
-	return &tx
-}
-
-func NewSpendingTransaction(script *Script, creditTx *bcore.Transaction) *bcore.Transaction {
-	var tx bcore.Transaction
-	tx.Version = 1
-	tx.Locktime = 0
-	tx.Inputs = make([]*bcore.TransactionInput, 1)
-	tx.Outputs = make([]*bcore.TransactionOutput, 1)
-	var input bcore.TransactionInput
-	var output bcore.TransactionOutput
-	input.PrevOutput = bcore.NewOutPoint(creditTx.ID(), 0)
-	input.ScriptSig = script.Bytes()
-	input.Sequence = bcore.TransactionFinalSequence
-	output.ScriptPubkey = make([]byte, 0)
-	output.Value = creditTx.Outputs[0].Value
-
-	tx.Inputs[0] = &input
-	tx.Outputs[0] = &output
-
-	return &tx
-}
-
 func NewTestBuilder(script *Script, comment string, flag Flag, P2SH bool, amount uint64) *TestBuilder {
 	var redeemscript *Script
 	scriptPubkey := script
@@ -1229,3 +1191,100 @@ func TestScriptFlag(t *testing.T) {
 	}
 
 }
+
+func TestFlagString(t *testing.T) {
+	tests := []struct {
+		flag   Flag
+		expect string
+	}{
+		{ScriptVerifyNone, "NONE"},
+		{ScriptVerifyP2SH, "P2SH"},
+		{ScriptVerifyP2SH | ScriptVerifyStrictEncoding | ScriptVerifyWitness, "STRICTENC,WITNESS,P2SH"},
+		{ScriptEnableCheckDataSig | 1, "CHECKDATASIG,0x1"},
+	}
+
+	for _, test := range tests {
+		if s := test.flag.String(); s != test.expect {
+			t.Errorf("expect %s got %s", test.expect, s)
+		}
+	}
+
+	for _, n := range flagNames {
+		flag, err := ParseFlag(n.flag.String())
+		if err != nil || flag != n.flag {
+			t.Errorf("%s: expect round trip, got %d %v", n.name, flag, err)
+		}
+	}
+
+	flag, err := ParseFlag(" p2sh, SCRIPT_VERIFY_WITNESS ,NONE,")
+	if err != nil || flag != ScriptVerifyP2SH|ScriptVerifyWitness {
+		t.Errorf("expect P2SH,WITNESS got %s %v", flag, err)
+	}
+
+	if _, err := ParseFlag("P2SH,NOSUCHFLAG"); !errors.Is(err, ErrFlagUnknow) {
+		t.Errorf("expect unknow flag error, got %v", err)
+	}
+}
+
+func TestFlagJSON(t *testing.T) {
+	type config struct {
+		Flag Flag `json:"flag"`
+	}
+
+	data, err := json.Marshal(config{ScriptVerifyP2SH | ScriptVerifyWitness})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"flag":"WITNESS,P2SH"}` {
+		t.Errorf("unexpect %s", data)
+	}
+
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil || c.Flag != ScriptVerifyP2SH|ScriptVerifyWitness {
+		t.Errorf("expect round trip, got %s %v", c.Flag, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"flag":524288}`), &c); err != nil || c.Flag != ScriptVerifyP2SH {
+		t.Errorf("expect numeric flag, got %s %v", c.Flag, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"flag":"P2SH,BOGUS"}`), &c); !errors.Is(err, ErrFlagUnknow) {
+		t.Errorf("expect unknow flag error, got %v", err)
+	}
+}
+
+func TestFlagValidate(t *testing.T) {
+	tests := []struct {
+		flag   Flag
+		expect error
+	}{
+		{ScriptVerifyNone, nil},
+		{ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyCleanStack, nil},
+		{ScriptVerifyP2SH | ScriptEnableSigHashForkID | ScriptVerifyCleanStack, nil},
+		{ScriptVerifyCleanStack, ErrFlagRequires},
+		{ScriptVerifyP2SH | ScriptVerifyCleanStack, ErrFlagRequires},
+		{ScriptBip16, ErrFlagRequires},
+		{ScriptVerifyWitness, ErrFlagRequires},
+		{ScriptVerifyDiscourageOPSuccess, ErrFlagRequires},
+		{ScriptVerifyP2SH | ScriptVerifyWitness | ScriptEnableSigHashForkID, ErrFlagConflict},
+		{1, ErrFlagUnknow},
+	}
+
+	for _, test := range tests {
+		if err := test.flag.Validate(); !errors.Is(err, test.expect) {
+			t.Errorf("%s: expect %v got %v", test.flag, test.expect, err)
+		}
+	}
+
+	// the median time past stays before the end of the Bitcoin Cash profile
+	for name, chain := range Chains {
+		flag, err := chain.StandardFlags(2000000, 1550000000)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if err := flag.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -145,7 +145,7 @@ var instructionOperator = map[OPCode]Operator{
 	OP_PUSHDATA2:    instructionPushOPBytes,
 	OP_PUSHDATA4:    instructionPushOPBytes,
 	OP_1NEGATE:      instructionPushOPN,
-	OP_RESERVED:     instructionRESERVED,
+	OP_RESERVED:     instructionBADOPCODE,
 	OP_1:            instructionPushOPN,
 	OP_2:            instructionPushOPN,
 	OP_3:            instructionPushOPN,
@@ -164,16 +164,16 @@ var instructionOperator = map[OPCode]Operator{
 	OP_16:           instructionPushOPN,
 
 	// control
-	OP_NOP:      instructionRESERVED,
-	OP_VER:      instructionRESERVED,
+	OP_NOP:      instructionNOP,
+	OP_VER:      instructionBADOPCODE,
 	OP_IF:       instructionIF,
 	OP_NOTIF:    instructionIF,
-	OP_VERIF:    instructionRESERVED,
-	OP_VERNOTIF: instructionRESERVED,
+	OP_VERIF:    instructionBADOPCODE,
+	OP_VERNOTIF: instructionBADOPCODE,
 	OP_ELSE:     instructionELSE,
 	OP_ENDIF:    instructionENDIF,
 	OP_VERIFY:   instructionVERIFY,
-	OP_RETURN:   instructionRESERVED,
+	OP_RETURN:   instructionRETURN,
 
 	// stack ops
 	OP_TOALTSTACK:   instructionTOTALSTACK,
@@ -210,8 +210,8 @@ var instructionOperator = map[OPCode]Operator{
 	OP_XOR:         instructionBITOP,
 	OP_EQUAL:       instructionEQUAL,
 	OP_EQUALVERIFY: instructionEQUALVERIFY,
-	OP_RESERVED1:   instructionRESERVED,
-	OP_RESERVED2:   instructionRESERVED,
+	OP_RESERVED1:   instructionBADOPCODE,
+	OP_RESERVED2:   instructionBADOPCODE,
 
 	// numeric
 	OP_1ADD:      instructionUNARY,
@@ -255,23 +255,44 @@ var instructionOperator = map[OPCode]Operator{
 	OP_CHECKSIGVERIFY:      instructionCHECKSIG,
 	OP_CHECKMULTISIG:       instructionCHECKMULTISIG,
 	OP_CHECKMULTISIGVERIFY: instructionCHECKMULTISIG,
+	OP_CHECKSIGADD:         instructionCHECKSIGADD,
+	OP_CHECKDATASIGVERIFY:  instructionCHECKDATASIG,
 
 	// expansion
-	OP_NOP1:                instructionRESERVED,
+	OP_NOP1:                instructionUpgradableNOP,
 	OP_CHECKLOCKTIMEVERIFY: instructionCHECKLOCKTIMEVERIFY,
 	//OP_NOP2 = OP_CHECKLOCKTIMEVERIFY
 	OP_CHECKSEQUENCEVERIFY: instructionCHECKSEQUENCEVERIFY,
 
 	//OP_NOP3 = OP_CHECKSEQUENCEVERIFY
-	OP_NOP4:  instructionRESERVED,
-	OP_NOP5:  instructionRESERVED,
-	OP_NOP6:  instructionRESERVED,
-	OP_NOP7:  instructionRESERVED,
-	OP_NOP8:  instructionRESERVED,
-	OP_NOP9:  instructionRESERVED,
-	OP_NOP10: instructionRESERVED,
+	OP_NOP4:  instructionUpgradableNOP,
+	OP_NOP5:  instructionUpgradableNOP,
+	OP_NOP6:  instructionUpgradableNOP,
+	OP_NOP7:  instructionUpgradableNOP,
+	OP_NOP8:  instructionUpgradableNOP,
+	OP_NOP9:  instructionUpgradableNOP,
+	OP_NOP10: instructionUpgradableNOP,
 }
 
-func instructionRESERVED(ctx *InterpreterContext) error {
+func instructionNOP(ctx *InterpreterContext) error {
 	return nil
 }
+
+// instructionUpgradableNOP runs the NOPs left for soft forks.
+func instructionUpgradableNOP(ctx *InterpreterContext) error {
+	if ctx.flag.Has(ScriptDiscourageUpgradableNops) {
+		return ErrInterpreterDiscourageUpgradableNops
+	}
+
+	return nil
+}
+
+// instructionBADOPCODE fails the reserved opcodes once executed, they only
+// pass in an unexecuted branch.
+func instructionBADOPCODE(ctx *InterpreterContext) error {
+	return ErrInterpreterBadOPCode
+}
+
+func instructionRETURN(ctx *InterpreterContext) error {
+	return ErrInterpreterOPReturn
+}
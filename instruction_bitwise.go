@@ -38,29 +38,31 @@ func instructionINVERT(ctx *InterpreterContext) error {
 func instructionBITOP(ctx *InterpreterContext) error {
 	i := ctx.i
 	ins := ctx.ins
-	d1, err := i.dstack.Peek(-2)
-	if err != nil {
-		return err
-	}
-	d2, err := i.dstack.Peek(-1)
-	if err != nil {
-		return err
+	if i.dstack.Depth() < 2 {
+		return ErrInterpreterInvalidStackOperation
 	}
 
+	d1, _ := i.dstack.Peek(-2)
+	d2, _ := i.dstack.Peek(-1)
+
 	if d1.Size() != d2.Size() {
 		return ErrInterpreterOperandsSize
 	}
 
+	// operate on a copy, the element may be shared with a OP_DUP result
+	d0 := StackElemnt(copySlice(d1))
 	switch ins.OPCode {
 	case OP_AND:
-		d1.BitAnd(d2)
+		d0.BitAnd(d2)
 	case OP_OR:
-		d1.BitOr(d2)
+		d0.BitOr(d2)
 	case OP_XOR:
-		d1.BitXor(d2)
+		d0.BitXor(d2)
 	}
 
 	i.dstack.Pop()
+	i.dstack.Pop()
+	i.dstack.Push(d0)
 
 	return nil
 }
@@ -29,7 +29,17 @@ func instructionIF(ctx *InterpreterContext) error {
 	if !i.shouldSkip() {
 		d, err := i.dstack.Pop()
 		if err != nil {
-			return err
+			return ErrInterpreterUnbalancedConditional
+		}
+
+		if ctx.sigver == SignatureVersionTapscript ||
+			(ctx.sigver == SignatureVersionWitnessV0 && ctx.flag.Has(ScriptVerifyMinimalIf)) {
+			if d.Size() > 1 || (d.Size() == 1 && d[0] != 1) {
+				if ctx.sigver == SignatureVersionTapscript {
+					return ErrInterpreterTapscriptMinimalIf
+				}
+				return ErrInterpreterMinimalIf
+			}
 		}
 
 		b := d.Boolean()
@@ -19,6 +19,10 @@ func instructionRIPEMD160(ctx *InterpreterContext) error {
 		return err
 	}
 
+	if err := i.meter.hash(len(d.Bytes())); err != nil {
+		return err
+	}
+
 	hasher := ripemd160.New()
 	hasher.Write(d.Bytes())
 	hash := hasher.Sum(nil)
@@ -35,6 +39,10 @@ func instructionSHA1(ctx *InterpreterContext) error {
 		return err
 	}
 
+	if err := i.meter.hash(len(d.Bytes())); err != nil {
+		return err
+	}
+
 	hasher := sha1.New()
 	hasher.Write(d.Bytes())
 	hash := hasher.Sum(nil)
@@ -51,6 +59,10 @@ func instructionSHA256(ctx *InterpreterContext) error {
 		return err
 	}
 
+	if err := i.meter.hash(len(d.Bytes())); err != nil {
+		return err
+	}
+
 	hash := sha256.Sum256(d.Bytes())
 	i.dstack.Push(hash[:])
 
@@ -64,6 +76,10 @@ func instructionHASH160(ctx *InterpreterContext) error {
 		return err
 	}
 
+	if err := i.meter.hash(len(d.Bytes())); err != nil {
+		return err
+	}
+
 	hash := sha256.Sum256(d.Bytes())
 	hasher := ripemd160.New()
 	hasher.Write(hash[:])
@@ -80,6 +96,10 @@ func instructionHASH256(ctx *InterpreterContext) error {
 		return err
 	}
 
+	if err := i.meter.hash(len(d.Bytes())); err != nil {
+		return err
+	}
+
 	hash := sha256.Sum256(d.Bytes())
 	hash = sha256.Sum256(hash[:])
 	i.dstack.Push(hash[:])
@@ -89,6 +109,9 @@ func instructionHASH256(ctx *InterpreterContext) error {
 
 func instructionCODESEPARATOR(ctx *InterpreterContext) error {
 	i := ctx.i
-	i.codesep = i.pc
+	i.codesep = ctx.script.Pos
+	if i.execdata != nil {
+		i.execdata.CodeSeparatorPos = i.opcodePos
+	}
 	return nil
 }
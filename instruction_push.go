@@ -15,6 +15,31 @@ func instructionPushOP0(ctx *InterpreterContext) error {
 }
 
 func instructionPushOPBytes(ctx *InterpreterContext) error {
+	if ctx.flag.Has(ScriptVerifyMinimalData) && !isMinimalPush(ctx.ins.OPCode, ctx.ins.Data) {
+		return ErrInterpreterMinimalData
+	}
+
 	ctx.i.dstack.Push(ctx.ins.Data)
 	return nil
 }
+
+// isMinimalPush reports whether data is pushed with the smallest opcode,
+// as MINIMALDATA requires.
+func isMinimalPush(opcode OPCode, data []byte) bool {
+	switch {
+	case len(data) == 0:
+		return opcode == OP_0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return false
+	case len(data) == 1 && data[0] == 0x81:
+		return false
+	case len(data) <= 75:
+		return int(opcode) == len(data)
+	case len(data) <= 255:
+		return opcode == OP_PUSHDATA1
+	case len(data) <= 65535:
+		return opcode == OP_PUSHDATA2
+	}
+
+	return true
+}
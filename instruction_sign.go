@@ -18,15 +18,26 @@ func instructionCHECKSIG(ctx *InterpreterContext) error {
 
 	pubkey := d1.Bytes()
 	sig := d2.Bytes()
-	if len(sig) < 1 {
-		i.dstack.Push(Boolean(false).Bytes())
-		return nil
-	}
 
-	hashtype := sig[len(sig)-1]
+	if sigver == SignatureVersionTapscript {
+		success, err := evalChecksigTapscript(ctx, sig, pubkey)
+		if err != nil {
+			return err
+		}
 
-	if err := CheckHashTypeEncoding(hashtype, flag); err != nil {
-		return err
+		// tapscript makes MINIMALIF consensus, so false has to be the
+		// empty vector here
+		if success {
+			i.dstack.Push([]byte{1})
+		} else {
+			i.dstack.Push([]byte{})
+		}
+
+		if ctx.ins.OPCode == OP_CHECKSIGVERIFY {
+			return instructionVERIFY(ctx)
+		}
+
+		return nil
 	}
 
 	if err := CheckPubkeyEncoding(pubkey, flag); err != nil {
@@ -37,6 +48,15 @@ func instructionCHECKSIG(ctx *InterpreterContext) error {
 		return err
 	}
 
+	// an empty signature fails without hashing, CHECKSIGVERIFY included
+	if len(sig) < 1 {
+		i.dstack.Push(Number(0).Bytes())
+		if ctx.ins.OPCode == OP_CHECKSIGVERIFY {
+			return instructionVERIFY(ctx)
+		}
+		return nil
+	}
+
 	subscript, err := script.SubScript(i.codesep)
 	if err != nil {
 		return err
@@ -47,7 +67,13 @@ func instructionCHECKSIG(ctx *InterpreterContext) error {
 		subscript = subscript.Filter(sigscript)
 	}
 
-	if err := checker.CheckSignature(sig, pubkey, subscript, flag, sigver); err != nil {
+	hashed := hashedBytesOf(checker)
+	err = checker.CheckSignature(sig, pubkey, subscript, flag, sigver)
+	if err := i.meter.hashChecker(checker, hashed); err != nil {
+		return err
+	}
+
+	if err != nil {
 		if flag.Has(ScriptVerifyNullFail) && len(sig) > 0 {
 			return ErrInterpreterSignatureNullFail
 		}
@@ -63,6 +89,140 @@ func instructionCHECKSIG(ctx *InterpreterContext) error {
 	return nil
 }
 
+// instructionCHECKSIGADD is the tapscript replacement of CHECKMULTISIG: it
+// adds the result of a signature check to a counter, (sig n pubkey -- n+success).
+func instructionCHECKSIGADD(ctx *InterpreterContext) error {
+	i := ctx.i
+	if ctx.sigver != SignatureVersionTapscript {
+		return instructionCHECKDATASIG(ctx)
+	}
+
+	if i.dstack.Depth() < 3 {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	sig, _ := i.dstack.Peek(-3)
+	d, _ := i.dstack.Peek(-2)
+	pubkey, _ := i.dstack.Peek(-1)
+
+	n, err := d.Number(ctx.flag.Has(ScriptVerifyMinimalData), NumberDefaultElementSize)
+	if err != nil {
+		return err
+	}
+
+	success, err := evalChecksigTapscript(ctx, sig.Bytes(), pubkey.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if success {
+		n++
+	}
+
+	i.dstack.Pop()
+	i.dstack.Pop()
+	i.dstack.Pop()
+	if n == 0 {
+		i.dstack.Push([]byte{})
+	} else {
+		i.dstack.Push(n.Bytes())
+	}
+
+	return nil
+}
+
+// instructionCHECKDATASIG verifies a signature of an arbitrary message
+// instead of the spending transaction, (sig message pubkey -- success).
+func instructionCHECKDATASIG(ctx *InterpreterContext) error {
+	i := ctx.i
+	flag := ctx.flag
+	if !flag.Has(ScriptEnableCheckDataSig) || ctx.sigver == SignatureVersionTapscript {
+		return ErrInterpreterBadOPCode
+	}
+
+	if i.dstack.Depth() < 3 {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	d1, _ := i.dstack.Peek(-3)
+	d2, _ := i.dstack.Peek(-2)
+	d3, _ := i.dstack.Peek(-1)
+
+	sig := d1.Bytes()
+	message := d2.Bytes()
+	pubkey := d3.Bytes()
+
+	if err := CheckDataSignatureEncoding(sig, flag); err != nil {
+		return err
+	}
+
+	if err := CheckPubkeyEncoding(pubkey, flag); err != nil {
+		return err
+	}
+
+	success := len(sig) > 0 && ctx.checker.CheckDataSignature(sig, pubkey, message, flag) == nil
+	if !success && flag.Has(ScriptVerifyNullFail) && len(sig) > 0 {
+		return ErrInterpreterSignatureNullFail
+	}
+
+	i.dstack.Pop()
+	i.dstack.Pop()
+	i.dstack.Pop()
+
+	if ctx.ins.OPCode == OP_CHECKDATASIGVERIFY {
+		if !success {
+			return ErrInterpreterCheckDataSigVerify
+		}
+		return nil
+	}
+
+	if success {
+		i.dstack.Push([]byte{1})
+	} else {
+		i.dstack.Push([]byte{})
+	}
+
+	return nil
+}
+
+// evalChecksigTapscript applies the BIP342 signature rules and reports
+// whether the signature was non-empty, invalid signatures are errors.
+func evalChecksigTapscript(ctx *InterpreterContext, sig, pubkey []byte) (bool, error) {
+	execdata := ctx.i.execdata
+	success := len(sig) > 0
+
+	if success && execdata != nil {
+		execdata.ValidationWeightLeft -= ValidationWeightPerSigop
+		if execdata.ValidationWeightLeft < 0 {
+			return false, ErrInterpreterTapscriptValidationWeight
+		}
+	}
+
+	switch len(pubkey) {
+	case 0:
+		return false, ErrInterpreterTapscriptEmptyPubkey
+	case 32:
+		if success {
+			hashed := hashedBytesOf(ctx.checker)
+			err := ctx.checker.CheckSchnorrSignature(sig, pubkey, ctx.sigver, execdata)
+			if err := ctx.i.meter.hashChecker(ctx.checker, hashed); err != nil {
+				return false, err
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+	default:
+		// unknown public key types are reserved for soft forks and
+		// succeed unconditionally
+		if ctx.flag.Has(ScriptVerifyDiscourageUpgradablePubkeyType) {
+			return false, ErrInterpreterDiscourageUpgradablePubkeyType
+		}
+	}
+
+	return success, nil
+}
+
 // Compares the first signature against each public key until it finds an ECDSA match.
 // Starting with the subsequent public key, it compares the second signature against each remaining public key until it finds an ECDSA match.
 // The process is repeated until all signatures have been checked or not enough public keys remain to produce a successful result.
@@ -70,6 +230,10 @@ func instructionCHECKSIG(ctx *InterpreterContext) error {
 // signatures must be placed in the scriptSig using the same order as their corresponding public keys were placed in the scriptPubKey or redeemScript.
 // If all signatures are valid, 1 is returned, 0 otherwise. Due to a bug, one extra unused value is removed from the stack.
 func instructionCHECKMULTISIG(ctx *InterpreterContext) error {
+	if ctx.sigver == SignatureVersionTapscript {
+		return ErrInterpreterTapscriptCheckMultisig
+	}
+
 	d, err := ctx.i.dstack.Pop()
 	if err != nil {
 		return err
@@ -80,8 +244,14 @@ func instructionCHECKMULTISIG(ctx *InterpreterContext) error {
 		return err
 	}
 
-	if n <= 0 || n > MaxInterpreterScriptPubekyesPerMultisig {
-		return ErrInterpreterBadInstruction
+	if n < 0 || int64(n) > int64(ctx.i.limits.MaxPubkeysPerMultisig) {
+		return ErrInterpreterScriptPubekyesPerMultisig
+	}
+
+	// every public key counts against the opcode limit
+	ctx.i.nop += int(n)
+	if ctx.i.nop > ctx.i.limits.MaxOps {
+		return ErrInterpreterScriptOPCount
 	}
 
 	keys := make([][]byte, n)
@@ -104,8 +274,8 @@ func instructionCHECKMULTISIG(ctx *InterpreterContext) error {
 		return err
 	}
 
-	if n == 0 {
-		return ErrInterpreterBadInstruction
+	if n < 0 || int(n) > len(keys) {
+		return ErrInterpreterScriptSigCount
 	}
 
 	sigs := make([][]byte, n)
@@ -137,7 +307,7 @@ func instructionCHECKMULTISIG(ctx *InterpreterContext) error {
 		key := keys[k]
 		sig := sigs[s]
 
-		if err := CheckSignatureEncoding(sig, ctx.flag, ctx.sigver); err != nil {
+		if err := CheckECDSASignatureEncoding(sig, ctx.flag, ctx.sigver); err != nil {
 			return err
 		}
 
@@ -145,7 +315,11 @@ func instructionCHECKMULTISIG(ctx *InterpreterContext) error {
 			return err
 		}
 
+		hashed := hashedBytesOf(ctx.checker)
 		err := ctx.checker.CheckSignature(sig, key, subscript, ctx.flag, ctx.sigver)
+		if err := ctx.i.meter.hashChecker(ctx.checker, hashed); err != nil {
+			return err
+		}
 		if err == nil {
 			s += 1
 		}
@@ -154,19 +328,23 @@ func instructionCHECKMULTISIG(ctx *InterpreterContext) error {
 		success = len(sigs)-s <= len(keys)-k
 	}
 
-	if ctx.i.dstack.Depth() > 0 && ctx.flag.Has(ScriptVerifyNullFail) {
-		return ErrInterpreterSignatureNullFail
+	// NULLFAIL requires every signature of a failed check to be empty
+	if !success && ctx.flag.Has(ScriptVerifyNullFail) {
+		for _, sig := range sigs {
+			if len(sig) > 0 {
+				return ErrInterpreterSignatureNullFail
+			}
+		}
 	}
 
 	if ctx.i.dstack.Depth() < 1 {
 		return ErrInterpreterInvalidStackOperation
 	}
 
-	if ctx.flag.Has(ScriptVerifyNullDummy) {
-		d, _ = ctx.i.dstack.Peek(-1)
-		if d.Size() > 0 {
-			return ErrInterpreterSignatureNullDummy
-		}
+	// the extra item CHECKMULTISIG pops due to the original off by one
+	d, _ = ctx.i.dstack.Pop()
+	if ctx.flag.Has(ScriptVerifyNullDummy) && d.Size() > 0 {
+		return ErrInterpreterSignatureNullDummy
 	}
 
 	if success {
@@ -188,7 +366,8 @@ func instructionCHECKLOCKTIMEVERIFY(ctx *InterpreterContext) error {
 	checker := ctx.checker
 
 	if flag.Has(ScriptVerifyCheckLockTimeVerify) {
-		d, err := i.dstack.Pop()
+		// the operand stays on the stack, scripts drop it themselves
+		d, err := i.dstack.Peek(-1)
 		if err != nil {
 			return err
 		}
@@ -219,7 +398,7 @@ func instructionCHECKSEQUENCEVERIFY(ctx *InterpreterContext) error {
 	checker := ctx.checker
 
 	if flag.Has(ScriptVerifyCheckSequenceVerify) {
-		d, err := i.dstack.Pop()
+		d, err := i.dstack.Peek(-1)
 		if err != nil {
 			return err
 		}
@@ -233,7 +412,8 @@ func instructionCHECKSEQUENCEVERIFY(ctx *InterpreterContext) error {
 			return ErrInterpreterNegativeLocktime
 		}
 
-		if sequence&SequenceLockTimeDisabledFlag == SequenceLockTimeDisabledFlag {
+		// the disable flag turns CHECKSEQUENCEVERIFY into a NOP
+		if sequence&SequenceLockTimeDisabledFlag == 0 {
 			if err := checker.CheckSequence(uint32(sequence)); err != nil {
 				return ErrInterpreterUnsatisfiedLocktime
 			}
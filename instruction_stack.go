@@ -13,7 +13,7 @@ func instructionTOTALSTACK(ctx *InterpreterContext) error {
 func instructionFROMALTSTACK(ctx *InterpreterContext) error {
 	data, err := ctx.i.astack.Pop()
 	if err != nil {
-		return err
+		return ErrInterpreterInvalidAltstackOperation
 	}
 	ctx.i.dstack.Push(data)
 
@@ -113,7 +113,7 @@ func instruction2SWAP(ctx *InterpreterContext) error {
 }
 
 func instructionIFDUP(ctx *InterpreterContext) error {
-	d, err := ctx.i.dstack.Peek(0)
+	d, err := ctx.i.dstack.Peek(-1)
 	if err != nil {
 		return err
 	}
@@ -204,10 +204,10 @@ func instructionSWAP(ctx *InterpreterContext) error {
 }
 
 func instructionTUCK(ctx *InterpreterContext) error {
-	d2, err := ctx.i.dstack.Peek(-2)
+	d, err := ctx.i.dstack.Peek(-1)
 	if err != nil {
 		return err
 	}
 
-	return ctx.i.dstack.InsertBefore(-2, d2)
+	return ctx.i.dstack.InsertBefore(-2, d)
 }
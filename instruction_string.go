@@ -1,32 +1,220 @@
 package bscript
 
 func instructionCAT(ctx *InterpreterContext) error {
-	d1, err := ctx.i.dstack.Peek(-2)
+	i := ctx.i
+	if i.dstack.Depth() < 2 {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	d2, _ := i.dstack.Pop()
+	d1, _ := i.dstack.Pop()
+
+	if d1.Size()+d2.Size() > i.limits.MaxElementSize {
+		return ErrInterpreterPushSize
+	}
+
+	if err := i.reserve(d1.Size() + d2.Size()); err != nil {
+		return err
+	}
+
+	i.dstack.Push(d1.Cat(d2))
+
+	return nil
+}
+
+// instructionSUBSTR is OP_SPLIT once the monolith opcodes are enabled.
+func instructionSUBSTR(ctx *InterpreterContext) error {
+	if ctx.flag.Has(ScriptEnableMonolithOpcodes) {
+		return instructionSPLIT(ctx)
+	}
+
+	i := ctx.i
+	if i.dstack.Depth() < 3 {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	required := ctx.flag.Has(ScriptVerifyMinimalData)
+	d1, _ := i.dstack.Peek(-2)
+	d2, _ := i.dstack.Peek(-1)
+
+	begin, err := d1.Number(required, NumberDefaultElementSize)
 	if err != nil {
 		return err
 	}
 
-	d2, err := ctx.i.dstack.Peek(-1)
+	size, err := d2.Number(required, NumberDefaultElementSize)
 	if err != nil {
 		return err
 	}
 
-	d1.Cat(d2)
+	end := begin + size
+	if begin < 0 || end < begin {
+		return ErrInterpreterInvalidSplitRange
+	}
 
-	ctx.i.dstack.Pop()
+	i.dstack.Pop()
+	i.dstack.Pop()
+	d, _ := i.dstack.Pop()
 
-	return nil
-}
+	if begin > Number(d.Size()) {
+		begin = Number(d.Size())
+	}
+	if end > Number(d.Size()) {
+		end = Number(d.Size())
+	}
+
+	i.dstack.Push(copySlice(d[begin:end]))
 
-func instructionSUBSTR(ctx *InterpreterContext) error {
 	return nil
 }
 
+// instructionLEFT is OP_NUM2BIN once the monolith opcodes are enabled.
 func instructionLEFT(ctx *InterpreterContext) error {
+	if ctx.flag.Has(ScriptEnableMonolithOpcodes) {
+		return instructionNUM2BIN(ctx)
+	}
+
+	d, size, err := popSpliceOperands(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.i.dstack.Push(copySlice(d[:size]))
+
 	return nil
 }
 
+// instructionRIGHT is OP_BIN2NUM once the monolith opcodes are enabled.
 func instructionRIGHT(ctx *InterpreterContext) error {
+	if ctx.flag.Has(ScriptEnableMonolithOpcodes) {
+		return instructionBIN2NUM(ctx)
+	}
+
+	d, size, err := popSpliceOperands(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.i.dstack.Push(copySlice(d[d.Size()-size:]))
+
+	return nil
+}
+
+// popSpliceOperands pops the (in size) operands of OP_LEFT and OP_RIGHT,
+// clamping size to the length of in.
+func popSpliceOperands(ctx *InterpreterContext) (StackElemnt, int, error) {
+	i := ctx.i
+	if i.dstack.Depth() < 2 {
+		return nil, 0, ErrInterpreterInvalidStackOperation
+	}
+
+	top, _ := i.dstack.Peek(-1)
+	n, err := top.Number(ctx.flag.Has(ScriptVerifyMinimalData), NumberDefaultElementSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if n < 0 {
+		return nil, 0, ErrInterpreterInvalidSplitRange
+	}
+
+	i.dstack.Pop()
+	d, _ := i.dstack.Pop()
+
+	size := int(n)
+	if size > d.Size() {
+		size = d.Size()
+	}
+
+	return d, size, nil
+}
+
+func instructionSPLIT(ctx *InterpreterContext) error {
+	i := ctx.i
+	if i.dstack.Depth() < 2 {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	top, _ := i.dstack.Peek(-1)
+	n, err := top.Number(ctx.flag.Has(ScriptVerifyMinimalData), NumberDefaultElementSize)
+	if err != nil {
+		return err
+	}
+
+	d, _ := i.dstack.Peek(-2)
+	if n < 0 || int(n) > d.Size() {
+		return ErrInterpreterInvalidSplitRange
+	}
+
+	i.dstack.Pop()
+	i.dstack.Pop()
+	i.dstack.Push(copySlice(d[:n]))
+	i.dstack.Push(copySlice(d[n:]))
+
+	return nil
+}
+
+func instructionNUM2BIN(ctx *InterpreterContext) error {
+	i := ctx.i
+	if i.dstack.Depth() < 2 {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	top, _ := i.dstack.Peek(-1)
+	n, err := top.Number(ctx.flag.Has(ScriptVerifyMinimalData), NumberDefaultElementSize)
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || int64(n) > int64(i.limits.MaxElementSize) {
+		return ErrInterpreterPushSize
+	}
+
+	i.dstack.Pop()
+	d, _ := i.dstack.Pop()
+
+	size := int(n)
+	if err := i.reserve(size); err != nil {
+		return err
+	}
+
+	raw := minimallyEncode(d)
+	if len(raw) > size {
+		return ErrInterpreterImpossibleEncoding
+	}
+
+	if len(raw) < size {
+		var signbit byte
+		if len(raw) > 0 {
+			signbit = raw[len(raw)-1] & 0x80
+			raw[len(raw)-1] &= 0x7f
+		}
+
+		for len(raw) < size-1 {
+			raw = append(raw, 0x00)
+		}
+		raw = append(raw, signbit)
+	}
+
+	i.dstack.Push(raw)
+
+	return nil
+}
+
+func instructionBIN2NUM(ctx *InterpreterContext) error {
+	i := ctx.i
+	d, err := i.dstack.Pop()
+	if err != nil {
+		return ErrInterpreterInvalidStackOperation
+	}
+
+	raw := minimallyEncode(d)
+	if len(raw) > NumberDefaultElementSize {
+		return ErrInterpreterInvalidNumberRange
+	}
+
+	i.dstack.Push(raw)
+
 	return nil
 }
 
@@ -2,18 +2,18 @@ package bscript
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"os"
 	"text/tabwriter"
-
-	. "github.com/detailyang/go-bprimitives"
 )
 
 var (
-	ErrInterpreterScriptSize                         = errors.New("interpreter: over script size 1000")
-	ErrInterpreterScriptOPCount                      = errors.New("interpreter: over script op count 210")
+	ErrInterpreterScriptSize                         = errors.New("interpreter: over script size limit")
+	ErrInterpreterScriptOPCount                      = errors.New("interpreter: over script op count limit")
 	ErrInterpreterInvalidStackOperation              = errors.New("interpreter: invalid stack operation")
+	ErrInterpreterInvalidAltstackOperation           = errors.New("interpreter: invalid altstack operation")
 	ErrInterpreterOperandsSize                       = errors.New("interpreter: operands size are not equal")
 	ErrInterpreterVerifyFailed                       = errors.New("interpreter: verify failed")
 	ErrInterpreterDivZero                            = errors.New("interpreter: div zero")
@@ -24,6 +24,7 @@ var (
 	ErrInterpreterBadOPCode                          = errors.New("interpreter: bad opcode")
 	ErrInterpreterIllegalOPCode                      = errors.New("interpreter: illegal opcode")
 	ErrInterpreterStackOverflow                      = errors.New("interpreter: data stack overflow")
+	ErrInterpreterStackMemory                        = errors.New("interpreter: stack memory exceeded")
 	ErrInterpreterUnbalancedConditional              = errors.New("interpreter: unbalanced conditional")
 	ErrInterpreterDisabledOPCode                     = errors.New("interpreter: disabled opcode")
 	ErrInterpreterNegativeLocktime                   = errors.New("interpreter: negative locktime")
@@ -43,6 +44,7 @@ var (
 	ErrInterpreterCleanStack                         = errors.New("interpreter: clean stack")
 	ErrInterpreterWitnessUnexpected                  = errors.New("interpreter: wintess unexpected")
 	ErrInterpreterScriptPubekyesPerMultisig          = errors.New("interpreter: too many multisig")
+	ErrInterpreterScriptSigCount                     = errors.New("interpreter: bad multisig signature count")
 	ErrInterpreterSignatureNullDummy                 = errors.New("interpreter: siganture null dummy")
 	ErrInterpreterBadSignatureDer                    = errors.New("interpreter: bad signature der format")
 	ErrInterpreterSigantureHighS                     = errors.New("interpreter: signature invalid high s")
@@ -52,21 +54,49 @@ var (
 	ErrInterpreterSignatureNullFail                  = errors.New("interpreter: null fail siganture")
 	ErrInterpreterIllegalForkId                      = errors.New("interpreter: illegal forkid")
 	ErrInterpreterMustUseForkId                      = errors.New("interpreter: must use forkid")
+	ErrInterpreterInvalidSplitRange                  = errors.New("interpreter: invalid split range")
+	ErrInterpreterInvalidNumberRange                 = errors.New("interpreter: invalid number range")
+	ErrInterpreterImpossibleEncoding                 = errors.New("interpreter: impossible encoding")
+	ErrInterpreterMinimalIf                          = errors.New("interpreter: non minimal if")
+	ErrInterpreterMinimalData                        = errors.New("interpreter: non minimal push")
+	ErrInterpreterOPReturn                           = errors.New("interpreter: op return")
+	ErrInterpreterSchnorrSig                         = errors.New("interpreter: invalid schnorr signature")
+	ErrInterpreterSchnorrSigSize                     = errors.New("interpreter: invalid schnorr signature size")
+	ErrInterpreterSchnorrSigHashType                 = errors.New("interpreter: invalid schnorr signature hash type")
+	ErrInterpreterTaprootWrongControlSize            = errors.New("interpreter: taproot wrong control block size")
+	ErrInterpreterTapscriptValidationWeight          = errors.New("interpreter: tapscript validation weight exceeded")
+	ErrInterpreterTapscriptCheckMultisig             = errors.New("interpreter: tapscript checkmultisig disabled")
+	ErrInterpreterTapscriptMinimalIf                 = errors.New("interpreter: tapscript non minimal if")
+	ErrInterpreterTapscriptEmptyPubkey               = errors.New("interpreter: tapscript empty public key")
+	ErrInterpreterDiscourageOPSuccess                = errors.New("interpreter: discourage op success")
+	ErrInterpreterDiscourageUpgradableTaprootVersion = errors.New("interpreter: discourage upgradable taproot version")
+	ErrInterpreterDiscourageUpgradablePubkeyType     = errors.New("interpreter: discourage upgradable pubkey type")
+	ErrInterpreterSignatureBadLength                 = errors.New("interpreter: schnorr signature in checkmultisig")
+	ErrInterpreterCheckDataSigVerify                 = errors.New("interpreter: checkdatasigverify failed")
 )
 
+// Deprecated: the interpreter enforces a Limits, these are the values of
+// LimitsBitcoin.
 const (
-	MaxInterpreterScriptSize                = 1000
-	MaxInterpreterScriptOPS                 = 210
+	MaxInterpreterScriptSize                = 10000
+	MaxInterpreterScriptOPS                 = 201
 	MaxInterpreterScriptPubekyesPerMultisig = 20
+	MaxInterpreterScriptElementSize         = 520
+	MaxInterpreterStackSize                 = 1000
 )
 
 type Interpreter struct {
-	dstack  *Stack
-	astack  *Stack
-	cstack  []int
-	pc      int
-	codesep int
-	traces  []Trace
+	dstack    *Stack
+	astack    *Stack
+	cstack    []int
+	pc        int
+	codesep   int
+	opcodePos uint32
+	nop       int
+	execdata  *ScriptExecutionData
+	traces    []Trace
+	limits    Limits
+	meter     *executionMeter
 }
 
 type InterpreterContext struct {
@@ -101,59 +131,156 @@ func verifyWitnessProgramm(
 	wintessProgram []byte,
 	flag Flag,
 	checker Checker,
+	isP2SH bool,
+	parent *Interpreter,
 ) error {
-	if witnessVersion != 0 {
-		if flag.Has(ScriptVerifyDiscourageUpgradeableWitnessProgram) {
-			return ErrInterpreterDiscourageUpgradableWitnessProgram
-		}
-
-		return nil
-	}
-
 	witnessStack := NewStack()
 	scriptPubkey := NewScript()
 
-	if len(wintessProgram) == 32 {
-		if scriptWitness.Size() == 0 {
-			return ErrInterpreterWitnessProgramWitnessEmpty
-		}
+	if witnessVersion == 0 {
+		if len(wintessProgram) == 32 {
+			if scriptWitness.Size() == 0 {
+				return ErrInterpreterWitnessProgramWitnessEmpty
+			}
+
+			script := scriptWitness[scriptWitness.Size()-1]
+			scriptPubkeyHash := sha256.Sum256(script)
+
+			if !bytes.Equal(scriptPubkeyHash[:], wintessProgram) {
+				return ErrInterpreterWitnessProgramMismatch
+			}
+
+			for _, s := range scriptWitness[:scriptWitness.Size()-1] {
+				witnessStack.Push(copySlice(s))
+			}
 
-		pubkey := scriptWitness[scriptWitness.Size()-1]
-		stack := scriptWitness[:scriptWitness.Size()-1]
-		scriptPubkeyHash := Hash256(scriptPubkey.Bytes())
+			scriptPubkey.PushBytes(script)
 
-		if !scriptPubkeyHash.Equal(NewHash(wintessProgram[0:32])) {
-			return ErrInterpreterWitnessProgramMismatch
+		} else if len(wintessProgram) == 20 {
+			if scriptWitness.Size() != 2 {
+				return ErrInterpreterWitnessProgramMismatch
+			}
+
+			// the program is a 20 byte pubkey hash, which cannot fail
+			scriptPubkey, _ = NewPayToPubkeyHashScript(wintessProgram)
+
+			for _, s := range scriptWitness {
+				witnessStack.Push(copySlice(s))
+			}
+		} else {
+			return ErrInterpreterWitnessProgramWrongLength
 		}
 
-		for _, s := range stack {
-			witnessStack.Push(copySlice(s))
+		return executeWitnessScript(witnessStack, scriptPubkey, flag, checker, SignatureVersionWitnessV0, nil, parent)
+	}
+
+	if witnessVersion == 1 && len(wintessProgram) == 32 && !isP2SH {
+		if !flag.Has(ScriptVerifyTaproot) {
+			return nil
 		}
 
-		scriptPubkey.PushBytes(pubkey)
+		return verifyTaprootProgram(scriptWitness, wintessProgram, flag, checker, parent)
+	}
+
+	if flag.Has(ScriptVerifyDiscourageUpgradeableWitnessProgram) {
+		return ErrInterpreterDiscourageUpgradableWitnessProgram
+	}
+
+	return nil
+}
+
+// verifyTaprootProgram spends a witness v1 output by key path when a single
+// element (besides the annex) is left, by script path otherwise.
+func verifyTaprootProgram(scriptWitness ScriptWitness, program []byte, flag Flag, checker Checker, parent *Interpreter) error {
+	if scriptWitness.Size() == 0 {
+		return ErrInterpreterWitnessProgramWitnessEmpty
+	}
+
+	execdata := NewScriptExecutionData()
+	stack := scriptWitness
+
+	if len(stack) >= 2 && len(stack[len(stack)-1]) > 0 && stack[len(stack)-1][0] == TaprootAnnexTag {
+		execdata.AnnexPresent = true
+		execdata.AnnexHash = computeAnnexHash(stack[len(stack)-1])
+		stack = stack[:len(stack)-1]
+	}
+
+	if len(stack) == 1 {
+		return checker.CheckSchnorrSignature(stack[0], program, SignatureVersionTaproot, execdata)
+	}
+
+	control := stack[len(stack)-1]
+	script := stack[len(stack)-2]
+	stack = stack[:len(stack)-2]
 
-	} else if len(wintessProgram) == 20 {
-		if scriptWitness.Size() != 2 {
-			return ErrInterpreterWitnessProgramMismatch
+	cb, err := NewTaprootControlBlock(control)
+	if err != nil {
+		return ErrInterpreterTaprootWrongControlSize
+	}
+
+	execdata.TapleafHash = ComputeTapleafHash(cb.LeafVersion, script)
+	if !cb.VerifyCommitment(program, execdata.TapleafHash) {
+		return ErrInterpreterWitnessProgramMismatch
+	}
+
+	if cb.LeafVersion != TaprootLeafTapscript {
+		if flag.Has(ScriptVerifyDiscourageUpgradableTaprootVersion) {
+			return ErrInterpreterDiscourageUpgradableTaprootVersion
 		}
 
-		scriptPubkey.
-			PushOPCode(OP_DUP).
-			PushOPCode(OP_HASH160).
-			PushBytesWithOP(wintessProgram).
-			PushOPCode(OP_EQUALVERIFY).
-			PushOPCode(OP_CHECKSIG)
+		return nil
+	}
+
+	execdata.ValidationWeightLeft = int64(len(scriptWitness.Bytes())) + ValidationWeightOffset
+
+	witnessStack := NewStack()
+	for _, s := range stack {
+		witnessStack.Push(copySlice(s))
+	}
+
+	return executeWitnessScript(witnessStack, NewScriptFromBytes(script), flag, checker, SignatureVersionTapscript, execdata, parent)
+}
+
+func executeWitnessScript(
+	witnessStack *Stack,
+	script *Script,
+	flag Flag,
+	checker Checker,
+	sigversion SignatureVersion,
+	execdata *ScriptExecutionData,
+	parent *Interpreter,
+) error {
+	if sigversion == SignatureVersionTapscript {
+		// OP_SUCCESSx anywhere in the script makes it valid before
+		// anything is executed, a parse failure makes it invalid. Most
+		// of them are undefined bytes, which Next hands over as opcodes
+		// and which fail elsewhere once executed.
+		for {
+			ins, err := script.Next()
+			if err != nil {
+				if err == ErrScriptEOF {
+					break
+				}
+				return ErrInterpreterBadOPCode
+			}
+
+			if IsOPSuccess(ins.OPCode) {
+				if flag.Has(ScriptVerifyDiscourageOPSuccess) {
+					return ErrInterpreterDiscourageOPSuccess
+				}
+				return nil
+			}
+		}
+		script.Reset()
 
-		for _, s := range scriptWitness {
-			witnessStack.Push(copySlice(s))
+		if witnessStack.Depth() > parent.limits.MaxStackSize {
+			return ErrInterpreterStackOverflow
 		}
-	} else {
-		return ErrInterpreterWitnessProgramWrongLength
 	}
 
 	ok := true
 	witnessStack.Iter(func(e StackElemnt) {
-		if len(e.Bytes()) > MaxInterpreterScriptSize {
+		if len(e.Bytes()) > parent.limits.MaxElementSize {
 			ok = false
 		}
 	})
@@ -164,18 +291,26 @@ func verifyWitnessProgramm(
 
 	interpreter := NewInterpreter()
 	interpreter.SetDStack(witnessStack)
-	err := interpreter.Eval(scriptPubkey, flag, checker, SignatureVersionWitnessV0)
+	interpreter.SetExecutionData(execdata)
+	interpreter.limits = parent.limits
+	interpreter.meter = parent.meter
+	err := interpreter.Eval(script, flag, checker, sigversion)
 	if err != nil {
 		return err
 	}
 
+	// Scripts inside witness implicitly require cleanstack behaviour
+	if witnessStack.Depth() != 1 {
+		return ErrInterpreterCleanStack
+	}
+
 	d, err := witnessStack.Peek(-1)
 	if err != nil {
 		return err
 	}
 
 	if !d.Boolean() {
-		return ErrInterpreterWitnessVerifyFailed
+		return ErrInterpreterEvalFalse
 	}
 
 	return nil
@@ -187,11 +322,17 @@ func EvalScript(script *Script, flag Flag, checker Checker) error {
 }
 
 func VerifyScript(scriptSig, scriptPubkey *Script, scriptWitness ScriptWitness, flag Flag, checker Checker, sigversion SignatureVersion) error {
+	return NewInterpreter().Verify(scriptSig, scriptPubkey, scriptWitness, flag, checker, sigversion)
+}
+
+// Verify is VerifyScript under the limits and context of i, which must not
+// have evaluated anything yet.
+func (i *Interpreter) Verify(scriptSig, scriptPubkey *Script, scriptWitness ScriptWitness, flag Flag, checker Checker, sigversion SignatureVersion) error {
 	if flag.Has(ScriptVerifySigPushOnly) && !scriptSig.IsPushOnly() {
 		return ErrInterpreterSignaturePushOnly
 	}
 
-	interpreter := NewInterpreter()
+	interpreter := i
 	stack := NewStack()
 	interpreter.SetDStack(stack)
 	stackCopy := NewStack()
@@ -229,22 +370,27 @@ func VerifyScript(scriptSig, scriptPubkey *Script, scriptWitness ScriptWitness,
 
 	// Verify witness program
 	if flag.Has(ScriptVerifyWitness) {
-		witnessVersion, witnessProgram, ok := scriptPubkey.ParseWitnessProgram()
-		if !ok {
-			return ErrInterpreterWitnessMalleated
-		}
+		if witnessVersion, witnessProgram, ok := scriptPubkey.ParseWitnessProgram(); ok {
+			// The scriptSig must be _exactly_ empty, otherwise we
+			// reintroduce malleability.
+			if scriptSig.Size() != 0 {
+				return ErrInterpreterWitnessMalleated
+			}
 
-		hadWitness = true
-		cleanStack = false
+			hadWitness = true
+			cleanStack = false
 
-		err = verifyWitnessProgramm(
-			scriptWitness,
-			witnessVersion,
-			witnessProgram,
-			flag,
-			checker)
-		if err != nil {
-			return err
+			err = verifyWitnessProgramm(
+				scriptWitness,
+				witnessVersion,
+				witnessProgram,
+				flag,
+				checker,
+				false,
+				interpreter)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -287,27 +433,25 @@ func VerifyScript(scriptSig, scriptPubkey *Script, scriptWitness ScriptWitness,
 		}
 
 		if flag.Has(ScriptVerifyWitness) {
-			witnessVersion, witnessProgram, ok := pubkey.ParseWitnessProgram()
-			if !ok {
-				return ErrInterpreterParseWitnessFailed
-			}
-
-			if !bytes.Equal(scriptSig.Bytes(), NewScript().PushBytesWithOP(pubkey.Bytes()).Bytes()) {
-				return ErrInterpreterWitnessMalleatedP2SH
+			if witnessVersion, witnessProgram, ok := pubkey.ParseWitnessProgram(); ok {
+				if !bytes.Equal(scriptSig.Bytes(), NewScript().PushBytesWithOP(pubkey.Bytes()).Bytes()) {
+					return ErrInterpreterWitnessMalleatedP2SH
+				}
+
+				hadWitness = true
+				cleanStack = false
+				err = verifyWitnessProgramm(
+					scriptWitness,
+					witnessVersion,
+					witnessProgram,
+					flag,
+					checker,
+					true,
+					interpreter)
+				if err != nil {
+					return err
+				}
 			}
-
-			hadWitness = true
-			cleanStack = false
-			err = verifyWitnessProgramm(
-				scriptWitness,
-				witnessVersion,
-				witnessProgram,
-				flag,
-				checker)
-			if err != nil {
-				return err
-			}
-
 		}
 	}
 
@@ -321,7 +465,7 @@ func VerifyScript(scriptSig, scriptPubkey *Script, scriptWitness ScriptWitness,
 	}
 
 	if flag.Has(ScriptVerifyWitness) {
-		if !hadWitness && scriptWitness.Size() == 0 {
+		if !hadWitness && scriptWitness.Size() != 0 {
 			return ErrInterpreterWitnessUnexpected
 		}
 	}
@@ -336,6 +480,7 @@ func NewInterpreter() *Interpreter {
 		cstack:  make([]int, 0, 128),
 		pc:      0,
 		codesep: 0,
+		limits:  DefaultLimits(),
 	}
 }
 
@@ -347,14 +492,25 @@ func (i *Interpreter) GetDStack() *Stack {
 	return i.dstack
 }
 
+// SetExecutionData sets the taproot state used by tapscript evaluation.
+func (i *Interpreter) SetExecutionData(execdata *ScriptExecutionData) {
+	i.execdata = execdata
+}
+
 func (i *Interpreter) Eval(script *Script, flag Flag, checker Checker, sigversion SignatureVersion) error {
-	if script.Size() > MaxInterpreterScriptSize {
+	// tapscript has no script size and opcode limits, signature checks
+	// are bounded by the validation weight instead
+	tapscript := sigversion == SignatureVersionTapscript
+
+	if !tapscript && script.Size() > i.limits.MaxScriptSize {
 		return ErrInterpreterScriptSize
 	}
 
-	nop := 0
+	i.nop = 0
+	i.codesep = 0
+	i.opcodePos = 0
 
-	for {
+	for ; ; i.opcodePos++ {
 		ins, err := script.Next()
 		if err != nil {
 			if err == ErrScriptEOF {
@@ -365,15 +521,23 @@ func (i *Interpreter) Eval(script *Script, flag Flag, checker Checker, sigversio
 
 		i.pc++
 
+		if err := i.meter.step(); err != nil {
+			return err
+		}
+
+		if len(ins.Data) > i.limits.MaxElementSize {
+			return ErrInterpreterPushSize
+		}
+
 		opcode := ins.OPCode
-		if opcode.IsCountable() {
-			nop++
-			if nop > MaxInterpreterScriptOPS {
+		if !tapscript && opcode.IsCountable() {
+			i.nop++
+			if i.nop > i.limits.MaxOps {
 				return ErrInterpreterScriptOPCount
 			}
 		}
 
-		if !flag.Has(ScriptSkipDisabledOPCode) && opcode.IsDisabled() {
+		if !flag.Has(ScriptSkipDisabledOPCode) && opcode.IsDisabledWithFlag(flag) {
 			return ErrInterpreterDisabledOPCode
 		}
 
@@ -395,16 +559,28 @@ func (i *Interpreter) Eval(script *Script, flag Flag, checker Checker, sigversio
 			return err
 		}
 
-		if i.dstack.Depth()+i.astack.Depth() > 1000 {
+		if i.dstack.Depth()+i.astack.Depth() > i.limits.MaxStackSize {
 			return ErrInterpreterStackOverflow
 		}
 
+		if i.limits.MaxStackMemory != Unlimited && stackMemory(i.dstack, i.astack) > uint64(i.limits.MaxStackMemory) {
+			return ErrInterpreterStackMemory
+		}
+
+		if err := i.meter.checkStack(i.dstack, i.astack); err != nil {
+			return err
+		}
+
 		if flag.Has(ScriptEnableTrace) {
+			// a malformed tail is reported by Next once it is reached
+			disassembler := NewDisassembler()
+			disassembler.SetFlag(flag)
+			remaining, _ := disassembler.disassemble(script, " ")
 			trace := Trace{
 				Step:      i.pc,
-				Executed:  ins.OPCode.String(),
+				Executed:  ins.OPCode.StringWithFlag(flag),
 				Stack:     i.dstack.String(),
-				Remaining: script.Disassemble(" "),
+				Remaining: remaining,
 			}
 			i.traces = append(i.traces, trace)
 		}
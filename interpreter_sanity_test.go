@@ -1,219 +1,166 @@
 package bscript
 
 import (
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"strings"
 	"testing"
 )
 
-func scriptTestName(test []interface{}) (string, error) {
-	// Account for any optional leading witness data.
-	var witnessOffset int
-	if _, ok := test[0].([]interface{}); ok {
-		witnessOffset++
+// TestInterpreter runs Bitcoin Core's script_tests.json. Vectors which do not
+// pass yet are listed with their status in
+// testdata/script_tests_known_failures.txt; any other mismatch, or a listed
+// vector which now passes, fails the test so the list only ever shrinks.
+func TestInterpreter(t *testing.T) {
+	f, err := ioutil.ReadFile("testdata/script_tests.json")
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// In addition to the optional leading witness data, the test must
-	// consist of at least a signature script, public key script, flags,
-	// and expected error.  Finally, it may optionally contain a comment.
-	if len(test) < witnessOffset+4 || len(test) > witnessOffset+5 {
-		return "", fmt.Errorf("invalid test length %d", len(test))
+	known, err := loadKnownFailures("testdata/script_tests_known_failures.txt")
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// Use the comment for the test name if one is specified, otherwise,
-	// construct the name based on the signature script, public key script,
-	// and flags.
-	var name string
-	if len(test) == witnessOffset+5 {
-		name = fmt.Sprintf("test (%s)", test[witnessOffset+4])
-	} else {
-		name = fmt.Sprintf("test ([%s, %s, %s])", test[witnessOffset],
-			test[witnessOffset+1], test[witnessOffset+2])
+	report, err := RunConformanceVectors(f)
+	if err != nil {
+		t.Fatalf("TestScripts couldn't load vectors: %v", err)
 	}
-	return name, nil
-}
 
-// parseWitnessStack parses a json array of witness items encoded as hex into a
-// slice of witness elements.
-func parseWitnessStack(elements []interface{}) ([][]byte, error) {
-	witness := make([][]byte, len(elements))
-	for i, e := range elements {
-		witElement, err := hex.DecodeString(e.(string))
-		if err != nil {
-			return nil, err
+	for _, result := range report.Results {
+		status, ok := known[result.Vector.Index]
+		delete(known, result.Vector.Index)
+
+		switch {
+		case result.Status == ConformanceBadInput:
+			t.Errorf("%s", result)
+		case result.Status == ConformancePass && ok:
+			t.Errorf("%s: listed as %s, remove it from the known failures", result, status)
+		case result.Status != ConformancePass && result.Status.String() != status:
+			t.Errorf("%s: regression, listed as %q", result, status)
 		}
+	}
 
-		witness[i] = witElement
+	for index, status := range known {
+		t.Errorf("known failure %d %s matches no vector", index, status)
 	}
 
-	return witness, nil
+	t.Log(report.Summary())
 }
 
-func TestInterpreter(t *testing.T) {
-	f, err := ioutil.ReadFile("testdata/script_tests.json")
+// loadKnownFailures reads the vector index and status of the conformance
+// vectors which are known not to pass yet, one "<index> <status>" per line.
+func loadKnownFailures(path string) (map[int]string, error) {
+	f, err := ioutil.ReadFile(path)
 	if err != nil {
-		t.Fatal(err)
+		return nil, err
 	}
 
-	var tests [][]interface{}
-	err = json.Unmarshal(f, &tests)
-	if err != nil {
-		t.Fatalf("TestScripts couldn't Unmarshal: %v", err)
-	}
-
-	for i, test := range tests {
-		continue
-		if len(test) == 1 {
+	known := make(map[int]string)
+	for _, line := range strings.Split(string(f), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		name, err := scriptTestName(test)
-		if err != nil {
-			t.Errorf("TestScripts: invalid test #%d: %v", i, err)
-			continue
-		}
-		// scriptSigString, scriptPubKeyString, scriptFlagString, scriptErrorString := test[0], test[1], test[2], test[3]
-		var (
-			witness ScriptWitness
-			amount  int64
-		// inputAmt btcutil.Amount
-		)
-
-		// "0",
-		// "IF 0 ELSE 1 ELSE 0 ENDIF",
-		// "P2SH,STRICTENC",
-		// "OK",
-		// "Multiple ELSE's are valid and executed inverts on each ELSE encountered"
-
-		// When the first field of the test data is a slice it contains
-		// witness data and everything else is offset by 1 as a result.
-		witnessOffset := 0
-		if witnessData, ok := test[0].([]interface{}); ok {
-			witnessOffset++
-
-			// If this is a witness test, then the final element
-			// within the slice is the input amount, so we ignore
-			// all but the last element in order to parse the
-			// witness stack.
-			strWitnesses := witnessData[:len(witnessData)-1]
-			witness, err = parseWitnessStack(strWitnesses)
-			if err != nil {
-				t.Errorf("%s: can't parse witness; %v", name, err)
-				continue
-			}
-
-			amount = int64(witnessData[len(witnessData)-1].(float64) * 1e8)
-			_ = amount
-			_ = witness
-		}
 
-		// Extract and parse the signature script from the test fields.
-		scriptSigStr, ok := test[witnessOffset].(string)
-		if !ok {
-			t.Errorf("%s: signature script is not a string", name)
-			continue
+		var index int
+		var status string
+		if _, err := fmt.Sscanf(line, "%d %s", &index, &status); err != nil {
+			return nil, fmt.Errorf("%s: bad line %q", path, line)
 		}
+		known[index] = status
+	}
 
-		// Extract and parse the public key script from the test fields.
-		scriptPubKeyStr, ok := test[witnessOffset+1].(string)
-		if !ok {
-			t.Errorf("%s: public key script is not a string", name)
-			continue
-		}
+	return known, nil
+}
 
-		// Extract and parse the script flags from the test fields.
-		flagsStr, ok := test[witnessOffset+2].(string)
-		if !ok {
-			t.Errorf("%s: flags field is not a string", name)
-			continue
-		}
+// TestCheckMultisigConformance pins the script_tests.json vectors of the
+// CHECKMULTISIG dummy element and of NULLFAIL, which only holds for the
+// signatures of a failed check.
+func TestCheckMultisigConformance(t *testing.T) {
+	f, err := ioutil.ReadFile("testdata/script_tests.json")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		scriptErrStr, ok := test[witnessOffset+3].(string)
-		if !ok {
-			continue
-		}
+	report, err := RunConformanceVectors(f)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		sigScript, err := parseScript(scriptSigStr)
-		if err != nil {
-			continue
-		}
+	comments := map[string]bool{
+		"CHECKMULTISIG must push false to stack when signature is invalid when NOT in strict enc mode": true,
+		"BIP66 and NULLFAIL-compliant":                          true,
+		"BIP66 and NULLFAIL-compliant, not NULLDUMMY-compliant": true,
+		"BIP66-compliant but not NULLFAIL-compliant":            true,
+		"P2WSH CHECKMULTISIG with compressed keys":              true,
+		"P2SH(P2WSH) CHECKMULTISIG with compressed keys":        true,
+	}
 
-		pubkeyScript, err := parseScript(scriptPubKeyStr)
-		if err != nil {
+	n := 0
+	for _, result := range report.Results {
+		if !comments[result.Vector.Comment] {
 			continue
 		}
 
-		flag := NewFlagFromString(flagsStr)
-
-		err = VerifyScript(
-			sigScript,
-			pubkeyScript,
-			nil,
-			flag,
-			NewNoopChecker(),
-			SignatureVersionBase,
-		)
-
-		if scriptErrStr != "OK" {
-			if err != nil {
-				continue
-			}
-			t.Fatal("bad script", test)
+		n++
+		if result.Status != ConformancePass {
+			t.Errorf("%s", result)
 		}
 	}
-}
 
-var scriptFlagMap = map[string]Flag{
-	"NONE":                                  ScriptVerifyNone,
-	"P2SH":                                  ScriptVerifyP2SH,
-	"STRICTENC":                             ScriptVerifyStrictEncoding,
-	"DERSIG":                                ScriptVerifyDERSignatures,
-	"LOW_S":                                 ScriptVerifyLowS,
-	"SIGPUSHONLY":                           ScriptVerifySigPushOnly,
-	"MINIMALDATA":                           ScriptVerifyMinimalData,
-	"NULLDUMMY":                             ScriptVerifyNullFail,
-	"DISCOURAGE_UPGRADABLE_NOPS":            ScriptDiscourageUpgradableNops,
-	"CLEANSTACK":                            ScriptVerifyCleanStack,
-	"MINIMALIF":                             ScriptVerifyMinimalIf,
-	"NULLFAIL":                              ScriptVerifyNullFail,
-	"CHECKLOCKTIMEVERIFY":                   ScriptVerifyCheckLockTimeVerify,
-	"CHECKSEQUENCEVERIFY":                   ScriptVerifyCheckSequenceVerify,
-	"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": ScriptVerifyDiscourageUpgradeableWitnessProgram,
-	"COMPRESSED_PUBKEYTYPE":                 ScriptVerifyCompressedPubkeyType,
-	"SIGHASH_FORKID":                        ScriptEnableSigHashForkID,
-	"REPLAY_PROTECTION":                     ScriptEnableReplayProtection,
-	"MONOLITH_OPCODES":                      ScriptEnableMonolithOpcodes,
+	if n == 0 {
+		t.Error("expect CHECKMULTISIG vectors")
+	}
 }
 
-func parseScript(str string) (*Script, error) {
-	b := make([]string, len(str))
-	for _, s := range strings.Split(str, " ") {
-		_, err := NewOPCodeFromString("OP_" + s)
+func TestParseConformanceFlags(t *testing.T) {
+	tests := []struct {
+		flags  string
+		expect Flag
+	}{
+		{"", 0},
+		{"NONE", 0},
+		{"P2SH", ScriptVerifyP2SH},
+		{"P2SH,STRICTENC", ScriptVerifyP2SH | ScriptVerifyStrictEncoding},
+		{"NULLDUMMY,NULLFAIL", ScriptVerifyNullDummy | ScriptVerifyNullFail},
+		{"P2SH,WITNESS,DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM",
+			ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyDiscourageUpgradeableWitnessProgram},
+	}
+
+	for _, test := range tests {
+		flag, err := ParseConformanceFlags(test.flags)
 		if err != nil {
-			b = append(b, s)
-			continue
+			t.Fatal(err)
+		}
+
+		if flag != test.expect {
+			t.Errorf("%s: expect %d got %d", test.flags, test.expect, flag)
 		}
-		b = append(b, "OP_"+s)
 	}
 
-	return NewScriptFromString(strings.Join(b, " "))
+	if _, err := ParseConformanceFlags("P2SH,NOSUCHFLAG"); err == nil {
+		t.Error("expect unknow flag error")
+	}
 }
 
-func NewFlagFromString(f string) Flag {
-	flag := Flag(0)
-	for _, s := range strings.Split(f, ",") {
-		if len(s) == 0 {
-			continue
-		}
+func TestRunConformanceVector(t *testing.T) {
+	tests := []struct {
+		vector *ConformanceVector
+		expect ConformanceStatus
+	}{
+		{&ConformanceVector{ScriptSig: "1", ScriptPubkey: "DUP", Flags: "P2SH", Expected: "OK"}, ConformancePass},
+		{&ConformanceVector{ScriptSig: "0", ScriptPubkey: "DUP", Flags: "P2SH", Expected: "OK"}, ConformanceUnexpectedFailure},
+		{&ConformanceVector{ScriptSig: "0", ScriptPubkey: "DUP", Flags: "P2SH", Expected: "EVAL_FALSE"}, ConformancePass},
+		{&ConformanceVector{ScriptSig: "1", ScriptPubkey: "DUP", Flags: "P2SH", Expected: "EVAL_FALSE"}, ConformanceUnexpectedSuccess},
+		{&ConformanceVector{ScriptSig: "0", ScriptPubkey: "DUP", Flags: "P2SH", Expected: "CLEANSTACK"}, ConformanceWrongError},
+		{&ConformanceVector{ScriptSig: "1", ScriptPubkey: "DUP", Flags: "BADFLAG", Expected: "OK"}, ConformanceBadInput},
+	}
 
-		v, ok := scriptFlagMap[s]
-		if !ok {
-			continue
+	for _, test := range tests {
+		result := RunConformanceVector(test.vector)
+		if result.Status != test.expect {
+			t.Errorf("%s: expect %s got %s", test.vector, test.expect, result.Status)
 		}
-		flag.Enable(v)
 	}
-
-	return flag
 }
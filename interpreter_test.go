@@ -417,3 +417,76 @@ func TestInterpreterOPNumberic(t *testing.T) {
 		}
 	}
 }
+
+func TestSplice(t *testing.T) {
+	tests, err := getTests("testdata/splice.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := map[string]Flag{
+		"none":     0,
+		"legacy":   ScriptSkipDisabledOPCode,
+		"monolith": ScriptEnableMonolithOpcodes,
+	}
+
+	for _, test := range tests {
+		name := test[0].(string)
+		code := test[1].(string)
+		flag := flags[test[2].(string)]
+		expect := test[3].(string)
+
+		script, err := NewScriptFromString(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		interpreter := NewInterpreter()
+		err = interpreter.Eval(script, flag, &NoopChecker{}, SignatureVersionBase)
+		if expectErr, ok := ConformanceErrors[expect]; ok {
+			if err != expectErr {
+				t.Errorf("%s: expect %s got %v with \"%s\"", name, expectErr, err, code)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s with \"%s\"", name, err, code)
+			continue
+		}
+
+		d, err := interpreter.GetDStack().Peek(-1)
+		if err != nil {
+			t.Errorf("%s: %s with \"%s\"", name, err, code)
+			continue
+		}
+
+		if hex.EncodeToString(d.Bytes()) != expect {
+			t.Errorf("%s: expect %s got %x with \"%s\"", name, expect, d.Bytes(), code)
+		}
+	}
+}
+
+func TestCheckHashTypeEncoding(t *testing.T) {
+	forkid := byte(SigHashAll | SigHashForkId)
+	all := byte(SigHashAll)
+
+	tests := []struct {
+		hashtype byte
+		flag     Flag
+		expect   error
+	}{
+		{all, ScriptVerifyStrictEncoding, nil},
+		{forkid, ScriptVerifyStrictEncoding, ErrInterpreterIllegalForkId},
+		{forkid, ScriptVerifyStrictEncoding | ScriptEnableSigHashForkID, nil},
+		{all, ScriptVerifyStrictEncoding | ScriptEnableSigHashForkID, ErrInterpreterMustUseForkId},
+		{all, ScriptEnableSigHashForkID, nil},
+		{forkid, ScriptVerifyNone, nil},
+	}
+
+	for _, test := range tests {
+		if err := CheckHashTypeEncoding(test.hashtype, test.flag); err != test.expect {
+			t.Errorf("%#x %s: expect %v got %v", test.hashtype, test.flag, test.expect, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package bscript
+
+// Unlimited disables a limit.
+const Unlimited = int(^uint(0) >> 1)
+
+// Limits are the consensus resource limits of script evaluation, which differ
+// between chains. Tapscript ignores MaxScriptSize and MaxOps, as it does on
+// Bitcoin.
+type Limits struct {
+	// MaxScriptSize is the size of an evaluated script.
+	MaxScriptSize int
+	// MaxOps is the number of opcodes above OP_16 in a script.
+	MaxOps int
+	// MaxStackSize is the number of items on the main and alt stacks.
+	MaxStackSize int
+	// MaxElementSize is the size of a pushed or computed stack item.
+	MaxElementSize int
+	// MaxStackMemory is the size of the items of the main and alt stacks
+	// together, which computed items are checked against before they are
+	// allocated.
+	MaxStackMemory int
+	// MaxPubkeysPerMultisig is the key count CHECKMULTISIG accepts.
+	MaxPubkeysPerMultisig int
+}
+
+var (
+	// LimitsBitcoin are Bitcoin Core's limits.
+	LimitsBitcoin = Limits{
+		MaxScriptSize:         MaxInterpreterScriptSize,
+		MaxOps:                MaxInterpreterScriptOPS,
+		MaxStackSize:          MaxInterpreterStackSize,
+		MaxElementSize:        MaxInterpreterScriptElementSize,
+		MaxStackMemory:        Unlimited,
+		MaxPubkeysPerMultisig: MaxInterpreterScriptPubekyesPerMultisig,
+	}
+
+	// LimitsBCH are Bitcoin Cash's limits before the May 2025 upgrade,
+	// which are Bitcoin's.
+	LimitsBCH = LimitsBitcoin
+
+	// LimitsBCH2025 are Bitcoin Cash's limits since the May 2025 VM limits
+	// upgrade, which raises the element size and drops the opcode count.
+	// The operation cost and hash density budgets replacing the opcode
+	// count and the big integers of that upgrade are not implemented, so
+	// ChainBitcoinCash does not use them. Bound evaluations under them with
+	// an ExecutionBudget.
+	LimitsBCH2025 = Limits{
+		MaxScriptSize:         MaxInterpreterScriptSize,
+		MaxOps:                Unlimited,
+		MaxStackSize:          MaxInterpreterStackSize,
+		MaxElementSize:        10000,
+		MaxStackMemory:        Unlimited,
+		MaxPubkeysPerMultisig: MaxInterpreterScriptPubekyesPerMultisig,
+	}
+
+	// LimitsBSV are Bitcoin SV's consensus limits after Genesis, which lift
+	// all of these but stack memory. Its consensus leaves stack memory
+	// unbounded as well, it is held to the 100 MB default of Bitcoin SV's
+	// policy so that OP_NUM2BIN and OP_CAT can not exhaust memory. Script
+	// numbers keep their 4 byte operands, the larger numbers of Genesis are
+	// not implemented.
+	LimitsBSV = Limits{
+		MaxScriptSize:         Unlimited,
+		MaxOps:                Unlimited,
+		MaxStackSize:          Unlimited,
+		MaxElementSize:        Unlimited,
+		MaxStackMemory:        100000000,
+		MaxPubkeysPerMultisig: Unlimited,
+	}
+
+	// LimitsUnlimited lifts every limit, for research on scripts no chain
+	// accepts. Bound such evaluations with an ExecutionBudget instead.
+	LimitsUnlimited = Limits{
+		MaxScriptSize:         Unlimited,
+		MaxOps:                Unlimited,
+		MaxStackSize:          Unlimited,
+		MaxElementSize:        Unlimited,
+		MaxStackMemory:        Unlimited,
+		MaxPubkeysPerMultisig: Unlimited,
+	}
+)
+
+// DefaultLimits are the limits of a new Interpreter.
+func DefaultLimits() Limits {
+	return LimitsBitcoin
+}
+
+// SetLimits replaces the limits of the following Eval and Verify calls.
+func (i *Interpreter) SetLimits(limits Limits) {
+	i.limits = limits
+}
+
+// Limits returns the limits i enforces.
+func (i *Interpreter) Limits() Limits {
+	return i.limits
+}
+
+// reserve fails when n more bytes would take the stacks past MaxStackMemory
+// or the stack memory budget, before an instruction allocates them.
+func (i *Interpreter) reserve(n int) error {
+	budgeted := i.meter != nil && i.meter.budget.StackMemory > 0
+	if i.limits.MaxStackMemory == Unlimited && !budgeted {
+		return nil
+	}
+
+	size := stackMemory(i.dstack, i.astack) + uint64(n)
+	if size > uint64(i.limits.MaxStackMemory) {
+		return ErrInterpreterStackMemory
+	}
+
+	return i.meter.checkMemory(size)
+}
@@ -0,0 +1,137 @@
+package bscript
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestInterpreterLimits(t *testing.T) {
+	bigPush := NewScript().PushBytesWithOP(bytes.Repeat([]byte{1}, 600)).PushOPCode(OP_SIZE).PushOPCode(OP_DROP)
+	nops := NewScript().PushOPCode(OP_1)
+	for i := 0; i < 202; i++ {
+		nops.PushOPCode(OP_NOP)
+	}
+	// 1-of-21 whatever its outcome
+	multisig := NewScript().PushOPCode(OP_0).PushOPCode(OP_0).PushOPCode(OP_1)
+	for i := 0; i < 21; i++ {
+		multisig.PushOPCode(OP_0)
+	}
+	multisig.PushInt64(21).PushOPCode(OP_CHECKMULTISIG).PushOPCode(OP_DROP).PushOPCode(OP_1)
+
+	tests := []struct {
+		name   string
+		script *Script
+		limits Limits
+		expect error
+	}{
+		{"push bitcoin", bigPush, LimitsBitcoin, ErrInterpreterPushSize},
+		{"push bch", bigPush, LimitsBCH, ErrInterpreterPushSize},
+		{"push bsv", bigPush, LimitsBSV, nil},
+		{"ops bitcoin", nops, LimitsBitcoin, ErrInterpreterScriptOPCount},
+		{"ops unlimited", nops, LimitsUnlimited, nil},
+		{"multisig bitcoin", multisig, LimitsBitcoin, ErrInterpreterScriptPubekyesPerMultisig},
+		{"multisig bsv", multisig, LimitsBSV, nil},
+		{"script size", nops, Limits{MaxScriptSize: 100, MaxOps: Unlimited, MaxStackSize: 1000, MaxElementSize: 520, MaxStackMemory: Unlimited, MaxPubkeysPerMultisig: 20}, ErrInterpreterScriptSize},
+	}
+
+	for _, test := range tests {
+		interpreter := NewInterpreter()
+		interpreter.SetLimits(test.limits)
+
+		err := interpreter.Verify(NewScript(), NewScriptFromBytes(test.script.Bytes()), NewScriptWitness([][]byte{}), 0, NewNoopChecker(), SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+
+	if limits := NewInterpreter().Limits(); limits != DefaultLimits() || limits != LimitsBitcoin {
+		t.Errorf("expect bitcoin limits by default got %+v", limits)
+	}
+
+	// witness scripts inherit the limits
+	witnessScript := bigPush.Bytes()
+	program := sha256.Sum256(witnessScript)
+	p2wsh := NewScript().PushOPCode(OP_0).PushBytesWithOP(program[:])
+	witness := NewScriptWitness([][]byte{witnessScript})
+
+	for _, test := range []struct {
+		limits Limits
+		expect error
+	}{
+		{LimitsBitcoin, ErrInterpreterPushSize},
+		{LimitsUnlimited, nil},
+	} {
+		interpreter := NewInterpreter()
+		interpreter.SetLimits(test.limits)
+
+		err := interpreter.Verify(NewScript(), NewScriptFromBytes(p2wsh.Bytes()), witness, ScriptVerifyP2SH|ScriptVerifyWitness, NewNoopChecker(), SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("p2wsh %+v: expect %v got %v", test.limits, test.expect, err)
+		}
+	}
+
+	// OP_CAT stays under the element size
+	cat, err := NewScriptFromString(strings.Repeat("OP_DUP OP_CAT ", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		limits Limits
+		expect error
+	}{
+		{LimitsBCH, ErrInterpreterPushSize},
+		{LimitsBSV, nil},
+	} {
+		interpreter := NewInterpreter()
+		interpreter.SetLimits(test.limits)
+		interpreter.GetDStack().Push(bytes.Repeat([]byte{1}, 40))
+
+		err := interpreter.Eval(NewScriptFromBytes(cat.Bytes()), ScriptEnableMonolithOpcodes, NewNoopChecker(), SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("cat %+v: expect %v got %v", test.limits, test.expect, err)
+		}
+	}
+}
+
+func TestInterpreterStackMemory(t *testing.T) {
+	// OP_NUM2BIN of 2 GiB and OP_CAT doubling 40 bytes past 1000
+	num2bin := NewScript().PushOPCode(OP_0).PushInt64(0x7fffffff).PushOPCode(OP_NUM2BIN)
+	cat := NewScript().PushBytesWithOP(bytes.Repeat([]byte{1}, 40))
+	for n := 0; n < 5; n++ {
+		cat.PushOPCode(OP_DUP).PushOPCode(OP_CAT)
+	}
+
+	small := LimitsBSV
+	small.MaxStackMemory = 1000
+
+	tests := []struct {
+		name   string
+		script *Script
+		limits Limits
+		budget *ExecutionBudget
+		expect error
+	}{
+		{"num2bin bsv", num2bin, LimitsBSV, nil, ErrInterpreterStackMemory},
+		{"num2bin budget", num2bin, LimitsUnlimited, &ExecutionBudget{StackMemory: 1 << 20}, ErrInterpreterStackMemoryBudget},
+		{"num2bin bch 2025", num2bin, LimitsBCH2025, nil, ErrInterpreterPushSize},
+		{"cat", cat, small, nil, ErrInterpreterStackMemory},
+		{"cat budget", cat, LimitsUnlimited, &ExecutionBudget{StackMemory: 1000}, ErrInterpreterStackMemoryBudget},
+		{"cat bsv", cat, LimitsBSV, nil, nil},
+		{"cat bch 2025", cat, LimitsBCH2025, nil, nil},
+		{"cat bch", cat, LimitsBCH, nil, ErrInterpreterPushSize},
+	}
+
+	for _, test := range tests {
+		interpreter := NewInterpreter()
+		interpreter.SetLimits(test.limits)
+		interpreter.SetContext(context.Background(), test.budget)
+
+		err := interpreter.Eval(NewScriptFromBytes(test.script.Bytes()), ScriptEnableMonolithOpcodes, NewNoopChecker(), SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package bscript
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrMiniscriptSyntax          = errors.New("miniscript: syntax error")
+	ErrMiniscriptUnknowFragment  = errors.New("miniscript: unknow fragment")
+	ErrMiniscriptBadKey          = errors.New("miniscript: bad key")
+	ErrMiniscriptBadHash         = errors.New("miniscript: bad hash")
+	ErrMiniscriptBadNumber       = errors.New("miniscript: bad number")
+	ErrMiniscriptBadThreshold    = errors.New("miniscript: bad threshold")
+	ErrMiniscriptBadType         = errors.New("miniscript: type check failed")
+	ErrMiniscriptBadContext      = errors.New("miniscript: fragment not allowed in this context")
+	ErrMiniscriptNotMiniscript   = errors.New("miniscript: script is not miniscript")
+	ErrMiniscriptUnknowKeyHash   = errors.New("miniscript: unknow key hash")
+	ErrMiniscriptNotTopLevelBase = errors.New("miniscript: top level expression is not of type B")
+)
+
+// MiniscriptContext is the script a Miniscript compiles to, which decides
+// the key encoding and the multisig fragment.
+type MiniscriptContext uint8
+
+const (
+	// MiniscriptContextP2WSH takes 33 bytes compressed keys and multi.
+	MiniscriptContextP2WSH MiniscriptContext = iota
+	// MiniscriptContextTapscript takes 32 bytes x-only keys and multi_a.
+	MiniscriptContextTapscript
+)
+
+// MiniscriptFragment is the kind of a Miniscript node. The sugared forms
+// pk, pkh, and_n, t:, l: and u: parse into the fragments they stand for.
+type MiniscriptFragment uint8
+
+const (
+	MiniscriptJust0 MiniscriptFragment = iota
+	MiniscriptJust1
+	MiniscriptPkK
+	MiniscriptPkH
+	MiniscriptOlder
+	MiniscriptAfter
+	MiniscriptSha256
+	MiniscriptHash256
+	MiniscriptRipemd160
+	MiniscriptHash160
+	MiniscriptWrapA
+	MiniscriptWrapS
+	MiniscriptWrapC
+	MiniscriptWrapD
+	MiniscriptWrapV
+	MiniscriptWrapJ
+	MiniscriptWrapN
+	MiniscriptAndV
+	MiniscriptAndB
+	MiniscriptOrB
+	MiniscriptOrC
+	MiniscriptOrD
+	MiniscriptOrI
+	MiniscriptAndOr
+	MiniscriptThresh
+	MiniscriptMulti
+	MiniscriptMultiA
+)
+
+var miniscriptFragmentNames = map[string]MiniscriptFragment{
+	"pk_k":      MiniscriptPkK,
+	"pk_h":      MiniscriptPkH,
+	"older":     MiniscriptOlder,
+	"after":     MiniscriptAfter,
+	"sha256":    MiniscriptSha256,
+	"hash256":   MiniscriptHash256,
+	"ripemd160": MiniscriptRipemd160,
+	"hash160":   MiniscriptHash160,
+	"and_v":     MiniscriptAndV,
+	"and_b":     MiniscriptAndB,
+	"or_b":      MiniscriptOrB,
+	"or_c":      MiniscriptOrC,
+	"or_d":      MiniscriptOrD,
+	"or_i":      MiniscriptOrI,
+	"andor":     MiniscriptAndOr,
+	"thresh":    MiniscriptThresh,
+	"multi":     MiniscriptMulti,
+	"multi_a":   MiniscriptMultiA,
+}
+
+var miniscriptWrappers = map[byte]MiniscriptFragment{
+	'a': MiniscriptWrapA,
+	's': MiniscriptWrapS,
+	'c': MiniscriptWrapC,
+	'd': MiniscriptWrapD,
+	'v': MiniscriptWrapV,
+	'j': MiniscriptWrapJ,
+	'n': MiniscriptWrapN,
+}
+
+const (
+	// MiniscriptMaxPubkeysPerMultiA is the key limit of multi_a, as Bitcoin
+	// Core's MAX_PUBKEYS_PER_MULTI_A.
+	MiniscriptMaxPubkeysPerMultiA = 999
+	// MiniscriptMaxStandardP2WSHScriptSize and
+	// MiniscriptMaxStandardP2WSHStackItems are the standardness limits of a
+	// P2WSH spend.
+	MiniscriptMaxStandardP2WSHScriptSize = 3600
+	MiniscriptMaxStandardP2WSHStackItems = 100
+	// MiniscriptMaxTapscriptStackSize is the stack size limit a tapscript
+	// satisfaction has to fit in.
+	MiniscriptMaxTapscriptStackSize = 1000
+)
+
+// Miniscript is a node of a Miniscript expression. K is the threshold of
+// thresh, multi and multi_a and the value of older and after, Keys are the
+// keys of pk_k, pk_h, multi and multi_a and Data is the hash of the hash
+// fragments.
+type Miniscript struct {
+	Fragment MiniscriptFragment
+	K        uint32
+	Keys     [][]byte
+	Data     []byte
+	Subs     []*Miniscript
+
+	ctx  MiniscriptContext
+	typ  MiniscriptType
+	size miniscriptWitnessSize
+}
+
+func newMiniscript(ctx MiniscriptContext, fragment MiniscriptFragment, k uint32, keys [][]byte, data []byte, subs ...*Miniscript) *Miniscript {
+	m := &Miniscript{
+		Fragment: fragment,
+		K:        k,
+		Keys:     keys,
+		Data:     data,
+		Subs:     subs,
+		ctx:      ctx,
+	}
+	m.typ = m.computeType()
+	m.size = m.computeWitnessSize()
+
+	return m
+}
+
+// NewMiniscriptFromString parses a Miniscript expression of ctx, keys
+// written in hex. Every node has to type check and the whole expression has
+// to be of type B.
+func NewMiniscriptFromString(s string, ctx MiniscriptContext) (*Miniscript, error) {
+	p := &miniscriptParser{src: s, ctx: ctx}
+
+	m, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.src) {
+		return nil, fmt.Errorf("%w: trailing %q", ErrMiniscriptSyntax, p.src[p.pos:])
+	}
+	if !m.typ.Has(MiniscriptTypeB) {
+		return nil, ErrMiniscriptNotTopLevelBase
+	}
+
+	return m, nil
+}
+
+type miniscriptParser struct {
+	src string
+	pos int
+	ctx MiniscriptContext
+}
+
+// token reads up to the next delimiter.
+func (p *miniscriptParser) token() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune("(),", rune(p.src[p.pos])) {
+		p.pos++
+	}
+
+	return p.src[start:p.pos]
+}
+
+func (p *miniscriptParser) expect(c byte) error {
+	if p.pos >= len(p.src) || p.src[p.pos] != c {
+		return fmt.Errorf("%w: expect %q at %d", ErrMiniscriptSyntax, c, p.pos)
+	}
+	p.pos++
+
+	return nil
+}
+
+func (p *miniscriptParser) parse() (*Miniscript, error) {
+	name := p.token()
+
+	wrappers := ""
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		wrappers, name = name[:i], name[i+1:]
+	}
+
+	m, err := p.parseFragment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the wrapper next to the fragment applies first
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		switch w := wrappers[i]; w {
+		case 't':
+			m = newMiniscript(p.ctx, MiniscriptAndV, 0, nil, nil, m, newMiniscript(p.ctx, MiniscriptJust1, 0, nil, nil))
+		case 'l':
+			m = newMiniscript(p.ctx, MiniscriptOrI, 0, nil, nil, newMiniscript(p.ctx, MiniscriptJust0, 0, nil, nil), m)
+		case 'u':
+			m = newMiniscript(p.ctx, MiniscriptOrI, 0, nil, nil, m, newMiniscript(p.ctx, MiniscriptJust0, 0, nil, nil))
+		default:
+			fragment, ok := miniscriptWrappers[w]
+			if !ok {
+				return nil, fmt.Errorf("%w: wrapper %q", ErrMiniscriptUnknowFragment, w)
+			}
+			m = newMiniscript(p.ctx, fragment, 0, nil, nil, m)
+		}
+		if m.typ == 0 {
+			return nil, fmt.Errorf("%w: %c:", ErrMiniscriptBadType, wrappers[i])
+		}
+	}
+
+	return m, nil
+}
+
+func (p *miniscriptParser) parseFragment(name string) (*Miniscript, error) {
+	switch name {
+	case "0":
+		return newMiniscript(p.ctx, MiniscriptJust0, 0, nil, nil), nil
+	case "1":
+		return newMiniscript(p.ctx, MiniscriptJust1, 0, nil, nil), nil
+	}
+
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var m *Miniscript
+	switch fragment, ok := miniscriptFragmentNames[name]; {
+	case name == "pk" || name == "pkh":
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		fragment = MiniscriptPkK
+		if name == "pkh" {
+			fragment = MiniscriptPkH
+		}
+		m = newMiniscript(p.ctx, MiniscriptWrapC, 0, nil, nil, newMiniscript(p.ctx, fragment, 0, [][]byte{key}, nil))
+
+	case name == "and_n":
+		subs, err := p.parseSubs(2)
+		if err != nil {
+			return nil, err
+		}
+		m = newMiniscript(p.ctx, MiniscriptAndOr, 0, nil, nil, subs[0], subs[1], newMiniscript(p.ctx, MiniscriptJust0, 0, nil, nil))
+
+	case !ok:
+		return nil, fmt.Errorf("%w: %s", ErrMiniscriptUnknowFragment, name)
+
+	case fragment == MiniscriptPkK || fragment == MiniscriptPkH:
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		m = newMiniscript(p.ctx, fragment, 0, [][]byte{key}, nil)
+
+	case fragment == MiniscriptOlder || fragment == MiniscriptAfter:
+		n, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 || n >= 1<<31 {
+			return nil, fmt.Errorf("%w: %s(%d)", ErrMiniscriptBadNumber, name, n)
+		}
+		m = newMiniscript(p.ctx, fragment, uint32(n), nil, nil)
+
+	case fragment >= MiniscriptSha256 && fragment <= MiniscriptHash160:
+		size := 32
+		if fragment == MiniscriptRipemd160 || fragment == MiniscriptHash160 {
+			size = 20
+		}
+		hash, err := hex.DecodeString(p.token())
+		if err != nil || len(hash) != size {
+			return nil, fmt.Errorf("%w: %s", ErrMiniscriptBadHash, name)
+		}
+		m = newMiniscript(p.ctx, fragment, 0, nil, hash)
+
+	case fragment == MiniscriptThresh:
+		k, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		var subs []*Miniscript
+		for p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+			sub, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+		if k < 1 || k > int64(len(subs)) {
+			return nil, ErrMiniscriptBadThreshold
+		}
+		m = newMiniscript(p.ctx, fragment, uint32(k), nil, nil, subs...)
+
+	case fragment == MiniscriptMulti || fragment == MiniscriptMultiA:
+		if (fragment == MiniscriptMulti) != (p.ctx == MiniscriptContextP2WSH) {
+			return nil, fmt.Errorf("%w: %s", ErrMiniscriptBadContext, name)
+		}
+		k, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		var keys [][]byte
+		for p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		max := LimitsBitcoin.MaxPubkeysPerMultisig
+		if fragment == MiniscriptMultiA {
+			max = MiniscriptMaxPubkeysPerMultiA
+		}
+		if k < 1 || k > int64(len(keys)) || len(keys) > max {
+			return nil, ErrMiniscriptBadThreshold
+		}
+		m = newMiniscript(p.ctx, fragment, uint32(k), keys, nil)
+
+	default:
+		n := 2
+		if fragment == MiniscriptAndOr {
+			n = 3
+		}
+		subs, err := p.parseSubs(n)
+		if err != nil {
+			return nil, err
+		}
+		m = newMiniscript(p.ctx, fragment, 0, nil, nil, subs...)
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	if m.typ == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMiniscriptBadType, name)
+	}
+
+	return m, nil
+}
+
+func (p *miniscriptParser) parseSubs(n int) ([]*Miniscript, error) {
+	subs := make([]*Miniscript, n)
+	for i := range subs {
+		if i > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+
+		sub, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		subs[i] = sub
+	}
+
+	return subs, nil
+}
+
+func (p *miniscriptParser) parseNumber() (int64, error) {
+	s := p.token()
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != s {
+		return 0, fmt.Errorf("%w: %q", ErrMiniscriptBadNumber, s)
+	}
+
+	return n, nil
+}
+
+func (p *miniscriptParser) parseKey() ([]byte, error) {
+	s := p.token()
+	key, err := hex.DecodeString(s)
+	if err != nil || !isMiniscriptKey(key, p.ctx) {
+		return nil, fmt.Errorf("%w: %q", ErrMiniscriptBadKey, s)
+	}
+
+	return key, nil
+}
+
+// isMiniscriptKey reports whether key has the encoding of ctx, compressed
+// for P2WSH and x-only for tapscript, and is on the curve.
+func isMiniscriptKey(key []byte, ctx MiniscriptContext) bool {
+	if ctx == MiniscriptContextTapscript {
+		_, ok := secp256k1LiftX(key)
+		return len(key) == 32 && ok
+	}
+
+	return len(key) == 33 && IsPubkeyOnCurve(key)
+}
+
+// Context is the script context m was parsed or decoded for.
+func (m *Miniscript) Context() MiniscriptContext {
+	return m.ctx
+}
+
+// String writes m back with the sugared forms, wrappers merged as in
+// "vc:pk_k(K)".
+func (m *Miniscript) String() string {
+	return m.toString(false)
+}
+
+func (m *Miniscript) toString(wrapped bool) string {
+	prefix := ""
+	if wrapped {
+		prefix = ":"
+	}
+
+	switch m.Fragment {
+	case MiniscriptWrapA, MiniscriptWrapS, MiniscriptWrapD, MiniscriptWrapV, MiniscriptWrapJ, MiniscriptWrapN:
+		for letter, fragment := range miniscriptWrappers {
+			if fragment == m.Fragment {
+				return string(letter) + m.Subs[0].toString(true)
+			}
+		}
+	case MiniscriptWrapC:
+		switch m.Subs[0].Fragment {
+		case MiniscriptPkK:
+			return prefix + "pk(" + hex.EncodeToString(m.Subs[0].Keys[0]) + ")"
+		case MiniscriptPkH:
+			return prefix + "pkh(" + hex.EncodeToString(m.Subs[0].Keys[0]) + ")"
+		}
+		return "c" + m.Subs[0].toString(true)
+	case MiniscriptAndV:
+		if m.Subs[1].Fragment == MiniscriptJust1 {
+			return "t" + m.Subs[0].toString(true)
+		}
+	case MiniscriptOrI:
+		if m.Subs[0].Fragment == MiniscriptJust0 {
+			return "l" + m.Subs[1].toString(true)
+		}
+		if m.Subs[1].Fragment == MiniscriptJust0 {
+			return "u" + m.Subs[0].toString(true)
+		}
+	}
+
+	var args []string
+	for _, key := range m.Keys {
+		args = append(args, hex.EncodeToString(key))
+	}
+	for _, sub := range m.Subs {
+		args = append(args, sub.toString(false))
+	}
+
+	switch m.Fragment {
+	case MiniscriptJust0:
+		return prefix + "0"
+	case MiniscriptJust1:
+		return prefix + "1"
+	case MiniscriptOlder, MiniscriptAfter:
+		args = []string{strconv.FormatUint(uint64(m.K), 10)}
+	case MiniscriptSha256, MiniscriptHash256, MiniscriptRipemd160, MiniscriptHash160:
+		args = []string{hex.EncodeToString(m.Data)}
+	case MiniscriptThresh, MiniscriptMulti, MiniscriptMultiA:
+		args = append([]string{strconv.FormatUint(uint64(m.K), 10)}, args...)
+	case MiniscriptAndOr:
+		if m.Subs[2].Fragment == MiniscriptJust0 {
+			return prefix + "and_n(" + args[0] + "," + args[1] + ")"
+		}
+	}
+
+	for name, fragment := range miniscriptFragmentNames {
+		if fragment == m.Fragment {
+			return prefix + name + "(" + strings.Join(args, ",") + ")"
+		}
+	}
+
+	return prefix + "?"
+}
+
+// miniscriptKeyHash is the hash pk_h commits to.
+func miniscriptKeyHash(key []byte) []byte {
+	return Hash160(key)
+}
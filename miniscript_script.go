@@ -0,0 +1,562 @@
+package bscript
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Script compiles m into the script it stands for.
+func (m *Miniscript) Script() *Script {
+	script := NewScript()
+	m.compile(script, false)
+
+	return NewScriptFromBytes(script.Data)
+}
+
+// compile appends the script of m, verify is set when OP_VERIFY follows it
+// so that the last opcode turns into its VERIFY form.
+func (m *Miniscript) compile(s *Script, verify bool) {
+	verifyOP := func(op, opVerify OPCode) OPCode {
+		if verify {
+			return opVerify
+		}
+		return op
+	}
+
+	switch m.Fragment {
+	case MiniscriptJust0:
+		s.PushOPCode(OP_0)
+	case MiniscriptJust1:
+		s.PushOPCode(OP_1)
+	case MiniscriptPkK:
+		s.PushBytesWithOP(m.Keys[0])
+	case MiniscriptPkH:
+		s.PushOPCode(OP_DUP).PushOPCode(OP_HASH160).PushBytesWithOP(miniscriptKeyHash(m.Keys[0])).PushOPCode(OP_EQUALVERIFY)
+	case MiniscriptOlder:
+		s.PushInt64(int64(m.K)).PushOPCode(OP_CHECKSEQUENCEVERIFY)
+	case MiniscriptAfter:
+		s.PushInt64(int64(m.K)).PushOPCode(OP_CHECKLOCKTIMEVERIFY)
+	case MiniscriptSha256, MiniscriptHash256, MiniscriptRipemd160, MiniscriptHash160:
+		s.PushOPCode(OP_SIZE).PushInt64(32).PushOPCode(OP_EQUALVERIFY).PushOPCode(miniscriptHashOPCodes[m.Fragment]).
+			PushBytesWithOP(m.Data).PushOPCode(verifyOP(OP_EQUAL, OP_EQUALVERIFY))
+	case MiniscriptMulti:
+		s.PushInt64(int64(m.K))
+		for _, key := range m.Keys {
+			s.PushBytesWithOP(key)
+		}
+		s.PushInt64(int64(len(m.Keys))).PushOPCode(verifyOP(OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY))
+	case MiniscriptMultiA:
+		for i, key := range m.Keys {
+			s.PushBytesWithOP(key)
+			if i == 0 {
+				s.PushOPCode(OP_CHECKSIG)
+			} else {
+				s.PushOPCode(OP_CHECKSIGADD)
+			}
+		}
+		s.PushInt64(int64(m.K)).PushOPCode(verifyOP(OP_NUMEQUAL, OP_NUMEQUALVERIFY))
+
+	case MiniscriptWrapA:
+		s.PushOPCode(OP_TOALTSTACK)
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_FROMALTSTACK)
+	case MiniscriptWrapS:
+		s.PushOPCode(OP_SWAP)
+		m.Subs[0].compile(s, verify)
+	case MiniscriptWrapC:
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(verifyOP(OP_CHECKSIG, OP_CHECKSIGVERIFY))
+	case MiniscriptWrapD:
+		s.PushOPCode(OP_DUP).PushOPCode(OP_IF)
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_ENDIF)
+	case MiniscriptWrapV:
+		m.Subs[0].compile(s, true)
+		if m.Subs[0].typ.Has(MiniscriptTypeX) {
+			s.PushOPCode(OP_VERIFY)
+		}
+	case MiniscriptWrapJ:
+		s.PushOPCode(OP_SIZE).PushOPCode(OP_0NOTEQUAL).PushOPCode(OP_IF)
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_ENDIF)
+	case MiniscriptWrapN:
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_0NOTEQUAL)
+
+	case MiniscriptAndV:
+		m.Subs[0].compile(s, false)
+		m.Subs[1].compile(s, verify)
+	case MiniscriptAndB:
+		m.Subs[0].compile(s, false)
+		m.Subs[1].compile(s, false)
+		s.PushOPCode(OP_BOOLAND)
+	case MiniscriptOrB:
+		m.Subs[0].compile(s, false)
+		m.Subs[1].compile(s, false)
+		s.PushOPCode(OP_BOOLOR)
+	case MiniscriptOrC:
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_NOTIF)
+		m.Subs[1].compile(s, false)
+		s.PushOPCode(OP_ENDIF)
+	case MiniscriptOrD:
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_IFDUP).PushOPCode(OP_NOTIF)
+		m.Subs[1].compile(s, false)
+		s.PushOPCode(OP_ENDIF)
+	case MiniscriptOrI:
+		s.PushOPCode(OP_IF)
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_ELSE)
+		m.Subs[1].compile(s, false)
+		s.PushOPCode(OP_ENDIF)
+	case MiniscriptAndOr:
+		m.Subs[0].compile(s, false)
+		s.PushOPCode(OP_NOTIF)
+		m.Subs[2].compile(s, false)
+		s.PushOPCode(OP_ELSE)
+		m.Subs[1].compile(s, false)
+		s.PushOPCode(OP_ENDIF)
+	case MiniscriptThresh:
+		for i, sub := range m.Subs {
+			sub.compile(s, false)
+			if i > 0 {
+				s.PushOPCode(OP_ADD)
+			}
+		}
+		s.PushInt64(int64(m.K)).PushOPCode(verifyOP(OP_EQUAL, OP_EQUALVERIFY))
+	}
+}
+
+var miniscriptHashOPCodes = map[MiniscriptFragment]OPCode{
+	MiniscriptSha256:    OP_SHA256,
+	MiniscriptHash256:   OP_HASH256,
+	MiniscriptRipemd160: OP_RIPEMD160,
+	MiniscriptHash160:   OP_HASH160,
+}
+
+// miniscriptVerifyOPCodes are the opcodes with a VERIFY form, which the
+// decoder splits into the opcode and OP_VERIFY.
+var miniscriptVerifyOPCodes = map[OPCode]OPCode{
+	OP_CHECKSIGVERIFY:      OP_CHECKSIG,
+	OP_CHECKMULTISIGVERIFY: OP_CHECKMULTISIG,
+	OP_NUMEQUALVERIFY:      OP_NUMEQUAL,
+	OP_EQUALVERIFY:         OP_EQUAL,
+}
+
+// NewMiniscriptFromScript decodes script of ctx back into Miniscript. A
+// script is Miniscript only when the expression decoded compiles back into
+// it byte for byte, so non minimal pushes and a bare OP_VERIFY after an
+// opcode with a VERIFY form are rejected. The script only carries the hash
+// of a pk_h key, keys lists the keys to look them up in.
+func NewMiniscriptFromScript(script *Script, ctx MiniscriptContext, keys ...[]byte) (*Miniscript, error) {
+	d := &miniscriptDecoder{ctx: ctx, keys: make(map[string][]byte)}
+	for _, key := range keys {
+		d.keys[string(miniscriptKeyHash(key))] = key
+	}
+
+	s := NewScriptFromBytes(script.Bytes())
+	for {
+		ins, err := s.Next()
+		if err == ErrScriptEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if op, ok := miniscriptVerifyOPCodes[ins.OPCode]; ok {
+			d.tokens = append(d.tokens, &Instruction{OPCode: op}, &Instruction{OPCode: OP_VERIFY})
+			continue
+		}
+		d.tokens = append(d.tokens, ins)
+	}
+	d.pos = len(d.tokens)
+
+	m, err := d.decodeBKV()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != 0 {
+		return nil, ErrMiniscriptNotMiniscript
+	}
+	if !m.typ.Has(MiniscriptTypeB) {
+		return nil, ErrMiniscriptNotTopLevelBase
+	}
+	if !bytes.Equal(m.Script().Data, script.Bytes()) {
+		return nil, ErrMiniscriptNotMiniscript
+	}
+
+	return m, nil
+}
+
+// miniscriptDecoder reads the tokens of a script backwards, from the last
+// opcode, the way Bitcoin Core's DecodeScript does.
+type miniscriptDecoder struct {
+	ctx    MiniscriptContext
+	keys   map[string][]byte
+	tokens []*Instruction
+	pos    int
+}
+
+// peek is the i-th token before the current position, nil past the start.
+func (d *miniscriptDecoder) peek(i int) *Instruction {
+	if d.pos-1-i < 0 {
+		return nil
+	}
+
+	return d.tokens[d.pos-1-i]
+}
+
+func (d *miniscriptDecoder) is(i int, op OPCode) bool {
+	tok := d.peek(i)
+	return tok != nil && tok.OPCode == op
+}
+
+func (d *miniscriptDecoder) expect(op OPCode) error {
+	if !d.is(0, op) {
+		return fmt.Errorf("%w: expect %s", ErrMiniscriptNotMiniscript, op)
+	}
+	d.pos--
+
+	return nil
+}
+
+// number is the value of the i-th token when it pushes a number.
+func (d *miniscriptDecoder) number(i int) (int64, bool) {
+	tok := d.peek(i)
+	switch {
+	case tok == nil:
+		return 0, false
+	case tok.OPCode == OP_0:
+		return 0, true
+	case tok.OPCode >= OP_1 && tok.OPCode <= OP_16:
+		return int64(tok.OPCode-OP_1) + 1, true
+	case tok.OPCode >= OP_PUSHBYTES_1 && tok.OPCode <= OP_PUSHDATA4:
+		n, err := NewNumberFromBytes(tok.Data, true, 4)
+		return int64(n), err == nil
+	}
+
+	return 0, false
+}
+
+func (d *miniscriptDecoder) key(i int) ([]byte, bool) {
+	tok := d.peek(i)
+	if tok == nil || tok.OPCode < OP_PUSHBYTES_1 || tok.OPCode > OP_PUSHDATA4 || !isMiniscriptKey(tok.Data, d.ctx) {
+		return nil, false
+	}
+
+	return tok.Data, true
+}
+
+func (d *miniscriptDecoder) node(fragment MiniscriptFragment, k uint32, keys [][]byte, data []byte, subs ...*Miniscript) (*Miniscript, error) {
+	m := newMiniscript(d.ctx, fragment, k, keys, data, subs...)
+	if m.typ == 0 {
+		return nil, ErrMiniscriptBadType
+	}
+
+	return m, nil
+}
+
+// decodeBKV decodes an expression of type B, K or V, the and_v of the
+// expressions before it when they are not the end of an enclosing fragment.
+func (d *miniscriptDecoder) decodeBKV() (*Miniscript, error) {
+	y, err := d.decodeSingle()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := d.peek(0)
+	if tok == nil || tok.OPCode == OP_IF || tok.OPCode == OP_ELSE || tok.OPCode == OP_NOTIF ||
+		tok.OPCode == OP_TOALTSTACK || tok.OPCode == OP_SWAP {
+		return y, nil
+	}
+
+	x, err := d.decodeBKV()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.node(MiniscriptAndV, 0, nil, nil, x, y)
+}
+
+// decodeW decodes an expression of type W, a: or s:.
+func (d *miniscriptDecoder) decodeW() (*Miniscript, error) {
+	fragment, end := MiniscriptWrapS, OP_SWAP
+	if d.is(0, OP_FROMALTSTACK) {
+		d.pos--
+		fragment, end = MiniscriptWrapA, OP_TOALTSTACK
+	}
+
+	x, err := d.decodeBKV()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.expect(end); err != nil {
+		return nil, err
+	}
+
+	return d.node(fragment, 0, nil, nil, x)
+}
+
+func (d *miniscriptDecoder) decodeSingle() (*Miniscript, error) {
+	tok := d.peek(0)
+	if tok == nil {
+		return nil, ErrMiniscriptNotMiniscript
+	}
+
+	switch {
+	case tok.OPCode == OP_0:
+		d.pos--
+		return d.node(MiniscriptJust0, 0, nil, nil)
+
+	case tok.OPCode == OP_1:
+		d.pos--
+		return d.node(MiniscriptJust1, 0, nil, nil)
+	}
+
+	if key, ok := d.key(0); ok {
+		d.pos--
+		return d.node(MiniscriptPkK, 0, [][]byte{key}, nil)
+	}
+
+	if d.is(0, OP_VERIFY) && d.is(1, OP_EQUAL) && d.is(3, OP_HASH160) && d.is(4, OP_DUP) && len(d.peek(2).Data) == 20 {
+		key, ok := d.keys[string(d.peek(2).Data)]
+		if !ok {
+			return nil, ErrMiniscriptUnknowKeyHash
+		}
+		d.pos -= 5
+		return d.node(MiniscriptPkH, 0, [][]byte{key}, nil)
+	}
+
+	if d.is(0, OP_CHECKSEQUENCEVERIFY) || d.is(0, OP_CHECKLOCKTIMEVERIFY) {
+		k, ok := d.number(1)
+		if !ok || k < 1 || k >= 1<<31 {
+			return nil, ErrMiniscriptBadNumber
+		}
+		fragment := MiniscriptOlder
+		if tok.OPCode == OP_CHECKLOCKTIMEVERIFY {
+			fragment = MiniscriptAfter
+		}
+		d.pos -= 2
+		return d.node(fragment, uint32(k), nil, nil)
+	}
+
+	if size, ok := d.number(5); ok && size == 32 && d.is(0, OP_EQUAL) && d.is(3, OP_VERIFY) && d.is(4, OP_EQUAL) && d.is(6, OP_SIZE) {
+		for fragment, op := range miniscriptHashOPCodes {
+			hashSize := 32
+			if fragment == MiniscriptRipemd160 || fragment == MiniscriptHash160 {
+				hashSize = 20
+			}
+			if d.is(2, op) && len(d.peek(1).Data) == hashSize {
+				hash := d.peek(1).Data
+				d.pos -= 7
+				return d.node(fragment, 0, nil, hash)
+			}
+		}
+	}
+
+	if d.is(0, OP_CHECKMULTISIG) {
+		return d.decodeMulti()
+	}
+
+	if d.is(0, OP_NUMEQUAL) && d.ctx == MiniscriptContextTapscript {
+		return d.decodeMultiA()
+	}
+
+	switch tok.OPCode {
+	case OP_ENDIF:
+		d.pos--
+		return d.decodeEndIf()
+
+	case OP_CHECKSIG:
+		d.pos--
+		x, err := d.decodeSingle()
+		if err != nil {
+			return nil, err
+		}
+		return d.node(MiniscriptWrapC, 0, nil, nil, x)
+
+	case OP_VERIFY:
+		d.pos--
+		x, err := d.decodeSingle()
+		if err != nil {
+			return nil, err
+		}
+		return d.node(MiniscriptWrapV, 0, nil, nil, x)
+
+	case OP_0NOTEQUAL:
+		d.pos--
+		x, err := d.decodeSingle()
+		if err != nil {
+			return nil, err
+		}
+		return d.node(MiniscriptWrapN, 0, nil, nil, x)
+
+	case OP_BOOLAND, OP_BOOLOR:
+		d.pos--
+		y, err := d.decodeW()
+		if err != nil {
+			return nil, err
+		}
+		x, err := d.decodeBKV()
+		if err != nil {
+			return nil, err
+		}
+		fragment := MiniscriptAndB
+		if tok.OPCode == OP_BOOLOR {
+			fragment = MiniscriptOrB
+		}
+		return d.node(fragment, 0, nil, nil, x, y)
+
+	case OP_EQUAL:
+		k, ok := d.number(1)
+		if !ok {
+			break
+		}
+		d.pos -= 2
+		return d.decodeThresh(k)
+	}
+
+	return nil, ErrMiniscriptNotMiniscript
+}
+
+// decodeEndIf decodes the fragments ending with OP_ENDIF: or_i, andor, d:,
+// j:, or_d and or_c.
+func (d *miniscriptDecoder) decodeEndIf() (*Miniscript, error) {
+	last, err := d.decodeBKV()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case d.is(0, OP_ELSE):
+		d.pos--
+		first, err := d.decodeBKV()
+		if err != nil {
+			return nil, err
+		}
+		if d.is(0, OP_IF) {
+			d.pos--
+			return d.node(MiniscriptOrI, 0, nil, nil, first, last)
+		}
+		if err := d.expect(OP_NOTIF); err != nil {
+			return nil, err
+		}
+		x, err := d.decodeBKV()
+		if err != nil {
+			return nil, err
+		}
+		return d.node(MiniscriptAndOr, 0, nil, nil, x, last, first)
+
+	case d.is(0, OP_IF):
+		if d.is(1, OP_DUP) {
+			d.pos -= 2
+			return d.node(MiniscriptWrapD, 0, nil, nil, last)
+		}
+		if d.is(1, OP_0NOTEQUAL) && d.is(2, OP_SIZE) {
+			d.pos -= 3
+			return d.node(MiniscriptWrapJ, 0, nil, nil, last)
+		}
+
+	case d.is(0, OP_NOTIF):
+		d.pos--
+		fragment := MiniscriptOrC
+		if d.is(0, OP_IFDUP) {
+			d.pos--
+			fragment = MiniscriptOrD
+		}
+		x, err := d.decodeBKV()
+		if err != nil {
+			return nil, err
+		}
+		return d.node(fragment, 0, nil, nil, x, last)
+	}
+
+	return nil, ErrMiniscriptNotMiniscript
+}
+
+// decodeThresh decodes the subs of thresh, W expressions each followed by
+// OP_ADD after the first one.
+func (d *miniscriptDecoder) decodeThresh(k int64) (*Miniscript, error) {
+	var subs []*Miniscript
+	for d.is(0, OP_ADD) {
+		d.pos--
+		sub, err := d.decodeW()
+		if err != nil {
+			return nil, err
+		}
+		subs = append([]*Miniscript{sub}, subs...)
+	}
+
+	first, err := d.decodeBKV()
+	if err != nil {
+		return nil, err
+	}
+	subs = append([]*Miniscript{first}, subs...)
+	if k < 1 || k > int64(len(subs)) {
+		return nil, ErrMiniscriptBadThreshold
+	}
+
+	return d.node(MiniscriptThresh, uint32(k), nil, nil, subs...)
+}
+
+// decodeMulti decodes k <key>... n OP_CHECKMULTISIG.
+func (d *miniscriptDecoder) decodeMulti() (*Miniscript, error) {
+	if d.ctx != MiniscriptContextP2WSH {
+		return nil, ErrMiniscriptBadContext
+	}
+
+	n, ok := d.number(1)
+	if !ok || n < 1 || n > int64(LimitsBitcoin.MaxPubkeysPerMultisig) {
+		return nil, ErrMiniscriptBadThreshold
+	}
+	keys := make([][]byte, n)
+	for i := range keys {
+		key, ok := d.key(2 + int(n) - 1 - i)
+		if !ok {
+			return nil, ErrMiniscriptBadKey
+		}
+		keys[i] = key
+	}
+	k, ok := d.number(2 + int(n))
+	if !ok || k < 1 || k > n {
+		return nil, ErrMiniscriptBadThreshold
+	}
+	d.pos -= 3 + int(n)
+
+	return d.node(MiniscriptMulti, uint32(k), keys, nil)
+}
+
+// decodeMultiA decodes <key> CHECKSIG (<key> CHECKSIGADD)... k NUMEQUAL.
+func (d *miniscriptDecoder) decodeMultiA() (*Miniscript, error) {
+	k, ok := d.number(1)
+	if !ok {
+		return nil, ErrMiniscriptNotMiniscript
+	}
+
+	var keys [][]byte
+	i := 2
+	for d.is(i, OP_CHECKSIGADD) {
+		key, ok := d.key(i + 1)
+		if !ok {
+			return nil, ErrMiniscriptBadKey
+		}
+		keys = append([][]byte{key}, keys...)
+		i += 2
+	}
+	if !d.is(i, OP_CHECKSIG) {
+		return nil, ErrMiniscriptNotMiniscript
+	}
+	key, ok := d.key(i + 1)
+	if !ok {
+		return nil, ErrMiniscriptBadKey
+	}
+	keys = append([][]byte{key}, keys...)
+	if k < 1 || k > int64(len(keys)) || len(keys) > MiniscriptMaxPubkeysPerMultiA {
+		return nil, ErrMiniscriptBadThreshold
+	}
+	d.pos -= i + 2
+
+	return d.node(MiniscriptMultiA, uint32(k), keys, nil)
+}
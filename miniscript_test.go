@@ -0,0 +1,297 @@
+package bscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	bcrypto "github.com/detailyang/go-bcrypto"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func miniscriptTestKeys() (compressed, xonly []string, pubkeys [][]byte) {
+	for _, b := range [][32]byte{key0bytes, key1bytes, key2bytes} {
+		pubkey, _ := bcrypto.NewKey(b[:], true).GetPubkey()
+		pubkeys = append(pubkeys, pubkey.Bytes())
+		compressed = append(compressed, hex.EncodeToString(pubkey.Bytes()))
+		xonly = append(xonly, hex.EncodeToString(pubkey.Bytes()[1:]))
+	}
+
+	return compressed, xonly, pubkeys
+}
+
+// expandMiniscript replaces the key names A, B and C of s with keys.
+func expandMiniscript(s string, keys []string) string {
+	return strings.NewReplacer("A", keys[0], "B", keys[1], "C", keys[2]).Replace(s)
+}
+
+func TestMiniscript(t *testing.T) {
+	compressed, xonly, pubkeys := miniscriptTestKeys()
+	h := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		ms      string
+		ctx     MiniscriptContext
+		typ     string
+		script  string
+		witness int
+		sane    bool
+	}{
+		{"pk(A)", MiniscriptContextP2WSH, "Bonduemsk", "21Aac", 73, true},
+		{"pk(A)", MiniscriptContextTapscript, "Bonduemsk", "20Aac", 66, true},
+		{"pkh(A)", MiniscriptContextP2WSH, "Bnduemsk", "76a914#88ac", 107, true},
+		{"older(144)", MiniscriptContextP2WSH, "Bzfmxhk", "029000b2", 0, false},
+		{"and_v(v:pk(A),older(144))", MiniscriptContextP2WSH, "Bonfmsxhk", "21Aad029000b2", 73, true},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", MiniscriptContextP2WSH, "Bfmsxhk", "21Aac736421Bad029000b268", 74, true},
+		{"multi(2,A,B,C)", MiniscriptContextP2WSH, "Bnduemsk", "5221A21B21C53ae", 147, true},
+		{"multi_a(1,A,B)", MiniscriptContextTapscript, "Bduemsk", "20Aac20Bba519c", 67, true},
+		{"thresh(2,pk(A),s:pk(B),s:pk(C))", MiniscriptContextP2WSH, "Bduemsk", "21Aac7c21Bac937c21Cac935287", 147, true},
+		{"and_v(v:sha256(" + h + "),pk(A))", MiniscriptContextP2WSH, "Bnumsk", "82012088a820" + h + "8821Aac", 106, true},
+		{"andor(pk(A),older(1),pk(B))", MiniscriptContextP2WSH, "Bdemsxhk", "21Aac6421Bac6751b268", 74, true},
+		{"or_i(pk(A),pk(B))", MiniscriptContextP2WSH, "Bdumsxk", "6321Aac6721Bac68", 75, true},
+		{"tv:pk(A)", MiniscriptContextP2WSH, "Bonufmsxk", "21Aad51", 73, true},
+		{"and_v(v:after(500000001),after(1))", MiniscriptContextP2WSH, "Bzfmxij", "040165cd1db16951b1", 0, false},
+		{"and_n(pk(A),older(1))", MiniscriptContextP2WSH, "Bodemsxhk", "21Aac64006751b268", 73, true},
+	}
+
+	for _, test := range tests {
+		keys := compressed
+		if test.ctx == MiniscriptContextTapscript {
+			keys = xonly
+		}
+		src := expandMiniscript(test.ms, keys)
+
+		m, err := NewMiniscriptFromString(src, test.ctx)
+		if err != nil {
+			t.Errorf("%s: %v", test.ms, err)
+			continue
+		}
+		if m.String() != src {
+			t.Errorf("%s: expect string %s got %s", test.ms, src, m.String())
+		}
+		if m.Type().String() != test.typ {
+			t.Errorf("%s: expect type %s got %s", test.ms, test.typ, m.Type())
+		}
+
+		script := strings.ReplaceAll(expandMiniscript(test.script, keys), " ", "")
+		script = strings.ReplaceAll(script, "#", hex.EncodeToString(Hash160(pubkeys[0])))
+		if got := hex.EncodeToString(m.Script().Data); got != script {
+			t.Errorf("%s: expect script %s got %s", test.ms, script, got)
+		}
+		if size, ok := m.MaxWitnessSize(); !ok || size != test.witness {
+			t.Errorf("%s: expect witness size %d got %d", test.ms, test.witness, size)
+		}
+		if m.IsSane() != test.sane {
+			t.Errorf("%s: expect sane %v", test.ms, test.sane)
+		}
+
+		decoded, err := NewMiniscriptFromScript(m.Script(), test.ctx, pubkeys...)
+		if err != nil {
+			t.Errorf("%s: decode: %v", test.ms, err)
+			continue
+		}
+		if decoded.String() != src {
+			t.Errorf("%s: expect decoded %s got %s", test.ms, src, decoded.String())
+		}
+	}
+}
+
+func TestMiniscriptInvalid(t *testing.T) {
+	compressed, xonly, _ := miniscriptTestKeys()
+
+	tests := []struct {
+		ms  string
+		ctx MiniscriptContext
+		err error
+	}{
+		{"pk(A", MiniscriptContextP2WSH, ErrMiniscriptSyntax},
+		{"pk(A)x", MiniscriptContextP2WSH, ErrMiniscriptSyntax},
+		{"foo(A)", MiniscriptContextP2WSH, ErrMiniscriptUnknowFragment},
+		{"q:pk(A)", MiniscriptContextP2WSH, ErrMiniscriptUnknowFragment},
+		{"pk(00)", MiniscriptContextP2WSH, ErrMiniscriptBadKey},
+		{"pk(" + strings.Repeat("00", 32) + ")", MiniscriptContextTapscript, ErrMiniscriptBadKey},
+		{"sha256(abcd)", MiniscriptContextP2WSH, ErrMiniscriptBadHash},
+		{"older(0)", MiniscriptContextP2WSH, ErrMiniscriptBadNumber},
+		{"after(2147483648)", MiniscriptContextP2WSH, ErrMiniscriptBadNumber},
+		{"older(01)", MiniscriptContextP2WSH, ErrMiniscriptBadNumber},
+		{"multi(3,A,B)", MiniscriptContextP2WSH, ErrMiniscriptBadThreshold},
+		{"thresh(0,pk(A))", MiniscriptContextP2WSH, ErrMiniscriptBadThreshold},
+		{"multi(1,A)", MiniscriptContextTapscript, ErrMiniscriptBadContext},
+		{"multi_a(1,A)", MiniscriptContextP2WSH, ErrMiniscriptBadContext},
+		{"and_v(pk(A),pk(B))", MiniscriptContextP2WSH, ErrMiniscriptBadType},
+		{"thresh(1,pk(A),pk(B))", MiniscriptContextP2WSH, ErrMiniscriptBadType},
+		{"v:pk(A)", MiniscriptContextP2WSH, ErrMiniscriptNotTopLevelBase},
+		{"pk_k(A)", MiniscriptContextP2WSH, ErrMiniscriptNotTopLevelBase},
+	}
+
+	for _, test := range tests {
+		keys := compressed
+		if test.ctx == MiniscriptContextTapscript {
+			keys = xonly
+		}
+		if _, err := NewMiniscriptFromString(expandMiniscript(test.ms, keys), test.ctx); !errors.Is(err, test.err) {
+			t.Errorf("%s: expect %v got %v", test.ms, test.err, err)
+		}
+	}
+
+	m, _ := NewMiniscriptFromString(expandMiniscript("and_v(v:pk(A),pkh(B))", compressed), MiniscriptContextP2WSH)
+	if _, err := NewMiniscriptFromScript(m.Script(), MiniscriptContextP2WSH); err != ErrMiniscriptUnknowKeyHash {
+		t.Errorf("expect unknow key hash, got %v", err)
+	}
+
+	scripts := []string{
+		// OP_CHECKSIG OP_VERIFY instead of OP_CHECKSIGVERIFY
+		"21" + compressed[0] + "ac69" + "51",
+		// 1 pushed as a number instead of OP_1
+		"0101",
+		// OP_DROP has no fragment
+		"21" + compressed[0] + "ac75",
+		// a V expression at the top level
+		"21" + compressed[0] + "ad",
+	}
+	for _, s := range scripts {
+		script, _ := NewScriptFromHexString(s)
+		if _, err := NewMiniscriptFromScript(script, MiniscriptContextP2WSH); err == nil {
+			t.Errorf("%s: expect not miniscript", s)
+		}
+	}
+}
+
+func TestMiniscriptSpend(t *testing.T) {
+	compressed, xonly, pubkeys := miniscriptTestKeys()
+	secrets := [][32]byte{key0bytes, key1bytes, key2bytes}
+	preimage := []byte(strings.Repeat("p", 32))
+	sha := sha256.Sum256(preimage)
+
+	flag := ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyTaproot | ScriptVerifyStrictEncoding |
+		ScriptVerifyLowS | ScriptVerifyNullDummy | ScriptVerifyNullFail | ScriptVerifyCleanStack |
+		ScriptVerifyMinimalData | ScriptVerifyMinimalIf | ScriptVerifyCheckLockTimeVerify | ScriptVerifyCheckSequenceVerify
+
+	// the witness stack is listed bottom first, sigA to sigC sign with the
+	// keys A to C, pkA is the public key of A and pre the sha256 preimage
+	tests := []struct {
+		ms       string
+		ctx      MiniscriptContext
+		witness  []string
+		locktime uint32
+		sequence uint32
+		expect   error
+	}{
+		{"pk(A)", MiniscriptContextP2WSH, []string{"sigA"}, 0, 0, nil},
+		{"pk(A)", MiniscriptContextP2WSH, []string{"sigB"}, 0, 0, ErrInterpreterSignatureNullFail},
+		{"pkh(A)", MiniscriptContextP2WSH, []string{"sigA", "pkA"}, 0, 0, nil},
+		{"and_v(v:pk(A),older(144))", MiniscriptContextP2WSH, []string{"sigA"}, 0, 144, nil},
+		{"and_v(v:pk(A),older(144))", MiniscriptContextP2WSH, []string{"sigA"}, 0, 143, ErrInterpreterUnsatisfiedLocktime},
+		{"and_v(v:pk(A),after(500000))", MiniscriptContextP2WSH, []string{"sigA"}, 500000, 0, nil},
+		{"and_v(v:pk(A),after(500000))", MiniscriptContextP2WSH, []string{"sigA"}, 499999, 0, ErrInterpreterUnsatisfiedLocktime},
+		{"multi(2,A,B,C)", MiniscriptContextP2WSH, []string{"", "sigA", "sigC"}, 0, 0, nil},
+		{"or_b(pk(A),s:pk(B))", MiniscriptContextP2WSH, []string{"sigB", ""}, 0, 0, nil},
+		{"or_b(pk(A),s:pk(B))", MiniscriptContextP2WSH, []string{"", ""}, 0, 0, ErrInterpreterEvalFalse},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", MiniscriptContextP2WSH, []string{"sigA"}, 0, 0, nil},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", MiniscriptContextP2WSH, []string{"sigB", ""}, 0, 144, nil},
+		{"or_i(pk(A),pk(B))", MiniscriptContextP2WSH, []string{"sigA", "1"}, 0, 0, nil},
+		{"or_i(pk(A),pk(B))", MiniscriptContextP2WSH, []string{"sigB", ""}, 0, 0, nil},
+		{"thresh(2,pk(A),s:pk(B),s:pk(C))", MiniscriptContextP2WSH, []string{"sigC", "", "sigA"}, 0, 0, nil},
+		{"thresh(2,pk(A),s:pk(B),s:pk(C))", MiniscriptContextP2WSH, []string{"", "", "sigA"}, 0, 0, ErrInterpreterEvalFalse},
+		{"andor(pk(A),older(1),pk(B))", MiniscriptContextP2WSH, []string{"sigA"}, 0, 1, nil},
+		{"andor(pk(A),older(1),pk(B))", MiniscriptContextP2WSH, []string{"sigB", ""}, 0, 0, nil},
+		{"and_v(v:sha256(H),pk(A))", MiniscriptContextP2WSH, []string{"sigA", "pre"}, 0, 0, nil},
+		{"and_v(v:sha256(H),pk(A))", MiniscriptContextP2WSH, []string{"sigA", "pkA"}, 0, 0, ErrInterpreterVerifyFailed},
+
+		{"pk(A)", MiniscriptContextTapscript, []string{"sigA"}, 0, 0, nil},
+		{"pk(A)", MiniscriptContextTapscript, []string{"sigB"}, 0, 0, ErrInterpreterSchnorrSig},
+		{"and_v(v:pk(A),older(144))", MiniscriptContextTapscript, []string{"sigA"}, 0, 144, nil},
+		{"and_v(v:pk(A),after(500000))", MiniscriptContextTapscript, []string{"sigA"}, 500000, 0, nil},
+		{"multi_a(1,A,B)", MiniscriptContextTapscript, []string{"", "sigA"}, 0, 0, nil},
+		{"multi_a(1,A,B)", MiniscriptContextTapscript, []string{"sigB", ""}, 0, 0, nil},
+		{"multi_a(1,A,B)", MiniscriptContextTapscript, []string{"", ""}, 0, 0, ErrInterpreterEvalFalse},
+		{"or_b(pk(A),s:pk(B))", MiniscriptContextTapscript, []string{"sigB", ""}, 0, 0, nil},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", MiniscriptContextTapscript, []string{"sigB", ""}, 0, 144, nil},
+		{"or_i(pk(A),pk(B))", MiniscriptContextTapscript, []string{"sigB", ""}, 0, 0, nil},
+		{"thresh(2,pk(A),s:pk(B),s:pk(C))", MiniscriptContextTapscript, []string{"sigC", "sigB", ""}, 0, 0, nil},
+		{"andor(pk(A),older(1),pk(B))", MiniscriptContextTapscript, []string{"sigA"}, 0, 1, nil},
+		{"and_v(v:sha256(H),pk(A))", MiniscriptContextTapscript, []string{"sigA", "pre"}, 0, 0, nil},
+	}
+
+	internalKey := secp256k1Mul(secp256k1G, big.NewInt(0x1234)).xBytes()
+
+	for _, test := range tests {
+		keys := compressed
+		if test.ctx == MiniscriptContextTapscript {
+			keys = xonly
+		}
+		src := strings.ReplaceAll(expandMiniscript(test.ms, keys), "H", hex.EncodeToString(sha[:]))
+		m, err := NewMiniscriptFromString(src, test.ctx)
+		if err != nil {
+			t.Errorf("%s: %v", test.ms, err)
+			continue
+		}
+		script := m.Script()
+
+		var scriptPubkey *Script
+		var leafHash, control []byte
+		if test.ctx == MiniscriptContextTapscript {
+			leafHash = ComputeTapleafHash(TaprootLeafTapscript, script.Bytes())
+			outputKey, parity, _ := ComputeTaprootOutputKey(internalKey, leafHash)
+			scriptPubkey = NewScript().PushOPCode(OP_1).PushBytesWithOP(outputKey)
+			control = (&TaprootControlBlock{LeafVersion: TaprootLeafTapscript, Parity: parity, InternalKey: internalKey}).Bytes()
+		} else {
+			hash := sha256.Sum256(script.Bytes())
+			scriptPubkey, _ = NewPayToWitnessScriptHashScript(hash[:])
+		}
+
+		credit := NewCreditingTransaction(scriptPubkey, 1000)
+		tx := NewSpendingTransaction(NewScript(), credit)
+		tx.Version = 2
+		tx.Locktime = test.locktime
+		tx.Inputs[0].Sequence = test.sequence
+		ts := NewTransactionSignerWithPrevOutputs(tx, 0, credit.Outputs)
+
+		sign := func(i int) []byte {
+			if test.ctx == MiniscriptContextTapscript {
+				execdata := NewScriptExecutionData()
+				execdata.TapleafHash = leafHash
+				hash, err := ts.SignatureHash(nil, SigHashDefault, flag, SignatureVersionTapscript, execdata)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signSchnorrBIP340(new(big.Int).SetBytes(secrets[i][:]), hash.Bytes())
+			}
+
+			hash, err := ts.SignatureHash(script, SigHashAll, flag, SignatureVersionWitnessV0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, _ := bcrypto.NewKey(secrets[i][:], true).Signature(hash.Bytes(), 0)
+			return append(sig, byte(SigHashAll))
+		}
+
+		var witness [][]byte
+		for _, item := range test.witness {
+			switch item {
+			case "sigA", "sigB", "sigC":
+				witness = append(witness, sign(int(item[3]-'A')))
+			case "pkA":
+				witness = append(witness, pubkeys[0])
+			case "pre":
+				witness = append(witness, preimage)
+			case "1":
+				witness = append(witness, []byte{1})
+			default:
+				witness = append(witness, []byte{})
+			}
+		}
+		witness = append(witness, script.Bytes())
+		if control != nil {
+			witness = append(witness, control)
+		}
+
+		err = VerifyScript(NewScript(), NewScriptFromBytes(scriptPubkey.Bytes()), NewScriptWitness(witness), flag, ts, SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("%s %d %v: expect %v got %v", test.ms, test.ctx, test.witness, test.expect, err)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package bscript
+
+import "strings"
+
+// MiniscriptType is the set of type properties of a Miniscript node, see
+// https://bitcoin.sipa.be/miniscript/. Exactly one of the basic types B, V,
+// K and W is set on a valid node, the zero type is an invalid node.
+type MiniscriptType uint32
+
+const (
+	// MiniscriptTypeB leaves a nonzero value on success and an exact zero on
+	// dissatisfaction.
+	MiniscriptTypeB MiniscriptType = 1 << iota
+	// MiniscriptTypeV leaves nothing on success and can not be dissatisfied.
+	MiniscriptTypeV
+	// MiniscriptTypeK leaves a key for a signature check.
+	MiniscriptTypeK
+	// MiniscriptTypeW takes its input from one below the top of the stack.
+	MiniscriptTypeW
+	// MiniscriptTypeZ consumes exactly zero stack elements.
+	MiniscriptTypeZ
+	// MiniscriptTypeO consumes exactly one stack element.
+	MiniscriptTypeO
+	// MiniscriptTypeN consumes a nonzero top element on satisfaction.
+	MiniscriptTypeN
+	// MiniscriptTypeD has a dissatisfaction.
+	MiniscriptTypeD
+	// MiniscriptTypeU leaves exactly 1 on satisfaction.
+	MiniscriptTypeU
+	// MiniscriptTypeF can not be dissatisfied without a signature.
+	MiniscriptTypeF
+	// MiniscriptTypeE has a unique, non malleable dissatisfaction.
+	MiniscriptTypeE
+	// MiniscriptTypeM has a non malleable satisfaction.
+	MiniscriptTypeM
+	// MiniscriptTypeS always needs a signature to be satisfied.
+	MiniscriptTypeS
+	// MiniscriptTypeX ends with an opcode without a VERIFY form.
+	MiniscriptTypeX
+	// MiniscriptTypeG contains a relative time lock.
+	MiniscriptTypeG
+	// MiniscriptTypeH contains a relative height lock.
+	MiniscriptTypeH
+	// MiniscriptTypeI contains an absolute time lock.
+	MiniscriptTypeI
+	// MiniscriptTypeJ contains an absolute height lock.
+	MiniscriptTypeJ
+	// MiniscriptTypeNoMix, the k property, has no satisfaction mixing heights
+	// and times.
+	MiniscriptTypeNoMix
+)
+
+const miniscriptTypeLetters = "BVKWzondufemsxghijk"
+
+// newMiniscriptType is the type of the letters in s.
+func newMiniscriptType(s string) MiniscriptType {
+	var t MiniscriptType
+	for _, c := range s {
+		t |= 1 << uint(strings.IndexRune(miniscriptTypeLetters, c))
+	}
+
+	return t
+}
+
+// Has reports whether t has all the properties of o.
+func (t MiniscriptType) Has(o MiniscriptType) bool {
+	return t&o == o
+}
+
+func (t MiniscriptType) String() string {
+	var b strings.Builder
+	for i, c := range miniscriptTypeLetters {
+		if t&(1<<uint(i)) != 0 {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+func (t MiniscriptType) has(s string) bool {
+	return t.Has(newMiniscriptType(s))
+}
+
+// when is t if cond holds, the empty type otherwise.
+func (t MiniscriptType) when(cond bool) MiniscriptType {
+	if cond {
+		return t
+	}
+
+	return 0
+}
+
+func (t MiniscriptType) and(s string) MiniscriptType {
+	return t & newMiniscriptType(s)
+}
+
+var (
+	miniscriptTypeBasic = newMiniscriptType("BVKW")
+	miniscriptTypeTime  = newMiniscriptType("ghij")
+)
+
+// sanitize drops t to the empty type when its properties contradict each
+// other.
+func (t MiniscriptType) sanitize() MiniscriptType {
+	switch t & miniscriptTypeBasic {
+	case MiniscriptTypeB, MiniscriptTypeV, MiniscriptTypeK, MiniscriptTypeW:
+	default:
+		return 0
+	}
+
+	if t.has("z") && t.has("o") || t.has("n") && t.has("z") || t.has("n") && t.has("W") ||
+		t.has("V") && t.has("d") || t.has("K") && !t.has("u") || t.has("V") && t.has("u") ||
+		t.has("e") && t.has("f") || t.has("e") && !t.has("d") || t.has("V") && t.has("e") ||
+		t.has("d") && t.has("f") || t.has("V") && !t.has("f") || t.has("K") && !t.has("s") ||
+		t.has("z") && !t.has("m") {
+		return 0
+	}
+
+	return t
+}
+
+// miniscriptNoTimelockMix is k of a conjunction of x and y, which no longer holds
+// once a satisfaction needs both a height and a time lock of the same kind.
+func miniscriptNoTimelockMix(x, y MiniscriptType) MiniscriptType {
+	mixed := x.has("g") && y.has("h") || x.has("h") && y.has("g") ||
+		x.has("i") && y.has("j") || x.has("j") && y.has("i")
+
+	return MiniscriptTypeNoMix.when(x.has("k") && y.has("k") && !mixed)
+}
+
+// computeType follows the type rules of Bitcoin Core's ComputeType.
+func (m *Miniscript) computeType() MiniscriptType {
+	var x, y, z MiniscriptType
+	for _, sub := range m.Subs {
+		if sub.typ == 0 {
+			return 0
+		}
+	}
+	if len(m.Subs) > 0 {
+		x = m.Subs[0].typ
+	}
+	if len(m.Subs) > 1 {
+		y = m.Subs[1].typ
+	}
+	if len(m.Subs) > 2 {
+		z = m.Subs[2].typ
+	}
+
+	var t MiniscriptType
+	switch m.Fragment {
+	case MiniscriptJust0:
+		t = newMiniscriptType("Bzudemsxk")
+	case MiniscriptJust1:
+		t = newMiniscriptType("Bzufmxk")
+	case MiniscriptPkK:
+		t = newMiniscriptType("Konudemsxk")
+	case MiniscriptPkH:
+		t = newMiniscriptType("Knudemsxk")
+	case MiniscriptOlder:
+		time := m.K&TransactionSequenceLockTimeTypeFlag != 0
+		t = MiniscriptTypeG.when(time) | MiniscriptTypeH.when(!time) | newMiniscriptType("Bzfmxk")
+	case MiniscriptAfter:
+		time := m.K >= TransactionSignerLocktimeThreshold
+		t = MiniscriptTypeI.when(time) | MiniscriptTypeJ.when(!time) | newMiniscriptType("Bzfmxk")
+	case MiniscriptSha256, MiniscriptHash256, MiniscriptRipemd160, MiniscriptHash160:
+		t = newMiniscriptType("Bonudmk")
+	case MiniscriptMulti:
+		t = newMiniscriptType("Bnudemsk")
+	case MiniscriptMultiA:
+		t = newMiniscriptType("Budemsk")
+
+	case MiniscriptWrapA:
+		t = MiniscriptTypeW.when(x.has("B")) | x.and("ghijk") | x.and("udfems") | MiniscriptTypeX
+	case MiniscriptWrapS:
+		t = MiniscriptTypeW.when(x.has("Bo")) | x.and("ghijk") | x.and("udfemsx")
+	case MiniscriptWrapC:
+		t = MiniscriptTypeB.when(x.has("K")) | x.and("ghijk") | x.and("ondfem") | newMiniscriptType("us")
+	case MiniscriptWrapD:
+		// MINIMALIF is consensus in tapscript only, so d: is u there alone
+		t = MiniscriptTypeB.when(x.has("Vz")) | MiniscriptTypeO.when(x.has("z")) | MiniscriptTypeE.when(x.has("f")) |
+			x.and("ghijk") | x.and("ms") | MiniscriptTypeU.when(m.ctx == MiniscriptContextTapscript) | newMiniscriptType("ndx")
+	case MiniscriptWrapV:
+		t = MiniscriptTypeV.when(x.has("B")) | x.and("ghijk") | x.and("zonms") | newMiniscriptType("fx")
+	case MiniscriptWrapJ:
+		t = MiniscriptTypeB.when(x.has("Bn")) | MiniscriptTypeE.when(x.has("f")) | x.and("ghijk") | x.and("oums") | newMiniscriptType("ndx")
+	case MiniscriptWrapN:
+		t = x.and("ghijk") | x.and("Bzondfems") | newMiniscriptType("ux")
+
+	case MiniscriptAndV:
+		t = y.and("KVB").when(x.has("V")) | x.and("n") | y.and("n").when(x.has("z")) |
+			(x | y).and("o").when((x | y).has("z")) | (x & y).and("dmz") | (x | y).and("s") |
+			MiniscriptTypeF.when(y.has("f") || x.has("s")) | y.and("ux") | (x|y)&miniscriptTypeTime |
+			miniscriptNoTimelockMix(x, y)
+	case MiniscriptAndB:
+		t = x.and("B").when(y.has("W")) | (x | y).and("o").when((x | y).has("z")) | x.and("n") |
+			y.and("n").when(x.has("z")) | (x & y).and("e").when((x & y).has("s")) | (x & y).and("dzm") |
+			MiniscriptTypeF.when((x&y).has("f") || x.has("sf") || y.has("sf")) | (x | y).and("s") |
+			newMiniscriptType("ux") | (x|y)&miniscriptTypeTime | miniscriptNoTimelockMix(x, y)
+	case MiniscriptOrB:
+		t = MiniscriptTypeB.when(x.has("Bd") && y.has("Wd")) | (x | y).and("o").when((x | y).has("z")) |
+			(x & y).and("m").when((x|y).has("s") && (x&y).has("e")) | (x & y).and("zse") |
+			newMiniscriptType("dux") | (x|y)&miniscriptTypeTime | (x & y).and("k")
+	case MiniscriptOrC:
+		t = y.and("V").when(x.has("Bdu")) | x.and("o").when(y.has("z")) |
+			(x & y).and("m").when(x.has("e") && (x|y).has("s")) | (x & y).and("zs") |
+			newMiniscriptType("fx") | (x|y)&miniscriptTypeTime | (x & y).and("k")
+	case MiniscriptOrD:
+		t = y.and("B").when(x.has("Bdu")) | x.and("o").when(y.has("z")) |
+			(x & y).and("m").when(x.has("e") && (x|y).has("s")) | (x & y).and("zes") |
+			y.and("ufde") | MiniscriptTypeX | (x|y)&miniscriptTypeTime | (x & y).and("k")
+	case MiniscriptOrI:
+		t = (x & y).and("VBKufs") | MiniscriptTypeO.when((x & y).has("z")) |
+			(x | y).and("e").when((x | y).has("f")) | (x & y).and("m").when((x | y).has("s")) |
+			(x | y).and("d") | MiniscriptTypeX | (x|y)&miniscriptTypeTime | (x & y).and("k")
+	case MiniscriptAndOr:
+		t = (y & z).and("BKV").when(x.has("Bdu")) | (x & y & z).and("z") |
+			(x | y&z).and("o").when((x | y&z).has("z")) | (y & z).and("u") |
+			z.and("f").when(x.has("s") || y.has("f")) | z.and("d") |
+			z.and("e").when(x.has("s") || y.has("f")) |
+			(x & y & z).and("m").when(x.has("e") && (x|y|z).has("s")) | (z & (x | y)).and("s") |
+			MiniscriptTypeX | (x|y|z)&miniscriptTypeTime |
+			MiniscriptTypeNoMix.when(z.has("k") && miniscriptNoTimelockMix(x, y) != 0)
+	case MiniscriptThresh:
+		t = m.computeThreshType()
+	}
+
+	return t.sanitize()
+}
+
+func (m *Miniscript) computeThreshType() MiniscriptType {
+	allE, allM := true, true
+	args, numS := 0, 0
+	acc := MiniscriptTypeNoMix
+	for i, sub := range m.Subs {
+		t := sub.typ
+		if i == 0 && !t.has("Bdu") || i > 0 && !t.has("Wdu") {
+			return 0
+		}
+		allE = allE && t.has("e")
+		allM = allM && t.has("m")
+		if t.has("s") {
+			numS++
+		}
+		switch {
+		case t.has("z"):
+		case t.has("o"):
+			args++
+		default:
+			args += 2
+		}
+
+		noMix := MiniscriptTypeNoMix
+		if m.K > 1 {
+			noMix = miniscriptNoTimelockMix(acc, t)
+		}
+		acc = (acc|t)&miniscriptTypeTime | MiniscriptTypeNoMix.when(acc.has("k") && t.has("k") && noMix != 0)
+	}
+
+	n, k := len(m.Subs), int(m.K)
+	return newMiniscriptType("Bdu") | MiniscriptTypeZ.when(args == 0) | MiniscriptTypeO.when(args == 1) |
+		MiniscriptTypeE.when(allE && numS == n) | MiniscriptTypeM.when(allE && allM && numS >= n-k) |
+		MiniscriptTypeS.when(numS >= n-k+1) | acc
+}
+
+// Type is the type of m.
+func (m *Miniscript) Type() MiniscriptType {
+	return m.typ
+}
+
+// IsNonMalleable reports whether every satisfaction of m can be made non
+// malleable, the m property.
+func (m *Miniscript) IsNonMalleable() bool {
+	return m.typ.Has(MiniscriptTypeM)
+}
+
+// NeedsSignature reports whether every satisfaction of m needs a signature,
+// the s property.
+func (m *Miniscript) NeedsSignature() bool {
+	return m.typ.Has(MiniscriptTypeS)
+}
+
+// HasTimelockMix reports whether some satisfaction of m needs both a height
+// and a time lock of the same kind, which no transaction can meet.
+func (m *Miniscript) HasTimelockMix() bool {
+	return !m.typ.Has(MiniscriptTypeNoMix)
+}
+
+// miniscriptMaxInt is a size that may not exist, the size of the
+// satisfaction of a fragment which can not be satisfied for one.
+type miniscriptMaxInt struct {
+	valid bool
+	n     int
+}
+
+func miniscriptSize(n int) miniscriptMaxInt {
+	return miniscriptMaxInt{valid: true, n: n}
+}
+
+var miniscriptNoSize = miniscriptMaxInt{}
+
+func (a miniscriptMaxInt) add(b miniscriptMaxInt) miniscriptMaxInt {
+	if !a.valid || !b.valid {
+		return miniscriptNoSize
+	}
+
+	return miniscriptSize(a.n + b.n)
+}
+
+func (a miniscriptMaxInt) plus(n int) miniscriptMaxInt {
+	return a.add(miniscriptSize(n))
+}
+
+// or is the larger of a and b.
+func (a miniscriptMaxInt) or(b miniscriptMaxInt) miniscriptMaxInt {
+	if !a.valid {
+		return b
+	}
+	if !b.valid || a.n >= b.n {
+		return a
+	}
+
+	return b
+}
+
+// miniscriptWitnessSize is the largest satisfaction and dissatisfaction of
+// a node, in serialized bytes and in stack elements.
+type miniscriptWitnessSize struct {
+	sat, dsat           miniscriptMaxInt
+	satItems, dsatItems miniscriptMaxInt
+}
+
+// computeWitnessSize follows Bitcoin Core's CalcWitnessSize and
+// CalcStackSize.
+func (m *Miniscript) computeWitnessSize() miniscriptWitnessSize {
+	sigSize, pubkeySize := 1+72, 1+33
+	if m.ctx == MiniscriptContextTapscript {
+		sigSize, pubkeySize = 1+65, 1+32
+	}
+	fixed := func(sat, dsat, satItems, dsatItems miniscriptMaxInt) miniscriptWitnessSize {
+		return miniscriptWitnessSize{sat: sat, dsat: dsat, satItems: satItems, dsatItems: dsatItems}
+	}
+
+	var x, y, z miniscriptWitnessSize
+	if len(m.Subs) > 0 {
+		x = m.Subs[0].size
+	}
+	if len(m.Subs) > 1 {
+		y = m.Subs[1].size
+	}
+	if len(m.Subs) > 2 {
+		z = m.Subs[2].size
+	}
+	k, n := int(m.K), len(m.Keys)
+
+	switch m.Fragment {
+	case MiniscriptJust0:
+		return fixed(miniscriptNoSize, miniscriptSize(0), miniscriptNoSize, miniscriptSize(0))
+	case MiniscriptJust1, MiniscriptOlder, MiniscriptAfter:
+		return fixed(miniscriptSize(0), miniscriptNoSize, miniscriptSize(0), miniscriptNoSize)
+	case MiniscriptPkK:
+		return fixed(miniscriptSize(sigSize), miniscriptSize(1), miniscriptSize(1), miniscriptSize(1))
+	case MiniscriptPkH:
+		return fixed(miniscriptSize(sigSize+pubkeySize), miniscriptSize(1+pubkeySize), miniscriptSize(2), miniscriptSize(2))
+	case MiniscriptMulti:
+		return fixed(miniscriptSize(k*sigSize+1), miniscriptSize(k+1), miniscriptSize(k+1), miniscriptSize(k+1))
+	case MiniscriptMultiA:
+		return fixed(miniscriptSize(k*sigSize+n-k), miniscriptSize(n), miniscriptSize(n), miniscriptSize(n))
+	case MiniscriptSha256, MiniscriptHash256, MiniscriptRipemd160, MiniscriptHash160:
+		return fixed(miniscriptSize(1+32), miniscriptNoSize, miniscriptSize(1), miniscriptNoSize)
+
+	case MiniscriptWrapA, MiniscriptWrapS, MiniscriptWrapC, MiniscriptWrapN:
+		return x
+	case MiniscriptWrapD:
+		return fixed(x.sat.plus(1+1), miniscriptSize(1), x.satItems.plus(1), miniscriptSize(1))
+	case MiniscriptWrapV:
+		return fixed(x.sat, miniscriptNoSize, x.satItems, miniscriptNoSize)
+	case MiniscriptWrapJ:
+		return fixed(x.sat, miniscriptSize(1), x.satItems, miniscriptSize(1))
+
+	case MiniscriptAndV:
+		return fixed(x.sat.add(y.sat), miniscriptNoSize, x.satItems.add(y.satItems), miniscriptNoSize)
+	case MiniscriptAndB:
+		return fixed(x.sat.add(y.sat), x.dsat.add(y.dsat), x.satItems.add(y.satItems), x.dsatItems.add(y.dsatItems))
+	case MiniscriptOrB:
+		return fixed(x.dsat.add(y.sat).or(x.sat.add(y.dsat)), x.dsat.add(y.dsat),
+			x.dsatItems.add(y.satItems).or(x.satItems.add(y.dsatItems)), x.dsatItems.add(y.dsatItems))
+	case MiniscriptOrC:
+		return fixed(x.sat.or(x.dsat.add(y.sat)), miniscriptNoSize, x.satItems.or(x.dsatItems.add(y.satItems)), miniscriptNoSize)
+	case MiniscriptOrD:
+		return fixed(x.sat.or(x.dsat.add(y.sat)), x.dsat.add(y.dsat),
+			x.satItems.or(x.dsatItems.add(y.satItems)), x.dsatItems.add(y.dsatItems))
+	case MiniscriptOrI:
+		// the branch is picked with a 1 or an empty push
+		return fixed(x.sat.plus(1+1).or(y.sat.plus(1)), x.dsat.plus(1+1).or(y.dsat.plus(1)),
+			x.satItems.plus(1).or(y.satItems.plus(1)), x.dsatItems.plus(1).or(y.dsatItems.plus(1)))
+	case MiniscriptAndOr:
+		return fixed(x.sat.add(y.sat).or(x.dsat.add(z.sat)), x.dsat.add(z.dsat),
+			x.satItems.add(y.satItems).or(x.dsatItems.add(z.satItems)), x.dsatItems.add(z.dsatItems))
+	case MiniscriptThresh:
+		// sats[j] is the largest witness of the subs so far with j of them
+		// satisfied
+		sats, items := []miniscriptMaxInt{miniscriptSize(0)}, []miniscriptMaxInt{miniscriptSize(0)}
+		for _, sub := range m.Subs {
+			nextSats := []miniscriptMaxInt{sats[0].add(sub.size.dsat)}
+			nextItems := []miniscriptMaxInt{items[0].add(sub.size.dsatItems)}
+			for j := 1; j < len(sats); j++ {
+				nextSats = append(nextSats, sats[j].add(sub.size.dsat).or(sats[j-1].add(sub.size.sat)))
+				nextItems = append(nextItems, items[j].add(sub.size.dsatItems).or(items[j-1].add(sub.size.satItems)))
+			}
+			nextSats = append(nextSats, sats[len(sats)-1].add(sub.size.sat))
+			nextItems = append(nextItems, items[len(items)-1].add(sub.size.satItems))
+			sats, items = nextSats, nextItems
+		}
+		if k >= len(sats) {
+			return miniscriptWitnessSize{}
+		}
+		return fixed(sats[k], sats[0], items[k], items[0])
+	}
+
+	return miniscriptWitnessSize{}
+}
+
+// MaxWitnessSize is the size of the largest satisfaction of m, its witness
+// elements with their length prefixes but without the script itself. It is
+// false when m can not be satisfied.
+func (m *Miniscript) MaxWitnessSize() (int, bool) {
+	return m.size.sat.n, m.size.sat.valid
+}
+
+// MaxWitnessItems is the number of witness elements of the largest
+// satisfaction of m, false when m can not be satisfied.
+func (m *Miniscript) MaxWitnessItems() (int, bool) {
+	return m.size.satItems.n, m.size.satItems.valid
+}
+
+// IsSane reports whether m is safe to use: it needs a signature, has a non
+// malleable satisfaction, mixes no time locks, repeats no key and its
+// satisfaction fits the standardness limits of its context. The ops limit
+// of P2WSH and the execution stack of tapscript are not checked.
+func (m *Miniscript) IsSane() bool {
+	if !m.typ.Has(MiniscriptTypeB|MiniscriptTypeM|MiniscriptTypeS|MiniscriptTypeNoMix) || m.hasDuplicateKey() {
+		return false
+	}
+
+	items, ok := m.MaxWitnessItems()
+	if !ok {
+		return false
+	}
+	if m.ctx == MiniscriptContextTapscript {
+		return items <= MiniscriptMaxTapscriptStackSize
+	}
+
+	return items <= MiniscriptMaxStandardP2WSHStackItems && len(m.Script().Data) <= MiniscriptMaxStandardP2WSHScriptSize
+}
+
+func (m *Miniscript) hasDuplicateKey() bool {
+	seen := make(map[string]bool)
+	var walk func(*Miniscript) bool
+	walk = func(n *Miniscript) bool {
+		for _, key := range n.Keys {
+			if seen[string(key)] {
+				return true
+			}
+			seen[string(key)] = true
+		}
+		for _, sub := range n.Subs {
+			if walk(sub) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return walk(m)
+}
@@ -0,0 +1,242 @@
+package bscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrMultisigNotMultisig    = errors.New("multisig: not a multisig script")
+	ErrMultisigScriptMismatch = errors.New("multisig: script does not match the spent output")
+	ErrMultisigNoMatchingKey  = errors.New("multisig: signature matches no public key")
+	ErrMultisigMissingSigs    = errors.New("multisig: missing signatures")
+	ErrMultisigBadInputIndex  = errors.New("multisig: bad input index")
+)
+
+// multisigSpend is how the output spent by a PartialMultisig wraps its
+// multisig script.
+type multisigSpend uint8
+
+const (
+	multisigSpendBare multisigSpend = iota
+	multisigSpendP2SH
+	multisigSpendP2WSH
+	multisigSpendP2SHP2WSH
+)
+
+// PartialMultisig collects the signatures of the cosigners of a multisig
+// input, in any order and from any number of partial scriptSigs, until
+// Finalize can build the final scriptSig and witness.
+type PartialMultisig struct {
+	Transaction *bcore.Transaction
+	InputIndex  int
+	PrevOutput  *bcore.TransactionOutput
+	Script      *Script
+	Flag        Flag
+
+	spend   multisigSpend
+	version SignatureVersion
+	m       int
+	pubkeys [][]byte
+	// sigs holds the signature of each of pubkeys, nil while missing
+	sigs [][]byte
+}
+
+// NewPartialMultisig prepares input index of tx, which spends prevOutput
+// paying to script bare, P2SH, P2WSH or P2SH wrapped P2WSH. Signatures are
+// checked under flag.
+func NewPartialMultisig(tx *bcore.Transaction, index int, prevOutput *bcore.TransactionOutput, script *Script, flag Flag) (*PartialMultisig, error) {
+	if index < 0 || index >= len(tx.Inputs) {
+		return nil, ErrMultisigBadInputIndex
+	}
+
+	m, pubkeys, ok := script.ParseMultisig()
+	if !ok {
+		return nil, ErrMultisigNotMultisig
+	}
+
+	p := &PartialMultisig{
+		Transaction: tx,
+		InputIndex:  index,
+		PrevOutput:  prevOutput,
+		Script:      script,
+		Flag:        flag,
+		version:     SignatureVersionBase,
+		m:           m,
+		pubkeys:     pubkeys,
+		sigs:        make([][]byte, len(pubkeys)),
+	}
+
+	h := sha256.Sum256(script.Data)
+	p2sh, _ := NewPayToScriptHashScript(Hash160(script.Data))
+	p2wsh, _ := NewPayToWitnessScriptHashScript(h[:])
+	p2shp2wsh, _ := NewPayToScriptHashScript(Hash160(p2wsh.Data))
+
+	switch scriptPubkey := prevOutput.ScriptPubkey; {
+	case bytes.Equal(scriptPubkey, script.Data):
+		p.spend = multisigSpendBare
+	case bytes.Equal(scriptPubkey, p2sh.Data):
+		p.spend = multisigSpendP2SH
+	case bytes.Equal(scriptPubkey, p2wsh.Data):
+		p.spend, p.version = multisigSpendP2WSH, SignatureVersionWitnessV0
+	case bytes.Equal(scriptPubkey, p2shp2wsh.Data):
+		p.spend, p.version = multisigSpendP2SHP2WSH, SignatureVersionWitnessV0
+	default:
+		return nil, ErrMultisigScriptMismatch
+	}
+
+	return p, nil
+}
+
+// AddSignature matches sig, hash type included, to the public key it
+// verifies against and returns the index of that key. A signature for a key
+// which already has one replaces it.
+func (p *PartialMultisig) AddSignature(sig []byte) (int, error) {
+	if err := CheckECDSASignatureEncoding(sig, p.Flag, p.version); err != nil {
+		return -1, err
+	}
+
+	ts := NewTransactionSigner(p.Transaction, p.InputIndex, p.PrevOutput.Value)
+	for i, pubkey := range p.pubkeys {
+		if len(sig) > 0 && ts.CheckSignature(sig, pubkey, p.Script, p.Flag, p.version) == nil {
+			p.sigs[i] = sig
+			return i, nil
+		}
+	}
+
+	return -1, ErrMultisigNoMatchingKey
+}
+
+// AddScriptSig merges the signatures of a partial scriptSig or witness, as
+// another cosigner produced them, and returns how many it added. Pushes
+// which are not signatures of the input, such as the dummy or the scripts,
+// are skipped.
+func (p *PartialMultisig) AddScriptSig(scriptSig *Script, witness ScriptWitness) (int, error) {
+	items := [][]byte(witness)
+	if scriptSig != nil {
+		s := NewScriptFromBytes(scriptSig.Data)
+		for {
+			ins, err := s.Next()
+			if err == ErrScriptEOF {
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			items = append(items, ins.Data)
+		}
+	}
+
+	n := 0
+	for _, item := range items {
+		if len(item) == 0 {
+			continue
+		}
+		if _, err := p.AddSignature(item); err == nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Status reports how many signatures are collected and how many are still
+// missing.
+func (p *PartialMultisig) Status() (int, int) {
+	n := 0
+	for _, sig := range p.sigs {
+		if sig != nil {
+			n++
+		}
+	}
+
+	if n >= p.m {
+		return n, 0
+	}
+
+	return n, p.m - n
+}
+
+// Signatures are the collected signatures in key order, to hand over to
+// the other cosigners.
+func (p *PartialMultisig) Signatures() [][]byte {
+	var sigs [][]byte
+	for _, sig := range p.sigs {
+		if sig != nil {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	return sigs
+}
+
+// Finalize builds the scriptSig and witness spending the input with m of
+// the collected signatures in key order and verifies the result, which
+// becomes the scriptSig of the input once it does.
+func (p *PartialMultisig) Finalize() (*Script, ScriptWitness, error) {
+	if _, missing := p.Status(); missing > 0 {
+		return nil, nil, ErrMultisigMissingSigs
+	}
+
+	// the extra item CHECKMULTISIG pops
+	stack := [][]byte{{}}
+	for _, sig := range p.sigs {
+		if sig != nil && len(stack) <= p.m {
+			stack = append(stack, sig)
+		}
+	}
+
+	var witness ScriptWitness
+	switch p.spend {
+	case multisigSpendP2SH:
+		stack = append(stack, p.Script.Bytes())
+	case multisigSpendP2WSH, multisigSpendP2SHP2WSH:
+		witness = NewScriptWitness(append(stack, p.Script.Bytes()))
+		stack = nil
+		if p.spend == multisigSpendP2SHP2WSH {
+			h := sha256.Sum256(p.Script.Data)
+			p2wsh, _ := NewPayToWitnessScriptHashScript(h[:])
+			stack = [][]byte{p2wsh.Bytes()}
+		}
+	}
+
+	scriptSig := pushAll(stack)
+	input := p.Transaction.Inputs[p.InputIndex]
+	original := input.ScriptSig
+	input.ScriptSig = scriptSig.Bytes()
+
+	err := VerifyScript(NewScriptFromBytes(scriptSig.Bytes()), NewScriptFromBytes(p.PrevOutput.ScriptPubkey), witness,
+		p.Flag, NewTransactionSigner(p.Transaction, p.InputIndex, p.PrevOutput.Value), SignatureVersionBase)
+	if err != nil {
+		input.ScriptSig = original
+		return nil, nil, err
+	}
+
+	return scriptSig, witness, nil
+}
+
+// SignMultisig adds the signatures of the keys s holds to p and returns how
+// many it added.
+func (s *Signer) SignMultisig(p *PartialMultisig) (int, error) {
+	ts := NewTransactionSigner(p.Transaction, p.InputIndex, p.PrevOutput.Value)
+
+	n := 0
+	for i, pubkey := range p.pubkeys {
+		sig, err := s.createSignature(ts, pubkey, p.Script, p.version, s.SigHash)
+		if err == ErrSignerMissingKey {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		p.sigs[i] = sig
+		n++
+	}
+
+	return n, nil
+}
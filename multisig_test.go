@@ -0,0 +1,151 @@
+package bscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	bcrypto "github.com/detailyang/go-bcrypto"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func TestPartialMultisig(t *testing.T) {
+	keys := make([]*bcrypto.Key, 5)
+	pubkeys := make([][]byte, 5)
+	for i := range keys {
+		b := [32]byte{31: byte(i + 1)}
+		keys[i] = bcrypto.NewKey(b[:], true)
+		pubkey, _ := keys[i].GetPubkey()
+		pubkeys[i] = pubkey.Bytes()
+	}
+
+	flag := ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyStrictEncoding | ScriptVerifyLowS |
+		ScriptVerifyNullDummy | ScriptVerifyNullFail | ScriptVerifyCleanStack
+
+	twoOfThree, _ := NewMultisigScript(2, pubkeys[:3])
+	threeOfFive, _ := NewSortedMultisigScript(3, pubkeys)
+	h := sha256.Sum256(threeOfFive.Data)
+	p2wsh, _ := NewPayToWitnessScriptHashScript(h[:])
+	p2sh, _ := NewPayToScriptHashScript(Hash160(twoOfThree.Data))
+	p2shp2wsh, _ := NewPayToScriptHashScript(Hash160(p2wsh.Data))
+
+	tests := []struct {
+		name         string
+		script       *Script
+		scriptPubkey *Script
+		signers      []int
+		witness      bool
+	}{
+		{"bare 2-of-3", twoOfThree, twoOfThree, []int{2, 0}, false},
+		{"p2sh 2-of-3", twoOfThree, p2sh, []int{1, 2}, false},
+		{"p2wsh 3-of-5", threeOfFive, p2wsh, []int{4, 0, 2}, true},
+		{"p2sh-p2wsh 3-of-5", threeOfFive, p2shp2wsh, []int{3, 1, 4, 0}, true},
+	}
+
+	for _, test := range tests {
+		creditTx := NewCreditingTransaction(test.scriptPubkey, 1000)
+		tx := NewSpendingTransaction(NewScript(), creditTx)
+
+		coordinator, err := NewPartialMultisig(tx, 0, creditTx.Outputs[0], test.script, flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _ := test.script.ParseMultisig()
+		for i, k := range test.signers {
+			// each cosigner signs on their own and hands the signature over
+			cosigner, _ := NewPartialMultisig(tx, 0, creditTx.Outputs[0], test.script, flag)
+			signer := NewSigner(flag, SigHashAll)
+			signer.AddKey(keys[k])
+			if n, err := signer.SignMultisig(cosigner); n != 1 || err != nil {
+				t.Fatalf("%s: expect one signature got %d %v", test.name, n, err)
+			}
+
+			sig := cosigner.Signatures()[0]
+			if _, err := coordinator.AddSignature(sig); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			want := m - i - 1
+			if want < 0 {
+				want = 0
+			}
+			have, missing := coordinator.Status()
+			if have != i+1 || missing != want {
+				t.Errorf("%s: unexpect status %d %d", test.name, have, missing)
+			}
+			if missing > 0 {
+				if _, _, err := coordinator.Finalize(); err != ErrMultisigMissingSigs {
+					t.Errorf("%s: expect missing signatures, got %v", test.name, err)
+				}
+			}
+		}
+
+		scriptSig, witness, err := coordinator.Finalize()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.witness != (witness.Size() > 0) {
+			t.Errorf("%s: unexpected witness %x", test.name, witness)
+		}
+		if !bytes.Equal(tx.Inputs[0].ScriptSig, scriptSig.Bytes()) {
+			t.Errorf("%s: expect the input scriptSig to be set", test.name)
+		}
+
+		// a second coordinator merges the final scriptSig and witness
+		merged, _ := NewPartialMultisig(tx, 0, creditTx.Outputs[0], test.script, flag)
+		if n, err := merged.AddScriptSig(scriptSig, witness); err != nil || n != m {
+			t.Errorf("%s: expect %d merged signatures got %d %v", test.name, m, n, err)
+		}
+	}
+}
+
+func TestPartialMultisigErrors(t *testing.T) {
+	key := bcrypto.NewKey(key0bytes[:], true)
+	other := bcrypto.NewKey(key1bytes[:], true)
+	pubkey, _ := key.GetPubkey()
+	multisig, _ := NewMultisigScript(1, [][]byte{pubkey.Bytes()})
+	p2pkh, _ := NewPayToPubkeyHashScript(Hash160(pubkey.Bytes()))
+
+	creditTx := NewCreditingTransaction(multisig, 1000)
+	tx := NewSpendingTransaction(NewScript(), creditTx)
+
+	if _, err := NewPartialMultisig(tx, 0, creditTx.Outputs[0], p2pkh, 0); err != ErrMultisigNotMultisig {
+		t.Errorf("expect not multisig, got %v", err)
+	}
+	other2, _ := NewMultisigScript(1, [][]byte{pubkey.Bytes(), pubkey.Bytes()})
+	if _, err := NewPartialMultisig(tx, 0, creditTx.Outputs[0], other2, 0); err != ErrMultisigScriptMismatch {
+		t.Errorf("expect script mismatch, got %v", err)
+	}
+	if _, err := NewPartialMultisig(tx, 1, creditTx.Outputs[0], multisig, 0); err != ErrMultisigBadInputIndex {
+		t.Errorf("expect bad input index, got %v", err)
+	}
+
+	p, _ := NewPartialMultisig(tx, 0, creditTx.Outputs[0], multisig, 0)
+	signer := NewSigner(0, SigHashAll)
+	signer.AddKey(other)
+	if n, _ := signer.SignMultisig(p); n != 0 {
+		t.Errorf("expect no signature from a foreign key, got %d", n)
+	}
+
+	hash, _ := NewTransactionSigner(tx, 0, 1000).SignatureHash(multisig, SigHashAll, 0, SignatureVersionBase, nil)
+	sig, _ := other.Signature(hash.Bytes(), 0)
+	if _, err := p.AddSignature(append(sig, byte(SigHashAll))); err != ErrMultisigNoMatchingKey {
+		t.Errorf("expect no matching key, got %v", err)
+	}
+
+	// a transaction changed after signing fails to finalize and keeps its
+	// scriptSig
+	signer.AddKey(key)
+	if n, err := signer.SignMultisig(p); n != 1 || err != nil {
+		t.Fatalf("expect one signature got %d %v", n, err)
+	}
+	tx.Inputs[0].ScriptSig = []byte{byte(OP_1)}
+	tx.Outputs[0].Value--
+	if _, _, err := p.Finalize(); err == nil {
+		t.Error("expect finalize to fail")
+	}
+	if !bytes.Equal(tx.Inputs[0].ScriptSig, []byte{byte(OP_1)}) {
+		t.Errorf("expect the scriptSig to be kept, got %x", tx.Inputs[0].ScriptSig)
+	}
+}
@@ -99,7 +99,44 @@ func isMinimallyEncode(d []byte) bool {
 	return true
 }
 
-// Bytes -- returns the number serialized as a little endian with a sign bit
+// minimallyEncode returns a copy of d with the redundant sign padding
+// removed, keeping the numeric value.
+func minimallyEncode(d []byte) []byte {
+	rv := copySlice(d)
+	if len(rv) == 0 {
+		return rv
+	}
+
+	last := rv[len(rv)-1]
+	if last&0x7f != 0 {
+		return rv
+	}
+
+	if len(rv) == 1 {
+		return rv[:0]
+	}
+
+	if rv[len(rv)-2]&0x80 != 0 {
+		return rv
+	}
+
+	for i := len(rv) - 1; i > 0; i-- {
+		if rv[i-1] != 0 {
+			if rv[i-1]&0x80 != 0 {
+				rv[i] = last
+				i++
+			} else {
+				rv[i-1] |= last
+			}
+			return rv[:i]
+		}
+	}
+
+	return rv[:0]
+}
+
+// Bytes -- returns the number serialized as a little endian with a sign bit,
+// zero being the empty array as the interpreter pushes it
 // Example encodings:
 //       127 -> [0x7f]
 //      -127 -> [0xff]
@@ -115,7 +152,7 @@ func isMinimallyEncode(d []byte) bool {
 //    -32768 -> [0x00 0x80 0x80]
 func (n Number) Bytes() []byte {
 	if n == 0 {
-		return []byte{0x00}
+		return []byte{}
 	}
 
 	absn := n
@@ -152,6 +152,11 @@ var (
 	OP_RIGHT  OPCode = 0x81
 	OP_SIZE   OPCode = 0x82
 
+	// monolith opcodes reuse the splice ops, StringWithFlag names them
+	OP_SPLIT   OPCode = 0x7f
+	OP_NUM2BIN OPCode = 0x80
+	OP_BIN2NUM OPCode = 0x81
+
 	// bit logic
 	OP_INVERT      OPCode = 0x83
 	OP_AND         OPCode = 0x84
@@ -219,6 +224,18 @@ var (
 	OP_NOP8  OPCode = 0xb7
 	OP_NOP9  OPCode = 0xb8
 	OP_NOP10 OPCode = 0xb9
+
+	// tapscript
+	OP_CHECKSIGADD OPCode = 0xba
+
+	// bch reuses the tapscript byte, the flags decide which one executes
+	// and StringWithFlag which one is named
+	OP_CHECKDATASIG       OPCode = 0xba
+	OP_CHECKDATASIGVERIFY OPCode = 0xbb
+
+	// bytes between OP_CHECKDATASIGVERIFY and OP_INVALIDOPCODE are undefined
+	// and only fail when executed.
+	OP_INVALIDOPCODE OPCode = 0xff
 )
 
 func NewOPCodeFromString(s string) (OPCode, error) {
@@ -487,10 +504,16 @@ func NewOPCodeFromString(s string) (OPCode, error) {
 	// splice ops
 	case "OP_CAT":
 		return OP_CAT, nil
+	case "OP_SPLIT":
+		fallthrough
 	case "OP_SUBSTR":
 		return OP_SUBSTR, nil
+	case "OP_NUM2BIN":
+		fallthrough
 	case "OP_LEFT":
 		return OP_LEFT, nil
+	case "OP_BIN2NUM":
+		fallthrough
 	case "OP_RIGHT":
 		return OP_RIGHT, nil
 	case "OP_SIZE":
@@ -598,9 +621,13 @@ func NewOPCodeFromString(s string) (OPCode, error) {
 	// expansion
 	case "OP_NOP1":
 		return OP_NOP1, nil
+	case "OP_NOP2":
+		fallthrough
 	case "OP_CHECKLOCKTIMEVERIFY":
 		return OP_CHECKLOCKTIMEVERIFY, nil
 	//OP_NOP2 = OP_CHECKLOCKTIMEVERIFY
+	case "OP_NOP3":
+		fallthrough
 	case "OP_CHECKSEQUENCEVERIFY":
 		return OP_CHECKSEQUENCEVERIFY, nil
 	//OP_NOP3 = OP_CHECKSEQUENCEVERIFY
@@ -618,11 +645,22 @@ func NewOPCodeFromString(s string) (OPCode, error) {
 		return OP_NOP9, nil
 	case "OP_NOP10":
 		return OP_NOP10, nil
+	case "OP_CHECKDATASIG":
+		fallthrough
+	case "OP_CHECKSIGADD":
+		return OP_CHECKSIGADD, nil
+	case "OP_CHECKDATASIGVERIFY":
+		return OP_CHECKDATASIGVERIFY, nil
+	case "OP_INVALIDOPCODE":
+		return OP_INVALIDOPCODE, nil
 	}
 
 	return 0, errors.New("unknow opcode")
 }
 
+// NewOPCode returns the opcode of byte n. An undefined byte comes back with
+// ErrOPCodeUnknow, scripts may still hold it since it only fails once
+// executed, or makes a tapscript succeed when it is an OP_SUCCESSx.
 func NewOPCode(n uint8) (OPCode, error) {
 	switch n {
 	case 0x00:
@@ -1006,11 +1044,23 @@ func NewOPCode(n uint8) (OPCode, error) {
 		return OP_NOP9, nil
 	case 0xb9:
 		return OP_NOP10, nil
+	case 0xba:
+		return OP_CHECKSIGADD, nil
+	case 0xbb:
+		return OP_CHECKDATASIGVERIFY, nil
+	case 0xff:
+		return OP_INVALIDOPCODE, nil
 	default:
-		return 0, ErrOPCodeUnknow
+		return OPCode(n), ErrOPCodeUnknow
 	}
 }
 
+// IsUndefined reports the bytes NewOPCode does not know.
+func (o OPCode) IsUndefined() bool {
+	_, err := NewOPCode(uint8(o))
+	return err == ErrOPCodeUnknow
+}
+
 func (o OPCode) IsDisabled() bool {
 	switch o {
 	case OP_CAT:
@@ -1048,6 +1098,26 @@ func (o OPCode) IsDisabled() bool {
 	return false
 }
 
+// IsDisabledWithFlag is IsDisabled with the opcodes enabled by
+// ScriptEnableMonolithOpcodes taken into account.
+func (o OPCode) IsDisabledWithFlag(flag Flag) bool {
+	if flag.Has(ScriptEnableMonolithOpcodes) {
+		switch o {
+		case OP_CAT, OP_SPLIT, OP_AND, OP_OR, OP_XOR, OP_DIV, OP_MOD, OP_NUM2BIN, OP_BIN2NUM:
+			return false
+		}
+	}
+
+	return o.IsDisabled()
+}
+
+// IsDataSigOp reports the BCH OP_CHECKDATASIG opcodes, which only count as a
+// signature operation once ScriptEnableCheckDataSig is set.
+func (o OPCode) IsDataSigOp(flag Flag) bool {
+	return flag.Has(ScriptEnableCheckDataSig) &&
+		(o == OP_CHECKDATASIG || o == OP_CHECKDATASIGVERIFY)
+}
+
 func (o OPCode) String() string {
 	switch o {
 	case OP_0:
@@ -1441,11 +1511,38 @@ func (o OPCode) String() string {
 		return "OP_NOP9"
 	case OP_NOP10:
 		return "OP_NOP10"
+	case OP_CHECKSIGADD:
+		return "OP_CHECKSIGADD"
+	case OP_CHECKDATASIGVERIFY:
+		return "OP_CHECKDATASIGVERIFY"
+	case OP_INVALIDOPCODE:
+		return "OP_INVALIDOPCODE"
 	}
 
 	return "OP_UNKNOW"
 }
 
+// StringWithFlag is String for the chain flag validates, the bytes Bitcoin
+// Cash reuses are named after the opcodes flag enables there.
+func (o OPCode) StringWithFlag(flag Flag) string {
+	if flag.Has(ScriptEnableMonolithOpcodes) {
+		switch o {
+		case OP_SPLIT:
+			return "OP_SPLIT"
+		case OP_NUM2BIN:
+			return "OP_NUM2BIN"
+		case OP_BIN2NUM:
+			return "OP_BIN2NUM"
+		}
+	}
+
+	if flag.Has(ScriptEnableCheckDataSig) && o == OP_CHECKDATASIG {
+		return "OP_CHECKDATASIG"
+	}
+
+	return o.String()
+}
+
 func (o OPCode) IsCountable() bool {
 	return o > OP_16
 }
@@ -0,0 +1,1076 @@
+package bscript
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrPSBTBadMagic          = errors.New("psbt: bad magic")
+	ErrPSBTDuplicateKey      = errors.New("psbt: duplicate key")
+	ErrPSBTBadKey            = errors.New("psbt: bad key")
+	ErrPSBTBadValue          = errors.New("psbt: bad value")
+	ErrPSBTBadVersion        = errors.New("psbt: unknow version")
+	ErrPSBTMissingTx         = errors.New("psbt: missing unsigned transaction")
+	ErrPSBTMissingField      = errors.New("psbt: missing required field")
+	ErrPSBTUnexpectedField   = errors.New("psbt: field not allowed in this version")
+	ErrPSBTNotUnsigned       = errors.New("psbt: transaction has signature scripts")
+	ErrPSBTCountMismatch     = errors.New("psbt: input or output count mismatch")
+	ErrPSBTBadLocktime       = errors.New("psbt: inputs require conflicting locktimes")
+	ErrPSBTBadBase64         = errors.New("psbt: bad base64")
+	ErrPSBTBadInputIndex     = errors.New("psbt: bad input index")
+	ErrPSBTMissingUtxo       = errors.New("psbt: missing spent output")
+	ErrPSBTUtxoMismatch      = errors.New("psbt: spent output does not match the input")
+	ErrPSBTTransactionDiffer = errors.New("psbt: combined psbts have different transactions")
+	ErrPSBTIncomplete        = errors.New("psbt: input can not be finalized")
+	ErrPSBTNotFinalized      = errors.New("psbt: input is not finalized")
+)
+
+// psbtMagic starts every PSBT, "psbt" and a 0xff separator.
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// BIP174 and BIP370 key types.
+const (
+	psbtGlobalUnsignedTx       = 0x00
+	psbtGlobalXpub             = 0x01
+	psbtGlobalTxVersion        = 0x02
+	psbtGlobalFallbackLocktime = 0x03
+	psbtGlobalInputCount       = 0x04
+	psbtGlobalOutputCount      = 0x05
+	psbtGlobalTxModifiable     = 0x06
+	psbtGlobalVersion          = 0xfb
+
+	psbtInNonWitnessUtxo         = 0x00
+	psbtInWitnessUtxo            = 0x01
+	psbtInPartialSig             = 0x02
+	psbtInSigHash                = 0x03
+	psbtInRedeemScript           = 0x04
+	psbtInWitnessScript          = 0x05
+	psbtInBip32Derivation        = 0x06
+	psbtInFinalScriptSig         = 0x07
+	psbtInFinalScriptWitness     = 0x08
+	psbtInPrevTxid               = 0x0e
+	psbtInOutputIndex            = 0x0f
+	psbtInSequence               = 0x10
+	psbtInRequiredTimeLocktime   = 0x11
+	psbtInRequiredHeightLocktime = 0x12
+	psbtInTaprootKeySig          = 0x13
+	psbtInTaprootScriptSig       = 0x14
+	psbtInTaprootLeafScript      = 0x15
+	psbtInTaprootBip32Derivation = 0x16
+	psbtInTaprootInternalKey     = 0x17
+	psbtInTaprootMerkleRoot      = 0x18
+
+	psbtOutRedeemScript           = 0x00
+	psbtOutWitnessScript          = 0x01
+	psbtOutBip32Derivation        = 0x02
+	psbtOutAmount                 = 0x03
+	psbtOutScript                 = 0x04
+	psbtOutTaprootInternalKey     = 0x05
+	psbtOutTaprootTree            = 0x06
+	psbtOutTaprootBip32Derivation = 0x07
+)
+
+// PSBTDerivation is the BIP32 origin of a key, the fingerprint of the
+// master key and the derivation path from it.
+type PSBTDerivation struct {
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// PSBTTaprootDerivation is the BIP32 origin of an x-only key and the hashes
+// of the leaves it appears in.
+type PSBTTaprootDerivation struct {
+	LeafHashes [][]byte
+	PSBTDerivation
+}
+
+// PSBTTaprootLeafScript is a tapscript leaf with its leaf version, keyed by
+// the control block which proves it.
+type PSBTTaprootLeafScript struct {
+	Script      []byte
+	LeafVersion byte
+}
+
+// PSBTInput holds what signers and finalizers need to know about an input.
+// Maps are keyed by the raw key data of their field: the public key for
+// PartialSigs and Bip32Derivation, the x-only key followed by the leaf hash
+// for TaprootScriptSigs, the control block for TaprootLeafScripts and the
+// x-only key for TaprootBip32Derivation.
+type PSBTInput struct {
+	NonWitnessUtxo     *bcore.Transaction
+	WitnessUtxo        *bcore.TransactionOutput
+	PartialSigs        map[string][]byte
+	SigHash            *SigHash
+	RedeemScript       *Script
+	WitnessScript      *Script
+	Bip32Derivation    map[string]*PSBTDerivation
+	FinalScriptSig     *Script
+	FinalScriptWitness ScriptWitness
+
+	// PSBT v2 fields, which replace the unsigned transaction.
+	PrevTxid               *Hash
+	OutputIndex            *uint32
+	Sequence               *uint32
+	RequiredTimeLocktime   *uint32
+	RequiredHeightLocktime *uint32
+
+	TaprootKeySig          []byte
+	TaprootScriptSigs      map[string][]byte
+	TaprootLeafScripts     map[string]*PSBTTaprootLeafScript
+	TaprootBip32Derivation map[string]*PSBTTaprootDerivation
+	TaprootInternalKey     []byte
+	TaprootMerkleRoot      []byte
+
+	// Unknown keeps the fields this package does not know, key included, so
+	// they survive a round trip.
+	Unknown map[string][]byte
+}
+
+// PSBTOutput holds what signers need to know about an output.
+type PSBTOutput struct {
+	RedeemScript    *Script
+	WitnessScript   *Script
+	Bip32Derivation map[string]*PSBTDerivation
+
+	// PSBT v2 fields, which replace the unsigned transaction.
+	Amount *uint64
+	Script *Script
+
+	TaprootInternalKey     []byte
+	TaprootTree            []byte
+	TaprootBip32Derivation map[string]*PSBTTaprootDerivation
+
+	Unknown map[string][]byte
+}
+
+// PSBT is a BIP174 (version 0) or BIP370 (version 2) partially signed
+// transaction. Version 0 carries UnsignedTx, version 2 spreads it over the
+// global, input and output fields; Transaction builds it for both.
+type PSBT struct {
+	Version    uint32
+	UnsignedTx *bcore.Transaction
+	// Xpubs are keyed by the 78 bytes serialized extended public key.
+	Xpubs map[string]*PSBTDerivation
+
+	// PSBT v2 fields, which replace the unsigned transaction.
+	TxVersion        uint32
+	FallbackLocktime *uint32
+	TxModifiable     *uint8
+
+	Inputs  []*PSBTInput
+	Outputs []*PSBTOutput
+
+	Unknown map[string][]byte
+}
+
+// NewPSBT is the Creator role, a version 0 PSBT for tx whose signature
+// scripts have to be empty.
+func NewPSBT(tx *bcore.Transaction) (*PSBT, error) {
+	for _, in := range tx.Inputs {
+		if len(in.ScriptSig) > 0 {
+			return nil, ErrPSBTNotUnsigned
+		}
+	}
+
+	p := &PSBT{
+		UnsignedTx: tx,
+		Inputs:     make([]*PSBTInput, len(tx.Inputs)),
+		Outputs:    make([]*PSBTOutput, len(tx.Outputs)),
+	}
+	for i := range p.Inputs {
+		p.Inputs[i] = &PSBTInput{}
+	}
+	for i := range p.Outputs {
+		p.Outputs[i] = &PSBTOutput{}
+	}
+
+	return p, nil
+}
+
+// NewPSBTV2 is the Creator role of BIP370, a version 2 PSBT with the
+// inputs and outputs of tx.
+func NewPSBTV2(tx *bcore.Transaction) (*PSBT, error) {
+	p, err := NewPSBT(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Version = 2
+	p.UnsignedTx = nil
+	p.TxVersion = tx.Version
+	locktime := tx.Locktime
+	p.FallbackLocktime = &locktime
+
+	for i, in := range tx.Inputs {
+		txid, index, sequence := in.PrevOutput.Hash, in.PrevOutput.Index, in.Sequence
+		p.Inputs[i].PrevTxid = &txid
+		p.Inputs[i].OutputIndex = &index
+		p.Inputs[i].Sequence = &sequence
+	}
+	for i, out := range tx.Outputs {
+		value := out.Value
+		p.Outputs[i].Amount = &value
+		p.Outputs[i].Script = NewScriptFromBytes(out.ScriptPubkey)
+	}
+
+	return p, nil
+}
+
+func NewPSBTFromBase64(s string) (*PSBT, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrPSBTBadBase64
+	}
+
+	return NewPSBTFromBytes(b)
+}
+
+// NewPSBTFromBytes parses the binary serialization of a PSBT and checks
+// the fields its version requires and forbids.
+func NewPSBTFromBytes(b []byte) (*PSBT, error) {
+	if !bytes.HasPrefix(b, psbtMagic) {
+		return nil, ErrPSBTBadMagic
+	}
+
+	buffer := NewBufferFromBytes(b[len(psbtMagic):])
+	p := &PSBT{}
+
+	global, err := readPSBTMap(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputCount, outputCount *uint64
+	for _, kv := range global {
+		switch kv.typ {
+		case psbtGlobalUnsignedTx:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if p.UnsignedTx, err = bcore.NewTransactionFromHexString(hex.EncodeToString(kv.value)); err != nil {
+				return nil, ErrPSBTBadValue
+			}
+		case psbtGlobalXpub:
+			if len(kv.data) != 78 {
+				return nil, ErrPSBTBadKey
+			}
+			derivation, err := parsePSBTDerivation(kv.value)
+			if err != nil {
+				return nil, err
+			}
+			if p.Xpubs == nil {
+				p.Xpubs = make(map[string]*PSBTDerivation)
+			}
+			p.Xpubs[string(kv.data)] = derivation
+		case psbtGlobalTxVersion:
+			if p.TxVersion, err = parsePSBTUint32(kv); err != nil {
+				return nil, err
+			}
+		case psbtGlobalFallbackLocktime:
+			locktime, err := parsePSBTUint32(kv)
+			if err != nil {
+				return nil, err
+			}
+			p.FallbackLocktime = &locktime
+		case psbtGlobalInputCount, psbtGlobalOutputCount:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			n, err := NewBufferFromBytes(kv.value).GetVarInt()
+			if err != nil {
+				return nil, ErrPSBTBadValue
+			}
+			if kv.typ == psbtGlobalInputCount {
+				inputCount = &n
+			} else {
+				outputCount = &n
+			}
+		case psbtGlobalTxModifiable:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) != 1 {
+				return nil, ErrPSBTBadValue
+			}
+			modifiable := kv.value[0]
+			p.TxModifiable = &modifiable
+		case psbtGlobalVersion:
+			if p.Version, err = parsePSBTUint32(kv); err != nil {
+				return nil, err
+			}
+		default:
+			p.Unknown = addPSBTUnknown(p.Unknown, kv)
+		}
+	}
+
+	switch p.Version {
+	case 0:
+		if p.UnsignedTx == nil {
+			return nil, ErrPSBTMissingTx
+		}
+		if inputCount != nil || outputCount != nil || p.FallbackLocktime != nil || p.TxModifiable != nil || global.has(psbtGlobalTxVersion) {
+			return nil, ErrPSBTUnexpectedField
+		}
+		for _, in := range p.UnsignedTx.Inputs {
+			if len(in.ScriptSig) > 0 {
+				return nil, ErrPSBTNotUnsigned
+			}
+		}
+		n, m := uint64(len(p.UnsignedTx.Inputs)), uint64(len(p.UnsignedTx.Outputs))
+		inputCount, outputCount = &n, &m
+	case 2:
+		if p.UnsignedTx != nil {
+			return nil, ErrPSBTUnexpectedField
+		}
+		if inputCount == nil || outputCount == nil || !global.has(psbtGlobalTxVersion) {
+			return nil, ErrPSBTMissingField
+		}
+	default:
+		return nil, ErrPSBTBadVersion
+	}
+
+	for i := uint64(0); i < *inputCount; i++ {
+		in, err := p.readInput(buffer)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs = append(p.Inputs, in)
+	}
+	for i := uint64(0); i < *outputCount; i++ {
+		out, err := p.readOutput(buffer)
+		if err != nil {
+			return nil, err
+		}
+		p.Outputs = append(p.Outputs, out)
+	}
+
+	return p, nil
+}
+
+func (p *PSBT) readInput(buffer *Buffer) (*PSBTInput, error) {
+	kvs, err := readPSBTMap(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &PSBTInput{}
+	for _, kv := range kvs {
+		switch kv.typ {
+		case psbtInNonWitnessUtxo:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if in.NonWitnessUtxo, err = bcore.NewTransactionFromHexString(hex.EncodeToString(kv.value)); err != nil {
+				return nil, ErrPSBTBadValue
+			}
+		case psbtInWitnessUtxo:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if in.WitnessUtxo, err = parsePSBTOutput(kv.value); err != nil {
+				return nil, err
+			}
+		case psbtInPartialSig:
+			if _, ok := secp256k1ParsePubkey(kv.data); !ok {
+				return nil, ErrPSBTBadKey
+			}
+			if in.PartialSigs == nil {
+				in.PartialSigs = make(map[string][]byte)
+			}
+			in.PartialSigs[string(kv.data)] = kv.value
+		case psbtInSigHash:
+			sighash, err := parsePSBTUint32(kv)
+			if err != nil {
+				return nil, err
+			}
+			in.SigHash = new(SigHash)
+			*in.SigHash = SigHash(sighash)
+		case psbtInRedeemScript, psbtInWitnessScript, psbtInFinalScriptSig:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			script := NewScriptFromBytes(kv.value)
+			switch kv.typ {
+			case psbtInRedeemScript:
+				in.RedeemScript = script
+			case psbtInWitnessScript:
+				in.WitnessScript = script
+			default:
+				in.FinalScriptSig = script
+			}
+		case psbtInBip32Derivation:
+			if in.Bip32Derivation, err = addPSBTDerivation(in.Bip32Derivation, kv); err != nil {
+				return nil, err
+			}
+		case psbtInFinalScriptWitness:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if in.FinalScriptWitness, err = NewScriptWitnessFromBuffer(NewBufferFromBytes(kv.value)); err != nil {
+				return nil, ErrPSBTBadValue
+			}
+		case psbtInPrevTxid:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) != 32 {
+				return nil, ErrPSBTBadValue
+			}
+			txid := NewHash(kv.value)
+			in.PrevTxid = &txid
+		case psbtInOutputIndex, psbtInSequence, psbtInRequiredTimeLocktime, psbtInRequiredHeightLocktime:
+			v, err := parsePSBTUint32(kv)
+			if err != nil {
+				return nil, err
+			}
+			switch kv.typ {
+			case psbtInOutputIndex:
+				in.OutputIndex = &v
+			case psbtInSequence:
+				in.Sequence = &v
+			case psbtInRequiredTimeLocktime:
+				if v < TransactionSignerLocktimeThreshold {
+					return nil, ErrPSBTBadValue
+				}
+				in.RequiredTimeLocktime = &v
+			default:
+				if v == 0 || v >= TransactionSignerLocktimeThreshold {
+					return nil, ErrPSBTBadValue
+				}
+				in.RequiredHeightLocktime = &v
+			}
+		case psbtInTaprootKeySig:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) != 64 && len(kv.value) != 65 {
+				return nil, ErrPSBTBadValue
+			}
+			in.TaprootKeySig = kv.value
+		case psbtInTaprootScriptSig:
+			if len(kv.data) != 64 {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) != 64 && len(kv.value) != 65 {
+				return nil, ErrPSBTBadValue
+			}
+			if in.TaprootScriptSigs == nil {
+				in.TaprootScriptSigs = make(map[string][]byte)
+			}
+			in.TaprootScriptSigs[string(kv.data)] = kv.value
+		case psbtInTaprootLeafScript:
+			if _, err := NewTaprootControlBlock(kv.data); err != nil {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) < 1 {
+				return nil, ErrPSBTBadValue
+			}
+			if in.TaprootLeafScripts == nil {
+				in.TaprootLeafScripts = make(map[string]*PSBTTaprootLeafScript)
+			}
+			in.TaprootLeafScripts[string(kv.data)] = &PSBTTaprootLeafScript{
+				Script:      kv.value[:len(kv.value)-1],
+				LeafVersion: kv.value[len(kv.value)-1],
+			}
+		case psbtInTaprootBip32Derivation:
+			if in.TaprootBip32Derivation, err = addPSBTTaprootDerivation(in.TaprootBip32Derivation, kv); err != nil {
+				return nil, err
+			}
+		case psbtInTaprootInternalKey, psbtInTaprootMerkleRoot:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) != 32 {
+				return nil, ErrPSBTBadValue
+			}
+			if kv.typ == psbtInTaprootInternalKey {
+				in.TaprootInternalKey = kv.value
+			} else {
+				in.TaprootMerkleRoot = kv.value
+			}
+		default:
+			in.Unknown = addPSBTUnknown(in.Unknown, kv)
+		}
+	}
+
+	v2 := kvs.has(psbtInPrevTxid) || kvs.has(psbtInOutputIndex) || kvs.has(psbtInSequence) ||
+		kvs.has(psbtInRequiredTimeLocktime) || kvs.has(psbtInRequiredHeightLocktime)
+	switch {
+	case p.Version == 0 && v2:
+		return nil, ErrPSBTUnexpectedField
+	case p.Version == 2 && (in.PrevTxid == nil || in.OutputIndex == nil):
+		return nil, ErrPSBTMissingField
+	}
+
+	return in, nil
+}
+
+func (p *PSBT) readOutput(buffer *Buffer) (*PSBTOutput, error) {
+	kvs, err := readPSBTMap(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &PSBTOutput{}
+	for _, kv := range kvs {
+		switch kv.typ {
+		case psbtOutRedeemScript, psbtOutWitnessScript, psbtOutScript:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			script := NewScriptFromBytes(kv.value)
+			switch kv.typ {
+			case psbtOutRedeemScript:
+				out.RedeemScript = script
+			case psbtOutWitnessScript:
+				out.WitnessScript = script
+			default:
+				out.Script = script
+			}
+		case psbtOutBip32Derivation:
+			if out.Bip32Derivation, err = addPSBTDerivation(out.Bip32Derivation, kv); err != nil {
+				return nil, err
+			}
+		case psbtOutAmount:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			amount, err := NewBufferFromBytes(kv.value).GetUint64()
+			if err != nil || len(kv.value) != 8 {
+				return nil, ErrPSBTBadValue
+			}
+			out.Amount = &amount
+		case psbtOutTaprootInternalKey:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if len(kv.value) != 32 {
+				return nil, ErrPSBTBadValue
+			}
+			out.TaprootInternalKey = kv.value
+		case psbtOutTaprootTree:
+			if len(kv.data) != 0 {
+				return nil, ErrPSBTBadKey
+			}
+			if !isPSBTTaprootTree(kv.value) {
+				return nil, ErrPSBTBadValue
+			}
+			out.TaprootTree = kv.value
+		case psbtOutTaprootBip32Derivation:
+			if out.TaprootBip32Derivation, err = addPSBTTaprootDerivation(out.TaprootBip32Derivation, kv); err != nil {
+				return nil, err
+			}
+		default:
+			out.Unknown = addPSBTUnknown(out.Unknown, kv)
+		}
+	}
+
+	switch {
+	case p.Version == 0 && (out.Amount != nil || out.Script != nil):
+		return nil, ErrPSBTUnexpectedField
+	case p.Version == 2 && (out.Amount == nil || out.Script == nil):
+		return nil, ErrPSBTMissingField
+	}
+
+	return out, nil
+}
+
+// Bytes serializes p, keys in the order of their types and, for keys of a
+// same type, of their data.
+func (p *PSBT) Bytes() []byte {
+	buffer := NewBuffer().PutBytes(psbtMagic)
+
+	var global psbtWriter
+	if p.Version == 0 && p.UnsignedTx != nil {
+		global.put(psbtGlobalUnsignedTx, nil, p.UnsignedTx.Bytes())
+	}
+	for key, derivation := range p.Xpubs {
+		global.put(psbtGlobalXpub, []byte(key), derivation.bytes())
+	}
+	if p.Version == 2 {
+		global.put(psbtGlobalTxVersion, nil, NewBuffer().PutUint32(p.TxVersion).Bytes())
+		if p.FallbackLocktime != nil {
+			global.put(psbtGlobalFallbackLocktime, nil, NewBuffer().PutUint32(*p.FallbackLocktime).Bytes())
+		}
+		global.put(psbtGlobalInputCount, nil, NewBuffer().PutVarInt(uint64(len(p.Inputs))).Bytes())
+		global.put(psbtGlobalOutputCount, nil, NewBuffer().PutVarInt(uint64(len(p.Outputs))).Bytes())
+		if p.TxModifiable != nil {
+			global.put(psbtGlobalTxModifiable, nil, []byte{*p.TxModifiable})
+		}
+	}
+	if p.Version != 0 {
+		global.put(psbtGlobalVersion, nil, NewBuffer().PutUint32(p.Version).Bytes())
+	}
+	global.putUnknown(p.Unknown)
+	global.writeTo(buffer)
+
+	for _, in := range p.Inputs {
+		in.writer().writeTo(buffer)
+	}
+	for _, out := range p.Outputs {
+		out.writer().writeTo(buffer)
+	}
+
+	return buffer.Bytes()
+}
+
+func (p *PSBT) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Bytes())
+}
+
+func (in *PSBTInput) writer() *psbtWriter {
+	w := &psbtWriter{}
+	if in.NonWitnessUtxo != nil {
+		w.put(psbtInNonWitnessUtxo, nil, in.NonWitnessUtxo.Bytes())
+	}
+	if in.WitnessUtxo != nil {
+		w.put(psbtInWitnessUtxo, nil, in.WitnessUtxo.Bytes())
+	}
+	for pubkey, sig := range in.PartialSigs {
+		w.put(psbtInPartialSig, []byte(pubkey), sig)
+	}
+	if in.SigHash != nil {
+		w.put(psbtInSigHash, nil, NewBuffer().PutUint32(uint32(*in.SigHash)).Bytes())
+	}
+	if in.RedeemScript != nil {
+		w.put(psbtInRedeemScript, nil, in.RedeemScript.Bytes())
+	}
+	if in.WitnessScript != nil {
+		w.put(psbtInWitnessScript, nil, in.WitnessScript.Bytes())
+	}
+	for pubkey, derivation := range in.Bip32Derivation {
+		w.put(psbtInBip32Derivation, []byte(pubkey), derivation.bytes())
+	}
+	if in.FinalScriptSig != nil {
+		w.put(psbtInFinalScriptSig, nil, in.FinalScriptSig.Bytes())
+	}
+	if in.FinalScriptWitness != nil {
+		w.put(psbtInFinalScriptWitness, nil, in.FinalScriptWitness.Bytes())
+	}
+	if in.PrevTxid != nil {
+		w.put(psbtInPrevTxid, nil, in.PrevTxid.Bytes())
+	}
+	if in.OutputIndex != nil {
+		w.put(psbtInOutputIndex, nil, NewBuffer().PutUint32(*in.OutputIndex).Bytes())
+	}
+	if in.Sequence != nil {
+		w.put(psbtInSequence, nil, NewBuffer().PutUint32(*in.Sequence).Bytes())
+	}
+	if in.RequiredTimeLocktime != nil {
+		w.put(psbtInRequiredTimeLocktime, nil, NewBuffer().PutUint32(*in.RequiredTimeLocktime).Bytes())
+	}
+	if in.RequiredHeightLocktime != nil {
+		w.put(psbtInRequiredHeightLocktime, nil, NewBuffer().PutUint32(*in.RequiredHeightLocktime).Bytes())
+	}
+	if in.TaprootKeySig != nil {
+		w.put(psbtInTaprootKeySig, nil, in.TaprootKeySig)
+	}
+	for key, sig := range in.TaprootScriptSigs {
+		w.put(psbtInTaprootScriptSig, []byte(key), sig)
+	}
+	for control, leaf := range in.TaprootLeafScripts {
+		w.put(psbtInTaprootLeafScript, []byte(control), append(append([]byte{}, leaf.Script...), leaf.LeafVersion))
+	}
+	for key, derivation := range in.TaprootBip32Derivation {
+		w.put(psbtInTaprootBip32Derivation, []byte(key), derivation.bytes())
+	}
+	if in.TaprootInternalKey != nil {
+		w.put(psbtInTaprootInternalKey, nil, in.TaprootInternalKey)
+	}
+	if in.TaprootMerkleRoot != nil {
+		w.put(psbtInTaprootMerkleRoot, nil, in.TaprootMerkleRoot)
+	}
+	w.putUnknown(in.Unknown)
+
+	return w
+}
+
+func (out *PSBTOutput) writer() *psbtWriter {
+	w := &psbtWriter{}
+	if out.RedeemScript != nil {
+		w.put(psbtOutRedeemScript, nil, out.RedeemScript.Bytes())
+	}
+	if out.WitnessScript != nil {
+		w.put(psbtOutWitnessScript, nil, out.WitnessScript.Bytes())
+	}
+	for pubkey, derivation := range out.Bip32Derivation {
+		w.put(psbtOutBip32Derivation, []byte(pubkey), derivation.bytes())
+	}
+	if out.Amount != nil {
+		w.put(psbtOutAmount, nil, NewBuffer().PutUint64(*out.Amount).Bytes())
+	}
+	if out.Script != nil {
+		w.put(psbtOutScript, nil, out.Script.Bytes())
+	}
+	if out.TaprootInternalKey != nil {
+		w.put(psbtOutTaprootInternalKey, nil, out.TaprootInternalKey)
+	}
+	if out.TaprootTree != nil {
+		w.put(psbtOutTaprootTree, nil, out.TaprootTree)
+	}
+	for key, derivation := range out.TaprootBip32Derivation {
+		w.put(psbtOutTaprootBip32Derivation, []byte(key), derivation.bytes())
+	}
+	w.putUnknown(out.Unknown)
+
+	return w
+}
+
+// Transaction builds the unsigned transaction of p. For version 2 the
+// locktime is the largest required one of the kind every input with a
+// requirement accepts, heights first, and FallbackLocktime without any.
+func (p *PSBT) Transaction() (*bcore.Transaction, error) {
+	if p.Version == 0 {
+		if p.UnsignedTx == nil {
+			return nil, ErrPSBTMissingTx
+		}
+		return cloneTransaction(p.UnsignedTx), nil
+	}
+
+	tx := &bcore.Transaction{Version: p.TxVersion}
+	if p.FallbackLocktime != nil {
+		tx.Locktime = *p.FallbackLocktime
+	}
+
+	heights, times, required := true, true, false
+	var height, time uint32
+	for _, in := range p.Inputs {
+		if in.PrevTxid == nil || in.OutputIndex == nil {
+			return nil, ErrPSBTMissingField
+		}
+		sequence := uint32(bcore.TransactionFinalSequence)
+		if in.Sequence != nil {
+			sequence = *in.Sequence
+		}
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{
+			PrevOutput: bcore.NewOutPoint(*in.PrevTxid, *in.OutputIndex),
+			Sequence:   sequence,
+		})
+
+		if in.RequiredHeightLocktime == nil && in.RequiredTimeLocktime == nil {
+			continue
+		}
+		required = true
+		if in.RequiredHeightLocktime == nil {
+			heights = false
+		} else if *in.RequiredHeightLocktime > height {
+			height = *in.RequiredHeightLocktime
+		}
+		if in.RequiredTimeLocktime == nil {
+			times = false
+		} else if *in.RequiredTimeLocktime > time {
+			time = *in.RequiredTimeLocktime
+		}
+	}
+
+	switch {
+	case !required:
+	case heights:
+		tx.Locktime = height
+	case times:
+		tx.Locktime = time
+	default:
+		return nil, ErrPSBTBadLocktime
+	}
+
+	for _, out := range p.Outputs {
+		if out.Amount == nil || out.Script == nil {
+			return nil, ErrPSBTMissingField
+		}
+		tx.Outputs = append(tx.Outputs, &bcore.TransactionOutput{Value: *out.Amount, ScriptPubkey: out.Script.Bytes()})
+	}
+
+	return tx, nil
+}
+
+// SpentOutput is the output input index spends, from its witness utxo or
+// from its non witness utxo, whose id has to be the one the input spends.
+func (p *PSBT) SpentOutput(index int) (*bcore.TransactionOutput, error) {
+	tx, err := p.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(p.Inputs) || index >= len(tx.Inputs) {
+		return nil, ErrPSBTBadInputIndex
+	}
+
+	in, prevOutput := p.Inputs[index], tx.Inputs[index].PrevOutput
+	if in.NonWitnessUtxo != nil {
+		if in.NonWitnessUtxo.ID() != prevOutput.Hash || int(prevOutput.Index) >= len(in.NonWitnessUtxo.Outputs) {
+			return nil, ErrPSBTUtxoMismatch
+		}
+		return in.NonWitnessUtxo.Outputs[prevOutput.Index], nil
+	}
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, nil
+	}
+
+	return nil, ErrPSBTMissingUtxo
+}
+
+func cloneTransaction(tx *bcore.Transaction) *bcore.Transaction {
+	clone := &bcore.Transaction{Version: tx.Version, Locktime: tx.Locktime}
+	for _, in := range tx.Inputs {
+		clone.Inputs = append(clone.Inputs, &bcore.TransactionInput{
+			PrevOutput: in.PrevOutput.Clone(),
+			ScriptSig:  append([]byte{}, in.ScriptSig...),
+			Sequence:   in.Sequence,
+		})
+	}
+	for _, out := range tx.Outputs {
+		clone.Outputs = append(clone.Outputs, out.Clone())
+	}
+
+	return clone
+}
+
+// psbtKeyValue is a map entry, its key split into the type and the data.
+type psbtKeyValue struct {
+	typ   uint64
+	data  []byte
+	key   []byte
+	value []byte
+}
+
+type psbtMap []*psbtKeyValue
+
+func (m psbtMap) has(typ uint64) bool {
+	for _, kv := range m {
+		if kv.typ == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readPSBTMap reads the entries of a map up to its 0x00 separator and
+// rejects a key found twice.
+func readPSBTMap(buffer *Buffer) (psbtMap, error) {
+	var m psbtMap
+	seen := make(map[string]bool)
+
+	for {
+		key, err := buffer.GetVarBytes()
+		if err != nil {
+			return nil, ErrPSBTBadValue
+		}
+		if len(key) == 0 {
+			return m, nil
+		}
+
+		value, err := buffer.GetVarBytes()
+		if err != nil {
+			return nil, ErrPSBTBadValue
+		}
+
+		if seen[string(key)] {
+			return nil, ErrPSBTDuplicateKey
+		}
+		seen[string(key)] = true
+
+		kb := NewBufferFromBytes(key)
+		typ, err := kb.GetVarInt()
+		if err != nil {
+			return nil, ErrPSBTBadKey
+		}
+		header := NewBuffer().PutVarInt(typ).Bytes()
+
+		m = append(m, &psbtKeyValue{
+			typ:   typ,
+			data:  append([]byte{}, key[len(header):]...),
+			key:   append([]byte{}, key...),
+			value: append([]byte{}, value...),
+		})
+	}
+}
+
+func parsePSBTUint32(kv *psbtKeyValue) (uint32, error) {
+	if len(kv.data) != 0 {
+		return 0, ErrPSBTBadKey
+	}
+	if len(kv.value) != 4 {
+		return 0, ErrPSBTBadValue
+	}
+
+	return NewBufferFromBytes(kv.value).GetUint32()
+}
+
+func parsePSBTOutput(b []byte) (*bcore.TransactionOutput, error) {
+	buffer := NewBufferFromBytes(b)
+	value, err := buffer.GetUint64()
+	if err != nil {
+		return nil, ErrPSBTBadValue
+	}
+	script, err := buffer.GetVarBytes()
+	if err != nil || len(script)+8+len(NewBuffer().PutVarInt(uint64(len(script))).Bytes()) != len(b) {
+		return nil, ErrPSBTBadValue
+	}
+
+	return &bcore.TransactionOutput{Value: value, ScriptPubkey: script}, nil
+}
+
+// isPSBTTaprootTree reports whether b is a non empty list of depth, leaf
+// version and script tuples whose leaves, in depth first order, make up a
+// complete binary tree no deeper than a control block can prove.
+func isPSBTTaprootTree(b []byte) bool {
+	buffer := NewBufferFromBytes(b)
+	var depths []int
+
+	for read := 0; read < len(b); {
+		header, err := buffer.GetBytes(2)
+		if err != nil {
+			return false
+		}
+		script, err := buffer.GetVarBytes()
+		if err != nil {
+			return false
+		}
+		read += 2 + len(NewBuffer().PutVarBytes(script).Bytes())
+
+		depth, version := int(header[0]), header[1]
+		if depth > TaprootControlMaxNodeCount || version&TaprootLeafMask != version {
+			return false
+		}
+		if len(depths) == 1 && depths[0] == 0 {
+			return false
+		}
+
+		// siblings of a same depth fold into their parent
+		depths = append(depths, depth)
+		for len(depths) >= 2 && depths[len(depths)-1] == depths[len(depths)-2] && depths[len(depths)-1] > 0 {
+			depths = append(depths[:len(depths)-2], depths[len(depths)-1]-1)
+		}
+	}
+
+	return len(depths) == 1 && depths[0] == 0
+}
+
+func parsePSBTDerivation(b []byte) (*PSBTDerivation, error) {
+	if len(b)%4 != 0 || len(b) == 0 {
+		return nil, ErrPSBTBadValue
+	}
+
+	buffer := NewBufferFromBytes(b)
+	derivation := &PSBTDerivation{}
+	derivation.Fingerprint, _ = buffer.GetUint32()
+	for i := 4; i < len(b); i += 4 {
+		index, _ := buffer.GetUint32()
+		derivation.Path = append(derivation.Path, index)
+	}
+
+	return derivation, nil
+}
+
+func (d *PSBTDerivation) bytes() []byte {
+	buffer := NewBuffer().PutUint32(d.Fingerprint)
+	for _, index := range d.Path {
+		buffer.PutUint32(index)
+	}
+
+	return buffer.Bytes()
+}
+
+func addPSBTDerivation(m map[string]*PSBTDerivation, kv *psbtKeyValue) (map[string]*PSBTDerivation, error) {
+	if _, ok := secp256k1ParsePubkey(kv.data); !ok {
+		return nil, ErrPSBTBadKey
+	}
+
+	derivation, err := parsePSBTDerivation(kv.value)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = make(map[string]*PSBTDerivation)
+	}
+	m[string(kv.data)] = derivation
+
+	return m, nil
+}
+
+func addPSBTTaprootDerivation(m map[string]*PSBTTaprootDerivation, kv *psbtKeyValue) (map[string]*PSBTTaprootDerivation, error) {
+	if len(kv.data) != 32 {
+		return nil, ErrPSBTBadKey
+	}
+
+	buffer := NewBufferFromBytes(kv.value)
+	n, err := buffer.GetVarInt()
+	if err != nil {
+		return nil, ErrPSBTBadValue
+	}
+	header := len(NewBuffer().PutVarInt(n).Bytes())
+	if uint64(len(kv.value)-header) < n*32 {
+		return nil, ErrPSBTBadValue
+	}
+
+	derivation := &PSBTTaprootDerivation{}
+	for i := uint64(0); i < n; i++ {
+		hash, _ := buffer.GetBytes(32)
+		derivation.LeafHashes = append(derivation.LeafHashes, hash)
+	}
+	origin, err := parsePSBTDerivation(kv.value[header+int(n)*32:])
+	if err != nil {
+		return nil, err
+	}
+	derivation.PSBTDerivation = *origin
+
+	if m == nil {
+		m = make(map[string]*PSBTTaprootDerivation)
+	}
+	m[string(kv.data)] = derivation
+
+	return m, nil
+}
+
+func (d *PSBTTaprootDerivation) bytes() []byte {
+	buffer := NewBuffer().PutVarInt(uint64(len(d.LeafHashes)))
+	for _, hash := range d.LeafHashes {
+		buffer.PutBytes(hash)
+	}
+
+	return buffer.PutBytes(d.PSBTDerivation.bytes()).Bytes()
+}
+
+func addPSBTUnknown(m map[string][]byte, kv *psbtKeyValue) map[string][]byte {
+	if m == nil {
+		m = make(map[string][]byte)
+	}
+	m[string(kv.key)] = kv.value
+
+	return m
+}
+
+// psbtWriter collects the entries of a map to write them sorted.
+type psbtWriter struct {
+	entries []*psbtKeyValue
+}
+
+func (w *psbtWriter) put(typ uint64, data, value []byte) {
+	key := append(NewBuffer().PutVarInt(typ).Bytes(), data...)
+	w.entries = append(w.entries, &psbtKeyValue{typ: typ, data: data, key: key, value: value})
+}
+
+func (w *psbtWriter) putUnknown(m map[string][]byte) {
+	for key, value := range m {
+		typ, _ := NewBufferFromBytes([]byte(key)).GetVarInt()
+		w.entries = append(w.entries, &psbtKeyValue{typ: typ, key: []byte(key), value: value})
+	}
+}
+
+func (w *psbtWriter) writeTo(buffer *Buffer) {
+	sort.Slice(w.entries, func(i, j int) bool {
+		return bytes.Compare(w.entries[i].key, w.entries[j].key) < 0
+	})
+
+	for _, kv := range w.entries {
+		buffer.PutVarBytes(kv.key).PutVarBytes(kv.value)
+	}
+	buffer.PutBytes([]byte{0x00})
+}
@@ -0,0 +1,471 @@
+package bscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+// Combine is the Combiner role, it merges the fields of others, which have
+// to be PSBTs of the same transaction, into p. Fields p already has are
+// kept.
+func (p *PSBT) Combine(others ...*PSBT) error {
+	tx, err := p.Transaction()
+	if err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		otx, err := other.Transaction()
+		if err != nil {
+			return err
+		}
+		if other.Version != p.Version || !bytes.Equal(tx.Bytes(), otx.Bytes()) {
+			return ErrPSBTTransactionDiffer
+		}
+		if len(other.Inputs) != len(p.Inputs) || len(other.Outputs) != len(p.Outputs) {
+			return ErrPSBTCountMismatch
+		}
+
+		p.Xpubs = mergePSBTDerivations(p.Xpubs, other.Xpubs)
+		p.Unknown = mergePSBTBytes(p.Unknown, other.Unknown)
+		for i, in := range p.Inputs {
+			in.merge(other.Inputs[i])
+		}
+		for i, out := range p.Outputs {
+			out.merge(other.Outputs[i])
+		}
+	}
+
+	return nil
+}
+
+func (in *PSBTInput) merge(other *PSBTInput) {
+	if in.NonWitnessUtxo == nil {
+		in.NonWitnessUtxo = other.NonWitnessUtxo
+	}
+	if in.WitnessUtxo == nil {
+		in.WitnessUtxo = other.WitnessUtxo
+	}
+	if in.SigHash == nil {
+		in.SigHash = other.SigHash
+	}
+	if in.RedeemScript == nil {
+		in.RedeemScript = other.RedeemScript
+	}
+	if in.WitnessScript == nil {
+		in.WitnessScript = other.WitnessScript
+	}
+	if in.FinalScriptSig == nil {
+		in.FinalScriptSig = other.FinalScriptSig
+	}
+	if in.FinalScriptWitness == nil {
+		in.FinalScriptWitness = other.FinalScriptWitness
+	}
+	if in.RequiredTimeLocktime == nil {
+		in.RequiredTimeLocktime = other.RequiredTimeLocktime
+	}
+	if in.RequiredHeightLocktime == nil {
+		in.RequiredHeightLocktime = other.RequiredHeightLocktime
+	}
+	if in.TaprootKeySig == nil {
+		in.TaprootKeySig = other.TaprootKeySig
+	}
+	if in.TaprootInternalKey == nil {
+		in.TaprootInternalKey = other.TaprootInternalKey
+	}
+	if in.TaprootMerkleRoot == nil {
+		in.TaprootMerkleRoot = other.TaprootMerkleRoot
+	}
+
+	in.PartialSigs = mergePSBTBytes(in.PartialSigs, other.PartialSigs)
+	in.Bip32Derivation = mergePSBTDerivations(in.Bip32Derivation, other.Bip32Derivation)
+	in.TaprootScriptSigs = mergePSBTBytes(in.TaprootScriptSigs, other.TaprootScriptSigs)
+	in.TaprootBip32Derivation = mergePSBTTaprootDerivations(in.TaprootBip32Derivation, other.TaprootBip32Derivation)
+	in.Unknown = mergePSBTBytes(in.Unknown, other.Unknown)
+	for control, leaf := range other.TaprootLeafScripts {
+		if in.TaprootLeafScripts == nil {
+			in.TaprootLeafScripts = make(map[string]*PSBTTaprootLeafScript)
+		}
+		if _, ok := in.TaprootLeafScripts[control]; !ok {
+			in.TaprootLeafScripts[control] = leaf
+		}
+	}
+
+	if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+		in.clearSigningFields()
+	}
+}
+
+func (out *PSBTOutput) merge(other *PSBTOutput) {
+	if out.RedeemScript == nil {
+		out.RedeemScript = other.RedeemScript
+	}
+	if out.WitnessScript == nil {
+		out.WitnessScript = other.WitnessScript
+	}
+	if out.TaprootInternalKey == nil {
+		out.TaprootInternalKey = other.TaprootInternalKey
+	}
+	if out.TaprootTree == nil {
+		out.TaprootTree = other.TaprootTree
+	}
+
+	out.Bip32Derivation = mergePSBTDerivations(out.Bip32Derivation, other.Bip32Derivation)
+	out.TaprootBip32Derivation = mergePSBTTaprootDerivations(out.TaprootBip32Derivation, other.TaprootBip32Derivation)
+	out.Unknown = mergePSBTBytes(out.Unknown, other.Unknown)
+}
+
+func mergePSBTBytes(dst, src map[string][]byte) map[string][]byte {
+	for k, v := range src {
+		if dst == nil {
+			dst = make(map[string][]byte)
+		}
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
+
+func mergePSBTDerivations(dst, src map[string]*PSBTDerivation) map[string]*PSBTDerivation {
+	for k, v := range src {
+		if dst == nil {
+			dst = make(map[string]*PSBTDerivation)
+		}
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
+
+func mergePSBTTaprootDerivations(dst, src map[string]*PSBTTaprootDerivation) map[string]*PSBTTaprootDerivation {
+	for k, v := range src {
+		if dst == nil {
+			dst = make(map[string]*PSBTTaprootDerivation)
+		}
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
+
+// psbtSpend is how an input spends its output: the script whose keys sign,
+// the scriptCode the signatures commit to and the wrapping around it.
+type psbtSpend struct {
+	typ        ScriptType
+	solutions  [][]byte
+	scriptCode *Script
+	version    SignatureVersion
+	redeem     *Script
+	witness    *Script
+	keyHash    bool
+}
+
+// resolvePSBTSpend unwraps the P2SH and segwit v0 layers of scriptPubkey
+// with the scripts of in.
+func resolvePSBTSpend(in *PSBTInput, scriptPubkey *Script) (*psbtSpend, error) {
+	spend := &psbtSpend{scriptCode: scriptPubkey, version: SignatureVersionBase}
+	spend.typ, spend.solutions = scriptPubkey.Solve()
+
+	if spend.typ == ScriptTypeScriptHash {
+		if in.RedeemScript == nil || !bytes.Equal(Hash160(in.RedeemScript.Data), spend.solutions[0]) {
+			return nil, ErrSignerMissingRedeemScript
+		}
+		spend.redeem = in.RedeemScript
+		spend.scriptCode = in.RedeemScript
+		spend.typ, spend.solutions = in.RedeemScript.Solve()
+	}
+
+	switch spend.typ {
+	case ScriptTypeWitnessV0KeyHash:
+		spend.keyHash = true
+		spend.version = SignatureVersionWitnessV0
+		spend.scriptCode, _ = NewPayToPubkeyHashScript(spend.solutions[0])
+		spend.typ, spend.solutions = spend.scriptCode.Solve()
+
+	case ScriptTypeWitnessV0ScriptHash:
+		if in.WitnessScript == nil {
+			return nil, ErrSignerMissingWitnessScript
+		}
+		if h := sha256.Sum256(in.WitnessScript.Data); !bytes.Equal(h[:], spend.solutions[0]) {
+			return nil, ErrSignerMissingWitnessScript
+		}
+		spend.witness = in.WitnessScript
+		spend.version = SignatureVersionWitnessV0
+		spend.scriptCode = in.WitnessScript
+		spend.typ, spend.solutions = in.WitnessScript.Solve()
+	}
+
+	return spend, nil
+}
+
+// SignPSBT is the Signer role, it adds the partial signatures of the keys s
+// holds to the inputs of p which are not finalized and returns how many it
+// added. Inputs without their spent output are skipped, as are taproot
+// inputs which this package has no Schnorr signer for. The sighash of an
+// input overrides s.SigHash.
+func (s *Signer) SignPSBT(p *PSBT) (int, error) {
+	tx, err := p.Transaction()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+			continue
+		}
+
+		prevOutput, err := p.SpentOutput(i)
+		if err == ErrPSBTMissingUtxo {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		spend, err := resolvePSBTSpend(in, NewScriptFromBytes(prevOutput.ScriptPubkey))
+		if err != nil {
+			return n, err
+		}
+
+		var pubkeys [][]byte
+		switch spend.typ {
+		case ScriptTypePubkey:
+			pubkeys = spend.solutions
+		case ScriptTypePubkeyHash:
+			if pubkey, ok := s.pubkeys[string(spend.solutions[0])]; ok {
+				pubkeys = [][]byte{pubkey}
+			}
+		case ScriptTypeMultisig:
+			pubkeys = spend.solutions[1 : len(spend.solutions)-1]
+		}
+
+		sighash := s.SigHash
+		if in.SigHash != nil {
+			sighash = *in.SigHash
+		}
+
+		ts := NewTransactionSigner(tx, i, prevOutput.Value)
+		for _, pubkey := range pubkeys {
+			sig, err := s.createSignature(ts, pubkey, spend.scriptCode, spend.version, sighash)
+			if err == ErrSignerMissingKey {
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+
+			if in.PartialSigs == nil {
+				in.PartialSigs = make(map[string][]byte)
+			}
+			in.PartialSigs[string(pubkey)] = sig
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Finalize is the Finalizer role, it finalizes every input it can with
+// FinalizeInput and returns ErrPSBTIncomplete if any input is left.
+func (p *PSBT) Finalize(flag Flag) error {
+	complete := true
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+			continue
+		}
+		if err := p.FinalizeInput(i, flag); err != nil {
+			complete = false
+		}
+	}
+
+	if !complete {
+		return ErrPSBTIncomplete
+	}
+
+	return nil
+}
+
+// FinalizeInput builds the final scriptSig and witness of input index from
+// its partial signatures, or taproot signatures, verifies them under flag
+// and clears the fields only signers need.
+func (p *PSBT) FinalizeInput(index int, flag Flag) error {
+	tx, err := p.Transaction()
+	if err != nil {
+		return err
+	}
+
+	prevOutput, err := p.SpentOutput(index)
+	if err != nil {
+		return err
+	}
+
+	in := p.Inputs[index]
+	scriptPubkey := NewScriptFromBytes(prevOutput.ScriptPubkey)
+
+	var stack [][]byte
+	var witness ScriptWitness
+	if typ, _ := scriptPubkey.Solve(); typ == ScriptTypeWitnessV1Taproot {
+		if witness = in.taprootWitness(); witness == nil {
+			return ErrPSBTIncomplete
+		}
+	} else {
+		spend, err := resolvePSBTSpend(in, scriptPubkey)
+		if err != nil {
+			return err
+		}
+		if stack = in.satisfy(spend); stack == nil {
+			return ErrPSBTIncomplete
+		}
+
+		switch {
+		case spend.keyHash:
+			witness, stack = NewScriptWitness(stack), nil
+		case spend.witness != nil:
+			witness, stack = NewScriptWitness(append(stack, spend.witness.Bytes())), nil
+		}
+		if spend.redeem != nil {
+			stack = append(stack, spend.redeem.Bytes())
+		}
+	}
+
+	scriptSig := pushAll(stack)
+	tx.Inputs[index].ScriptSig = scriptSig.Bytes()
+
+	ts := NewTransactionSigner(tx, index, prevOutput.Value)
+	if prevOutputs, err := p.spentOutputs(); err == nil {
+		ts = NewTransactionSignerWithPrevOutputs(tx, index, prevOutputs)
+	}
+	err = VerifyScript(NewScriptFromBytes(scriptSig.Bytes()), scriptPubkey, witness, flag, ts, SignatureVersionBase)
+	if err != nil {
+		return err
+	}
+
+	if len(stack) > 0 {
+		in.FinalScriptSig = scriptSig
+	}
+	in.FinalScriptWitness = witness
+
+	in.clearSigningFields()
+
+	return nil
+}
+
+// clearSigningFields drops what only signers and finalizers need once the
+// input is finalized.
+func (in *PSBTInput) clearSigningFields() {
+	in.PartialSigs = nil
+	in.SigHash = nil
+	in.RedeemScript = nil
+	in.WitnessScript = nil
+	in.Bip32Derivation = nil
+	in.TaprootKeySig = nil
+	in.TaprootScriptSigs = nil
+	in.TaprootLeafScripts = nil
+	in.TaprootBip32Derivation = nil
+	in.TaprootInternalKey = nil
+	in.TaprootMerkleRoot = nil
+}
+
+// satisfy is the stack spending the key template of spend with the partial
+// signatures of in, nil without enough signatures.
+func (in *PSBTInput) satisfy(spend *psbtSpend) [][]byte {
+	switch spend.typ {
+	case ScriptTypePubkey:
+		if sig, ok := in.PartialSigs[string(spend.solutions[0])]; ok {
+			return [][]byte{sig}
+		}
+
+	case ScriptTypePubkeyHash:
+		for pubkey, sig := range in.PartialSigs {
+			if bytes.Equal(Hash160([]byte(pubkey)), spend.solutions[0]) {
+				return [][]byte{sig, []byte(pubkey)}
+			}
+		}
+
+	case ScriptTypeMultisig:
+		m := int(spend.solutions[0][0])
+		// the extra item CHECKMULTISIG pops
+		stack := [][]byte{{}}
+		for _, pubkey := range spend.solutions[1 : len(spend.solutions)-1] {
+			if sig, ok := in.PartialSigs[string(pubkey)]; ok && len(stack) <= m {
+				stack = append(stack, sig)
+			}
+		}
+		if len(stack) > m {
+			return stack
+		}
+	}
+
+	return nil
+}
+
+// taprootWitness spends with the key path signature, or else with a
+// <key> OP_CHECKSIG leaf one of the script signatures is for.
+func (in *PSBTInput) taprootWitness() ScriptWitness {
+	if in.TaprootKeySig != nil {
+		return NewScriptWitness([][]byte{in.TaprootKeySig})
+	}
+
+	for control, leaf := range in.TaprootLeafScripts {
+		script := leaf.Script
+		if leaf.LeafVersion != TaprootLeafTapscript || len(script) != 34 ||
+			script[0] != byte(OP_PUSHBYTES_32) || script[33] != byte(OP_CHECKSIG) {
+			continue
+		}
+
+		leafHash := ComputeTapleafHash(leaf.LeafVersion, script)
+		if sig, ok := in.TaprootScriptSigs[string(script[1:33])+string(leafHash)]; ok {
+			return NewScriptWitness([][]byte{sig, script, []byte(control)})
+		}
+	}
+
+	return nil
+}
+
+// spentOutputs are the outputs spent by every input, which taproot
+// signatures commit to.
+func (p *PSBT) spentOutputs() ([]*bcore.TransactionOutput, error) {
+	prevOutputs := make([]*bcore.TransactionOutput, len(p.Inputs))
+	for i := range p.Inputs {
+		prevOutput, err := p.SpentOutput(i)
+		if err != nil {
+			return nil, err
+		}
+		prevOutputs[i] = prevOutput
+	}
+
+	return prevOutputs, nil
+}
+
+// Extract is the Transaction Extractor role, the transaction with the final
+// scriptSigs of p. bcore.Transaction carries no witness, so the final
+// witnesses are returned in input order, nil for non witness inputs.
+func (p *PSBT) Extract() (*bcore.Transaction, []ScriptWitness, error) {
+	tx, err := p.Transaction()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	witnesses := make([]ScriptWitness, len(p.Inputs))
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig == nil && in.FinalScriptWitness == nil {
+			return nil, nil, ErrPSBTNotFinalized
+		}
+		if in.FinalScriptSig != nil {
+			tx.Inputs[i].ScriptSig = in.FinalScriptSig.Bytes()
+		}
+		witnesses[i] = in.FinalScriptWitness
+	}
+
+	return tx, witnesses, nil
+}
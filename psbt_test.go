@@ -0,0 +1,444 @@
+package bscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/detailyang/go-bcore"
+	bcrypto "github.com/detailyang/go-bcrypto"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func TestPSBT(t *testing.T) {
+	keys := []*bcrypto.Key{
+		bcrypto.NewKey(key0bytes[:], true),
+		bcrypto.NewKey(key1bytes[:], true),
+		bcrypto.NewKey(key2bytes[:], true),
+	}
+	pubkeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		pubkey, _ := key.GetPubkey()
+		pubkeys[i] = pubkey.Bytes()
+	}
+
+	flag := ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyStrictEncoding | ScriptVerifyLowS |
+		ScriptVerifyNullDummy | ScriptVerifyNullFail | ScriptVerifyCleanStack
+
+	multisig, _ := NewMultisigScript(2, pubkeys)
+	h := sha256.Sum256(multisig.Data)
+	p2pkh, _ := NewPayToPubkeyHashScript(Hash160(pubkeys[0]))
+	p2sh, _ := NewPayToScriptHashScript(Hash160(multisig.Data))
+	p2wsh, _ := NewPayToWitnessScriptHashScript(h[:])
+	p2wpkh, _ := NewPayToWitnessPubkeyHashScript(Hash160(pubkeys[1]))
+	p2shp2wpkh, _ := NewPayToScriptHashScript(Hash160(p2wpkh.Data))
+
+	scriptPubkeys := []*Script{p2pkh, p2sh, p2wsh, p2shp2wpkh}
+	creditTxs := make([]*bcore.Transaction, len(scriptPubkeys))
+	tx := &bcore.Transaction{Version: 2}
+	for i, scriptPubkey := range scriptPubkeys {
+		creditTxs[i] = NewCreditingTransaction(scriptPubkey, uint64(1000*(i+1)))
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{
+			PrevOutput: bcore.NewOutPoint(creditTxs[i].ID(), 0),
+			Sequence:   bcore.TransactionFinalSequence,
+		})
+	}
+	tx.Outputs = append(tx.Outputs, &bcore.TransactionOutput{Value: 9000, ScriptPubkey: p2wpkh.Bytes()})
+
+	for _, version := range []uint32{0, 2} {
+		creator := NewPSBT
+		if version == 2 {
+			creator = NewPSBTV2
+		}
+		p, err := creator(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Updater
+		p.Inputs[0].NonWitnessUtxo = creditTxs[0]
+		p.Inputs[1].NonWitnessUtxo = creditTxs[1]
+		p.Inputs[1].RedeemScript = multisig
+		p.Inputs[2].WitnessUtxo = creditTxs[2].Outputs[0]
+		p.Inputs[2].WitnessScript = multisig
+		p.Inputs[3].WitnessUtxo = creditTxs[3].Outputs[0]
+		p.Inputs[3].RedeemScript = p2wpkh
+		p.Inputs[0].Bip32Derivation = map[string]*PSBTDerivation{
+			string(pubkeys[0]): {Fingerprint: 0xdeadbeef, Path: []uint32{0x8000002c, 0x80000000, 0x80000000, 0, 1}},
+		}
+		p.Outputs[0].Unknown = map[string][]byte{"\xfc\x01x": {1, 2, 3}}
+
+		if again, err := NewPSBTFromBase64(p.Base64()); err != nil || !bytes.Equal(again.Bytes(), p.Bytes()) {
+			t.Fatalf("v%d: round trip failed %v", version, err)
+		}
+
+		// each cosigner signs its own copy
+		var signed []*PSBT
+		for _, key := range keys[:2] {
+			cosigner, _ := NewPSBTFromBytes(p.Bytes())
+			signer := NewSigner(flag, SigHashAll)
+			signer.AddKey(key)
+			if _, err := signer.SignPSBT(cosigner); err != nil {
+				t.Fatalf("v%d: %v", version, err)
+			}
+			signed = append(signed, cosigner)
+		}
+
+		if err := signed[0].Finalize(flag); err != ErrPSBTIncomplete {
+			t.Errorf("v%d: expect incomplete, got %v", version, err)
+		}
+		if signed[0].Inputs[0].FinalScriptSig == nil || signed[0].Inputs[1].FinalScriptSig != nil {
+			t.Errorf("v%d: expect only the inputs with enough signatures finalized", version)
+		}
+		if err := signed[0].Combine(signed[1]); err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		if err := signed[0].Finalize(flag); err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+
+		final, err := NewPSBTFromBase64(signed[0].Base64())
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		if final.Inputs[0].Bip32Derivation != nil || final.Inputs[1].PartialSigs != nil {
+			t.Errorf("v%d: expect finalized inputs to be cleared", version)
+		}
+
+		signedTx, witnesses, err := final.Extract()
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		for i, in := range signedTx.Inputs {
+			err := VerifyScript(NewScriptFromBytes(in.ScriptSig), NewScriptFromBytes(scriptPubkeys[i].Bytes()), witnesses[i], flag,
+				NewTransactionSigner(signedTx, i, creditTxs[i].Outputs[0].Value), SignatureVersionBase)
+			if err != nil {
+				t.Errorf("v%d: input %d: %v", version, i, err)
+			}
+		}
+	}
+}
+
+func TestPSBTV2Locktime(t *testing.T) {
+	tx := &bcore.Transaction{Version: 2, Locktime: 7}
+	for i := 0; i < 3; i++ {
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{PrevOutput: bcore.NewOutPoint(HashOne, uint32(i))})
+	}
+
+	u32 := func(v uint32) *uint32 { return &v }
+	tests := []struct {
+		heights, times []*uint32
+		locktime       uint32
+		err            error
+	}{
+		{[]*uint32{nil, nil, nil}, []*uint32{nil, nil, nil}, 7, nil},
+		{[]*uint32{u32(10), nil, u32(20)}, []*uint32{nil, nil, nil}, 20, nil},
+		{[]*uint32{u32(10), nil, nil}, []*uint32{u32(500000001), u32(500000009), nil}, 500000009, nil},
+		{[]*uint32{u32(10), u32(30), nil}, []*uint32{u32(500000001), nil, nil}, 30, nil},
+		{[]*uint32{u32(10), nil, nil}, []*uint32{nil, u32(500000001), nil}, 0, ErrPSBTBadLocktime},
+	}
+
+	for i, test := range tests {
+		p, _ := NewPSBTV2(tx)
+		for j, in := range p.Inputs {
+			in.RequiredHeightLocktime = test.heights[j]
+			in.RequiredTimeLocktime = test.times[j]
+		}
+
+		p, err := NewPSBTFromBytes(p.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		unsigned, err := p.Transaction()
+		if err != test.err {
+			t.Errorf("test %d: expect %v got %v", i, test.err, err)
+		}
+		if err == nil && unsigned.Locktime != test.locktime {
+			t.Errorf("test %d: expect locktime %d got %d", i, test.locktime, unsigned.Locktime)
+		}
+	}
+}
+
+func TestPSBTInvalid(t *testing.T) {
+	tx := &bcore.Transaction{Version: 2}
+	tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{PrevOutput: bcore.NewOutPoint(HashOne, 0)})
+	tx.Outputs = append(tx.Outputs, &bcore.TransactionOutput{Value: 1})
+
+	v0, _ := NewPSBT(tx)
+	v2, _ := NewPSBTV2(tx)
+	p0, p2 := v0.Bytes(), v2.Bytes()
+
+	// the global map of v0 is only the unsigned transaction
+	global := len(psbtMagic) + 2 + len(NewBuffer().PutVarBytes(tx.Bytes()).Bytes())
+	withKey := func(b []byte, at int, kv ...byte) []byte {
+		return append(append(append([]byte{}, b[:at]...), kv...), b[at:]...)
+	}
+
+	signedTx := &bcore.Transaction{Version: 2}
+	signedTx.Inputs = append(signedTx.Inputs, &bcore.TransactionInput{PrevOutput: bcore.NewOutPoint(HashOne, 0), ScriptSig: []byte{0x51}})
+
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"bad magic", append([]byte("psbu\xff"), p0[5:]...), ErrPSBTBadMagic},
+		{"truncated", p0[:len(p0)-1], ErrPSBTBadValue},
+		{"duplicate key", withKey(p0, global, 1, 0xfc, 1, 0, 1, 0xfc, 1, 0), ErrPSBTDuplicateKey},
+		{"version 1", withKey(p0, global, 1, 0xfb, 4, 1, 0, 0, 0), ErrPSBTBadVersion},
+		{"v0 with tx version", withKey(p0, global, 1, 0x02, 4, 2, 0, 0, 0), ErrPSBTUnexpectedField},
+		{"v2 with unsigned tx", withKey(p2, 5, append([]byte{1, 0, byte(len(tx.Bytes()))}, tx.Bytes()...)...), ErrPSBTUnexpectedField},
+		{"missing tx", []byte("psbt\xff\x00"), ErrPSBTMissingTx},
+		{"bad sighash", withKey(p0, global+1, 1, 0x03, 2, 1, 0), ErrPSBTBadValue},
+	}
+
+	for _, test := range tests {
+		if _, err := NewPSBTFromBytes(test.b); err != test.err {
+			t.Errorf("%s: expect %v got %v", test.name, test.err, err)
+		}
+	}
+
+	if _, err := NewPSBT(signedTx); err != ErrPSBTNotUnsigned {
+		t.Errorf("expect not unsigned, got %v", err)
+	}
+	if _, err := NewPSBTFromBase64("cHNidP8"); err != ErrPSBTBadBase64 {
+		t.Errorf("expect bad base64, got %v", err)
+	}
+	if _, _, err := v0.Extract(); err != ErrPSBTNotFinalized {
+		t.Errorf("expect not finalized, got %v", err)
+	}
+	if err := v0.Combine(v2); err != ErrPSBTTransactionDiffer {
+		t.Errorf("expect different transactions, got %v", err)
+	}
+}
+
+// psbtTestMap is a PSBT map as hex key and value pairs, the key starting with
+// its type.
+type psbtTestMap [][2]string
+
+func (m psbtTestMap) with(kvs ...[2]string) psbtTestMap {
+	return append(append(psbtTestMap{}, m...), kvs...)
+}
+
+func (m psbtTestMap) without(key string) psbtTestMap {
+	var kept psbtTestMap
+	for _, kv := range m {
+		if kv[0] != key {
+			kept = append(kept, kv)
+		}
+	}
+
+	return kept
+}
+
+func newPSBTTestBytes(maps ...psbtTestMap) []byte {
+	buffer := NewBuffer().PutBytes(psbtMagic)
+	for _, m := range maps {
+		for _, kv := range m {
+			key, _ := hex.DecodeString(kv[0])
+			value, _ := hex.DecodeString(kv[1])
+			buffer.PutVarBytes(key).PutVarBytes(value)
+		}
+		buffer.PutUint8(0)
+	}
+
+	return buffer.Bytes()
+}
+
+// TestPSBTBIPVectors follows the test vector lists of BIP174, BIP370 and
+// BIP371, with keys and values built here since they are checked by kind.
+func TestPSBTBIPVectors(t *testing.T) {
+	pubkey, _ := bcrypto.NewKey(key0bytes[:], true).GetPubkey()
+	compressed := hex.EncodeToString(pubkey.Bytes())
+	xonly := compressed[2:]
+	badPubkey := "05" + xonly
+	leafHash := strings.Repeat("22", 32)
+	origin := "deadbeef" + "2c000080"
+
+	tx := &bcore.Transaction{Version: 2}
+	tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{PrevOutput: bcore.NewOutPoint(HashOne, 0)})
+	tx.Outputs = append(tx.Outputs, &bcore.TransactionOutput{Value: 1000, ScriptPubkey: []byte{0x51}})
+	unsignedTx := hex.EncodeToString(tx.Bytes())
+	tx.Inputs[0].ScriptSig = []byte{0x51}
+	signedTx := hex.EncodeToString(tx.Bytes())
+
+	v0Global := psbtTestMap{{"00", unsignedTx}}
+	v2Global := psbtTestMap{{"02", "02000000"}, {"04", "01"}, {"05", "01"}, {"fb", "02000000"}}
+	v2Input := psbtTestMap{{"0e", hex.EncodeToString(HashOne.Bytes())}, {"0f", "00000000"}}
+	v2Output := psbtTestMap{{"03", "e803000000000000"}, {"04", "51"}}
+
+	taprootInput := psbtTestMap{
+		{"01", "e803000000000000" + "22" + "5120" + xonly},
+		{"13", strings.Repeat("11", 64)},
+		{"14" + xonly + leafHash, strings.Repeat("33", 64) + "01"},
+		{"15" + "c1" + xonly, "51" + "c0"},
+		{"16" + xonly, "01" + leafHash + origin},
+		{"17", xonly},
+		{"18", strings.Repeat("44", 32)},
+		{"fc0161", "01"},
+	}
+	taprootTree := "01c00151" + "02c00152" + "02c00153"
+	taprootOutput := psbtTestMap{
+		{"05", xonly},
+		{"06", taprootTree},
+		{"07" + xonly, "00" + origin},
+	}
+
+	valid := []struct {
+		name string
+		b    []byte
+	}{
+		{"bip174 minimal", newPSBTTestBytes(v0Global, nil, nil)},
+		{"bip174 legacy fields", newPSBTTestBytes(v0Global, psbtTestMap{
+			{"00", unsignedTx},
+			{"02" + compressed, "3006020101020101" + "01"},
+			{"03", "01000000"},
+			{"04", "51"},
+			{"05", "52"},
+			{"06" + compressed, origin},
+			{"07", "53"},
+			{"08", "0101" + "01"},
+		}, psbtTestMap{
+			{"00", "51"},
+			{"01", "52"},
+			{"02" + compressed, origin},
+		})},
+		{"bip174 proprietary and unknown keys", newPSBTTestBytes(
+			v0Global.with([2]string{"0f", "00"}, [2]string{"fc0161", "01"}),
+			psbtTestMap{{"fc0161", "01"}},
+			psbtTestMap{{"fc0161", "01"}})},
+		{"bip371 taproot v0", newPSBTTestBytes(v0Global, taprootInput, taprootOutput)},
+		{"bip370 minimal", newPSBTTestBytes(v2Global, v2Input, v2Output)},
+		{"bip370 all fields", newPSBTTestBytes(
+			psbtTestMap{{"02", "02000000"}, {"03", "00000000"}, {"04", "01"}, {"05", "01"}, {"06", "03"}, {"fb", "02000000"}},
+			v2Input.with([2]string{"10", "feffffff"}, [2]string{"11", "0065cd1d"}, [2]string{"12", "01000000"}),
+			v2Output)},
+		{"bip371 taproot v2", newPSBTTestBytes(v2Global, append(taprootInput[:1].with(v2Input...), taprootInput[1:]...), append(v2Output, taprootOutput...))},
+	}
+
+	for _, test := range valid {
+		p, err := NewPSBTFromBytes(test.b)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(p.Bytes(), test.b) {
+			t.Errorf("%s: expect round trip %x got %x", test.name, test.b, p.Bytes())
+		}
+	}
+
+	p, _ := NewPSBTFromBytes(newPSBTTestBytes(v0Global, taprootInput, taprootOutput))
+	in, out := p.Inputs[0], p.Outputs[0]
+	key, _ := hex.DecodeString(xonly)
+	hash, _ := hex.DecodeString(leafHash)
+	if len(in.TaprootKeySig) != 64 || len(in.TaprootScriptSigs[string(key)+string(hash)]) != 65 {
+		t.Errorf("expect taproot signatures got %x %x", in.TaprootKeySig, in.TaprootScriptSigs)
+	}
+	if leaf := in.TaprootLeafScripts["\xc1"+string(key)]; leaf == nil || !bytes.Equal(leaf.Script, []byte{0x51}) || leaf.LeafVersion != TaprootLeafTapscript {
+		t.Errorf("expect leaf script got %+v", leaf)
+	}
+	for _, derivations := range []map[string]*PSBTTaprootDerivation{in.TaprootBip32Derivation, out.TaprootBip32Derivation} {
+		if d := derivations[string(key)]; d == nil || d.Fingerprint != 0xefbeadde || len(d.Path) != 1 || d.Path[0] != 0x8000002c {
+			t.Errorf("expect taproot derivation got %+v", d)
+		}
+	}
+	if d := in.TaprootBip32Derivation[string(key)]; d == nil || len(d.LeafHashes) != 1 || !bytes.Equal(d.LeafHashes[0], hash) {
+		t.Errorf("expect leaf hashes got %+v", d)
+	}
+	if !bytes.Equal(in.TaprootInternalKey, key) || len(in.TaprootMerkleRoot) != 32 || !bytes.Equal(out.TaprootInternalKey, key) {
+		t.Errorf("expect taproot keys got %x %x %x", in.TaprootInternalKey, in.TaprootMerkleRoot, out.TaprootInternalKey)
+	}
+	if hex.EncodeToString(out.TaprootTree) != taprootTree {
+		t.Errorf("expect taproot tree %s got %x", taprootTree, out.TaprootTree)
+	}
+
+	rawTx, _ := hex.DecodeString(unsignedTx)
+	invalid := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		// BIP174
+		{"network transaction", rawTx, ErrPSBTBadMagic},
+		{"missing outputs", newPSBTTestBytes(v0Global, nil), ErrPSBTBadValue},
+		{"filled signature script", newPSBTTestBytes(psbtTestMap{{"00", signedTx}}, nil, nil), ErrPSBTNotUnsigned},
+		{"missing unsigned tx", newPSBTTestBytes(nil, nil, nil), ErrPSBTMissingTx},
+		{"duplicate input key", newPSBTTestBytes(v0Global, psbtTestMap{{"04", "51"}, {"04", "52"}}, nil), ErrPSBTDuplicateKey},
+		{"global unsigned tx key data", newPSBTTestBytes(psbtTestMap{{"0000", unsignedTx}}, nil, nil), ErrPSBTBadKey},
+		{"input non witness utxo key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0000", unsignedTx}}, nil), ErrPSBTBadKey},
+		{"input witness utxo key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0100", "e80300000000000000"}}, nil), ErrPSBTBadKey},
+		{"input witness utxo trailing bytes", newPSBTTestBytes(v0Global, psbtTestMap{{"01", "e8030000000000000000"}}, nil), ErrPSBTBadValue},
+		{"input partial sig bad pubkey", newPSBTTestBytes(v0Global, psbtTestMap{{"02" + badPubkey, "300602010102010101"}}, nil), ErrPSBTBadKey},
+		{"input sighash key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0300", "01000000"}}, nil), ErrPSBTBadKey},
+		{"input redeem script key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0400", "51"}}, nil), ErrPSBTBadKey},
+		{"input witness script key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0500", "51"}}, nil), ErrPSBTBadKey},
+		{"input bip32 bad pubkey", newPSBTTestBytes(v0Global, psbtTestMap{{"06" + badPubkey, origin}}, nil), ErrPSBTBadKey},
+		{"input bip32 bad origin", newPSBTTestBytes(v0Global, psbtTestMap{{"06" + compressed, origin + "00"}}, nil), ErrPSBTBadValue},
+		{"input final script sig key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0700", "51"}}, nil), ErrPSBTBadKey},
+		{"input final witness key data", newPSBTTestBytes(v0Global, psbtTestMap{{"0800", "0101" + "01"}}, nil), ErrPSBTBadKey},
+		{"output redeem script key data", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"0000", "51"}}), ErrPSBTBadKey},
+		{"output witness script key data", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"0100", "51"}}), ErrPSBTBadKey},
+		{"output bip32 bad pubkey", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"02" + badPubkey, origin}}), ErrPSBTBadKey},
+
+		// BIP371
+		{"input taproot key sig key data", newPSBTTestBytes(v0Global, psbtTestMap{{"1300", strings.Repeat("11", 64)}}, nil), ErrPSBTBadKey},
+		{"input taproot key sig short", newPSBTTestBytes(v0Global, psbtTestMap{{"13", strings.Repeat("11", 63)}}, nil), ErrPSBTBadValue},
+		{"input taproot key sig long", newPSBTTestBytes(v0Global, psbtTestMap{{"13", strings.Repeat("11", 66)}}, nil), ErrPSBTBadValue},
+		{"input taproot script sig short key", newPSBTTestBytes(v0Global, psbtTestMap{{"14" + xonly, strings.Repeat("11", 64)}}, nil), ErrPSBTBadKey},
+		{"input taproot script sig long", newPSBTTestBytes(v0Global, psbtTestMap{{"14" + xonly + leafHash, strings.Repeat("11", 66)}}, nil), ErrPSBTBadValue},
+		{"input taproot leaf script bad control block", newPSBTTestBytes(v0Global, psbtTestMap{{"15c1" + xonly + "00", "51c0"}}, nil), ErrPSBTBadKey},
+		{"input taproot leaf script empty", newPSBTTestBytes(v0Global, psbtTestMap{{"15c1" + xonly, ""}}, nil), ErrPSBTBadValue},
+		{"input taproot bip32 compressed key", newPSBTTestBytes(v0Global, psbtTestMap{{"16" + compressed, "00" + origin}}, nil), ErrPSBTBadKey},
+		{"input taproot bip32 missing leaf hash", newPSBTTestBytes(v0Global, psbtTestMap{{"16" + xonly, "02" + leafHash + origin}}, nil), ErrPSBTBadValue},
+		{"input taproot internal key key data", newPSBTTestBytes(v0Global, psbtTestMap{{"1700", xonly}}, nil), ErrPSBTBadKey},
+		{"input taproot internal key compressed", newPSBTTestBytes(v0Global, psbtTestMap{{"17", compressed}}, nil), ErrPSBTBadValue},
+		{"input taproot merkle root key data", newPSBTTestBytes(v0Global, psbtTestMap{{"1800", leafHash}}, nil), ErrPSBTBadKey},
+		{"input taproot merkle root short", newPSBTTestBytes(v0Global, psbtTestMap{{"18", leafHash[2:]}}, nil), ErrPSBTBadValue},
+		{"output taproot internal key key data", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"0500", xonly}}), ErrPSBTBadKey},
+		{"output taproot internal key compressed", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"05", compressed}}), ErrPSBTBadValue},
+		{"output taproot tree key data", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"0600", "00c00151"}}), ErrPSBTBadKey},
+		{"output taproot tree empty", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"06", ""}}), ErrPSBTBadValue},
+		{"output taproot tree incomplete", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"06", "01c00151"}}), ErrPSBTBadValue},
+		{"output taproot tree leaf after root", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"06", "00c00151" + "00c00152"}}), ErrPSBTBadValue},
+		{"output taproot tree odd leaf version", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"06", "00c10151"}}), ErrPSBTBadValue},
+		{"output taproot tree too deep", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"06", "81c00151"}}), ErrPSBTBadValue},
+		{"output taproot tree truncated script", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"06", "00c00251"}}), ErrPSBTBadValue},
+		{"output taproot bip32 compressed key", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"07" + compressed, "00" + origin}}), ErrPSBTBadKey},
+
+		// BIP370
+		{"v2 missing input count", newPSBTTestBytes(v2Global.without("04"), v2Input, v2Output), ErrPSBTMissingField},
+		{"v2 missing output count", newPSBTTestBytes(v2Global.without("05"), v2Input, v2Output), ErrPSBTMissingField},
+		{"v2 missing tx version", newPSBTTestBytes(v2Global.without("02"), v2Input, v2Output), ErrPSBTMissingField},
+		{"v2 with unsigned tx", newPSBTTestBytes(v2Global.with(v0Global[0]), v2Input, v2Output), ErrPSBTUnexpectedField},
+		{"v2 modifiable key data", newPSBTTestBytes(v2Global.with([2]string{"0600", "00"}), v2Input, v2Output), ErrPSBTBadKey},
+		{"v2 missing input txid", newPSBTTestBytes(v2Global, v2Input.without("0e"), v2Output), ErrPSBTMissingField},
+		{"v2 missing input index", newPSBTTestBytes(v2Global, v2Input.without("0f"), v2Output), ErrPSBTMissingField},
+		{"v2 input txid key data", newPSBTTestBytes(v2Global, v2Input.without("0e").with([2]string{"0e00", leafHash}), v2Output), ErrPSBTBadKey},
+		{"v2 input txid short", newPSBTTestBytes(v2Global, v2Input.without("0e").with([2]string{"0e", leafHash[2:]}), v2Output), ErrPSBTBadValue},
+		{"v2 missing output amount", newPSBTTestBytes(v2Global, v2Input, v2Output.without("03")), ErrPSBTMissingField},
+		{"v2 missing output script", newPSBTTestBytes(v2Global, v2Input, v2Output.without("04")), ErrPSBTMissingField},
+		{"v2 time locktime below threshold", newPSBTTestBytes(v2Global, v2Input.with([2]string{"11", "ff64cd1d"}), v2Output), ErrPSBTBadValue},
+		{"v2 height locktime zero", newPSBTTestBytes(v2Global, v2Input.with([2]string{"12", "00000000"}), v2Output), ErrPSBTBadValue},
+		{"v2 height locktime above threshold", newPSBTTestBytes(v2Global, v2Input.with([2]string{"12", "0065cd1d"}), v2Output), ErrPSBTBadValue},
+		{"v0 with tx version", newPSBTTestBytes(v0Global.with([2]string{"02", "02000000"}), nil, nil), ErrPSBTUnexpectedField},
+		{"v0 with fallback locktime", newPSBTTestBytes(v0Global.with([2]string{"03", "00000000"}), nil, nil), ErrPSBTUnexpectedField},
+		{"v0 with input count", newPSBTTestBytes(v0Global.with([2]string{"04", "01"}), nil, nil), ErrPSBTUnexpectedField},
+		{"v0 with output count", newPSBTTestBytes(v0Global.with([2]string{"05", "01"}), nil, nil), ErrPSBTUnexpectedField},
+		{"v0 with modifiable", newPSBTTestBytes(v0Global.with([2]string{"06", "00"}), nil, nil), ErrPSBTUnexpectedField},
+		{"v0 with input txid", newPSBTTestBytes(v0Global, psbtTestMap{{"0e", leafHash}}, nil), ErrPSBTUnexpectedField},
+		{"v0 with input index", newPSBTTestBytes(v0Global, psbtTestMap{{"0f", "00000000"}}, nil), ErrPSBTUnexpectedField},
+		{"v0 with input sequence", newPSBTTestBytes(v0Global, psbtTestMap{{"10", "ffffffff"}}, nil), ErrPSBTUnexpectedField},
+		{"v0 with time locktime", newPSBTTestBytes(v0Global, psbtTestMap{{"11", "0065cd1d"}}, nil), ErrPSBTUnexpectedField},
+		{"v0 with height locktime", newPSBTTestBytes(v0Global, psbtTestMap{{"12", "01000000"}}, nil), ErrPSBTUnexpectedField},
+		{"v0 with output amount", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"03", "e803000000000000"}}), ErrPSBTUnexpectedField},
+		{"v0 with output script", newPSBTTestBytes(v0Global, nil, psbtTestMap{{"04", "51"}}), ErrPSBTUnexpectedField},
+	}
+
+	for _, test := range invalid {
+		if _, err := NewPSBTFromBytes(test.b); err != test.err {
+			t.Errorf("%s: expect %v got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package bscript
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrPubkeyBadSize      = errors.New("pubkey: bad size")
+	ErrPubkeyBadPrefix    = errors.New("pubkey: bad prefix")
+	ErrPubkeyNotOnCurve   = errors.New("pubkey: point not on curve")
+	ErrPubkeyHybridParity = errors.New("pubkey: hybrid prefix does not match the parity of y")
+)
+
+// IsHybridPubkey reports whether pubkey has the size and prefix of a hybrid
+// key, an uncompressed key with the parity of y in its 0x06 or 0x07 prefix.
+// OpenSSL accepted them, SCRIPT_VERIFY_STRICTENC rejects them.
+func IsHybridPubkey(pubkey []byte) bool {
+	return len(pubkey) == 65 && (pubkey[0] == 6 || pubkey[0] == 7)
+}
+
+// CheckPubkey reports why pubkey, compressed, uncompressed or hybrid, is not
+// a point of secp256k1, nil if it is. Unlike isPubKey, which only looks at
+// the prefix and size as STRICTENC does, it checks the point itself.
+func CheckPubkey(pubkey []byte) error {
+	_, err := parsePubkeyPoint(pubkey)
+	return err
+}
+
+// IsPubkeyOnCurve reports whether pubkey decodes to a point of secp256k1.
+func IsPubkeyOnCurve(pubkey []byte) bool {
+	return CheckPubkey(pubkey) == nil
+}
+
+// CompressPubkey is the 33 bytes encoding of pubkey.
+func CompressPubkey(pubkey []byte) ([]byte, error) {
+	p, err := parsePubkeyPoint(pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.compressedBytes(), nil
+}
+
+// DecompressPubkey is the 65 bytes 0x04 encoding of pubkey.
+func DecompressPubkey(pubkey []byte) ([]byte, error) {
+	p, err := parsePubkeyPoint(pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.uncompressedBytes(), nil
+}
+
+func parsePubkeyPoint(pubkey []byte) (*secp256k1Point, error) {
+	switch len(pubkey) {
+	case 33:
+		if pubkey[0] != 2 && pubkey[0] != 3 {
+			return nil, ErrPubkeyBadPrefix
+		}
+		p, ok := secp256k1ParsePubkey(pubkey)
+		if !ok {
+			return nil, ErrPubkeyNotOnCurve
+		}
+		return p, nil
+
+	case 65:
+		if pubkey[0] != 4 && !IsHybridPubkey(pubkey) {
+			return nil, ErrPubkeyBadPrefix
+		}
+		p := &secp256k1Point{x: new(big.Int).SetBytes(pubkey[1:33]), y: new(big.Int).SetBytes(pubkey[33:])}
+		if !p.isOnCurve() {
+			return nil, ErrPubkeyNotOnCurve
+		}
+		if IsHybridPubkey(pubkey) && (pubkey[0] == 7) == p.hasEvenY() {
+			return nil, ErrPubkeyHybridParity
+		}
+		return p, nil
+	}
+
+	return nil, ErrPubkeyBadSize
+}
@@ -0,0 +1,54 @@
+package bscript
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPubkey(t *testing.T) {
+	compressed, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	uncompressed, _ := hex.DecodeString("0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+		"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+
+	hybrid := append([]byte{6}, uncompressed[1:]...)
+	wrongParity := append([]byte{7}, uncompressed[1:]...)
+	offCurve := append([]byte{}, uncompressed...)
+	offCurve[64] ^= 1
+	noX := append([]byte{2}, bytes.Repeat([]byte{0xff}, 32)...)
+
+	tests := []struct {
+		name   string
+		pubkey []byte
+		hybrid bool
+		err    error
+	}{
+		{"compressed", compressed, false, nil},
+		{"uncompressed", uncompressed, false, nil},
+		{"hybrid", hybrid, true, nil},
+		{"hybrid wrong parity", wrongParity, true, ErrPubkeyHybridParity},
+		{"off curve", offCurve, false, ErrPubkeyNotOnCurve},
+		{"x out of field", noX, false, ErrPubkeyNotOnCurve},
+		{"bad prefix", append([]byte{5}, uncompressed[1:]...), false, ErrPubkeyBadPrefix},
+		{"bad size", compressed[:32], false, ErrPubkeyBadSize},
+	}
+
+	for _, test := range tests {
+		if err := CheckPubkey(test.pubkey); err != test.err {
+			t.Errorf("%s: expect %v got %v", test.name, test.err, err)
+		}
+		if IsHybridPubkey(test.pubkey) != test.hybrid {
+			t.Errorf("%s: expect hybrid %v", test.name, test.hybrid)
+		}
+		if test.err != nil {
+			continue
+		}
+
+		if c, err := CompressPubkey(test.pubkey); err != nil || !bytes.Equal(c, compressed) {
+			t.Errorf("%s: expect compressed %x got %x %v", test.name, compressed, c, err)
+		}
+		if u, err := DecompressPubkey(test.pubkey); err != nil || !bytes.Equal(u, uncompressed) {
+			t.Errorf("%s: expect uncompressed %x got %x %v", test.name, uncompressed, u, err)
+		}
+	}
+}
@@ -44,108 +44,9 @@ func NewScriptFromBytes(src []byte) *Script {
 	}
 }
 
+// NewScriptFromString assembles src written in the bscript dialect.
 func NewScriptFromString(src string) (*Script, error) {
-	lexer := NewLexer(src)
-	script := NewScript()
-
-	needPushSize := true
-
-	for {
-		tok, err := lexer.Scan()
-		if err != nil {
-			if err == ErrLexerReachEOF {
-				break
-			}
-			return nil, err
-		}
-
-		switch tok.kind {
-		case TOKEN_CODE:
-			opcode, ok := tok.value.(OPCode)
-			if !ok {
-				return nil, ErrScriptBadTypeCast
-			}
-			script.PushOPCode(opcode)
-
-			if OP_PUSHBYTES_1 <= opcode && opcode <= OP_PUSHDATA4 {
-				needPushSize = false
-			} else {
-				needPushSize = true
-			}
-		case TOKEN_NUMBER:
-			value, ok := tok.value.(int64)
-			if !ok {
-				return nil, ErrScriptBadTypeCast
-			}
-
-			var n Number
-			var size int
-			if value != 0 {
-				n = Number(value)
-				size = len(n.Bytes())
-			} else {
-				n = Number(0)
-				size = 1
-			}
-
-			if needPushSize {
-				switch {
-				case size <= math.MaxInt8:
-					script.PushOPCode(OP_PUSHDATA1)
-					script.PushBytes([]byte{byte(size)})
-				case size <= math.MaxInt16:
-					script.PushOPCode(OP_PUSHDATA2)
-					buf := make([]byte, 2)
-					binary.LittleEndian.PutUint16(buf, uint16(size))
-					script.PushBytes(buf)
-				case size <= math.MaxInt32:
-					script.PushOPCode(OP_PUSHDATA4)
-					buf := make([]byte, 4)
-					binary.LittleEndian.PutUint32(buf, uint32(size))
-					script.PushBytes(buf)
-				default:
-					return nil, ErrScriptPushSizeOverflow
-				}
-			}
-
-			if value != 0 {
-				script.PushNumber(n)
-			} else {
-				script.PushBytes([]byte{0})
-			}
-		case TOKEN_HEXSTRING:
-			value, ok := tok.value.([]byte)
-			if !ok {
-				return nil, ErrScriptBadTypeCast
-			}
-
-			size := len(value)
-
-			if needPushSize {
-				switch {
-				case size <= math.MaxInt8:
-					script.PushOPCode(OP_PUSHDATA1)
-					script.PushBytes([]byte{byte(size)})
-				case size <= math.MaxInt16:
-					script.PushOPCode(OP_PUSHDATA2)
-					buf := make([]byte, 2)
-					binary.LittleEndian.PutUint16(buf, uint16(size))
-					script.PushBytes(buf)
-				case size <= math.MaxInt32:
-					script.PushOPCode(OP_PUSHDATA4)
-					buf := make([]byte, 4)
-					binary.LittleEndian.PutUint32(buf, uint32(size))
-					script.PushBytes(buf)
-				default:
-					return nil, ErrScriptPushSizeOverflow
-				}
-			}
-
-			script.PushBytes(value)
-		}
-	}
-
-	return script, nil
+	return NewScriptFromStringWithDialect(src, DialectBScript)
 }
 
 func (s Script) IsPushOnly() bool {
@@ -197,17 +98,17 @@ func (s *Script) PushBytesWithOP(b []byte) *Script {
 	size := len(b)
 
 	switch {
-	case size <= int(OP_PUSHDATA1):
+	case size < int(OP_PUSHDATA1):
 		s.PushBytes([]byte{byte(size)})
-	case size <= math.MaxInt8:
+	case size <= math.MaxUint8:
 		s.PushOPCode(OP_PUSHDATA1)
 		s.PushBytes([]byte{byte(size)})
-	case size <= math.MaxInt16:
+	case size <= math.MaxUint16:
 		s.PushOPCode(OP_PUSHDATA2)
 		buf := make([]byte, 2)
 		binary.LittleEndian.PutUint16(buf, uint16(size))
 		s.PushBytes(buf)
-	case size <= math.MaxInt32:
+	case uint64(size) <= math.MaxUint32:
 		s.PushOPCode(OP_PUSHDATA4)
 		buf := make([]byte, 4)
 		binary.LittleEndian.PutUint32(buf, uint32(size))
@@ -243,7 +144,7 @@ func (s *Script) PushInt64(n int64) *Script {
 	} else if n == 0 {
 		s.Data = append(s.Data, byte(OP_0))
 	} else {
-		return s.PushNumber(Number(n))
+		return s.PushBytesWithOP(Number(n).Bytes())
 	}
 
 	return s
@@ -277,7 +178,7 @@ func (s *Script) Filter(fs *Script) *Script {
 }
 
 func (s *Script) takePushBytes(offset, n int) ([]byte, error) {
-	if offset+n >= len(s.Data) {
+	if offset+n > len(s.Data) {
 		return nil, ErrScriptTakeOverflow
 	}
 
@@ -309,24 +210,28 @@ func (s *Script) SubScript(from int) (*Script, error) {
 	return NewScriptFromBytes(s.Data[from:]), nil
 }
 
+// WithoutSep returns the whole script with every OP_CODESEPARATOR removed.
+// The other instructions keep their raw bytes, and a malformed tail is kept
+// as is, like the script code serialized for legacy signature hashes.
 func (s Script) WithoutSep() *Script {
-	ns := NewScript()
+	s.Pos = 0
+	data := make([]byte, 0, len(s.Data))
+	begin := 0
 
 	for {
+		offset := s.Pos
 		ins, err := s.Next()
 		if err != nil {
 			break
 		}
 
-		opcode := ins.OPCode
-		if opcode == OP_CODESEPARATOR {
-			continue
+		if ins.OPCode == OP_CODESEPARATOR {
+			data = append(data, s.Data[begin:offset]...)
+			begin = s.Pos
 		}
-
-		ns.PushInstruction(ins)
 	}
 
-	return ns
+	return NewScriptFromBytes(append(data, s.Data[begin:]...))
 }
 
 func (s *Script) Next() (*Instruction, error) {
@@ -335,8 +240,9 @@ func (s *Script) Next() (*Instruction, error) {
 	}
 
 	u8 := s.Data[s.Pos]
+	// undefined opcodes are instructions too, they fail once executed
 	opcode, err := NewOPCode(u8)
-	if err != nil {
+	if err != nil && err != ErrOPCodeUnknow {
 		return nil, err
 	}
 
@@ -392,13 +298,10 @@ func (s *Script) Next() (*Instruction, error) {
 			Data:   make([]byte, 0),
 		}, nil
 	}
-
-	return nil, ErrScriptBadInstruction
 }
 
-func (s *Script) Disassemble(sep string) string {
-	dis, _ := NewDisassembler().Disassemble(s, sep)
-	return dis
+func (s *Script) Disassemble(sep string) (string, error) {
+	return NewDisassembler().Disassemble(s, sep)
 }
 
 func (s *Script) Reset() {
@@ -61,6 +61,22 @@ func TestScriptFromBytes(t *testing.T) {
 	}
 }
 
+func TestScriptUndefinedOPCode(t *testing.T) {
+	if opcode, err := NewOPCode(0xbc); err != ErrOPCodeUnknow || opcode != OPCode(0xbc) {
+		t.Errorf("expect unknow 0xbc got %v %v", opcode, err)
+	}
+	if opcode, err := NewOPCode(0xff); err != nil || opcode != OP_INVALIDOPCODE {
+		t.Errorf("expect OP_INVALIDOPCODE got %v %v", opcode, err)
+	}
+
+	// undefined opcodes stay instructions of the script
+	script, _ := NewScriptFromHexString("bc51")
+	ins, err := script.Next()
+	if err != nil || ins.OPCode != OPCode(0xbc) || !ins.OPCode.IsUndefined() {
+		t.Errorf("expect 0xbc got %v %v", ins, err)
+	}
+}
+
 func TestScriptFromString(t *testing.T) {
 	code := `1 2 OP_ADD`
 	s, err := NewScriptFromString(code)
@@ -72,3 +88,25 @@ func TestScriptFromString(t *testing.T) {
 		t.Fatal("expect []byte{0x01, 0x01, 0x01, 0x02, 0x93}")
 	}
 }
+
+func TestScriptWithoutSep(t *testing.T) {
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"ab51ab", "51"},
+		// a non-minimal push keeps its length prefix
+		{"4c0102ab51", "4c010251"},
+		// a malformed tail is kept verbatim
+		{"ab4c05ab", "4c05ab"},
+	}
+
+	for _, test := range tests {
+		script, _ := NewScriptFromHexString(test.script)
+		script.Pos = 2
+
+		if got := script.WithoutSep().Hex(); got != test.expect {
+			t.Errorf("%s: expect %s got %s", test.script, test.expect, got)
+		}
+	}
+}
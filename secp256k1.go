@@ -0,0 +1,287 @@
+package bscript
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+// Curve arithmetic needed by taproot. Public keys and ECDSA stay with
+// go-bcrypto, this only covers x-only keys, BIP340 verification and the
+// taproot tweak, none of which are constant time as they handle public data.
+
+var (
+	secp256k1P, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	secp256k1N, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	secp256k1Gx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	secp256k1Gy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+	secp256k1G     = &secp256k1Point{x: secp256k1Gx, y: secp256k1Gy}
+)
+
+// secp256k1Point is an affine point, nil is the point at infinity.
+type secp256k1Point struct {
+	x *big.Int
+	y *big.Int
+}
+
+func (p *secp256k1Point) hasEvenY() bool {
+	return p.y.Bit(0) == 0
+}
+
+func (p *secp256k1Point) xBytes() []byte {
+	return padTo32(p.x.Bytes())
+}
+
+func secp256k1Add(p1, p2 *secp256k1Point) *secp256k1Point {
+	if p1 == nil {
+		return p2
+	}
+	if p2 == nil {
+		return p1
+	}
+
+	P := secp256k1P
+	lambda := new(big.Int)
+
+	if p1.x.Cmp(p2.x) == 0 {
+		if p1.y.Cmp(p2.y) != 0 || p1.y.Sign() == 0 {
+			return nil
+		}
+
+		// lambda = 3x^2 / 2y
+		num := new(big.Int).Mul(p1.x, p1.x)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(p1.y, 1)
+		den.ModInverse(den.Mod(den, P), P)
+		lambda.Mul(num, den).Mod(lambda, P)
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		num := new(big.Int).Sub(p2.y, p1.y)
+		den := new(big.Int).Sub(p2.x, p1.x)
+		den.ModInverse(den.Mod(den, P), P)
+		lambda.Mul(num, den).Mod(lambda, P)
+	}
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, p1.x).Sub(x, p2.x).Mod(x, P)
+
+	y := new(big.Int).Sub(p1.x, x)
+	y.Mul(y, lambda).Sub(y, p1.y).Mod(y, P)
+
+	return &secp256k1Point{x: x, y: y}
+}
+
+func secp256k1Mul(p *secp256k1Point, k *big.Int) *secp256k1Point {
+	var r *secp256k1Point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = secp256k1Add(r, r)
+		if k.Bit(i) == 1 {
+			r = secp256k1Add(r, p)
+		}
+	}
+
+	return r
+}
+
+// secp256k1LiftX returns the point with the given x coordinate and an even y.
+func secp256k1LiftX(xb []byte) (*secp256k1Point, bool) {
+	if len(xb) != 32 {
+		return nil, false
+	}
+
+	x := new(big.Int).SetBytes(xb)
+	if x.Cmp(secp256k1P) >= 0 {
+		return nil, false
+	}
+
+	c := new(big.Int).Mul(x, x)
+	c.Mul(c, x).Add(c, big.NewInt(7)).Mod(c, secp256k1P)
+
+	e := new(big.Int).Add(secp256k1P, big.NewInt(1))
+	e.Rsh(e, 2)
+	y := new(big.Int).Exp(c, e, secp256k1P)
+
+	if new(big.Int).Exp(y, big.NewInt(2), secp256k1P).Cmp(c) != 0 {
+		return nil, false
+	}
+
+	if y.Bit(0) != 0 {
+		y.Sub(secp256k1P, y)
+	}
+
+	return &secp256k1Point{x: x, y: y}, true
+}
+
+func padTo32(b []byte) []byte {
+	if len(b) >= 32 {
+		return b
+	}
+
+	rv := make([]byte, 32)
+	copy(rv[32-len(b):], b)
+	return rv
+}
+
+// TaggedHash is SHA256(SHA256(tag) || SHA256(tag) || msg) from BIP340.
+func TaggedHash(tag string, msg ...[]byte) [32]byte {
+	th := sha256.Sum256([]byte(tag))
+
+	h := sha256.New()
+	h.Write(th[:])
+	h.Write(th[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+
+	var rv [32]byte
+	copy(rv[:], h.Sum(nil))
+	return rv
+}
+
+// VerifySchnorrBIP340 verifies a 64 byte BIP340 signature of a 32 byte
+// message under a 32 byte x-only public key.
+func VerifySchnorrBIP340(pubkey, msg, sig []byte) bool {
+	if len(pubkey) != 32 || len(msg) != 32 || len(sig) != 64 {
+		return false
+	}
+
+	P, ok := secp256k1LiftX(pubkey)
+	if !ok {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	if r.Cmp(secp256k1P) >= 0 {
+		return false
+	}
+
+	s := new(big.Int).SetBytes(sig[32:])
+	if s.Cmp(secp256k1N) >= 0 {
+		return false
+	}
+
+	eh := TaggedHash("BIP0340/challenge", sig[:32], pubkey, msg)
+	e := new(big.Int).SetBytes(eh[:])
+	e.Mod(e, secp256k1N)
+	e.Sub(secp256k1N, e)
+
+	R := secp256k1Add(secp256k1Mul(secp256k1G, s), secp256k1Mul(P, e))
+	if R == nil || !R.hasEvenY() || R.x.Cmp(r) != 0 {
+		return false
+	}
+
+	return true
+}
+
+// tweakXOnlyPubkey returns the x-only key Q = P + int(TapTweak(P || merkleRoot))G
+// and the parity of its y coordinate.
+func tweakXOnlyPubkey(internal, merkleRoot []byte) ([]byte, byte, bool) {
+	P, ok := secp256k1LiftX(internal)
+	if !ok {
+		return nil, 0, false
+	}
+
+	th := TaggedHash("TapTweak", internal, merkleRoot)
+	t := new(big.Int).SetBytes(th[:])
+	if t.Cmp(secp256k1N) >= 0 {
+		return nil, 0, false
+	}
+
+	Q := secp256k1Add(P, secp256k1Mul(secp256k1G, t))
+	if Q == nil {
+		return nil, 0, false
+	}
+
+	parity := byte(0)
+	if !Q.hasEvenY() {
+		parity = 1
+	}
+
+	return Q.xBytes(), parity, true
+}
+
+// secp256k1ParsePubkey decodes a compressed or uncompressed SEC1 public key.
+func secp256k1ParsePubkey(b []byte) (*secp256k1Point, bool) {
+	switch {
+	case len(b) == 33 && (b[0] == 2 || b[0] == 3):
+		p, ok := secp256k1LiftX(b[1:])
+		if !ok {
+			return nil, false
+		}
+		if b[0] == 3 {
+			p.y.Sub(secp256k1P, p.y)
+		}
+		return p, true
+	case len(b) == 65 && b[0] == 4:
+		p := &secp256k1Point{x: new(big.Int).SetBytes(b[1:33]), y: new(big.Int).SetBytes(b[33:])}
+		if !p.isOnCurve() {
+			return nil, false
+		}
+		return p, true
+	}
+
+	return nil, false
+}
+
+// isOnCurve reports whether p has coordinates in the field and satisfies
+// y^2 = x^3 + 7.
+func (p *secp256k1Point) isOnCurve() bool {
+	if p.x.Cmp(secp256k1P) >= 0 || p.y.Cmp(secp256k1P) >= 0 {
+		return false
+	}
+
+	lhs := new(big.Int).Mul(p.y, p.y)
+	lhs.Mod(lhs, secp256k1P)
+	rhs := new(big.Int).Mul(p.x, p.x)
+	rhs.Mul(rhs, p.x).Add(rhs, big.NewInt(7)).Mod(rhs, secp256k1P)
+
+	return lhs.Cmp(rhs) == 0
+}
+
+func (p *secp256k1Point) compressedBytes() []byte {
+	prefix := byte(2)
+	if !p.hasEvenY() {
+		prefix = 3
+	}
+
+	return append([]byte{prefix}, p.xBytes()...)
+}
+
+func (p *secp256k1Point) uncompressedBytes() []byte {
+	return append(append([]byte{4}, p.xBytes()...), padTo32(p.y.Bytes())...)
+}
+
+// VerifySchnorrBCH verifies a 64 byte Schnorr signature of the BCH 2019
+// upgrade, which commits to the compressed public key and requires R to have
+// a quadratic residue y instead of an even one.
+func VerifySchnorrBCH(pubkey, msg, sig []byte) bool {
+	if len(msg) != 32 || len(sig) != 64 {
+		return false
+	}
+
+	P, ok := secp256k1ParsePubkey(pubkey)
+	if !ok {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	if r.Cmp(secp256k1P) >= 0 {
+		return false
+	}
+
+	s := new(big.Int).SetBytes(sig[32:])
+	if s.Cmp(secp256k1N) >= 0 {
+		return false
+	}
+
+	eh := sha256.Sum256(append(append(append([]byte{}, sig[:32]...), P.compressedBytes()...), msg...))
+	e := new(big.Int).SetBytes(eh[:])
+	e.Mod(e, secp256k1N)
+	e.Sub(secp256k1N, e)
+
+	R := secp256k1Add(secp256k1Mul(secp256k1G, s), secp256k1Mul(P, e))
+	if R == nil || big.Jacobi(R.y, secp256k1P) != 1 || R.x.Cmp(r) != 0 {
+		return false
+	}
+
+	return true
+}
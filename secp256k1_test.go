@@ -0,0 +1,112 @@
+package bscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// signSchnorrBIP340 is the BIP340 reference signing algorithm with zero
+// auxiliary randomness, only used to produce test signatures.
+func signSchnorrBIP340(d *big.Int, msg []byte) []byte {
+	P := secp256k1Mul(secp256k1G, d)
+	if !P.hasEvenY() {
+		d = new(big.Int).Sub(secp256k1N, d)
+	}
+
+	aux := TaggedHash("BIP0340/aux", make([]byte, 32))
+	t := padTo32(d.Bytes())
+	for i := range t {
+		t[i] ^= aux[i]
+	}
+
+	rand := TaggedHash("BIP0340/nonce", t, P.xBytes(), msg)
+	k := new(big.Int).SetBytes(rand[:])
+	k.Mod(k, secp256k1N)
+
+	R := secp256k1Mul(secp256k1G, k)
+	if !R.hasEvenY() {
+		k.Sub(secp256k1N, k)
+	}
+
+	eh := TaggedHash("BIP0340/challenge", R.xBytes(), P.xBytes(), msg)
+	e := new(big.Int).SetBytes(eh[:])
+	e.Mul(e, d).Add(e, k).Mod(e, secp256k1N)
+
+	return append(R.xBytes(), padTo32(e.Bytes())...)
+}
+
+// signSchnorrBCH signs with the BCH 2019 scheme using a nonce derived from
+// the key and message, only used to produce test signatures.
+func signSchnorrBCH(d *big.Int, msg []byte) []byte {
+	P := secp256k1Mul(secp256k1G, d)
+
+	kh := sha256.Sum256(append(padTo32(d.Bytes()), msg...))
+	k := new(big.Int).SetBytes(kh[:])
+	k.Mod(k, secp256k1N)
+
+	R := secp256k1Mul(secp256k1G, k)
+	if big.Jacobi(R.y, secp256k1P) != 1 {
+		k.Sub(secp256k1N, k)
+	}
+
+	eh := sha256.Sum256(append(append(R.xBytes(), P.compressedBytes()...), msg...))
+	e := new(big.Int).SetBytes(eh[:])
+	e.Mod(e, secp256k1N)
+	e.Mul(e, d).Add(e, k).Mod(e, secp256k1N)
+
+	return append(R.xBytes(), padTo32(e.Bytes())...)
+}
+
+func TestVerifySchnorrBIP340(t *testing.T) {
+	pubkey, _ := hex.DecodeString("f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9")
+	sig, _ := hex.DecodeString("e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0")
+	msg := make([]byte, 32)
+
+	if got := signSchnorrBIP340(big.NewInt(3), msg); hex.EncodeToString(got) != hex.EncodeToString(sig) {
+		t.Fatalf("sign: expect %x got %x", sig, got)
+	}
+
+	if !VerifySchnorrBIP340(pubkey, msg, sig) {
+		t.Fatal("expect valid signature")
+	}
+
+	sig[63] ^= 1
+	if VerifySchnorrBIP340(pubkey, msg, sig) {
+		t.Fatal("expect invalid signature")
+	}
+}
+
+func TestVerifySchnorrBCH(t *testing.T) {
+	pubkey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	sig, _ := hex.DecodeString("787a848e71043d280c50470e8e1532b2dd5d20ee912a45dbdd2bd1dfbf187ef67031a98831859dc34dffeedda86831842ccd0079e1f92af177f7f22cc1dced05")
+	msg := make([]byte, 32)
+
+	if !VerifySchnorrBCH(pubkey, msg, sig) {
+		t.Fatal("expect valid signature")
+	}
+
+	d := big.NewInt(0x1234)
+	P := secp256k1Mul(secp256k1G, d)
+	msg[0] = 1
+	sig = signSchnorrBCH(d, msg)
+
+	uncompressed := append([]byte{4}, P.xBytes()...)
+	uncompressed = append(uncompressed, padTo32(P.y.Bytes())...)
+
+	for _, pubkey := range [][]byte{P.compressedBytes(), uncompressed} {
+		if !VerifySchnorrBCH(pubkey, msg, sig) {
+			t.Errorf("%x: expect valid signature", pubkey)
+		}
+	}
+
+	if VerifySchnorrBIP340(P.xBytes(), msg, sig) {
+		t.Error("expect BCH signature to be invalid under BIP340")
+	}
+
+	sig[63] ^= 1
+	if VerifySchnorrBCH(P.compressedBytes(), msg, sig) {
+		t.Error("expect invalid signature")
+	}
+}
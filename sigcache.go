@@ -0,0 +1,262 @@
+package bscript
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/detailyang/go-bprimitives"
+)
+
+// DefaultSignatureCacheSize is the number of entries of a SignatureCache
+// built with a non positive size, about 10MB of keys.
+const DefaultSignatureCacheSize = 1 << 18
+
+// SignatureCacheStats is a snapshot of the counters of a SignatureCache.
+type SignatureCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Inserts   uint64
+	Evictions uint64
+	Size      int
+}
+
+// SignatureCache remembers signatures which verified, keyed on a salted hash
+// of what they sign, the public key and the signature. It holds at most its
+// size entries and evicts the oldest first. It is safe for concurrent use and
+// meant to be shared by every CachingChecker of a node, so signatures seen
+// in the mempool are not verified again in a block.
+type SignatureCache struct {
+	salt [32]byte
+
+	mu      sync.RWMutex
+	entries map[Hash]int
+	ring    []Hash
+	// next is the ring slot the next insert takes
+	next int
+
+	hits      uint64
+	misses    uint64
+	inserts   uint64
+	evictions uint64
+}
+
+func NewSignatureCache(size int) *SignatureCache {
+	if size <= 0 {
+		size = DefaultSignatureCacheSize
+	}
+
+	c := &SignatureCache{
+		entries: make(map[Hash]int, size),
+		ring:    make([]Hash, 0, size),
+	}
+
+	// the salt keeps entries unpredictable, so nobody can craft
+	// transactions which collide in the cache of a node
+	if _, err := rand.Read(c.salt[:]); err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// key is the salted hash of a signature check, scheme separating the
+// schemes a signature of the same bytes could be verified with.
+func (c *SignatureCache) key(scheme signatureScheme, hash, pubkey, sig []byte) Hash {
+	h := sha256.New()
+	h.Write(c.salt[:])
+	h.Write([]byte{byte(scheme)})
+	h.Write(hash)
+	h.Write(NewBuffer().PutVarBytes(pubkey).Bytes())
+	h.Write(sig)
+
+	return NewHash(h.Sum(nil))
+}
+
+// Contains reports whether key is cached, and removes it if erase is set.
+func (c *SignatureCache) Contains(key Hash, erase bool) bool {
+	var ok bool
+	if erase {
+		c.mu.Lock()
+		if slot, found := c.entries[key]; found {
+			ok = true
+			delete(c.entries, key)
+			// the slot is reused once the ring wraps to it
+			c.ring[slot] = HashZero
+		}
+		c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		_, ok = c.entries[key]
+		c.mu.RUnlock()
+	}
+
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+
+	return ok
+}
+
+// Add caches key, evicting the oldest entry when full.
+func (c *SignatureCache) Add(key Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.entries[key]; found {
+		return
+	}
+
+	if len(c.ring) < cap(c.ring) {
+		c.entries[key] = len(c.ring)
+		c.ring = append(c.ring, key)
+	} else {
+		old := c.ring[c.next]
+		if slot, found := c.entries[old]; found && slot == c.next {
+			delete(c.entries, old)
+			c.evictions++
+		}
+
+		c.entries[key] = c.next
+		c.ring[c.next] = key
+		c.next = (c.next + 1) % len(c.ring)
+	}
+
+	c.inserts++
+}
+
+// Stats returns the cache counters.
+func (c *SignatureCache) Stats() SignatureCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return SignatureCacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Inserts:   c.inserts,
+		Evictions: c.evictions,
+		Size:      len(c.entries),
+	}
+}
+
+// SignatureHasher is implemented by checkers whose CHECKSIG signatures sign
+// a signature hash, as TransactionSigner does. CachingChecker only caches
+// the signatures of such checkers, since the hash is part of the key, and
+// verifies a cache miss against that same hash.
+type SignatureHasher interface {
+	SignatureHash(script *Script, sighash SigHash, flag Flag, version SignatureVersion, execdata *ScriptExecutionData) (Hash, error)
+}
+
+// CachingChecker is a Checker which looks signatures up in a SignatureCache
+// before verifying them with the Checker it wraps. With store, signatures
+// which verify are added to the cache, as mempool acceptance wants. Without
+// it, hits are erased instead, as block validation wants since a signature
+// is not checked again once its transaction is in a block.
+type CachingChecker struct {
+	Checker
+	Cache *SignatureCache
+	Store bool
+}
+
+func NewCachingChecker(checker Checker, cache *SignatureCache, store bool) *CachingChecker {
+	return &CachingChecker{
+		Checker: checker,
+		Cache:   cache,
+		Store:   store,
+	}
+}
+
+// HashedBytes forwards to the wrapped checker, which hashes the preimages of
+// hits and misses alike.
+func (c *CachingChecker) HashedBytes() uint64 {
+	return hashedBytesOf(c.Checker)
+}
+
+func (c *CachingChecker) CheckSignature(sig, pubkey []byte, script *Script, flag Flag, version SignatureVersion) error {
+	hasher, ok := c.Checker.(SignatureHasher)
+	if !ok || len(sig) == 0 {
+		return c.Checker.CheckSignature(sig, pubkey, script, flag, version)
+	}
+
+	sighash := NewSigHash(uint32(sig[len(sig)-1]))
+	hash, err := hasher.SignatureHash(script, sighash, flag, version, nil)
+	if err != nil {
+		return c.Checker.CheckSignature(sig, pubkey, script, flag, version)
+	}
+
+	// the hash type is committed to by the hash
+	rawSig := sig[:len(sig)-1]
+	scheme := signatureSchemeOf(rawSig, flag)
+	key := c.Cache.key(scheme, hash.Bytes(), pubkey, rawSig)
+
+	return c.check(key, func() error {
+		if !verifySignature(scheme, pubkey, hash.Bytes(), rawSig) {
+			return ErrTransactionSignerVerifySignatureFailed
+		}
+
+		return nil
+	})
+}
+
+func (c *CachingChecker) CheckSchnorrSignature(sig, pubkey []byte, version SignatureVersion, execdata *ScriptExecutionData) error {
+	hasher, ok := c.Checker.(SignatureHasher)
+	if !ok || (len(sig) != SchnorrSignatureSize && len(sig) != SchnorrSignatureSize+1) {
+		return c.Checker.CheckSchnorrSignature(sig, pubkey, version, execdata)
+	}
+
+	sighash := SigHashDefault
+	if len(sig) == SchnorrSignatureSize+1 {
+		sighash = SigHash(sig[SchnorrSignatureSize])
+		if sighash == SigHashDefault {
+			return c.Checker.CheckSchnorrSignature(sig, pubkey, version, execdata)
+		}
+	}
+
+	hash, err := hasher.SignatureHash(nil, sighash, 0, version, execdata)
+	if err != nil {
+		return c.Checker.CheckSchnorrSignature(sig, pubkey, version, execdata)
+	}
+
+	rawSig := sig[:SchnorrSignatureSize]
+	key := c.Cache.key(signatureSchemeSchnorrBIP340, hash.Bytes(), pubkey, rawSig)
+
+	return c.check(key, func() error {
+		if !VerifySchnorrBIP340(pubkey, hash.Bytes(), rawSig) {
+			return ErrInterpreterSchnorrSig
+		}
+
+		return nil
+	})
+}
+
+func (c *CachingChecker) CheckDataSignature(sig, pubkey, message []byte, flag Flag) error {
+	if len(sig) == 0 {
+		return c.Checker.CheckDataSignature(sig, pubkey, message, flag)
+	}
+
+	hash := sha256.Sum256(message)
+	key := c.Cache.key(signatureSchemeOf(sig, flag), hash[:], pubkey, sig)
+
+	return c.check(key, func() error {
+		return c.Checker.CheckDataSignature(sig, pubkey, message, flag)
+	})
+}
+
+func (c *CachingChecker) check(key Hash, verify func() error) error {
+	if c.Cache.Contains(key, !c.Store) {
+		return nil
+	}
+
+	if err := verify(); err != nil {
+		return err
+	}
+
+	if c.Store {
+		c.Cache.Add(key)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package bscript
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	bcore "github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+// countingChecker counts the signature hashes computed by the wrapped signer.
+type countingChecker struct {
+	*TransactionSigner
+	n int
+}
+
+func (c *countingChecker) SignatureHash(script *Script, sighash SigHash, flag Flag, version SignatureVersion, execdata *ScriptExecutionData) (Hash, error) {
+	c.n++
+	return c.TransactionSigner.SignatureHash(script, sighash, flag, version, execdata)
+}
+
+func TestSignatureCache(t *testing.T) {
+	cache := NewSignatureCache(2)
+
+	keys := []Hash{HashOne, NewHash(bytes.Repeat([]byte{1}, 32)), NewHash(bytes.Repeat([]byte{2}, 32))}
+	for _, key := range keys {
+		cache.Add(key)
+	}
+
+	if cache.Contains(keys[0], false) {
+		t.Error("expect the oldest entry evicted")
+	}
+	if !cache.Contains(keys[1], false) || !cache.Contains(keys[2], true) {
+		t.Error("expect the newest entries cached")
+	}
+	if cache.Contains(keys[2], false) {
+		t.Error("expect the erased entry gone")
+	}
+
+	stats := cache.Stats()
+	expect := SignatureCacheStats{Hits: 2, Misses: 2, Inserts: 3, Evictions: 1, Size: 1}
+	if stats != expect {
+		t.Errorf("expect %+v got %+v", expect, stats)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := HashZero
+				key[0], key[1] = byte(i), byte(j)
+				cache.Add(key)
+				cache.Contains(key, j%2 == 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if size := cache.Stats().Size; size > 2 {
+		t.Errorf("expect at most 2 entries got %d", size)
+	}
+}
+
+func TestCachingChecker(t *testing.T) {
+	txhex := "0100000001484d40d45b9ea0d652fca8258ab7caa42541eb52975857f96fb50cd732c8b481000000008a47304402202cb265bf10707bf49346c3515dd3d16fc454618c58ec0a0ff448a676c54ff71302206c6624d762a1fcef4618284ead8f08678ac05b13c84235f1654e6ad168233e8201410414e301b2328f17442c0b8310d787bf3d8a404cfbd0704f135b6ad4b2d3ee751310f981926e53a6e8c39bd7d3fefd576c543cce493cbac06388f2651d1aacbfcdffffffff0162640100000000001976a914c8e90996c7c6080ee06284600c684ed904d14c5c88ac00000000"
+	tx, err := bcore.NewTransactionFromHexString(txhex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptSig := tx.Inputs[0].ScriptSig
+	scriptPubkey, err := NewScriptFromHexString("76a914df3bd30160e6c6145baaf2c88a8844c13a00d1d588ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewSignatureCache(0)
+	inner := &countingChecker{TransactionSigner: NewTransactionSigner(tx, 0, 0)}
+
+	verify := func(store bool) error {
+		return VerifyScript(
+			NewScriptFromBytes(scriptSig),
+			NewScriptFromBytes(scriptPubkey.Bytes()),
+			NewScriptWitness([][]byte{}),
+			ScriptVerifyP2SH,
+			NewCachingChecker(inner, cache, store),
+			SignatureVersionBase,
+		)
+	}
+
+	// mempool acceptance verifies and stores, the block hits the cache
+	for i, store := range []bool{true, true, false} {
+		if err := verify(store); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+
+	// every check hashes once, a miss verifies against that same hash
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Hits != 2 || inner.n != 3 {
+		t.Errorf("expect 1 miss, 2 hits and 3 hashes got %+v and %d hashes", stats, inner.n)
+	}
+
+	// the block erased the entry
+	if err := verify(false); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Misses != 2 || inner.n != 4 {
+		t.Errorf("expect 2 misses and 4 hashes got %+v and %d hashes", stats, inner.n)
+	}
+
+	// the signature does not sign the changed transaction
+	tx.Locktime++
+	if err := verify(true); err != ErrInterpreterEvalFalse {
+		t.Errorf("expect %v got %v", ErrInterpreterEvalFalse, err)
+	}
+	if stats := cache.Stats(); stats.Size != 0 {
+		t.Errorf("expect failures not cached got %+v", stats)
+	}
+}
@@ -0,0 +1,678 @@
+package bscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	// ErrTransactionSignerSigHashOne is returned for the legacy SIGHASH_SINGLE
+	// bug, which signs the constant one instead of a preimage.
+	ErrTransactionSignerSigHashOne = errors.New("transaction signer: signature hash is one")
+)
+
+// SigHashAlgorithm is the serialization a signature hash is computed over.
+type SigHashAlgorithm uint8
+
+const (
+	// SigHashAlgorithmLegacy is the original algorithm, a modified copy of
+	// the transaction.
+	SigHashAlgorithmLegacy SigHashAlgorithm = iota
+	// SigHashAlgorithmWitnessV0 is BIP143, also used by BCH and BSV for
+	// SIGHASH_FORKID signatures.
+	SigHashAlgorithmWitnessV0
+	// SigHashAlgorithmTaproot is BIP341 and its tapscript extension.
+	SigHashAlgorithmTaproot
+)
+
+func (a SigHashAlgorithm) String() string {
+	switch a {
+	case SigHashAlgorithmLegacy:
+		return "legacy"
+	case SigHashAlgorithmWitnessV0:
+		return "bip143"
+	case SigHashAlgorithmTaproot:
+		return "bip341"
+	}
+
+	return "unknow"
+}
+
+// SigHashPreimage is the breakdown of a signature hash preimage. Fields an
+// algorithm does not commit to are left zero: the legacy algorithm has no
+// hashes and commits to Transaction instead, and taproot only commits to the
+// Outpoint, Value, ScriptCode and Sequence of the input with ANYONECANPAY.
+type SigHashPreimage struct {
+	Algorithm    SigHashAlgorithm
+	Version      uint32
+	HashPrevouts Hash
+	HashSequence Hash
+	Outpoint     []byte
+	// ScriptCode is the spent scriptPubkey for taproot.
+	ScriptCode  []byte
+	Value       uint64
+	Sequence    uint32
+	HashOutputs Hash
+	Locktime    uint32
+	SigHash     SigHash
+
+	// Transaction is the modified transaction of the legacy algorithm.
+	Transaction []byte
+
+	// taproot only
+	SignatureVersion  SignatureVersion
+	HashAmounts       Hash
+	HashScriptPubkeys Hash
+	InputIndex        uint32
+	AnnexHash         []byte
+	TapleafHash       []byte
+	CodeSeparatorPos  uint32
+}
+
+func (p *SigHashPreimage) anyoneCanPay() bool {
+	return p.SigHash.Has(SigHashAnyoneCanPay)
+}
+
+// outputType is the taproot output commitment, SIGHASH_DEFAULT being ALL.
+func (p *SigHashPreimage) outputType() SigHash {
+	if p.SigHash == SigHashDefault {
+		return SigHashAll
+	}
+
+	return p.SigHash & 3
+}
+
+// SpendType is the taproot spend_type, ext_flag * 2 + annex_present.
+func (p *SigHashPreimage) SpendType() byte {
+	spendType := byte(0)
+	if p.SignatureVersion == SignatureVersionTapscript {
+		spendType |= 2
+	}
+	if p.AnnexHash != nil {
+		spendType |= 1
+	}
+
+	return spendType
+}
+
+// Bytes serializes the preimage, this is what gets hashed and what an
+// OP_PUSH_TX covenant expects on the stack.
+func (p *SigHashPreimage) Bytes() []byte {
+	switch p.Algorithm {
+	case SigHashAlgorithmLegacy:
+		return NewBuffer().
+			PutBytes(p.Transaction).
+			PutUint32(uint32(p.SigHash)).
+			Bytes()
+
+	case SigHashAlgorithmWitnessV0:
+		return NewBuffer().
+			PutUint32(p.Version).
+			PutBytes(p.HashPrevouts.Bytes()).
+			PutBytes(p.HashSequence.Bytes()).
+			PutBytes(p.Outpoint).
+			PutVarBytes(p.ScriptCode).
+			PutUint64(p.Value).
+			PutUint32(p.Sequence).
+			PutBytes(p.HashOutputs.Bytes()).
+			PutUint32(p.Locktime).
+			PutUint32(uint32(p.SigHash)).
+			Bytes()
+	}
+
+	// epoch
+	buffer := NewBuffer().PutBytes([]byte{0x00, byte(p.SigHash)})
+	buffer.PutUint32(p.Version).PutUint32(p.Locktime)
+
+	if !p.anyoneCanPay() {
+		buffer.PutBytes(p.HashPrevouts.Bytes()).
+			PutBytes(p.HashAmounts.Bytes()).
+			PutBytes(p.HashScriptPubkeys.Bytes()).
+			PutBytes(p.HashSequence.Bytes())
+	}
+
+	if p.outputType() == SigHashAll {
+		buffer.PutBytes(p.HashOutputs.Bytes())
+	}
+
+	buffer.PutBytes([]byte{p.SpendType()})
+
+	if p.anyoneCanPay() {
+		buffer.PutBytes(p.Outpoint).
+			PutUint64(p.Value).
+			PutVarBytes(p.ScriptCode).
+			PutUint32(p.Sequence)
+	} else {
+		buffer.PutUint32(p.InputIndex)
+	}
+
+	if p.AnnexHash != nil {
+		buffer.PutBytes(p.AnnexHash)
+	}
+
+	if p.outputType() == SigHashSingle {
+		buffer.PutBytes(p.HashOutputs.Bytes())
+	}
+
+	if p.SignatureVersion == SignatureVersionTapscript {
+		// key version 0
+		buffer.PutBytes(p.TapleafHash).
+			PutBytes([]byte{0x00}).
+			PutUint32(p.CodeSeparatorPos)
+	}
+
+	return buffer.Bytes()
+}
+
+// String is a field per line breakdown for debugging signature mismatches,
+// hashes are in serialization order rather than the reversed display order.
+func (p *SigHashPreimage) String() string {
+	var b strings.Builder
+
+	field := func(name string, value interface{}) {
+		switch v := value.(type) {
+		case Hash:
+			value = hex.EncodeToString(v.Bytes())
+		case []byte:
+			value = hex.EncodeToString(v)
+		}
+		fmt.Fprintf(&b, "%-18s %v\n", name, value)
+	}
+
+	field("algorithm", p.Algorithm)
+	field("version", p.Version)
+
+	switch p.Algorithm {
+	case SigHashAlgorithmLegacy:
+		field("outpoint", p.Outpoint)
+		field("scriptCode", p.ScriptCode)
+		field("nSequence", p.Sequence)
+		field("transaction", p.Transaction)
+	case SigHashAlgorithmWitnessV0:
+		field("hashPrevouts", p.HashPrevouts)
+		field("hashSequence", p.HashSequence)
+		field("outpoint", p.Outpoint)
+		field("scriptCode", p.ScriptCode)
+		field("value", p.Value)
+		field("nSequence", p.Sequence)
+		field("hashOutputs", p.HashOutputs)
+	case SigHashAlgorithmTaproot:
+		if !p.anyoneCanPay() {
+			field("hashPrevouts", p.HashPrevouts)
+			field("hashAmounts", p.HashAmounts)
+			field("hashScriptPubkeys", p.HashScriptPubkeys)
+			field("hashSequence", p.HashSequence)
+		}
+		if p.outputType() != SigHashNone {
+			field("hashOutputs", p.HashOutputs)
+		}
+		field("spendType", p.SpendType())
+		if p.anyoneCanPay() {
+			field("outpoint", p.Outpoint)
+			field("value", p.Value)
+			field("scriptPubkey", p.ScriptCode)
+			field("nSequence", p.Sequence)
+		} else {
+			field("inputIndex", p.InputIndex)
+		}
+		if p.AnnexHash != nil {
+			field("annexHash", p.AnnexHash)
+		}
+		if p.SignatureVersion == SignatureVersionTapscript {
+			field("tapleafHash", p.TapleafHash)
+			field("codeSeparatorPos", p.CodeSeparatorPos)
+		}
+	}
+
+	field("locktime", p.Locktime)
+	fmt.Fprintf(&b, "%-18s 0x%08x", "sighash", uint32(p.SigHash))
+
+	return b.String()
+}
+
+// SignatureHash is the hash signed by a signature of input ts.InputIndex.
+// It dispatches on version and flag: BIP341 for taproot and tapscript, BIP143
+// for witness v0 and SIGHASH_FORKID signatures, the original algorithm
+// otherwise. script is the script code and execdata the taproot execution
+// data, each is ignored by the algorithms which do not commit to it.
+func (ts *TransactionSigner) SignatureHash(script *Script, sighash SigHash, flag Flag, version SignatureVersion, execdata *ScriptExecutionData) (Hash, error) {
+	preimage, err := ts.SignaturePreimage(script, sighash, flag, version, execdata)
+	if err == ErrTransactionSignerSigHashOne {
+		return HashOne, nil
+	}
+	if err != nil {
+		return HashZero, err
+	}
+
+	ts.hashedBytes += uint64(len(preimage))
+
+	if version == SignatureVersionTaproot || version == SignatureVersionTapscript {
+		h := TaggedHash("TapSighash", preimage)
+		return NewHash(h[:]), nil
+	}
+
+	return DHash256(preimage), nil
+}
+
+// HashedBytes is the size of the preimages SignatureHash has hashed so far.
+func (ts *TransactionSigner) HashedBytes() uint64 {
+	return ts.hashedBytes
+}
+
+// SignaturePreimage is the message SignatureHash hashes, exposed for
+// covenants which rebuild it in script.
+func (ts *TransactionSigner) SignaturePreimage(script *Script, sighash SigHash, flag Flag, version SignatureVersion, execdata *ScriptExecutionData) ([]byte, error) {
+	preimage, err := ts.SignaturePreimageFields(script, sighash, flag, version, execdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return preimage.Bytes(), nil
+}
+
+// SignaturePreimageFields is SignaturePreimage broken down into the fields
+// it serializes.
+func (ts *TransactionSigner) SignaturePreimageFields(script *Script, sighash SigHash, flag Flag, version SignatureVersion, execdata *ScriptExecutionData) (*SigHashPreimage, error) {
+	switch version {
+	case SignatureVersionTaproot, SignatureVersionTapscript:
+		return ts.preimageTaproot(sighash, version, execdata)
+	}
+
+	if flag.Has(ScriptEnableReplayProtection) {
+		sighash = replayProtectedSigHash(sighash)
+	}
+
+	switch {
+	case version == SignatureVersionForkId,
+		sighash.Has(SigHashForkId) && flag.Has(ScriptEnableSigHashForkID):
+		return ts.preimageWitnessV0(script, sighash)
+	case version == SignatureVersionWitnessV0:
+		return ts.preimageWitnessV0(script, sighash)
+	default:
+		return ts.preimageOriginal(script, sighash)
+	}
+}
+
+// Deprecated: SiagntureHash ignores the signature version, use SignatureHash.
+func (ts *TransactionSigner) SiagntureHash(script *Script, sighash SigHash, flag Flag) Hash {
+	hash, _ := ts.SignatureHash(script, sighash, flag, SignatureVersionBase, nil)
+	return hash
+}
+
+// replayProtectedSigHash moves the fork value of sighash to 0xffxxxx, so
+// signatures of the protected chain are invalid on the legacy one. The xor
+// makes it change even when it already starts with 0xff.
+func replayProtectedSigHash(sighash SigHash) SigHash {
+	forkValue := uint32(sighash) >> 8
+	forkValue = 0xff0000 | (forkValue ^ 0xdead)
+	return SigHash(forkValue<<8 | uint32(sighash)&0xff)
+}
+
+// PrecomputedTransactionData holds the hashes of a transaction which the
+// signature hashes of all its inputs share, so hashing every input of a
+// transaction is linear in its size rather than quadratic. It is read only
+// once built and may be shared by the signers of every input, concurrent or
+// not, as long as the transaction is not modified.
+type PrecomputedTransactionData struct {
+	Transaction *bcore.Transaction
+	PrevOutputs []*bcore.TransactionOutput
+
+	// BIP143, double SHA256
+	HashPrevouts Hash
+	HashSequence Hash
+	HashOutputs  Hash
+
+	// BIP341, single SHA256, only computed when PrevOutputs covers every
+	// input
+	Taproot                  bool
+	TaprootHashPrevouts      Hash
+	TaprootHashAmounts       Hash
+	TaprootHashScriptPubkeys Hash
+	TaprootHashSequence      Hash
+	TaprootHashOutputs       Hash
+}
+
+// NewPrecomputedTransactionData hashes tx once for all its inputs.
+// prevOutputs are the outputs spent by tx.Inputs, needed for taproot only
+// and may be nil otherwise.
+func NewPrecomputedTransactionData(tx *bcore.Transaction, prevOutputs []*bcore.TransactionOutput) *PrecomputedTransactionData {
+	p := &PrecomputedTransactionData{
+		Transaction:  tx,
+		PrevOutputs:  prevOutputs,
+		HashPrevouts: DHash256(serializePrevouts(tx)),
+		HashSequence: DHash256(serializeSequences(tx)),
+		HashOutputs:  DHash256(serializeOutputs(tx)),
+	}
+
+	if len(prevOutputs) == len(tx.Inputs) {
+		p.computeTaproot()
+	}
+
+	return p
+}
+
+func (p *PrecomputedTransactionData) computeTaproot() {
+	p.Taproot = true
+	p.TaprootHashPrevouts = sha256Hash(serializePrevouts(p.Transaction))
+	p.TaprootHashAmounts = sha256Hash(serializeAmounts(p.PrevOutputs))
+	p.TaprootHashScriptPubkeys = sha256Hash(serializeScriptPubkeys(p.PrevOutputs))
+	p.TaprootHashSequence = sha256Hash(serializeSequences(p.Transaction))
+	p.TaprootHashOutputs = sha256Hash(serializeOutputs(p.Transaction))
+}
+
+// precomputed is ts.Precomputed when it was built for ts.Transaction.
+func (ts *TransactionSigner) precomputed() *PrecomputedTransactionData {
+	if ts.Precomputed != nil && ts.Precomputed.Transaction == ts.Transaction {
+		return ts.Precomputed
+	}
+
+	return nil
+}
+
+func sha256Hash(b []byte) Hash {
+	h := sha256.Sum256(b)
+	return NewHash(h[:])
+}
+
+func serializePrevouts(tx *bcore.Transaction) []byte {
+	buffer := NewBuffer()
+	for _, input := range tx.Inputs {
+		buffer.PutBytes(input.PrevOutput.Bytes())
+	}
+
+	return buffer.Bytes()
+}
+
+func serializeSequences(tx *bcore.Transaction) []byte {
+	buffer := NewBuffer()
+	for _, input := range tx.Inputs {
+		buffer.PutUint32(input.Sequence)
+	}
+
+	return buffer.Bytes()
+}
+
+func serializeOutputs(tx *bcore.Transaction) []byte {
+	buffer := NewBuffer()
+	for _, output := range tx.Outputs {
+		buffer.PutBytes(output.Bytes())
+	}
+
+	return buffer.Bytes()
+}
+
+func serializeAmounts(outputs []*bcore.TransactionOutput) []byte {
+	buffer := NewBuffer()
+	for _, output := range outputs {
+		buffer.PutUint64(output.Value)
+	}
+
+	return buffer.Bytes()
+}
+
+func serializeScriptPubkeys(outputs []*bcore.TransactionOutput) []byte {
+	buffer := NewBuffer()
+	for _, output := range outputs {
+		buffer.PutVarBytes(output.ScriptPubkey)
+	}
+
+	return buffer.Bytes()
+}
+
+func (ts *TransactionSigner) computeHashPrevOuts(sighash SigHash) Hash {
+	if !sighash.Has(SigHashAnyoneCanPay) {
+		if p := ts.precomputed(); p != nil {
+			return p.HashPrevouts
+		}
+
+		return DHash256(serializePrevouts(ts.Transaction))
+	}
+
+	return HashZero
+}
+
+func (ts *TransactionSigner) computeHashSequence(sighash SigHash) Hash {
+	if !sighash.Has(SigHashAnyoneCanPay) &&
+		!sighash.HasBaseType(SigHashSingle) &&
+		!sighash.HasBaseType(SigHashNone) {
+		if p := ts.precomputed(); p != nil {
+			return p.HashSequence
+		}
+
+		return DHash256(serializeSequences(ts.Transaction))
+	}
+
+	return HashZero
+}
+
+func (ts *TransactionSigner) computeHashOutputs(sighash SigHash) Hash {
+	if !sighash.HasBaseType(SigHashSingle) && !sighash.HasBaseType(SigHashNone) {
+		if p := ts.precomputed(); p != nil {
+			return p.HashOutputs
+		}
+
+		return DHash256(serializeOutputs(ts.Transaction))
+	} else if sighash.HasBaseType(SigHashSingle) {
+		if ts.InputIndex < len(ts.Transaction.Outputs) {
+			return DHash256(ts.Transaction.Outputs[ts.InputIndex].Bytes())
+		}
+	}
+
+	return HashZero
+}
+
+// Serialization of:
+// 1. nVersion of the transaction (4-byte little endian)
+// 2. hashPrevouts (32-byte hash)
+// 3. hashSequence (32-byte hash)
+// 4. outpoint (32-byte hash + 4-byte little endian)
+// 5. scriptCode of the input (serialized as scripts inside CTxOuts)
+// 6. value of the output spent by this input (8-byte little endian)
+// 7. nSequence of the input (4-byte little endian)
+// 8. hashOutputs (32-byte hash)
+// 9. nLocktime of the transaction (4-byte little endian)
+// 10. sighash type of the signature (4-byte little endian)
+//
+// BCH and BSV use the same serialization for SIGHASH_FORKID signatures.
+func (ts *TransactionSigner) preimageWitnessV0(script *Script, sighash SigHash) (*SigHashPreimage, error) {
+	if ts.InputIndex >= len(ts.Transaction.Inputs) {
+		return nil, ErrTransactionSignerSigHashOne
+	}
+
+	input := ts.Transaction.Inputs[ts.InputIndex]
+
+	return &SigHashPreimage{
+		Algorithm:    SigHashAlgorithmWitnessV0,
+		Version:      ts.Transaction.Version,
+		HashPrevouts: ts.computeHashPrevOuts(sighash),
+		HashSequence: ts.computeHashSequence(sighash),
+		Outpoint:     input.PrevOutput.Bytes(),
+		ScriptCode:   script.Bytes(),
+		Value:        ts.InputValue,
+		Sequence:     input.Sequence,
+		HashOutputs:  ts.computeHashOutputs(sighash),
+		Locktime:     ts.Transaction.Locktime,
+		SigHash:      sighash,
+	}, nil
+}
+
+func (ts *TransactionSigner) signatureHashOriginal(script *Script, sighash SigHash) Hash {
+	preimage, err := ts.preimageOriginal(script, sighash)
+	if err != nil {
+		return HashOne
+	}
+
+	return DHash256(preimage.Bytes())
+}
+
+// preimageOriginal serializes a copy of the transaction with the script code
+// in place of the signed input's scriptSig, and the other inputs and outputs
+// blanked according to sighash, followed by the 4 byte sighash type.
+func (ts *TransactionSigner) preimageOriginal(script *Script, sighash SigHash) (*SigHashPreimage, error) {
+	if ts.InputIndex >= len(ts.Transaction.Inputs) {
+		return nil, ErrTransactionSignerSigHashOne
+	}
+
+	if sighash.HasBaseType(SigHashSingle) && ts.InputIndex >= len(ts.Transaction.Outputs) {
+		return nil, ErrTransactionSignerSigHashOne
+	}
+
+	script = script.WithoutSep()
+
+	var inputs []*bcore.TransactionInput
+
+	if sighash.Has(SigHashAnyoneCanPay) {
+		input := ts.Transaction.Inputs[ts.InputIndex]
+		inputs = []*bcore.TransactionInput{
+			&bcore.TransactionInput{
+				PrevOutput: input.PrevOutput,
+				ScriptSig:  script.Bytes(),
+				Sequence:   input.Sequence,
+			},
+		}
+
+	} else {
+		inputs = make([]*bcore.TransactionInput, len(ts.Transaction.Inputs))
+		for i, input := range ts.Transaction.Inputs {
+			scriptSig := []byte{}
+			if i == ts.InputIndex {
+				scriptSig = script.Bytes()
+			}
+
+			sequence := input.Sequence
+			if i != ts.InputIndex && (sighash.HasBaseType(SigHashSingle) ||
+				sighash.HasBaseType(SigHashNone)) {
+				sequence = 0
+			}
+
+			inputs[i] = &bcore.TransactionInput{
+				PrevOutput: input.PrevOutput.Clone(),
+				ScriptSig:  scriptSig,
+				Sequence:   sequence,
+			}
+		}
+	}
+
+	var outputs []*bcore.TransactionOutput
+
+	switch sighash & 0x1f {
+	case SigHashNone:
+	case SigHashSingle:
+		outputs = make([]*bcore.TransactionOutput, 0, len(ts.Transaction.Outputs))
+		for i := 0; i < ts.InputIndex+1; i++ {
+			output := ts.Transaction.Outputs[i]
+			if i == ts.InputIndex {
+				outputs = append(outputs, output.Clone())
+			} else {
+				outputs = append(outputs, bcore.NewDefaultTransactionOutput())
+			}
+		}
+	default:
+		outputs = make([]*bcore.TransactionOutput, len(ts.Transaction.Outputs))
+		for i, output := range ts.Transaction.Outputs {
+			outputs[i] = output.Clone()
+		}
+	}
+
+	tx := &bcore.Transaction{
+		Version:  ts.Transaction.Version,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		Locktime: ts.Transaction.Locktime,
+	}
+
+	input := ts.Transaction.Inputs[ts.InputIndex]
+
+	return &SigHashPreimage{
+		Algorithm:   SigHashAlgorithmLegacy,
+		Version:     tx.Version,
+		Outpoint:    input.PrevOutput.Bytes(),
+		ScriptCode:  script.Bytes(),
+		Sequence:    input.Sequence,
+		Locktime:    tx.Locktime,
+		SigHash:     sighash,
+		Transaction: tx.Bytes(),
+	}, nil
+}
+
+// preimageTaproot is 0x00 || SigMsg of BIP341, extended with the leaf hash
+// and OP_CODESEPARATOR position for tapscript.
+func (ts *TransactionSigner) preimageTaproot(sighash SigHash, version SignatureVersion, execdata *ScriptExecutionData) (*SigHashPreimage, error) {
+	tx := ts.Transaction
+
+	if len(ts.PrevOutputs) != len(tx.Inputs) || ts.InputIndex >= len(tx.Inputs) {
+		return nil, ErrTransactionSignerMissingPrevOutputs
+	}
+
+	if execdata == nil {
+		execdata = NewScriptExecutionData()
+	}
+
+	switch sighash {
+	case SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyoneCanPay, SigHashNone | SigHashAnyoneCanPay, SigHashSingle | SigHashAnyoneCanPay:
+	default:
+		return nil, ErrInterpreterSchnorrSigHashType
+	}
+
+	if sighash&3 == SigHashSingle && ts.InputIndex >= len(tx.Outputs) {
+		return nil, ErrInterpreterSchnorrSigHashType
+	}
+
+	input := tx.Inputs[ts.InputIndex]
+	prev := ts.PrevOutputs[ts.InputIndex]
+
+	p := &SigHashPreimage{
+		Algorithm:        SigHashAlgorithmTaproot,
+		Version:          tx.Version,
+		Locktime:         tx.Locktime,
+		SigHash:          sighash,
+		Outpoint:         input.PrevOutput.Bytes(),
+		ScriptCode:       prev.ScriptPubkey,
+		Value:            prev.Value,
+		Sequence:         input.Sequence,
+		InputIndex:       uint32(ts.InputIndex),
+		SignatureVersion: version,
+	}
+
+	if execdata.AnnexPresent {
+		p.AnnexHash = execdata.AnnexHash
+	}
+
+	precomputed := ts.precomputed()
+	if precomputed == nil || !precomputed.Taproot {
+		precomputed = &PrecomputedTransactionData{Transaction: tx, PrevOutputs: ts.PrevOutputs}
+		precomputed.computeTaproot()
+	}
+
+	if !p.anyoneCanPay() {
+		p.HashPrevouts = precomputed.TaprootHashPrevouts
+		p.HashAmounts = precomputed.TaprootHashAmounts
+		p.HashScriptPubkeys = precomputed.TaprootHashScriptPubkeys
+		p.HashSequence = precomputed.TaprootHashSequence
+	}
+
+	switch p.outputType() {
+	case SigHashAll:
+		p.HashOutputs = precomputed.TaprootHashOutputs
+	case SigHashSingle:
+		p.HashOutputs = sha256Hash(tx.Outputs[ts.InputIndex].Bytes())
+	}
+
+	if version == SignatureVersionTapscript {
+		if len(execdata.TapleafHash) != 32 {
+			return nil, ErrInterpreterSchnorrSig
+		}
+
+		p.TapleafHash = execdata.TapleafHash
+		p.CodeSeparatorPos = execdata.CodeSeparatorPos
+	}
+
+	return p, nil
+}
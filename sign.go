@@ -1 +1,234 @@
 package bscript
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/detailyang/go-bcore"
+	bcrypto "github.com/detailyang/go-bcrypto"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrSignerMissingKey           = errors.New("signer: missing private key")
+	ErrSignerMissingRedeemScript  = errors.New("signer: missing redeem script")
+	ErrSignerMissingWitnessScript = errors.New("signer: missing witness script")
+	ErrSignerUnsupportedScript    = errors.New("signer: unsupported script")
+	ErrSignerBadInputIndex        = errors.New("signer: bad input index")
+)
+
+// Signer produces the scriptSig and witness of inputs spending standard
+// scripts with the keys and scripts it holds. Signature hashes come from
+// TransactionSigner and every signed input is verified with VerifyScript
+// under Flag, so the signer cannot produce what the interpreter rejects.
+type Signer struct {
+	// Flag selects the signature hash algorithm as the interpreter does,
+	// ScriptEnableSigHashForkID signs with SigHashForkId.
+	Flag    Flag
+	SigHash SigHash
+
+	keys    map[string]*bcrypto.Key
+	pubkeys map[string][]byte
+	scripts map[string]*Script
+}
+
+func NewSigner(flag Flag, sighash SigHash) *Signer {
+	return &Signer{
+		Flag:    flag,
+		SigHash: sighash,
+		keys:    make(map[string]*bcrypto.Key),
+		pubkeys: make(map[string][]byte),
+		scripts: make(map[string]*Script),
+	}
+}
+
+// AddKey makes key sign for its public key, compressed or not as key is.
+func (s *Signer) AddKey(key *bcrypto.Key) error {
+	pubkey, err := key.GetPubkey()
+	if err != nil {
+		return err
+	}
+
+	s.keys[string(pubkey.Bytes())] = key
+	s.pubkeys[string(Hash160(pubkey.Bytes()))] = pubkey.Bytes()
+
+	return nil
+}
+
+// AddScript makes script, a P2SH redeem script or a P2WSH witness script,
+// known by its hashes.
+func (s *Signer) AddScript(script *Script) {
+	h := sha256.Sum256(script.Data)
+	s.scripts[string(Hash160(script.Data))] = script
+	s.scripts[string(h[:])] = script
+}
+
+// SignInput signs input index of tx, which spends prevOutput, and sets its
+// scriptSig. The witness is returned, nil for non witness spends.
+func (s *Signer) SignInput(tx *bcore.Transaction, index int, prevOutput *bcore.TransactionOutput) (*Script, ScriptWitness, error) {
+	if index < 0 || index >= len(tx.Inputs) {
+		return nil, nil, ErrSignerBadInputIndex
+	}
+
+	ts := NewTransactionSigner(tx, index, prevOutput.Value)
+	scriptPubkey := NewScriptFromBytes(prevOutput.ScriptPubkey)
+
+	typ, stack, err := s.signStep(ts, scriptPubkey, SignatureVersionBase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var redeem []byte
+	if typ == ScriptTypeScriptHash {
+		redeem = stack[0]
+		typ, stack, err = s.signStep(ts, NewScriptFromBytes(redeem), SignatureVersionBase)
+		if err != nil {
+			return nil, nil, err
+		}
+		if typ == ScriptTypeScriptHash {
+			return nil, nil, ErrSignerUnsupportedScript
+		}
+	}
+
+	var witness ScriptWitness
+	switch typ {
+	case ScriptTypeWitnessV0KeyHash:
+		scriptCode, _ := NewPayToPubkeyHashScript(stack[0])
+		if _, stack, err = s.signStep(ts, scriptCode, SignatureVersionWitnessV0); err != nil {
+			return nil, nil, err
+		}
+		witness, stack = NewScriptWitness(stack), nil
+
+	case ScriptTypeWitnessV0ScriptHash:
+		witnessScript := NewScriptFromBytes(stack[0])
+		subtyp, substack, err := s.signStep(ts, witnessScript, SignatureVersionWitnessV0)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch subtyp {
+		case ScriptTypeScriptHash, ScriptTypeWitnessV0ScriptHash, ScriptTypeWitnessV0KeyHash:
+			return nil, nil, ErrSignerUnsupportedScript
+		}
+		witness, stack = NewScriptWitness(append(substack, witnessScript.Bytes())), nil
+	}
+
+	if redeem != nil {
+		stack = append(stack, redeem)
+	}
+
+	// the input keeps its scriptSig unless the new one verifies
+	scriptSig := pushAll(stack)
+	original := tx.Inputs[index].ScriptSig
+	tx.Inputs[index].ScriptSig = scriptSig.Bytes()
+
+	err = VerifyScript(NewScriptFromBytes(scriptSig.Bytes()), NewScriptFromBytes(prevOutput.ScriptPubkey), witness, s.Flag, ts, SignatureVersionBase)
+	if err != nil {
+		tx.Inputs[index].ScriptSig = original
+		return nil, nil, err
+	}
+
+	return scriptSig, witness, nil
+}
+
+// signStep satisfies script as Core's SignStep does: the signatures and keys
+// of the key templates, or the redeem script, witness script or key hash to
+// continue with for the others.
+func (s *Signer) signStep(ts *TransactionSigner, script *Script, version SignatureVersion) (ScriptType, [][]byte, error) {
+	typ, solutions := script.Solve()
+
+	switch typ {
+	case ScriptTypePubkey:
+		sig, err := s.createSignature(ts, solutions[0], script, version, s.SigHash)
+		if err != nil {
+			return typ, nil, err
+		}
+		return typ, [][]byte{sig}, nil
+
+	case ScriptTypePubkeyHash:
+		pubkey, ok := s.pubkeys[string(solutions[0])]
+		if !ok {
+			return typ, nil, ErrSignerMissingKey
+		}
+		sig, err := s.createSignature(ts, pubkey, script, version, s.SigHash)
+		if err != nil {
+			return typ, nil, err
+		}
+		return typ, [][]byte{sig, pubkey}, nil
+
+	case ScriptTypeScriptHash:
+		redeem, ok := s.scripts[string(solutions[0])]
+		if !ok {
+			return typ, nil, ErrSignerMissingRedeemScript
+		}
+		return typ, [][]byte{redeem.Bytes()}, nil
+
+	case ScriptTypeMultisig:
+		m := int(solutions[0][0])
+		// the extra item CHECKMULTISIG pops
+		stack := [][]byte{{}}
+		for _, pubkey := range solutions[1 : len(solutions)-1] {
+			if len(stack) > m {
+				break
+			}
+			if sig, err := s.createSignature(ts, pubkey, script, version, s.SigHash); err == nil {
+				stack = append(stack, sig)
+			}
+		}
+		if len(stack) <= m {
+			return typ, nil, ErrSignerMissingKey
+		}
+		return typ, stack, nil
+
+	case ScriptTypeWitnessV0KeyHash:
+		return typ, [][]byte{solutions[0]}, nil
+
+	case ScriptTypeWitnessV0ScriptHash:
+		witnessScript, ok := s.scripts[string(solutions[0])]
+		if !ok {
+			return typ, nil, ErrSignerMissingWitnessScript
+		}
+		return typ, [][]byte{witnessScript.Bytes()}, nil
+	}
+
+	return typ, nil, ErrSignerUnsupportedScript
+}
+
+// createSignature signs the signature hash of scriptCode with the key of
+// pubkey, the hash type appended.
+func (s *Signer) createSignature(ts *TransactionSigner, pubkey []byte, scriptCode *Script, version SignatureVersion, sighash SigHash) ([]byte, error) {
+	key, ok := s.keys[string(pubkey)]
+	if !ok {
+		return nil, ErrSignerMissingKey
+	}
+
+	if s.Flag.Has(ScriptEnableSigHashForkID) {
+		sighash.Enable(SigHashForkId)
+	}
+
+	hash, err := ts.SignatureHash(scriptCode, sighash, s.Flag, version, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := key.Signature(hash.Bytes(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sig, byte(sighash)), nil
+}
+
+// pushAll pushes each item of stack with the smallest push, as Core's
+// PushAll does.
+func pushAll(stack [][]byte) *Script {
+	script := NewScript()
+	for _, item := range stack {
+		if len(item) == 1 && item[0] >= 1 && item[0] <= 16 {
+			script.PushInt64(int64(item[0]))
+		} else {
+			script.PushBytesWithOP(item)
+		}
+	}
+
+	return script
+}
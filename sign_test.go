@@ -0,0 +1,134 @@
+package bscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	bcrypto "github.com/detailyang/go-bcrypto"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func TestSignerSignInput(t *testing.T) {
+	key0 := bcrypto.NewKey(key0bytes[:], true)
+	key1 := bcrypto.NewKey(key1bytes[:], true)
+	key2 := bcrypto.NewKey(key2bytes[:], false)
+	pubkey0, _ := key0.GetPubkey()
+	pubkey1, _ := key1.GetPubkey()
+	pubkey2, _ := key2.GetPubkey()
+
+	multisig, _ := NewMultisigScript(2, [][]byte{pubkey0.Bytes(), pubkey1.Bytes(), pubkey2.Bytes()})
+	multisigHash := sha256.Sum256(multisig.Data)
+	p2wpkh, _ := NewPayToWitnessPubkeyHashScript(Hash160(pubkey0.Bytes()))
+
+	build := func(s *Script, err error) *Script {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	witnessFlag := ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyStrictEncoding | ScriptVerifyLowS |
+		ScriptVerifyNullDummy | ScriptVerifyNullFail | ScriptVerifyCleanStack | ScriptVerifyMinimalData
+	forkFlag := ScriptVerifyP2SH | ScriptVerifyStrictEncoding | ScriptEnableSigHashForkID | ScriptVerifyLowS
+
+	tests := []struct {
+		name         string
+		scriptPubkey *Script
+		flag         Flag
+		witness      bool
+	}{
+		{"p2pk", build(NewPayToPubkeyScript(pubkey2.Bytes())), witnessFlag, false},
+		{"p2pkh", build(NewPayToPubkeyHashScript(Hash160(pubkey0.Bytes()))), witnessFlag, false},
+		{"p2pkh uncompressed", build(NewPayToPubkeyHashScript(Hash160(pubkey2.Bytes()))), witnessFlag, false},
+		{"bare multisig", multisig, witnessFlag, false},
+		{"p2sh multisig", build(NewPayToScriptHashScript(Hash160(multisig.Data))), witnessFlag, false},
+		{"p2wpkh", p2wpkh, witnessFlag, true},
+		{"p2sh-p2wpkh", build(NewPayToScriptHashScript(Hash160(p2wpkh.Data))), witnessFlag, true},
+		{"p2wsh multisig", build(NewPayToWitnessScriptHashScript(multisigHash[:])), witnessFlag, true},
+		{"forkid p2pkh", build(NewPayToPubkeyHashScript(Hash160(pubkey0.Bytes()))), forkFlag, false},
+		{"forkid p2sh multisig", build(NewPayToScriptHashScript(Hash160(multisig.Data))), forkFlag, false},
+	}
+
+	for _, test := range tests {
+		signer := NewSigner(test.flag, SigHashAll)
+		for _, key := range []*bcrypto.Key{key0, key1, key2} {
+			if err := signer.AddKey(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		signer.AddScript(multisig)
+		signer.AddScript(p2wpkh)
+
+		creditTx := NewCreditingTransaction(test.scriptPubkey, 1000)
+		tx := NewSpendingTransaction(NewScript(), creditTx)
+
+		scriptSig, witness, err := signer.SignInput(tx, 0, creditTx.Outputs[0])
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if test.witness != (witness.Size() > 0) {
+			t.Errorf("%s: unexpected witness %x", test.name, witness)
+		}
+
+		// the signatures commit to the amount of witness and forkid spends
+		err = VerifyScript(NewScriptFromBytes(scriptSig.Bytes()), NewScriptFromBytes(test.scriptPubkey.Bytes()), witness, test.flag,
+			NewTransactionSigner(tx, 0, 1000), SignatureVersionBase)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestSignerSignInputErrors(t *testing.T) {
+	key0 := bcrypto.NewKey(key0bytes[:], true)
+	key1 := bcrypto.NewKey(key1bytes[:], true)
+	pubkey0, _ := key0.GetPubkey()
+	pubkey1, _ := key1.GetPubkey()
+
+	signer := NewSigner(ScriptVerifyP2SH|ScriptVerifyWitness, SigHashAll)
+	signer.AddKey(key0)
+
+	multisig, _ := NewMultisigScript(2, [][]byte{pubkey0.Bytes(), pubkey1.Bytes()})
+	p2sh, _ := NewPayToScriptHashScript(Hash160(multisig.Data))
+	p2wsh, _ := NewPayToWitnessScriptHashScript(make([]byte, 32))
+	p2pkh, _ := NewPayToPubkeyHashScript(Hash160(pubkey1.Bytes()))
+	nulldata, _ := NewNullDataScript([]byte("data"))
+
+	tests := []struct {
+		scriptPubkey *Script
+		expect       error
+	}{
+		{p2pkh, ErrSignerMissingKey},
+		{multisig, ErrSignerMissingKey},
+		{p2sh, ErrSignerMissingRedeemScript},
+		{p2wsh, ErrSignerMissingWitnessScript},
+		{nulldata, ErrSignerUnsupportedScript},
+	}
+
+	for i, test := range tests {
+		creditTx := NewCreditingTransaction(test.scriptPubkey, 1000)
+		tx := NewSpendingTransaction(NewScript(), creditTx)
+		if _, _, err := signer.SignInput(tx, 0, creditTx.Outputs[0]); err != test.expect {
+			t.Errorf("#%d: expect %v got %v", i, test.expect, err)
+		}
+	}
+
+	creditTx := NewCreditingTransaction(p2pkh, 1000)
+	if _, _, err := signer.SignInput(NewSpendingTransaction(NewScript(), creditTx), 1, creditTx.Outputs[0]); err != ErrSignerBadInputIndex {
+		t.Errorf("expect bad input index, got %v", err)
+	}
+
+	// a scriptSig which fails to verify leaves the input untouched
+	forkid := NewSigner(ScriptVerifyP2SH|ScriptVerifyStrictEncoding, SigHashAll|SigHashForkId)
+	forkid.AddKey(key1)
+	tx := NewSpendingTransaction(NewScript().PushOPCode(OP_1), creditTx)
+	if _, _, err := forkid.SignInput(tx, 0, creditTx.Outputs[0]); err != ErrInterpreterIllegalForkId {
+		t.Errorf("expect illegal forkid, got %v", err)
+	}
+	if !bytes.Equal(tx.Inputs[0].ScriptSig, []byte{byte(OP_1)}) {
+		t.Errorf("expect the scriptSig to be kept, got %x", tx.Inputs[0].ScriptSig)
+	}
+}
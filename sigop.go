@@ -0,0 +1,187 @@
+package bscript
+
+import (
+	"errors"
+
+	"github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrSigOpMissingPrevOutputs = errors.New("sigop: missing prev outputs")
+	ErrSigOpMissingWitnesses   = errors.New("sigop: missing witnesses")
+)
+
+// WitnessScaleFactor is the weight of a legacy sigop relative to a witness
+// one in the sigop cost.
+const WitnessScaleFactor = 4
+
+// SigOpCount counts the signature operations of s. CHECKMULTISIG counts as
+// LimitsBitcoin.MaxPubkeysPerMultisig unless accurate is set and it is
+// preceded by OP_1 to OP_16, in which case it counts as that many. The BCH
+// CHECKDATASIG opcodes count as one once enabled by flag. Counting stops at
+// the first bad instruction.
+func (s Script) SigOpCount(accurate bool, flag Flag) int {
+	s.Pos = 0
+
+	n := 0
+	last := OP_INVALIDOPCODE
+	for {
+		ins, err := s.Next()
+		if err != nil {
+			break
+		}
+
+		switch opcode := ins.OPCode; {
+		case opcode == OP_CHECKSIG, opcode == OP_CHECKSIGVERIFY:
+			n++
+		case opcode == OP_CHECKMULTISIG, opcode == OP_CHECKMULTISIGVERIFY:
+			if accurate && OP_1 <= last && last <= OP_16 {
+				n += int(last-OP_1) + 1
+			} else {
+				n += LimitsBitcoin.MaxPubkeysPerMultisig
+			}
+		case opcode.IsDataSigOp(flag):
+			n++
+		}
+
+		last = ins.OPCode
+	}
+
+	return n
+}
+
+// P2SHSigOpCount is the accurate sigop count of the redeem script scriptSig
+// pushes when s is a P2SH scriptPubkey, and the accurate count of s itself
+// otherwise.
+func (s Script) P2SHSigOpCount(scriptSig *Script, flag Flag) int {
+	if !s.IsPayToScriptHash() {
+		return s.SigOpCount(true, flag)
+	}
+
+	redeem, ok := lastPush(scriptSig)
+	if !ok {
+		return 0
+	}
+
+	return NewScriptFromBytes(redeem).SigOpCount(true, flag)
+}
+
+// WitnessSigOpCount counts the sigops of spending s, native or P2SH nested
+// witness program, with scriptSig and witness. P2WPKH counts as one and
+// P2WSH as the accurate count of its witness script, other versions as zero.
+func (s Script) WitnessSigOpCount(scriptSig *Script, witness ScriptWitness, flag Flag) int {
+	if !flag.Has(ScriptVerifyWitness) {
+		return 0
+	}
+
+	if version, program, ok := s.ParseWitnessProgram(); ok {
+		return witnessSigOpCount(version, program, witness, flag)
+	}
+
+	if s.IsPayToScriptHash() {
+		redeem, ok := lastPush(scriptSig)
+		if !ok {
+			return 0
+		}
+
+		if version, program, ok := NewScriptFromBytes(redeem).ParseWitnessProgram(); ok {
+			return witnessSigOpCount(version, program, witness, flag)
+		}
+	}
+
+	return 0
+}
+
+func witnessSigOpCount(version uint8, program []byte, witness ScriptWitness, flag Flag) int {
+	if version != 0 {
+		return 0
+	}
+
+	if len(program) == 20 {
+		return 1
+	}
+
+	if len(program) == 32 && witness.Size() > 0 {
+		return NewScriptFromBytes(witness[witness.Size()-1]).SigOpCount(true, flag)
+	}
+
+	return 0
+}
+
+// lastPush is the data of the last push of a push only script.
+func lastPush(s *Script) ([]byte, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	s = NewScriptFromBytes(s.Data)
+
+	var data []byte
+	for {
+		ins, err := s.Next()
+		if err == ErrScriptEOF {
+			break
+		}
+		if err != nil || ins.OPCode > OP_16 {
+			return nil, false
+		}
+
+		data = ins.Data
+	}
+
+	return data, data != nil
+}
+
+// TransactionSigOpCost is the sigop cost of tx as block and standardness
+// limits count it: legacy sigops of every scriptSig and scriptPubkey, plus
+// the P2SH redeem scripts with ScriptVerifyP2SH, both scaled by
+// WitnessScaleFactor, plus the witness sigops with ScriptVerifyWitness.
+// prevOutputs are the outputs spent by tx.Inputs, witnesses their witnesses
+// and may be nil for a transaction without any.
+func TransactionSigOpCost(tx *bcore.Transaction, prevOutputs []*bcore.TransactionOutput, witnesses []ScriptWitness, flag Flag) (int, error) {
+	n := 0
+	for _, input := range tx.Inputs {
+		n += NewScriptFromBytes(input.ScriptSig).SigOpCount(false, flag)
+	}
+	for _, output := range tx.Outputs {
+		n += NewScriptFromBytes(output.ScriptPubkey).SigOpCount(false, flag)
+	}
+	n *= WitnessScaleFactor
+
+	if isCoinbase(tx) {
+		return n, nil
+	}
+
+	if len(prevOutputs) != len(tx.Inputs) {
+		return 0, ErrSigOpMissingPrevOutputs
+	}
+
+	if witnesses != nil && len(witnesses) != len(tx.Inputs) {
+		return 0, ErrSigOpMissingWitnesses
+	}
+
+	for i, input := range tx.Inputs {
+		scriptSig := NewScriptFromBytes(input.ScriptSig)
+		scriptPubkey := NewScriptFromBytes(prevOutputs[i].ScriptPubkey)
+
+		if flag.Has(ScriptVerifyP2SH) && scriptPubkey.IsPayToScriptHash() {
+			n += scriptPubkey.P2SHSigOpCount(scriptSig, flag) * WitnessScaleFactor
+		}
+
+		var witness ScriptWitness
+		if witnesses != nil {
+			witness = witnesses[i]
+		}
+
+		n += scriptPubkey.WitnessSigOpCount(scriptSig, witness, flag)
+	}
+
+	return n, nil
+}
+
+func isCoinbase(tx *bcore.Transaction) bool {
+	return len(tx.Inputs) == 1 &&
+		tx.Inputs[0].PrevOutput.Hash.Equal(HashZero) &&
+		tx.Inputs[0].PrevOutput.Index == 0xffffffff
+}
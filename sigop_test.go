@@ -0,0 +1,131 @@
+package bscript
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func TestScriptSigOpCount(t *testing.T) {
+	tests := []struct {
+		code     string
+		flag     Flag
+		legacy   int
+		accurate int
+	}{
+		{"", 0, 0, 0},
+		{"OP_CHECKSIG OP_CHECKSIGVERIFY", 0, 2, 2},
+		{"OP_1 OP_PUSHBYTES_1 0x01 OP_2 OP_CHECKMULTISIG", 0, 20, 2},
+		{"OP_16 OP_CHECKMULTISIGVERIFY", 0, 20, 16},
+		{"OP_0 OP_CHECKMULTISIG", 0, 20, 20},
+		{"OP_CHECKDATASIG OP_CHECKDATASIGVERIFY", 0, 0, 0},
+		{"OP_CHECKDATASIG OP_CHECKDATASIGVERIFY", ScriptEnableCheckDataSig, 2, 2},
+	}
+
+	for _, test := range tests {
+		script, err := NewScriptFromString(test.code)
+		if err != nil {
+			t.Fatalf("%s: %v", test.code, err)
+		}
+
+		if n := script.SigOpCount(false, test.flag); n != test.legacy {
+			t.Errorf("%s: expect legacy %d got %d", test.code, test.legacy, n)
+		}
+		if n := script.SigOpCount(true, test.flag); n != test.accurate {
+			t.Errorf("%s: expect accurate %d got %d", test.code, test.accurate, n)
+		}
+	}
+
+	// a truncated push ends the count
+	script := NewScriptFromBytes([]byte{byte(OP_CHECKSIG), byte(OP_PUSHBYTES_2), 0x01})
+	if n := script.SigOpCount(false, 0); n != 1 {
+		t.Errorf("truncated: expect 1 got %d", n)
+	}
+}
+
+func TestTransactionSigOpCost(t *testing.T) {
+	pubkey := bytes.Repeat([]byte{0x02}, 33)
+	redeem := NewScript().PushOPCode(OP_2).PushBytesWithOP(pubkey).PushBytesWithOP(pubkey).PushBytesWithOP(pubkey).PushOPCode(OP_3).PushOPCode(OP_CHECKMULTISIG)
+	p2sh := NewScript().PushOPCode(OP_HASH160).PushBytesWithOP(make([]byte, 20)).PushOPCode(OP_EQUAL)
+	p2wpkh := NewScript().PushOPCode(OP_0).PushBytesWithOP(make([]byte, 20))
+	p2wsh := NewScript().PushOPCode(OP_0).PushBytesWithOP(make([]byte, 32))
+	nested := NewScript().PushOPCode(OP_0).PushBytesWithOP(make([]byte, 20))
+
+	if n := p2sh.P2SHSigOpCount(NewScript().PushOPCode(OP_0).PushBytesWithOP(redeem.Bytes()), 0); n != 3 {
+		t.Errorf("p2sh: expect 3 got %d", n)
+	}
+	if n := p2sh.P2SHSigOpCount(NewScript().PushOPCode(OP_NOP).PushBytesWithOP(redeem.Bytes()), 0); n != 0 {
+		t.Errorf("p2sh not push only: expect 0 got %d", n)
+	}
+
+	witness := NewScriptWitness([][]byte{{}, redeem.Bytes()})
+	if n := p2wsh.WitnessSigOpCount(NewScript(), witness, ScriptVerifyWitness); n != 3 {
+		t.Errorf("p2wsh: expect 3 got %d", n)
+	}
+	if n := p2wsh.WitnessSigOpCount(NewScript(), witness, 0); n != 0 {
+		t.Errorf("p2wsh without witness flag: expect 0 got %d", n)
+	}
+
+	prevOutputs := []*bcore.TransactionOutput{
+		{ScriptPubkey: NewScript().PushBytesWithOP(pubkey).PushOPCode(OP_CHECKSIG).Bytes()},
+		{ScriptPubkey: p2sh.Bytes()},
+		{ScriptPubkey: p2wpkh.Bytes()},
+		{ScriptPubkey: p2wsh.Bytes()},
+		{ScriptPubkey: p2sh.Bytes()},
+	}
+	scriptSigs := []*Script{
+		NewScript().PushBytesWithOP(make([]byte, 71)),
+		NewScript().PushOPCode(OP_0).PushBytesWithOP(redeem.Bytes()),
+		NewScript(),
+		NewScript(),
+		NewScript().PushBytesWithOP(nested.Bytes()),
+	}
+	witnesses := []ScriptWitness{nil, nil, NewScriptWitness([][]byte{{}, pubkey}), witness, NewScriptWitness([][]byte{{}, pubkey})}
+
+	tx := &bcore.Transaction{Version: 1}
+	for i, scriptSig := range scriptSigs {
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{
+			PrevOutput: bcore.NewOutPoint(HashOne, uint32(i)),
+			ScriptSig:  scriptSig.Bytes(),
+			Sequence:   bcore.TransactionFinalSequence,
+		})
+	}
+	tx.Outputs = []*bcore.TransactionOutput{
+		{ScriptPubkey: NewScript().PushOPCode(OP_DUP).PushOPCode(OP_HASH160).PushBytesWithOP(make([]byte, 20)).PushOPCode(OP_EQUALVERIFY).PushOPCode(OP_CHECKSIG).Bytes()},
+	}
+
+	tests := []struct {
+		name   string
+		flag   Flag
+		expect int
+	}{
+		// the output's CHECKSIG, the spent outputs are not part of tx
+		{"legacy", 0, 1 * WitnessScaleFactor},
+		// the multisig redeem script
+		{"p2sh", ScriptVerifyP2SH, (1 + 3) * WitnessScaleFactor},
+		// p2wpkh, p2wsh multisig and p2sh nested p2wpkh
+		{"witness", ScriptVerifyP2SH | ScriptVerifyWitness, (1+3)*WitnessScaleFactor + 1 + 3 + 1},
+	}
+
+	for _, test := range tests {
+		n, err := TransactionSigOpCost(tx, prevOutputs, witnesses, test.flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != test.expect {
+			t.Errorf("%s: expect %d got %d", test.name, test.expect, n)
+		}
+	}
+
+	if _, err := TransactionSigOpCost(tx, prevOutputs[:1], witnesses, 0); err != ErrSigOpMissingPrevOutputs {
+		t.Errorf("expect %v got %v", ErrSigOpMissingPrevOutputs, err)
+	}
+
+	// coinbase inputs spend nothing
+	creditTx := NewCreditingTransaction(NewScript().PushOPCode(OP_CHECKSIG), 0)
+	if n, err := TransactionSigOpCost(creditTx, nil, nil, ScriptVerifyP2SH|ScriptVerifyWitness); err != nil || n != WitnessScaleFactor {
+		t.Errorf("coinbase: expect %d got %d %v", WitnessScaleFactor, n, err)
+	}
+}
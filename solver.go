@@ -0,0 +1,211 @@
+package bscript
+
+import (
+	"bytes"
+)
+
+// ScriptType is the standard template of a scriptPubkey, as Bitcoin Core's
+// Solver classifies it.
+type ScriptType int
+
+const (
+	ScriptTypeNonStandard ScriptType = iota
+	ScriptTypePubkey
+	ScriptTypePubkeyHash
+	ScriptTypeScriptHash
+	ScriptTypeMultisig
+	ScriptTypeNullData
+	ScriptTypeWitnessV0ScriptHash
+	ScriptTypeWitnessV0KeyHash
+	ScriptTypeWitnessV1Taproot
+	ScriptTypeWitnessUnknown
+	ScriptTypeAnchor
+)
+
+func (t ScriptType) String() string {
+	switch t {
+	case ScriptTypePubkey:
+		return "pubkey"
+	case ScriptTypePubkeyHash:
+		return "pubkeyhash"
+	case ScriptTypeScriptHash:
+		return "scripthash"
+	case ScriptTypeMultisig:
+		return "multisig"
+	case ScriptTypeNullData:
+		return "nulldata"
+	case ScriptTypeWitnessV0ScriptHash:
+		return "witness_v0_scripthash"
+	case ScriptTypeWitnessV0KeyHash:
+		return "witness_v0_keyhash"
+	case ScriptTypeWitnessV1Taproot:
+		return "witness_v1_taproot"
+	case ScriptTypeWitnessUnknown:
+		return "witness_unknown"
+	case ScriptTypeAnchor:
+		return "anchor"
+	}
+
+	return "nonstandard"
+}
+
+// anchorProgram is the witness v1 program of pay to anchor outputs.
+var anchorProgram = []byte{0x4e, 0x73}
+
+// Classify is the template type of s.
+func (s Script) Classify() ScriptType {
+	t, _ := s.Solve()
+	return t
+}
+
+// Solve classifies s and extracts its solutions as Core's Solver does:
+//
+//	pubkey                 the public key
+//	pubkeyhash             the public key hash
+//	scripthash             the script hash
+//	multisig               m, the public keys and n, m and n as a single byte
+//	witness_v0_keyhash     the witness program
+//	witness_v0_scripthash  the witness program
+//	witness_v1_taproot     the witness program
+//	witness_unknown        the version as a single byte and the program
+//
+// Other types have no solutions.
+func (s Script) Solve() (ScriptType, [][]byte) {
+	if s.IsPayToScriptHash() {
+		return ScriptTypeScriptHash, [][]byte{s.Data[2:22]}
+	}
+
+	if version, program, ok := s.ParseWitnessProgram(); ok {
+		switch {
+		case version == 0 && len(program) == 20:
+			return ScriptTypeWitnessV0KeyHash, [][]byte{program}
+		case version == 0 && len(program) == 32:
+			return ScriptTypeWitnessV0ScriptHash, [][]byte{program}
+		case version == 1 && len(program) == 32:
+			return ScriptTypeWitnessV1Taproot, [][]byte{program}
+		case version == 1 && bytes.Equal(program, anchorProgram):
+			return ScriptTypeAnchor, nil
+		case version != 0:
+			return ScriptTypeWitnessUnknown, [][]byte{{version}, program}
+		}
+
+		return ScriptTypeNonStandard, nil
+	}
+
+	if len(s.Data) >= 1 && OPCode(s.Data[0]) == OP_RETURN && isPushOnly(s.Data[1:]) {
+		return ScriptTypeNullData, nil
+	}
+
+	if pubkey, ok := s.parsePayToPubkey(); ok {
+		return ScriptTypePubkey, [][]byte{pubkey}
+	}
+
+	if s.isPayToPubkeyHash() {
+		return ScriptTypePubkeyHash, [][]byte{s.Data[3:23]}
+	}
+
+	if m, pubkeys, ok := s.ParseMultisig(); ok {
+		solutions := [][]byte{{byte(m)}}
+		solutions = append(solutions, pubkeys...)
+		return ScriptTypeMultisig, append(solutions, []byte{byte(len(pubkeys))})
+	}
+
+	return ScriptTypeNonStandard, nil
+}
+
+// ParseMultisig extracts the required signature count and the public keys of
+// a bare "m <pubkey>... n CHECKMULTISIG" script, with m and n of OP_1 to
+// OP_16.
+func (s Script) ParseMultisig() (int, [][]byte, bool) {
+	if len(s.Data) < 1 || OPCode(s.Data[len(s.Data)-1]) != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+
+	s.Pos = 0
+
+	ins, err := s.Next()
+	if err != nil || !isSmallInteger(ins.OPCode) {
+		return 0, nil, false
+	}
+	m := int(ins.OPCode-OP_1) + 1
+
+	var pubkeys [][]byte
+	for {
+		ins, err = s.Next()
+		if err != nil {
+			return 0, nil, false
+		}
+		if !isValidPubkeySize(ins.Data) {
+			break
+		}
+
+		pubkeys = append(pubkeys, ins.Data)
+	}
+
+	if !isSmallInteger(ins.OPCode) {
+		return 0, nil, false
+	}
+
+	n := int(ins.OPCode-OP_1) + 1
+	if len(pubkeys) != n || n < m {
+		return 0, nil, false
+	}
+
+	return m, pubkeys, s.Pos+1 == len(s.Data)
+}
+
+func (s Script) parsePayToPubkey() ([]byte, bool) {
+	switch {
+	case len(s.Data) == 35 && s.Data[0] == 33 && OPCode(s.Data[34]) == OP_CHECKSIG:
+		return s.Data[1:34], isValidPubkeySize(s.Data[1:34])
+	case len(s.Data) == 67 && s.Data[0] == 65 && OPCode(s.Data[66]) == OP_CHECKSIG:
+		return s.Data[1:66], isValidPubkeySize(s.Data[1:66])
+	}
+
+	return nil, false
+}
+
+func (s Script) isPayToPubkeyHash() bool {
+	return len(s.Data) == 25 &&
+		s.Data[0] == byte(OP_DUP) &&
+		s.Data[1] == byte(OP_HASH160) &&
+		s.Data[2] == byte(OP_PUSHBYTES_20) &&
+		s.Data[23] == byte(OP_EQUALVERIFY) &&
+		s.Data[24] == byte(OP_CHECKSIG)
+}
+
+// isPushOnly is Core's IsPushOnly, which unlike Script.IsPushOnly fails on
+// a truncated push.
+func isPushOnly(data []byte) bool {
+	s := NewScriptFromBytes(data)
+	for {
+		ins, err := s.Next()
+		if err == ErrScriptEOF {
+			return true
+		}
+		if err != nil || ins.OPCode > OP_16 {
+			return false
+		}
+	}
+}
+
+func isSmallInteger(opcode OPCode) bool {
+	return OP_1 <= opcode && opcode <= OP_16
+}
+
+// isValidPubkeySize reports whether the prefix of pubkey matches its size,
+// as Core's CPubKey::ValidSize.
+func isValidPubkeySize(pubkey []byte) bool {
+	if len(pubkey) == 0 {
+		return false
+	}
+
+	switch pubkey[0] {
+	case 0x02, 0x03:
+		return len(pubkey) == 33
+	case 0x04, 0x06, 0x07:
+		return len(pubkey) == 65
+	}
+
+	return false
+}
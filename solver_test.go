@@ -0,0 +1,70 @@
+package bscript
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestScriptSolve(t *testing.T) {
+	pubkey := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	uncompressed := "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+	hash20 := "751e76e8199196d454941c45d1b3a323f1433bd6"
+	hash32 := "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"
+
+	tests := []struct {
+		script    string
+		expect    ScriptType
+		solutions []string
+	}{
+		{"21" + pubkey + "ac", ScriptTypePubkey, []string{pubkey}},
+		{"41" + uncompressed + "ac", ScriptTypePubkey, []string{uncompressed}},
+		{"76a914" + hash20 + "88ac", ScriptTypePubkeyHash, []string{hash20}},
+		{"a914" + hash20 + "87", ScriptTypeScriptHash, []string{hash20}},
+		{"0014" + hash20, ScriptTypeWitnessV0KeyHash, []string{hash20}},
+		{"0020" + hash32, ScriptTypeWitnessV0ScriptHash, []string{hash32}},
+		{"5120" + hash32, ScriptTypeWitnessV1Taproot, []string{hash32}},
+		{"51024e73", ScriptTypeAnchor, nil},
+		{"5214" + hash20, ScriptTypeWitnessUnknown, []string{"02", hash20}},
+		{"0010" + hash20[:32], ScriptTypeNonStandard, nil},
+		{"51" + "21" + pubkey + "41" + uncompressed + "52ae", ScriptTypeMultisig, []string{"01", pubkey, uncompressed, "02"}},
+		{"6a", ScriptTypeNullData, nil},
+		{"6a04deadbeef", ScriptTypeNullData, nil},
+		{"6a04dead", ScriptTypeNonStandard, nil},
+		{"6a76", ScriptTypeNonStandard, nil},
+		{"21" + "05" + pubkey[2:] + "ac", ScriptTypeNonStandard, nil},
+		{"52" + "21" + pubkey + "51ae", ScriptTypeNonStandard, nil},
+		{"51" + "21" + pubkey + "51ae75", ScriptTypeNonStandard, nil},
+		{"00" + "21" + pubkey + "51ae", ScriptTypeNonStandard, nil},
+		{"", ScriptTypeNonStandard, nil},
+	}
+
+	for i, test := range tests {
+		script, err := NewScriptFromHexString(test.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		typ, solutions := script.Solve()
+		if typ != test.expect {
+			t.Errorf("#%d: expect %s got %s", i, test.expect, typ)
+			continue
+		}
+
+		if len(solutions) != len(test.solutions) {
+			t.Errorf("#%d: expect %d solutions got %d", i, len(test.solutions), len(solutions))
+			continue
+		}
+
+		for j, solution := range solutions {
+			expect, _ := hex.DecodeString(test.solutions[j])
+			if !bytes.Equal(solution, expect) {
+				t.Errorf("#%d: expect solution %d %x got %x", i, j, expect, solution)
+			}
+		}
+
+		if script.Classify() != typ {
+			t.Errorf("#%d: expect Classify to agree with Solve", i)
+		}
+	}
+}
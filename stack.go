@@ -29,7 +29,7 @@ func (s *Stack) CloneFrom(ns *Stack) {
 }
 
 func (s *Stack) Reverse() {
-	for i, j := 0, len(s.data); i < j; i, j = i+1, j-1 {
+	for i, j := 0, len(s.data)-1; i < j; i, j = i+1, j-1 {
 		s.data[i], s.data[j] = s.data[j], s.data[i]
 	}
 }
@@ -64,91 +64,79 @@ func (s *Stack) Swap(i, j int) error {
 }
 
 func (s *Stack) Replace(n int, data StackElemnt) error {
-	depth := len(s.data)
-	if n > 0 {
-		if n >= depth {
-			return ErrStackNotEnough
-		}
-		s.data[n] = data
-	} else {
-		if -n >= depth {
-			return ErrStackNotEnough
-		}
-		s.data[n+depth] = data
+	i, err := s.position(n)
+	if err != nil {
+		return err
 	}
+	s.data[i] = data
 
 	return nil
 }
 
+// Erase removes the items from start up to, not including, end.
 func (s *Stack) Erase(start, end int) error {
-	for i := start; i < end; i++ {
-		if err := s.Remove(i); err != nil {
-			return err
-		}
+	i, err := s.position(start)
+	if err != nil {
+		return err
+	}
+
+	j := end
+	if j < 0 {
+		j += len(s.data)
 	}
+	if j < i || j > len(s.data) {
+		return ErrStackEraseInvalid
+	}
+
+	s.data = append(s.data[:i], s.data[j:]...)
 
 	return nil
 }
 
 func (s *Stack) Remove(n int) error {
-	depth := len(s.data)
-	if n > 0 {
-		if n >= depth {
-			return ErrStackNotEnough
-		}
-
-		s.data = append(s.data[:n], s.data[n+1:]...)
-	} else {
-		if -n >= depth {
-			return ErrStackNotEnough
-		}
-
-		s.data = append(s.data[:depth+n], s.data[depth+n+1:]...)
+	i, err := s.position(n)
+	if err != nil {
+		return err
 	}
 
+	s.data = append(s.data[:i], s.data[i+1:]...)
+
 	return nil
 }
 
 func (s *Stack) InsertBefore(n int, data StackElemnt) error {
-	depth := len(s.data)
-	if n > 0 {
-		if n >= depth {
-			return ErrStackNotEnough
-		}
-
-		behind := s.data[n:]
-		s.data = append(append([]StackElemnt{data}, s.data[:n]...), behind...)
-	} else {
-		if -n >= depth {
-			return ErrStackNotEnough
-		}
-
-		behind := s.data[depth+n:]
-		s.data = append(append([]StackElemnt{data}, s.data[:depth+n]...), behind...)
+	i, err := s.position(n)
+	if err != nil {
+		return err
 	}
 
+	s.data = append(s.data[:i], append([]StackElemnt{data}, s.data[i:]...)...)
+
 	return nil
 }
 
 func (s *Stack) InsertAfter(n int, data StackElemnt) error {
-	depth := len(s.data)
-	if n > 0 {
-		if n >= depth {
-			return ErrStackNotEnough
-		}
+	i, err := s.position(n)
+	if err != nil {
+		return err
+	}
 
-		behind := s.data[n:]
-		s.data = append(append(s.data[:n], data), behind...)
-	} else {
-		if -n >= depth {
-			return ErrStackNotEnough
-		}
+	s.data = append(s.data[:i+1], append([]StackElemnt{data}, s.data[i+1:]...)...)
 
-		behind := s.data[depth+n:]
-		s.data = append(append(s.data[:depth+n], data), behind...)
+	return nil
+}
+
+// position resolves n, counted from the bottom when positive and from the
+// top when negative, -1 being the top.
+func (s *Stack) position(n int) (int, error) {
+	if n < 0 {
+		n += len(s.data)
+	}
+	if n < 0 || n >= len(s.data) {
+		return 0, ErrStackNotEnough
 	}
 
-	return nil
+	return n, nil
 }
 
 func (s *Stack) Pop() (StackElemnt, error) {
@@ -7,8 +7,11 @@ import (
 
 type StackElemnt []byte
 
-func (v StackElemnt) Cat(n StackElemnt) {
-	v = append(v, n...)
+// Cat returns a new element holding v followed by n.
+func (v StackElemnt) Cat(n StackElemnt) StackElemnt {
+	rv := make(StackElemnt, 0, len(v)+len(n))
+	rv = append(rv, v...)
+	return append(rv, n...)
 }
 
 func (v StackElemnt) Invert() {
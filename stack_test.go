@@ -33,3 +33,53 @@ func TestStack(t *testing.T) {
 		t.Error("expected 1")
 	}
 }
+
+func TestStackPositions(t *testing.T) {
+	items := func(s *Stack) string {
+		var b []byte
+		s.Iter(func(e StackElemnt) { b = append(b, e...) })
+		return string(b)
+	}
+	newStack := func() *Stack {
+		s := NewStack()
+		for _, c := range "abcd" {
+			s.Push(StackElemnt{byte(c)})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		op     func(s *Stack) error
+		expect string
+	}{
+		{"swap bottom", func(s *Stack) error { return s.Swap(-4, -1) }, "dbca"},
+		{"swap top", func(s *Stack) error { return s.Swap(-2, -1) }, "abdc"},
+		{"replace bottom", func(s *Stack) error { return s.Replace(-4, StackElemnt("x")) }, "xbcd"},
+		{"remove bottom", func(s *Stack) error { return s.Remove(-4) }, "bcd"},
+		{"remove top", func(s *Stack) error { return s.Remove(-1) }, "abc"},
+		{"remove first", func(s *Stack) error { return s.Remove(0) }, "bcd"},
+		{"erase", func(s *Stack) error { return s.Erase(-4, -2) }, "cd"},
+		{"insert before bottom", func(s *Stack) error { return s.InsertBefore(-4, StackElemnt("x")) }, "xabcd"},
+		{"insert before top", func(s *Stack) error { return s.InsertBefore(-1, StackElemnt("x")) }, "abcxd"},
+		{"insert after top", func(s *Stack) error { return s.InsertAfter(-1, StackElemnt("x")) }, "abcdx"},
+		{"insert after bottom", func(s *Stack) error { return s.InsertAfter(0, StackElemnt("x")) }, "axbcd"},
+	}
+
+	for _, test := range tests {
+		s := newStack()
+		if err := test.op(s); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := items(s); got != test.expect {
+			t.Errorf("%s: expect %s got %s", test.name, test.expect, got)
+		}
+	}
+
+	for _, n := range []int{-5, 4} {
+		if err := newStack().Remove(n); err != ErrStackNotEnough {
+			t.Errorf("remove %d: expect not enough got %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package bscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	. "github.com/detailyang/go-bprimitives"
+)
+
+var (
+	ErrTaprootControlBlockSize = errors.New("taproot: bad control block size")
+)
+
+const (
+	TaprootLeafMask            = 0xfe
+	TaprootLeafTapscript       = 0xc0
+	TaprootAnnexTag            = 0x50
+	TaprootControlBaseSize     = 33
+	TaprootControlNodeSize     = 32
+	TaprootControlMaxNodeCount = 128
+	TaprootControlMaxSize      = TaprootControlBaseSize + TaprootControlNodeSize*TaprootControlMaxNodeCount
+
+	// ValidationWeightPerSigop is the budget consumed by every non-empty
+	// signature checked in tapscript, see BIP342.
+	ValidationWeightPerSigop = 50
+	ValidationWeightOffset   = 50
+)
+
+// ScriptExecutionData carries the per input state of taproot spends into the
+// interpreter and the checker.
+type ScriptExecutionData struct {
+	TapleafHash          []byte
+	CodeSeparatorPos     uint32
+	AnnexPresent         bool
+	AnnexHash            []byte
+	ValidationWeightLeft int64
+}
+
+func NewScriptExecutionData() *ScriptExecutionData {
+	return &ScriptExecutionData{
+		CodeSeparatorPos: 0xffffffff,
+	}
+}
+
+// TaprootControlBlock is the last witness element of a script path spend:
+// leaf version and output key parity, internal key and merkle path.
+type TaprootControlBlock struct {
+	LeafVersion byte
+	Parity      byte
+	InternalKey []byte
+	Path        [][]byte
+}
+
+func NewTaprootControlBlock(b []byte) (*TaprootControlBlock, error) {
+	if len(b) < TaprootControlBaseSize || len(b) > TaprootControlMaxSize ||
+		(len(b)-TaprootControlBaseSize)%TaprootControlNodeSize != 0 {
+		return nil, ErrTaprootControlBlockSize
+	}
+
+	cb := &TaprootControlBlock{
+		LeafVersion: b[0] & TaprootLeafMask,
+		Parity:      b[0] & 1,
+		InternalKey: b[1:TaprootControlBaseSize],
+	}
+
+	for i := TaprootControlBaseSize; i < len(b); i += TaprootControlNodeSize {
+		cb.Path = append(cb.Path, b[i:i+TaprootControlNodeSize])
+	}
+
+	return cb, nil
+}
+
+func (cb *TaprootControlBlock) Bytes() []byte {
+	rv := append([]byte{cb.LeafVersion | cb.Parity}, cb.InternalKey...)
+	for _, node := range cb.Path {
+		rv = append(rv, node...)
+	}
+
+	return rv
+}
+
+// MerkleRoot folds the path into the root committed by the output key,
+// starting from the hash of the executed leaf.
+func (cb *TaprootControlBlock) MerkleRoot(tapleafHash []byte) []byte {
+	k := tapleafHash
+	for _, node := range cb.Path {
+		var h [32]byte
+		if bytes.Compare(k, node) < 0 {
+			h = TaggedHash("TapBranch", k, node)
+		} else {
+			h = TaggedHash("TapBranch", node, k)
+		}
+		k = h[:]
+	}
+
+	return k
+}
+
+// VerifyCommitment checks that program is the internal key tweaked with the
+// merkle root reached from tapleafHash.
+func (cb *TaprootControlBlock) VerifyCommitment(program, tapleafHash []byte) bool {
+	q, parity, ok := tweakXOnlyPubkey(cb.InternalKey, cb.MerkleRoot(tapleafHash))
+	if !ok {
+		return false
+	}
+
+	return parity == cb.Parity && bytes.Equal(q, program)
+}
+
+func ComputeTapleafHash(leafVersion byte, script []byte) []byte {
+	h := TaggedHash("TapLeaf", []byte{leafVersion}, NewBuffer().PutVarBytes(script).Bytes())
+	return h[:]
+}
+
+func ComputeTapbranchHash(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+
+	h := TaggedHash("TapBranch", a, b)
+	return h[:]
+}
+
+// ComputeTaprootOutputKey tweaks an internal key with a merkle root, which
+// is empty for key path only outputs, returning the x-only output key and
+// its parity.
+func ComputeTaprootOutputKey(internal, merkleRoot []byte) ([]byte, byte, bool) {
+	return tweakXOnlyPubkey(internal, merkleRoot)
+}
+
+func computeAnnexHash(annex []byte) []byte {
+	h := sha256.Sum256(NewBuffer().PutVarBytes(annex).Bytes())
+	return h[:]
+}
+
+// IsOPSuccess reports the opcodes which make a tapscript unconditionally
+// valid, see BIP342.
+func IsOPSuccess(opcode OPCode) bool {
+	o := uint8(opcode)
+	return o == 80 || o == 98 || (o >= 126 && o <= 129) ||
+		(o >= 131 && o <= 134) || (o >= 137 && o <= 138) ||
+		(o >= 141 && o <= 142) || (o >= 149 && o <= 153) ||
+		(o >= 187 && o <= 254)
+}
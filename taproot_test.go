@@ -0,0 +1,203 @@
+package bscript
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// tweakSecret returns the secret key of ComputeTaprootOutputKey(P, merkleRoot).
+func tweakSecret(d *big.Int, merkleRoot []byte) *big.Int {
+	P := secp256k1Mul(secp256k1G, d)
+	if !P.hasEvenY() {
+		d = new(big.Int).Sub(secp256k1N, d)
+	}
+
+	th := TaggedHash("TapTweak", P.xBytes(), merkleRoot)
+	t := new(big.Int).SetBytes(th[:])
+
+	return t.Add(t, d).Mod(t, secp256k1N)
+}
+
+func TestComputeTaprootOutputKey(t *testing.T) {
+	tests := []struct {
+		internal string
+		script   string
+		expect   string
+	}{
+		{"d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d", "", "53a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343"},
+		{"187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27", "20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac", "147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3"},
+	}
+
+	for _, test := range tests {
+		internal, _ := hex.DecodeString(test.internal)
+
+		var root []byte
+		if len(test.script) > 0 {
+			script, _ := hex.DecodeString(test.script)
+			root = ComputeTapleafHash(TaprootLeafTapscript, script)
+		}
+
+		key, _, ok := ComputeTaprootOutputKey(internal, root)
+		if !ok {
+			t.Fatalf("%s: tweak failed", test.internal)
+		}
+
+		if hex.EncodeToString(key) != test.expect {
+			t.Errorf("%s: expect %s got %x", test.internal, test.expect, key)
+		}
+	}
+}
+
+func TestTaprootControlBlock(t *testing.T) {
+	for _, size := range []int{0, 32, 34, 66, TaprootControlMaxSize + 32} {
+		if _, err := NewTaprootControlBlock(make([]byte, size)); err == nil {
+			t.Errorf("%d: expect error", size)
+		}
+	}
+
+	b := make([]byte, TaprootControlBaseSize+TaprootControlNodeSize)
+	b[0] = TaprootLeafTapscript | 1
+	cb, err := NewTaprootControlBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cb.LeafVersion != TaprootLeafTapscript || cb.Parity != 1 || len(cb.Path) != 1 {
+		t.Errorf("bad control block %+v", cb)
+	}
+}
+
+func TestVerifyTaproot(t *testing.T) {
+	flag := ScriptVerifyP2SH | ScriptVerifyWitness | ScriptVerifyTaproot
+	internal := big.NewInt(0x1234)
+	internalKey := secp256k1Mul(secp256k1G, internal).xBytes()
+	leafKey := big.NewInt(0x5678)
+	leafPubkey := secp256k1Mul(secp256k1G, leafKey).xBytes()
+
+	checksig := NewScript().PushBytesWithOP(leafPubkey).PushOPCode(OP_CHECKSIG)
+	checksigadd := NewScript().
+		PushBytesWithOP(leafPubkey).PushOPCode(OP_CHECKSIG).
+		PushBytesWithOP(leafPubkey).PushOPCode(OP_CHECKSIGADD).
+		PushOPCode(OP_2).PushOPCode(OP_NUMEQUAL)
+	multisig := NewScript().PushOPCode(OP_1).PushBytesWithOP(leafPubkey).PushOPCode(OP_1).PushOPCode(OP_CHECKMULTISIG)
+	success := NewScript().PushOPCode(OP_RESERVED)
+	minimalif := NewScript().PushOPCode(OP_IF).PushOPCode(OP_1).PushOPCode(OP_ENDIF)
+
+	leaves := []*Script{checksig, checksigadd, multisig, success, minimalif}
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = ComputeTapleafHash(TaprootLeafTapscript, leaf.Bytes())
+	}
+
+	// a maximally unbalanced tree, leaf i pairs with the subtree of all
+	// leaves after it
+	n := len(leaves)
+	subtrees := make([][]byte, n)
+	subtrees[n-1] = hashes[n-1]
+	for i := n - 2; i >= 0; i-- {
+		subtrees[i] = ComputeTapbranchHash(hashes[i], subtrees[i+1])
+	}
+	root := subtrees[0]
+
+	paths := make([][][]byte, n)
+	for i := range leaves {
+		if i < n-1 {
+			paths[i] = append(paths[i], subtrees[i+1])
+		}
+		for j := i - 1; j >= 0; j-- {
+			paths[i] = append(paths[i], hashes[j])
+		}
+	}
+
+	for i := range leaves {
+		got := (&TaprootControlBlock{Path: paths[i]}).MerkleRoot(hashes[i])
+		if hex.EncodeToString(got) != hex.EncodeToString(root) {
+			t.Fatalf("leaf %d: bad merkle path", i)
+		}
+	}
+
+	outputKey, parity, ok := ComputeTaprootOutputKey(internalKey, root)
+	if !ok {
+		t.Fatal("tweak failed")
+	}
+
+	scriptPubkey := NewScript().PushOPCode(OP_1).PushBytesWithOP(outputKey)
+	creditTx := NewCreditingTransaction(scriptPubkey, 1000)
+	spendTx := NewSpendingTransaction(NewScript(), creditTx)
+	signer := NewTransactionSignerWithPrevOutputs(spendTx, 0, creditTx.Outputs)
+
+	control := func(i int) []byte {
+		cb := &TaprootControlBlock{
+			LeafVersion: TaprootLeafTapscript,
+			Parity:      parity,
+			InternalKey: internalKey,
+			Path:        paths[i],
+		}
+		return cb.Bytes()
+	}
+
+	leafSig := func(i int, sighash SigHash) []byte {
+		execdata := NewScriptExecutionData()
+		execdata.TapleafHash = hashes[i]
+		hash, err := signer.SignatureHash(nil, sighash, 0, SignatureVersionTapscript, execdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig := signSchnorrBIP340(leafKey, hash.Bytes())
+		if sighash != SigHashDefault {
+			sig = append(sig, byte(sighash))
+		}
+		return sig
+	}
+
+	keyHash, err := signer.SignatureHash(nil, SigHashDefault, 0, SignatureVersionTaproot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySig := signSchnorrBIP340(tweakSecret(internal, root), keyHash.Bytes())
+	badKeySig := append([]byte{}, keySig...)
+	badKeySig[0] ^= 1
+
+	sigAll := leafSig(1, SigHashAll)
+
+	tests := []struct {
+		name    string
+		witness [][]byte
+		expect  error
+	}{
+		{"key path", [][]byte{keySig}, nil},
+		{"key path with annex", [][]byte{keySig, {TaprootAnnexTag}}, ErrInterpreterSchnorrSig},
+		{"key path bad signature", [][]byte{badKeySig}, ErrInterpreterSchnorrSig},
+		{"key path bad size", [][]byte{keySig[:63]}, ErrInterpreterSchnorrSigSize},
+		{"key path zero hashtype", [][]byte{append(append([]byte{}, keySig...), 0)}, ErrInterpreterSchnorrSigHashType},
+		{"empty witness", [][]byte{}, ErrInterpreterWitnessProgramWitnessEmpty},
+		{"checksig", [][]byte{leafSig(0, SigHashDefault), checksig.Bytes(), control(0)}, nil},
+		{"checksig empty signature", [][]byte{{}, checksig.Bytes(), control(0)}, ErrInterpreterEvalFalse},
+		{"checksigadd", [][]byte{sigAll, sigAll, checksigadd.Bytes(), control(1)}, nil},
+		{"checksigadd one empty", [][]byte{sigAll, {}, checksigadd.Bytes(), control(1)}, ErrInterpreterEvalFalse},
+		{"checkmultisig", [][]byte{{}, {}, multisig.Bytes(), control(2)}, ErrInterpreterTapscriptCheckMultisig},
+		{"op success", [][]byte{success.Bytes(), control(3)}, nil},
+		{"minimalif", [][]byte{{2}, minimalif.Bytes(), control(4)}, ErrInterpreterTapscriptMinimalIf},
+		{"wrong control size", [][]byte{checksig.Bytes(), control(0)[:40]}, ErrInterpreterTaprootWrongControlSize},
+		{"wrong leaf", [][]byte{leafSig(0, SigHashDefault), checksig.Bytes(), control(1)}, ErrInterpreterWitnessProgramMismatch},
+	}
+
+	for _, test := range tests {
+		err := VerifyScript(NewScript(), NewScriptFromBytes(scriptPubkey.Bytes()), NewScriptWitness(test.witness), flag, signer, SignatureVersionBase)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+
+	// without the taproot flag witness v1 stays anyone can spend
+	if err := VerifyScript(NewScript(), NewScriptFromBytes(scriptPubkey.Bytes()), NewScriptWitness([][]byte{badKeySig}), ScriptVerifyP2SH|ScriptVerifyWitness, signer, SignatureVersionBase); err != nil {
+		t.Errorf("expect success without taproot flag got %v", err)
+	}
+
+	err = VerifyScript(NewScript(), NewScriptFromBytes(scriptPubkey.Bytes()), NewScriptWitness([][]byte{success.Bytes(), control(3)}), flag|ScriptVerifyDiscourageOPSuccess, signer, SignatureVersionBase)
+	if err != ErrInterpreterDiscourageOPSuccess {
+		t.Errorf("expect %v got %v", ErrInterpreterDiscourageOPSuccess, err)
+	}
+}
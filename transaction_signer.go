@@ -19,16 +19,19 @@ package bscript
 // If greater than or equal to 500 million, locktime is parsed using the Unix epoch time format (the number of seconds elapsed since 1970-01-01T00:00 UTC—currently over 1.395 billion). The transaction can be added to any block whose block time is greater than the locktime.
 
 import (
+	"crypto/sha256"
 	"errors"
+	"fmt"
 
 	"github.com/detailyang/go-bcore"
-	"github.com/detailyang/go-bcrypto"
-	. "github.com/detailyang/go-bprimitives"
 )
 
 type SigHash uint32
 
 const (
+	// SigHashDefault is only valid for taproot, it signs like SigHashAll
+	// and is encoded by omitting the hash type byte.
+	SigHashDefault SigHash = 0
 	// the default, signs all the inputs and outputs, protecting everything except the signature scripts against modification.
 	SigHashAll SigHash = 1
 	// signs all of the inputs but none of the outputs, allowing anyone to change where the satoshis are going unless other signatures using other signature hash flags protect the outputs
@@ -65,12 +68,48 @@ func (s SigHash) IsDefined() bool {
 	return base >= SigHashAll && base <= SigHashSingle
 }
 
+var sigHashNames = map[SigHash]string{
+	SigHashAll:                                          "ALL",
+	SigHashAll | SigHashAnyoneCanPay:                    "ALL|ANYONECANPAY",
+	SigHashNone:                                         "NONE",
+	SigHashNone | SigHashAnyoneCanPay:                   "NONE|ANYONECANPAY",
+	SigHashSingle:                                       "SINGLE",
+	SigHashSingle | SigHashAnyoneCanPay:                 "SINGLE|ANYONECANPAY",
+	SigHashAll | SigHashForkId:                          "ALL|FORKID",
+	SigHashAll | SigHashForkId | SigHashAnyoneCanPay:    "ALL|FORKID|ANYONECANPAY",
+	SigHashNone | SigHashForkId:                         "NONE|FORKID",
+	SigHashNone | SigHashForkId | SigHashAnyoneCanPay:   "NONE|FORKID|ANYONECANPAY",
+	SigHashSingle | SigHashForkId:                       "SINGLE|FORKID",
+	SigHashSingle | SigHashForkId | SigHashAnyoneCanPay: "SINGLE|FORKID|ANYONECANPAY",
+}
+
+// NewSigHashFromString parses the names used by decodescript, e.g. "ALL|FORKID".
+func NewSigHashFromString(s string) (SigHash, bool) {
+	for sighash, name := range sigHashNames {
+		if name == s {
+			return sighash, true
+		}
+	}
+
+	return 0, false
+}
+
+func (s SigHash) String() string {
+	if name, ok := sigHashNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%02x", uint32(s))
+}
+
 type SignatureVersion uint32
 
 const (
 	SignatureVersionBase SignatureVersion = 1 << iota
 	SignatureVersionWitnessV0
 	SignatureVersionForkId
+	SignatureVersionTaproot
+	SignatureVersionTapscript
 )
 
 const (
@@ -103,12 +142,19 @@ var (
 	ErrTransactionSignerSequenceNotArrived    = errors.New("transaction signer: tosequnce < sequence")
 	ErrTransactionSignerEmptySignature        = errors.New("transaction signer: zero signature")
 	ErrTransactionSignerVerifySignatureFailed = errors.New("transaction signer: verify signature failed")
+	ErrTransactionSignerMissingPrevOutputs    = errors.New("transaction signer: missing spent outputs")
 )
 
 type TransactionSigner struct {
 	Transaction *bcore.Transaction
 	InputIndex  int
 	InputValue  uint64
+	PrevOutputs []*bcore.TransactionOutput
+	// Precomputed, when built for Transaction, saves rehashing the whole
+	// transaction for every signature hash
+	Precomputed *PrecomputedTransactionData
+
+	hashedBytes uint64
 }
 
 func NewTransactionSigner(tx *bcore.Transaction, InputIndex int, InputValue uint64) *TransactionSigner {
@@ -119,6 +165,29 @@ func NewTransactionSigner(tx *bcore.Transaction, InputIndex int, InputValue uint
 	}
 }
 
+// NewTransactionSignerWithPrevOutputs takes the outputs spent by every input
+// of tx, in input order, which taproot signatures commit to.
+func NewTransactionSignerWithPrevOutputs(tx *bcore.Transaction, InputIndex int, prevOutputs []*bcore.TransactionOutput) *TransactionSigner {
+	ts := NewTransactionSigner(tx, InputIndex, 0)
+	ts.PrevOutputs = prevOutputs
+	if InputIndex < len(prevOutputs) {
+		ts.InputValue = prevOutputs[InputIndex].Value
+	}
+
+	return ts
+}
+
+// NewTransactionSignerWithPrecomputed is a signer for input InputIndex of
+// precomputed.Transaction, which shares the transaction hashes with the
+// signers of the other inputs.
+func NewTransactionSignerWithPrecomputed(precomputed *PrecomputedTransactionData, InputIndex int, InputValue uint64) *TransactionSigner {
+	ts := NewTransactionSigner(precomputed.Transaction, InputIndex, InputValue)
+	ts.PrevOutputs = precomputed.PrevOutputs
+	ts.Precomputed = precomputed
+
+	return ts
+}
+
 func (ts *TransactionSigner) CheckLockTime(locktime uint32) error {
 	// There are two kinds of nLockTime: lock-by-blockheight
 	// and lock-by-blocktime, distinguished by whether
@@ -139,7 +208,8 @@ func (ts *TransactionSigner) CheckLockTime(locktime uint32) error {
 		return ErrTransactionSignerLockTimeNotArrived
 	}
 
-	if bcore.TransactionFinalSequence != ts.Transaction.Inputs[ts.InputIndex].Sequence {
+	// a final sequence lets the transaction ignore its locktime
+	if bcore.TransactionFinalSequence == ts.Transaction.Inputs[ts.InputIndex].Sequence {
 		return ErrTransactionSignerLocktimeSequenceFinal
 	}
 
@@ -169,8 +239,8 @@ func (ts *TransactionSigner) CheckSequence(sequence uint32) error {
 	// We want to compare apples to apples, so fail the script
 	// unless the type of nSequenceMasked being tested is the same as
 	// the nSequenceMasked in the transaction.
-	if !((tsequence < TransactionSequenceLockTimeTypeFlag && locktimeMask < TransactionSequenceLockTimeTypeFlag) ||
-		(tsequence >= TransactionSequenceLockTimeTypeFlag && locktimeMask >= TransactionSequenceLockTimeTypeFlag)) {
+	if !((tsequence < TransactionSequenceLockTimeTypeFlag && sequence < TransactionSequenceLockTimeTypeFlag) ||
+		(tsequence >= TransactionSequenceLockTimeTypeFlag && sequence >= TransactionSequenceLockTimeTypeFlag)) {
 		return ErrTransactionSignerSequenceThresold
 	}
 
@@ -181,198 +251,65 @@ func (ts *TransactionSigner) CheckSequence(sequence uint32) error {
 	return nil
 }
 
-func (ts *TransactionSigner) computeHashPrevOuts(sighash SigHash) Hash {
-	if !sighash.Has(SigHashAnyoneCanPay) {
-		buffer := NewBuffer()
-		for _, input := range ts.Transaction.Inputs {
-			buffer.PutBytes(input.PrevOutput.Bytes())
-		}
-
-		return DHash256(buffer.Bytes())
+func (ts *TransactionSigner) CheckSignature(sig, pubkey []byte, script *Script, flag Flag, version SignatureVersion) error {
+	if len(sig) == 0 {
+		return ErrTransactionSignerEmptySignature
 	}
 
-	return HashZero
-}
-
-func (ts *TransactionSigner) computeHashSequence(sighash SigHash) Hash {
-	if sighash.Has(SigHashAll) && !sighash.Has(SigHashAnyoneCanPay) {
-		buffer := NewBuffer()
-		for _, input := range ts.Transaction.Inputs {
-			buffer.PutUint32(input.Sequence)
-		}
+	sighash := NewSigHash(uint32(sig[len(sig)-1]))
+	sig = sig[:len(sig)-1]
 
-		return DHash256(buffer.Bytes())
+	hash, err := ts.SignatureHash(script, sighash, flag, version, nil)
+	if err != nil {
+		return err
 	}
 
-	return HashZero
-}
-
-func (ts *TransactionSigner) computeHashOutputs(sighash SigHash) Hash {
-	if sighash&SigHashAll == SigHashAll {
-		buffer := NewBuffer()
-		for _, output := range ts.Transaction.Outputs {
-			buffer.PutBytes(output.Bytes())
-		}
-
-		return DHash256(buffer.Bytes())
-	} else if sighash&SigHashSingle == SigHashSingle {
-		if ts.InputIndex < len(ts.Transaction.Outputs) {
-			return DHash256(ts.Transaction.Outputs[ts.InputIndex].Bytes())
-		}
+	if !verifySignature(signatureSchemeOf(sig, flag), pubkey, hash.Bytes(), sig) {
+		return ErrTransactionSignerVerifySignatureFailed
 	}
 
-	return HashZero
-}
-
-// Double SHA256 of the serialization of:
-// 1. nVersion of the transaction (4-byte little endian)
-// 2. hashPrevouts (32-byte hash)
-// 3. hashSequence (32-byte hash)
-// 4. outpoint (32-byte hash + 4-byte little endian)
-// 5. scriptCode of the input (serialized as scripts inside CTxOuts)
-// 6. value of the output spent by this input (8-byte little endian)
-// 7. nSequence of the input (4-byte little endian)
-// 8. hashOutputs (32-byte hash)
-// 9. nLocktime of the transaction (4-byte little endian)
-// 10. sighash type of the signature (4-byte little endian)
-func (ts *TransactionSigner) signatureHashWitnessV0(script *Script, sighash SigHash) Hash {
-	hashPrevouts := ts.computeHashPrevOuts(sighash)
-	hashSequence := ts.computeHashSequence(sighash)
-	hashOutputs := ts.computeHashOutputs(sighash)
-
-	return DHash256(NewBuffer().PutUint32(ts.Transaction.Version).
-		PutHash(hashPrevouts).
-		PutHash(hashSequence).
-		PutBytes(ts.Transaction.Inputs[ts.InputIndex].PrevOutput.Bytes()).
-		PutVarBytes(script.Bytes()).
-		PutUint64(ts.InputValue).
-		PutUint32(ts.Transaction.Inputs[ts.InputIndex].Sequence).
-		PutHash(hashOutputs).
-		PutUint32(ts.Transaction.Locktime).
-		PutUint32(uint32(sighash)).Bytes())
+	return nil
 }
 
-func (ts *TransactionSigner) signatureHashForkId(script *Script, sighash SigHash) Hash {
-	if ts.InputIndex >= len(ts.Transaction.Inputs) {
-		return HashOne
-	}
-
-	if sighash&0x1f == SigHashSingle {
-		return HashOne
+// CheckDataSignature verifies sig over the SHA256 of message, independently
+// of the transaction, as OP_CHECKDATASIG does.
+func (ts *TransactionSigner) CheckDataSignature(sig, pubkey, message []byte, flag Flag) error {
+	if len(sig) == 0 {
+		return ErrTransactionSignerEmptySignature
 	}
 
-	return ts.signatureHashWitnessV0(script, sighash)
-}
+	hash := sha256.Sum256(message)
 
-func (ts *TransactionSigner) signatureHashOriginal(script *Script, sighash SigHash) Hash {
-	if ts.InputIndex >= len(ts.Transaction.Inputs) {
-		return HashOne
-	}
-
-	if sighash.HasBaseType(SigHashSingle) && ts.InputIndex >= len(ts.Transaction.Outputs) {
-		return HashOne
+	if !verifySignature(signatureSchemeOf(sig, flag), pubkey, hash[:], sig) {
+		return ErrTransactionSignerVerifySignatureFailed
 	}
 
-	script = script.WithoutSep()
-
-	var inputs []*bcore.TransactionInput
-
-	if sighash.Has(SigHashAnyoneCanPay) {
-		input := ts.Transaction.Inputs[ts.InputIndex]
-		inputs = []*bcore.TransactionInput{
-			&bcore.TransactionInput{
-				PrevOutput: input.PrevOutput,
-				ScriptSig:  script.Bytes(),
-				Sequence:   input.Sequence,
-			},
-		}
+	return nil
+}
 
-	} else {
-		inputs = make([]*bcore.TransactionInput, len(ts.Transaction.Inputs))
-		for i, input := range ts.Transaction.Inputs {
-			scriptSig := []byte{}
-			if i == ts.InputIndex {
-				scriptSig = script.Bytes()
-			}
-
-			sequence := input.Sequence
-			if i != ts.InputIndex && (sighash.HasBaseType(SigHashSingle) ||
-				sighash.HasBaseType(SigHashNone)) {
-				sequence = 0
-			}
-
-			inputs[i] = &bcore.TransactionInput{
-				PrevOutput: input.PrevOutput.Clone(),
-				ScriptSig:  scriptSig,
-				Sequence:   sequence,
-			}
-		}
-	}
+func (ts *TransactionSigner) CheckSchnorrSignature(sig, pubkey []byte, version SignatureVersion, execdata *ScriptExecutionData) error {
+	sighash := SigHashDefault
 
-	var outputs []*bcore.TransactionOutput
-
-	switch sighash & 0x1f {
-	case SigHashNone:
-	case SigHashSingle:
-		outputs = make([]*bcore.TransactionOutput, 0, len(ts.Transaction.Outputs))
-		for i := 0; i < ts.InputIndex+1; i++ {
-			output := ts.Transaction.Outputs[i]
-			if i == ts.InputIndex {
-				outputs = append(outputs, output.Clone())
-			} else {
-				outputs = append(outputs, bcore.NewDefaultTransactionOutput())
-			}
+	switch len(sig) {
+	case 64:
+	case 65:
+		sighash = SigHash(sig[64])
+		if sighash == SigHashDefault {
+			return ErrInterpreterSchnorrSigHashType
 		}
+		sig = sig[:64]
 	default:
-		outputs = make([]*bcore.TransactionOutput, len(ts.Transaction.Outputs))
-		for i, output := range ts.Transaction.Outputs {
-			outputs[i] = output.Clone()
-		}
+		return ErrInterpreterSchnorrSigSize
 	}
 
-	tx := &bcore.Transaction{
-		Version:  ts.Transaction.Version,
-		Inputs:   inputs,
-		Outputs:  outputs,
-		Locktime: ts.Transaction.Locktime,
+	hash, err := ts.SignatureHash(nil, sighash, 0, version, execdata)
+	if err != nil {
+		return err
 	}
 
-	return DHash256(append(tx.Bytes(), byte(sighash), byte(sighash>>8), byte(sighash>>16), byte(sighash>>24)))
-}
-
-func (ts *TransactionSigner) CheckSignature(sig, pubkey []byte, script *Script, flag Flag, version SignatureVersion) error {
-	if len(sig) == 0 {
-		return ErrTransactionSignerEmptySignature
-	}
-
-	sighash := NewSigHash(uint32(sig[len(sig)-1]))
-	sig = sig[:len(sig)-1]
-
-	var hash Hash
-
-	// switch version {
-	// case SignatureVersionBase:
-	// 	hash = ts.signatureHashOriginal(script, sighash)
-	// case SignatureVersionWitnessV0:
-	// 	hash = ts.signatureHashWitnessV0(script, sighash)
-	// case SignatureVersionForkId:
-	// 	hash = ts.signatureHashForkId(script, sighash)
-	// }
-	hash = ts.SiagntureHash(script, sighash, flag)
-
-	pk := bcrypto.NewPublicKey(pubkey)
-	ok := pk.Verify(hash.Bytes(), sig)
-	if !ok {
-		return ErrTransactionSignerVerifySignatureFailed
+	if !VerifySchnorrBIP340(pubkey, hash.Bytes(), sig) {
+		return ErrInterpreterSchnorrSig
 	}
 
 	return nil
 }
-
-func (ts *TransactionSigner) SiagntureHash(script *Script, sighash SigHash, flag Flag) Hash {
-	if sighash.Has(SigHashForkId) && flag.Has(ScriptEnableSigHashForkID) {
-		return ts.signatureHashForkId(script, sighash)
-	}
-
-	return ts.signatureHashOriginal(script, sighash)
-}
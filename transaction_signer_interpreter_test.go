@@ -1,6 +1,9 @@
 package bscript
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
 	"testing"
 
 	bcore "github.com/detailyang/go-bcore"
@@ -41,3 +44,112 @@ func TestVerifyScript(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestVerifyScriptSchnorr(t *testing.T) {
+	d := big.NewInt(0x1234)
+	P := secp256k1Mul(secp256k1G, d)
+	flag := ScriptVerifyStrictEncoding | ScriptVerifyNullFail | ScriptEnableSigHashForkID
+	sighash := SigHashAll | SigHashForkId
+
+	p2pk := NewScript().PushBytesWithOP(P.compressedBytes()).PushOPCode(OP_CHECKSIG)
+	p2xonly := NewScript().PushBytesWithOP(P.xBytes()).PushOPCode(OP_CHECKSIG)
+	multisig := NewScript().PushOPCode(OP_1).PushBytesWithOP(P.compressedBytes()).PushOPCode(OP_1).PushOPCode(OP_CHECKMULTISIG)
+
+	creditTx := NewCreditingTransaction(p2pk, 0)
+	spendTx := NewSpendingTransaction(NewScript(), creditTx)
+	signer := NewTransactionSigner(spendTx, 0, 0)
+
+	hash := func(script *Script) []byte {
+		return signer.SiagntureHash(script, sighash, flag).Bytes()
+	}
+
+	bchSig := append(signSchnorrBCH(d, hash(p2pk)), byte(sighash))
+	bip340Sig := append(signSchnorrBIP340(d, hash(p2xonly)), byte(sighash))
+	badSig := append([]byte{}, bchSig...)
+	badSig[0] ^= 1
+
+	tests := []struct {
+		name         string
+		scriptSig    *Script
+		scriptPubkey *Script
+		flag         Flag
+		expect       error
+	}{
+		{"bch", NewScript().PushBytesWithOP(bchSig), p2pk, flag | ScriptEnableSchnorr, nil},
+		{"bch without flag", NewScript().PushBytesWithOP(bchSig), p2pk, flag, ErrInterpreterBadSignatureDer},
+		{"bch bad signature", NewScript().PushBytesWithOP(badSig), p2pk, flag | ScriptEnableSchnorr, ErrInterpreterSignatureNullFail},
+		{"bch checkmultisig", NewScript().PushOPCode(OP_0).PushBytesWithOP(bchSig), multisig, flag | ScriptEnableSchnorr, ErrInterpreterSignatureBadLength},
+		{"bip340 without flag", NewScript().PushBytesWithOP(bip340Sig), p2xonly, flag, ErrInterpreterBadPubkey},
+		{"bip340 under bch", NewScript().PushBytesWithOP(bip340Sig), p2xonly, flag | ScriptEnableSchnorr, ErrInterpreterBadPubkey},
+	}
+
+	for _, test := range tests {
+		err := VerifyScript(
+			NewScriptFromBytes(test.scriptSig.Bytes()),
+			NewScriptFromBytes(test.scriptPubkey.Bytes()),
+			NewScriptWitness([][]byte{}),
+			test.flag,
+			signer,
+			SignatureVersionBase,
+		)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+func TestVerifyScriptCheckDataSig(t *testing.T) {
+	d := big.NewInt(0x1234)
+	pubkey := secp256k1Mul(secp256k1G, d).compressedBytes()
+	message := []byte("oracle price 42")
+	hash := sha256.Sum256(message)
+	flag := ScriptVerifyStrictEncoding | ScriptVerifyNullFail | ScriptEnableSchnorr | ScriptEnableCheckDataSig
+
+	sig := signSchnorrBCH(d, hash[:])
+	badSig := append([]byte{}, sig...)
+	badSig[0] ^= 1
+
+	checkdatasig, err := NewScriptFromString("OP_CHECKDATASIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(checkdatasig.Bytes(), []byte{0xba}) {
+		t.Fatalf("expect 0xba got %x", checkdatasig.Bytes())
+	}
+
+	p2ds := NewScript().PushBytesWithOP(message).PushBytesWithOP(pubkey).PushOPCode(OP_CHECKDATASIG)
+	p2dsv := NewScript().PushBytesWithOP(message).PushBytesWithOP(pubkey).PushOPCode(OP_CHECKDATASIGVERIFY).PushOPCode(OP_1)
+	signer := NewTransactionSigner(NewSpendingTransaction(NewScript(), NewCreditingTransaction(p2ds, 0)), 0, 0)
+
+	tests := []struct {
+		name         string
+		sig          []byte
+		scriptPubkey *Script
+		flag         Flag
+		expect       error
+	}{
+		{"checkdatasig", sig, p2ds, flag, nil},
+		{"checkdatasigverify", sig, p2dsv, flag, nil},
+		{"bad signature", badSig, p2ds, flag, ErrInterpreterSignatureNullFail},
+		{"bad signature without nullfail", badSig, p2ds, flag &^ ScriptVerifyNullFail, ErrInterpreterEvalFalse},
+		{"empty signature", []byte{}, p2ds, flag, ErrInterpreterEvalFalse},
+		{"empty signature verify", []byte{}, p2dsv, flag, ErrInterpreterCheckDataSigVerify},
+		{"with hash type", append(append([]byte{}, sig...), 0x41), p2ds, flag, ErrInterpreterBadSignatureDer},
+		{"without flag", sig, p2ds, flag &^ ScriptEnableCheckDataSig, ErrInterpreterBadOPCode},
+		{"verify without flag", sig, p2dsv, flag &^ ScriptEnableCheckDataSig, ErrInterpreterBadOPCode},
+	}
+
+	for _, test := range tests {
+		err := VerifyScript(
+			NewScript().PushBytesWithOP(test.sig),
+			NewScriptFromBytes(test.scriptPubkey.Bytes()),
+			NewScriptWitness([][]byte{}),
+			test.flag,
+			signer,
+			SignatureVersionBase,
+		)
+		if err != test.expect {
+			t.Errorf("%s: expect %v got %v", test.name, test.expect, err)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package bscript
 
 import (
+	"encoding/hex"
+	"fmt"
 	"testing"
 
 	bcore "github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
 )
 
 func TestTransactionSignerHash(t *testing.T) {
@@ -534,3 +537,207 @@ func TestTransactionSignerHash(t *testing.T) {
 		}
 	}
 }
+
+func TestTransactionSignerSignatureHash(t *testing.T) {
+	// native P2WPKH example of BIP143
+	txhex := "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+	tx, err := bcore.NewTransactionFromHexString(txhex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := NewScriptFromHexString("76a9141d0f172a0ecb48aee1be1f2687d2963ae33f71a188ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := NewTransactionSigner(tx, 1, 600000000)
+	hash, err := ts.SignatureHash(script, SigHashAll, 0, SignatureVersionWitnessV0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670"; hex.EncodeToString(hash.Bytes()) != expect {
+		t.Errorf("witness v0: expect %s got %x", expect, hash.Bytes())
+	}
+
+	// the legacy algorithm commits to something else entirely
+	legacy, err := ts.SignatureHash(script, SigHashAll, 0, SignatureVersionBase, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Equal(hash) {
+		t.Error("expect legacy and witness v0 hashes to differ")
+	}
+
+	// FORKID signatures take the BIP143 serialization whatever the version
+	forkid := SigHashAll | SigHashForkId
+	preimage, err := ts.SignaturePreimage(script, forkid, ScriptEnableSigHashForkID, SignatureVersionBase, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preimage) != 4+32+32+36+1+len(script.Bytes())+8+4+32+4+4 {
+		t.Errorf("forkid: unexpected preimage size %d", len(preimage))
+	}
+
+	preimage, err = ts.SignaturePreimage(script, forkid, ScriptEnableSigHashForkID|ScriptEnableReplayProtection, SignatureVersionBase, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(preimage[len(preimage)-4:]); got != "41addeff" {
+		t.Errorf("replay protection: expect sighash type ffdead41 got %s", got)
+	}
+
+	// SIGHASH_SINGLE without a matching output signs the constant one
+	ts = NewTransactionSigner(tx, 1, 0)
+	tx.Outputs = tx.Outputs[:1]
+	if _, err := ts.SignaturePreimage(script, SigHashSingle, 0, SignatureVersionBase, nil); err != ErrTransactionSignerSigHashOne {
+		t.Errorf("expect %v got %v", ErrTransactionSignerSigHashOne, err)
+	}
+	if hash, _ := ts.SignatureHash(script, SigHashSingle, 0, SignatureVersionBase, nil); !hash.Equal(HashOne) {
+		t.Errorf("expect one got %x", hash.Bytes())
+	}
+}
+
+func TestTransactionSignerSignaturePreimageFields(t *testing.T) {
+	txhex := "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+	tx, err := bcore.NewTransactionFromHexString(txhex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := NewScriptFromHexString("76a9141d0f172a0ecb48aee1be1f2687d2963ae33f71a188ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := NewTransactionSigner(tx, 1, 600000000)
+	fields, err := ts.SignaturePreimageFields(script, SigHashAll, 0, SignatureVersionWitnessV0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fields.Algorithm != SigHashAlgorithmWitnessV0 || fields.Value != 600000000 || fields.Sequence != 0xffffffff || fields.Locktime != 0x11 {
+		t.Errorf("unexpected fields\n%s", fields)
+	}
+
+	for _, test := range []struct {
+		name   string
+		got    Hash
+		expect string
+	}{
+		{"hashPrevouts", fields.HashPrevouts, "96b827c8483d4e9b96712b6713a7b68d6e8003a781feba36c31143470b4efd37"},
+		{"hashSequence", fields.HashSequence, "52b0a642eea2fb7ae638c36f6252b6750293dbe574a806984b8e4d8548339a3b"},
+		{"hashOutputs", fields.HashOutputs, "863ef3e1a92afbfdb97f31ad0fc7683ee943e9abcf2501590ff8f6551f47e5e5"},
+	} {
+		if got := hex.EncodeToString(test.got.Bytes()); got != test.expect {
+			t.Errorf("%s: expect %s got %s", test.name, test.expect, got)
+		}
+	}
+
+	// the breakdown serializes to the preimage which is hashed
+	for _, version := range []SignatureVersion{SignatureVersionBase, SignatureVersionWitnessV0} {
+		fields, err := ts.SignaturePreimageFields(script, SigHashAll, 0, version, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hash, _ := ts.SignatureHash(script, SigHashAll, 0, version, nil)
+		if !DHash256(fields.Bytes()).Equal(hash) {
+			t.Errorf("%s: preimage does not hash to the signature hash", fields.Algorithm)
+		}
+	}
+}
+
+// newConsolidationTransaction spends n outputs into one.
+func newConsolidationTransaction(n int) (*bcore.Transaction, []*bcore.TransactionOutput) {
+	tx := &bcore.Transaction{Version: 2}
+	prevOutputs := make([]*bcore.TransactionOutput, n)
+	for i := 0; i < n; i++ {
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{
+			PrevOutput: bcore.NewOutPoint(HashOne, uint32(i)),
+			Sequence:   bcore.TransactionFinalSequence,
+		})
+		prevOutputs[i] = &bcore.TransactionOutput{
+			Value:        uint64(1000 + i),
+			ScriptPubkey: NewScript().PushOPCode(OP_1).PushBytesWithOP(make([]byte, 32)).Bytes(),
+		}
+	}
+	tx.Outputs = []*bcore.TransactionOutput{{Value: 1000, ScriptPubkey: make([]byte, 22)}}
+
+	return tx, prevOutputs
+}
+
+func TestPrecomputedTransactionData(t *testing.T) {
+	tx, prevOutputs := newConsolidationTransaction(3)
+	tx.Outputs = append(tx.Outputs, &bcore.TransactionOutput{Value: 1, ScriptPubkey: []byte{byte(OP_RETURN)}})
+	precomputed := NewPrecomputedTransactionData(tx, prevOutputs)
+	script := NewScript().PushOPCode(OP_CHECKSIG)
+
+	for i := range tx.Inputs {
+		plain := NewTransactionSignerWithPrevOutputs(tx, i, prevOutputs)
+		shared := NewTransactionSignerWithPrecomputed(precomputed, i, prevOutputs[i].Value)
+
+		for _, sighash := range []SigHash{SigHashAll, SigHashNone, SigHashSingle, SigHashAll | SigHashAnyoneCanPay, SigHashSingle | SigHashAnyoneCanPay} {
+			for _, version := range []SignatureVersion{SignatureVersionBase, SignatureVersionWitnessV0, SignatureVersionTaproot} {
+				expect, expectErr := plain.SignatureHash(script, sighash, 0, version, nil)
+				got, err := shared.SignatureHash(script, sighash, 0, version, nil)
+				if err != expectErr || !got.Equal(expect) {
+					t.Errorf("input %d sighash %x version %d: expect %x %v got %x %v", i, sighash, version, expect.Bytes(), expectErr, got.Bytes(), err)
+				}
+			}
+		}
+	}
+
+	// a precomputation of another transaction is ignored
+	other, _ := newConsolidationTransaction(3)
+	other.Locktime = 1
+	ts := NewTransactionSignerWithPrevOutputs(other, 0, prevOutputs)
+	ts.Precomputed = precomputed
+	expect, _ := NewTransactionSignerWithPrevOutputs(other, 0, prevOutputs).SignatureHash(script, SigHashAll, 0, SignatureVersionWitnessV0, nil)
+	if got, _ := ts.SignatureHash(script, SigHashAll, 0, SignatureVersionWitnessV0, nil); !got.Equal(expect) {
+		t.Error("expect the precomputation of another transaction ignored")
+	}
+}
+
+func benchmarkSignatureHashAllInputs(b *testing.B, n int, version SignatureVersion, precompute bool) {
+	tx, prevOutputs := newConsolidationTransaction(n)
+	script := NewScript().PushOPCode(OP_CHECKSIG)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var precomputed *PrecomputedTransactionData
+		if precompute {
+			precomputed = NewPrecomputedTransactionData(tx, prevOutputs)
+		}
+
+		for j := range tx.Inputs {
+			ts := NewTransactionSignerWithPrevOutputs(tx, j, prevOutputs)
+			ts.Precomputed = precomputed
+			if _, err := ts.SignatureHash(script, SigHashAll, 0, version, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSignatureHashAllInputs(b *testing.B) {
+	versions := []struct {
+		name    string
+		version SignatureVersion
+	}{
+		{"bip143", SignatureVersionWitnessV0},
+		{"bip341", SignatureVersionTaproot},
+	}
+
+	for _, v := range versions {
+		for _, n := range []int{10, 100, 1000} {
+			for _, precompute := range []bool{false, true} {
+				name := fmt.Sprintf("%s/inputs=%d/precomputed=%v", v.name, n, precompute)
+				b.Run(name, func(b *testing.B) {
+					benchmarkSignatureHashAllInputs(b, n, v.version, precompute)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package bscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/detailyang/go-bcore"
+)
+
+var (
+	ErrTransactionVerifierMissingPrevOutputs = errors.New("transaction verifier: missing prev outputs")
+	ErrTransactionVerifierMissingWitnesses   = errors.New("transaction verifier: missing witnesses")
+	// ErrTransactionVerifierCanceled is the result of the inputs left
+	// unverified once another input failed with FailFast.
+	ErrTransactionVerifierCanceled = errors.New("transaction verifier: canceled")
+)
+
+// InputResult is the outcome of verifying input Index, Err is nil when it
+// verified.
+type InputResult struct {
+	Index int
+	Err   error
+}
+
+// TransactionVerifyError is the error of the first input, by index, which
+// failed to verify.
+type TransactionVerifyError struct {
+	InputIndex int
+	Err        error
+}
+
+func (e *TransactionVerifyError) Error() string {
+	return fmt.Sprintf("transaction verifier: input %d: %s", e.InputIndex, e.Err)
+}
+
+func (e *TransactionVerifyError) Unwrap() error {
+	return e.Err
+}
+
+// TransactionVerifier verifies every input of a transaction on a pool of
+// Workers goroutines, NumCPU when not positive. With FailFast the inputs not
+// yet started are skipped once one fails. With a Cache signatures are looked
+// up and, with StoreCache, stored as a CachingChecker does. Budget, when
+// set, bounds the evaluation of each input, and Limits are the consensus
+// limits it is evaluated under.
+type TransactionVerifier struct {
+	Workers    int
+	FailFast   bool
+	Cache      *SignatureCache
+	StoreCache bool
+	Budget     *ExecutionBudget
+	Limits     Limits
+}
+
+func NewTransactionVerifier() *TransactionVerifier {
+	return &TransactionVerifier{
+		FailFast: true,
+		Limits:   DefaultLimits(),
+	}
+}
+
+// VerifyTransaction verifies tx with the default TransactionVerifier.
+func VerifyTransaction(tx *bcore.Transaction, prevOutputs []*bcore.TransactionOutput, witnesses []ScriptWitness, flag Flag) ([]*InputResult, error) {
+	return NewTransactionVerifier().Verify(tx, prevOutputs, witnesses, flag)
+}
+
+// Verify verifies every input of tx against prevOutputs, the outputs they
+// spend, and witnesses, their witnesses which may be nil for a transaction
+// without any. It returns a result per input, and a *TransactionVerifyError
+// when any failed.
+func (v *TransactionVerifier) Verify(tx *bcore.Transaction, prevOutputs []*bcore.TransactionOutput, witnesses []ScriptWitness, flag Flag) ([]*InputResult, error) {
+	return v.VerifyContext(context.Background(), tx, prevOutputs, witnesses, flag)
+}
+
+// VerifyContext is Verify under ctx, once it is done the inputs being
+// verified fail with ctx.Err() and the others are canceled.
+func (v *TransactionVerifier) VerifyContext(ctx context.Context, tx *bcore.Transaction, prevOutputs []*bcore.TransactionOutput, witnesses []ScriptWitness, flag Flag) ([]*InputResult, error) {
+	if len(prevOutputs) != len(tx.Inputs) {
+		return nil, ErrTransactionVerifierMissingPrevOutputs
+	}
+
+	if witnesses != nil && len(witnesses) != len(tx.Inputs) {
+		return nil, ErrTransactionVerifierMissingWitnesses
+	}
+
+	precomputed := NewPrecomputedTransactionData(tx, prevOutputs)
+	results := make([]*InputResult, len(tx.Inputs))
+
+	workers := v.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(tx.Inputs) {
+		workers = len(tx.Inputs)
+	}
+
+	var failed int32
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				if (v.FailFast && atomic.LoadInt32(&failed) != 0) || ctx.Err() != nil {
+					results[i] = &InputResult{Index: i, Err: ErrTransactionVerifierCanceled}
+					continue
+				}
+
+				var witness ScriptWitness
+				if witnesses != nil {
+					witness = witnesses[i]
+				}
+
+				err := v.verifyInput(ctx, precomputed, i, witness, flag)
+				if err != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+
+				results[i] = &InputResult{Index: i, Err: err}
+			}
+		}()
+	}
+
+	for i := range tx.Inputs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+
+	for _, result := range results {
+		if result.Err != nil && result.Err != ErrTransactionVerifierCanceled {
+			return results, &TransactionVerifyError{InputIndex: result.Index, Err: result.Err}
+		}
+	}
+
+	return results, nil
+}
+
+func (v *TransactionVerifier) verifyInput(ctx context.Context, precomputed *PrecomputedTransactionData, i int, witness ScriptWitness, flag Flag) error {
+	prevOutput := precomputed.PrevOutputs[i]
+
+	var checker Checker = NewTransactionSignerWithPrecomputed(precomputed, i, prevOutput.Value)
+	if v.Cache != nil {
+		checker = NewCachingChecker(checker, v.Cache, v.StoreCache)
+	}
+
+	interpreter := NewInterpreter()
+	interpreter.SetContext(ctx, v.Budget)
+	interpreter.SetLimits(v.Limits)
+
+	return interpreter.Verify(
+		NewScriptFromBytes(precomputed.Transaction.Inputs[i].ScriptSig),
+		NewScriptFromBytes(prevOutput.ScriptPubkey),
+		witness,
+		flag,
+		checker,
+		SignatureVersionBase,
+	)
+}
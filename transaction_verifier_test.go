@@ -0,0 +1,91 @@
+package bscript
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	bcore "github.com/detailyang/go-bcore"
+	. "github.com/detailyang/go-bprimitives"
+)
+
+func TestVerifyTransaction(t *testing.T) {
+	d := big.NewInt(0x1234)
+	P := secp256k1Mul(secp256k1G, d)
+	flag := ScriptVerifyP2SH | ScriptVerifyStrictEncoding | ScriptEnableSchnorr
+	p2pk := NewScript().PushBytesWithOP(P.compressedBytes()).PushOPCode(OP_CHECKSIG)
+
+	n := 8
+	tx := &bcore.Transaction{Version: 1}
+	prevOutputs := make([]*bcore.TransactionOutput, n)
+	for i := 0; i < n; i++ {
+		tx.Inputs = append(tx.Inputs, &bcore.TransactionInput{
+			PrevOutput: bcore.NewOutPoint(HashOne, uint32(i)),
+			Sequence:   bcore.TransactionFinalSequence,
+		})
+		prevOutputs[i] = &bcore.TransactionOutput{Value: 1000, ScriptPubkey: p2pk.Bytes()}
+	}
+	tx.Outputs = []*bcore.TransactionOutput{{Value: 1000 * uint64(n)}}
+
+	for i := range tx.Inputs {
+		hash, err := NewTransactionSigner(tx, i, 1000).SignatureHash(p2pk, SigHashAll, flag, SignatureVersionBase, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := append(signSchnorrBCH(d, hash.Bytes()), byte(SigHashAll))
+		tx.Inputs[i].ScriptSig = NewScript().PushBytesWithOP(sig).Bytes()
+	}
+
+	results, err := VerifyTransaction(tx, prevOutputs, nil, flag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != n {
+		t.Fatalf("expect %d results got %d", n, len(results))
+	}
+	for i, result := range results {
+		if result.Index != i || result.Err != nil {
+			t.Errorf("input %d: unexpected result %+v", i, result)
+		}
+	}
+
+	// swapping two signatures fails both inputs
+	tx.Inputs[2].ScriptSig, tx.Inputs[5].ScriptSig = tx.Inputs[5].ScriptSig, tx.Inputs[2].ScriptSig
+
+	verifier := NewTransactionVerifier()
+	verifier.FailFast = false
+	results, err = verifier.Verify(tx, prevOutputs, nil, flag)
+	var verr *TransactionVerifyError
+	if !errors.As(err, &verr) || verr.InputIndex != 2 || verr.Err != ErrInterpreterEvalFalse {
+		t.Fatalf("expect input 2 to fail got %v", err)
+	}
+	for i, result := range results {
+		expect := error(nil)
+		if i == 2 || i == 5 {
+			expect = ErrInterpreterEvalFalse
+		}
+		if result.Err != expect {
+			t.Errorf("input %d: expect %v got %v", i, expect, result.Err)
+		}
+	}
+
+	// a single worker stops at the first failure
+	verifier = NewTransactionVerifier()
+	verifier.Workers = 1
+	results, err = verifier.Verify(tx, prevOutputs, nil, flag)
+	if !errors.As(err, &verr) || verr.InputIndex != 2 {
+		t.Fatalf("expect input 2 to fail got %v", err)
+	}
+	for _, result := range results[3:] {
+		if result.Err != ErrTransactionVerifierCanceled {
+			t.Errorf("input %d: expect %v got %v", result.Index, ErrTransactionVerifierCanceled, result.Err)
+		}
+	}
+
+	if _, err := VerifyTransaction(tx, prevOutputs[1:], nil, flag); err != ErrTransactionVerifierMissingPrevOutputs {
+		t.Errorf("expect %v got %v", ErrTransactionVerifierMissingPrevOutputs, err)
+	}
+	if _, err := VerifyTransaction(tx, prevOutputs, make([]ScriptWitness, 1), flag); err != ErrTransactionVerifierMissingWitnesses {
+		t.Errorf("expect %v got %v", ErrTransactionVerifierMissingWitnesses, err)
+	}
+}